@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/assets"
+	"github.com/chibiegg/isucon9-final/bench/internal/alert"
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
 	"github.com/chibiegg/isucon9-final/bench/internal/config"
 	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
 	"github.com/chibiegg/isucon9-final/bench/internal/logger"
+	"github.com/chibiegg/isucon9-final/bench/internal/traffic"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/chibiegg/isucon9-final/bench/mock"
 	"github.com/chibiegg/isucon9-final/bench/payment"
@@ -21,7 +25,16 @@ import (
 )
 
 var (
-	assetDir string
+	assetDir     string
+	recordPath   string
+	scenarioFile string
+
+	onlyScenarios string
+	skipScenarios string
+
+	evidencePath string
+
+	timetableDir string
 )
 
 type BenchResult struct {
@@ -30,30 +43,63 @@ type BenchResult struct {
 	Messages      []string `json:"messages"`
 	AvailableDays int      `json:"available_days"`
 	Language      string   `json:"language"`
+	// 負荷走行対象ごとのリクエストの統計
+	Targets []*isutrain.TargetStat `json:"targets"`
+}
+
+// loadTimetable は、--timetable-dir が指定されていれば時刻表を読み込みます
+func loadTimetable() error {
+	if timetableDir == "" {
+		return nil
+	}
+	return isutraindb.LoadTimetable(timetableDir)
 }
 
-// UniqueMsgs は重複除去したメッセージ配列を返します
-func uniqueMsgs(msgs []string) (uniqMsgs []string) {
-	dedup := map[string]struct{}{}
+// summarizeMsgs は重複除去したメッセージ配列を、発生件数を付加して返します
+func summarizeMsgs(msgs []string) (summarizedMsgs []string) {
+	var (
+		uniqMsgs = []string{}
+		counts   = map[string]int{}
+	)
 	for _, msg := range msgs {
-		if _, ok := dedup[msg]; ok {
-			continue
+		if _, ok := counts[msg]; !ok {
+			uniqMsgs = append(uniqMsgs, msg)
+		}
+		counts[msg]++
+	}
+
+	for _, msg := range uniqMsgs {
+		if counts[msg] > 1 {
+			msg = fmt.Sprintf("%s (%d件)", msg, counts[msg])
 		}
-		dedup[msg] = struct{}{}
-		uniqMsgs = append(uniqMsgs, msg)
+		summarizedMsgs = append(summarizedMsgs, msg)
 	}
 	return
 }
 
+// splitNames はカンマ区切りの名前を分割します
+func splitNames(s string) []string {
+	names := []string{}
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func dumpFailedResult(messages []string) {
 	lgr := zap.S()
 
+	recordHistory(false, 0, messages)
+
 	b, err := json.Marshal(&BenchResult{
 		Pass:          false,
 		Score:         0,
 		Messages:      messages,
 		AvailableDays: config.AvailableDays,
 		Language:      config.Language,
+		Targets:       isutrain.TargetStats(),
 	})
 	if err != nil {
 		lgr.Warnf("FAILEDな結果を書き出す際にエラーが発生. messagesが失われました: messages=%+v err=%+v", messages, err)
@@ -66,7 +112,7 @@ func dumpFailedResult(messages []string) {
 var run = cli.Command{
 	Name:  "run",
 	Usage: "ベンチマーク実行",
-	Flags: []cli.Flag{
+	Flags: append(append([]cli.Flag{
 		cli.BoolFlag{
 			Name:        "debug",
 			Destination: &config.Debug,
@@ -81,21 +127,71 @@ var run = cli.Command{
 		cli.StringFlag{
 			Name:        "target",
 			Value:       "http://localhost",
+			Usage:       "負荷走行対象のURL (カンマ区切りで複数指定すると、ユーザごとに振り分ける)",
 			Destination: &config.TargetBaseURL,
 			EnvVar:      "BENCH_TARGET_URL",
 		},
+		cli.StringFlag{
+			Name:        "admin-token",
+			Usage:       "webappの管理APIのトークン (ADMIN_TOKEN). 指定時のみ運行情報のシナリオを実行する",
+			Destination: &config.AdminToken,
+			EnvVar:      "BENCH_ADMIN_TOKEN",
+		},
 		cli.StringFlag{
 			Name:        "assetdir",
 			Value:       "assets/testdata",
 			Destination: &assetDir,
 			EnvVar:      "BENCH_ASSETDIR",
 		},
+		cli.StringFlag{
+			Name:        "record",
+			Usage:       "isutrainへのリクエストとレスポンスをJSONLで記録するファイル",
+			Destination: &recordPath,
+			EnvVar:      "BENCH_RECORD_PATH",
+		},
+		cli.StringFlag{
+			Name:        "scenario-file",
+			Usage:       "追加で実行するYAML定義のシナリオ",
+			Destination: &scenarioFile,
+			EnvVar:      "BENCH_SCENARIO_FILE",
+		},
+		cli.StringFlag{
+			Name:        "timetable-dir",
+			Usage:       "fixture_generator.pyが生成した列車・時刻表のSQLがあるディレクトリ (指定時のみ発着時刻を検証する)",
+			Destination: &timetableDir,
+			EnvVar:      "BENCH_TIMETABLE_DIR",
+		},
+		cli.StringFlag{
+			Name:        "evidence",
+			Usage:       "エラーの原因となったリクエストとレスポンスをJSONLで書き出すファイル",
+			Destination: &evidencePath,
+			EnvVar:      "BENCH_EVIDENCE_PATH",
+		},
+		cli.StringFlag{
+			Name:        "only",
+			Usage:       "実行するシナリオ名 (カンマ区切り). pretest, load, finalcheck の全てのフェーズに適用する. scenario.Pretest, scenario.FinalCheck の検証は常に実行する",
+			Destination: &onlyScenarios,
+			EnvVar:      "BENCH_ONLY_SCENARIOS",
+		},
+		cli.StringFlag{
+			Name:        "skip",
+			Usage:       "実行しないシナリオ名 (カンマ区切り). 全てのフェーズに適用する",
+			Destination: &skipScenarios,
+			EnvVar:      "BENCH_SKIP_SCENARIOS",
+		},
 		cli.StringFlag{
 			Name:        "webhookurl",
 			Destination: &config.SlackWebhookURL,
 			EnvVar:      "BENCH_SLACK_WEBHOOK_URL",
 		},
-	},
+		historyPathFlag,
+		cli.StringFlag{
+			Name:        "label",
+			Usage:       "ベンチマーク結果の記録に付けるラベル (ブランチ名など)",
+			Destination: &historyLabel,
+			EnvVar:      "BENCH_HISTORY_LABEL",
+		},
+	}, alert.Flags("BENCH")...), alert.BenchFlags("BENCH")...),
 	Action: func(cliCtx *cli.Context) error {
 		ctx := context.Background()
 
@@ -106,6 +202,56 @@ var run = cli.Command{
 		}
 
 		lgr.Info("===== Prepare benchmarker =====")
+		benchStartedAt = time.Now()
+
+		if err := alert.ValidateRules(); err != nil {
+			lgr.Warnf("通知ルールが不正です: %+v", err)
+			dumpFailedResult([]string{})
+			return cli.NewExitError(err, 1)
+		}
+
+		if recordPath != "" {
+			if err := traffic.Start(recordPath); err != nil {
+				lgr.Warnf("トラフィック記録ファイルを作成できませんでした: %+v", err)
+				dumpFailedResult([]string{})
+				return cli.NewExitError(err, 1)
+			}
+			defer traffic.Stop()
+		}
+
+		if evidencePath != "" {
+			defer func() {
+				if err := bencherror.WriteEvidences(evidencePath); err != nil {
+					lgr.Warnf("エビデンスを書き出せませんでした: %+v", err)
+				}
+			}()
+		}
+
+		if scenarioFile != "" {
+			if err := scenario.LoadYAMLFile(scenarioFile); err != nil {
+				lgr.Warnf("シナリオ定義を読み込めませんでした: %+v", err)
+				dumpFailedResult([]string{})
+				return cli.NewExitError(err, 1)
+			}
+		}
+
+		if err := loadTimetable(); err != nil {
+			lgr.Warnf("時刻表を読み込めませんでした: %+v", err)
+			dumpFailedResult([]string{})
+			return cli.NewExitError(err, 1)
+		}
+
+		// --only, --skip は全てのフェーズのシナリオに適用する
+		phaseScenarios := map[scenario.Phase][]scenario.Scenario{}
+		for _, phase := range []scenario.Phase{scenario.PhasePretest, scenario.PhaseLoad, scenario.PhaseFinalCheck} {
+			filtered, err := scenario.Filter(scenario.Scenarios(phase), splitNames(onlyScenarios), splitNames(skipScenarios))
+			if err != nil {
+				lgr.Warnf("シナリオの指定が不正です: %+v", err)
+				dumpFailedResult([]string{})
+				return cli.NewExitError(err, 1)
+			}
+			phaseScenarios[phase] = filtered
+		}
 
 		assets, err := assets.Load(assetDir)
 		if err != nil {
@@ -140,11 +286,12 @@ var run = cli.Command{
 			httpmock.Activate()
 			defer httpmock.DeactivateAndReset()
 
-			_, err = mock.Register()
+			m, err := mock.Register()
 			if err != nil {
 				dumpFailedResult([]string{err.Error()})
 				return cli.NewExitError(err, 1)
 			}
+			m.AdminToken = config.AdminToken
 			initClient.ReplaceMockTransport()
 			testClient.ReplaceMockTransport()
 		}
@@ -167,8 +314,13 @@ var run = cli.Command{
 		// pretest (まず、正しく動作できているかチェック. エラーが見つかったら、採点しようがないのでFAILにする)
 		lgr.Info("===== Pretest webapp =====")
 		scenario.Pretest(ctx, testClient, paymentClient, assets)
+		// 組み込みのpretestシナリオは無く、 --scenario-file で phase: pretest と定義したシナリオを実行する
+		scenario.Run(ctx, phaseScenarios[scenario.PhasePretest])
 		if bencherror.PreTestErrs.IsError() {
 			lgr.Warnf("webappへの pretest でエラーが発生: %+v", bencherror.PreTestErrs.InternalMsgs)
+			if err := alert.NotifyPretestFailed(bencherror.PreTestErrs.Msgs); err != nil {
+				lgr.Warnf("pretestの失格を通知できませんでした: %+v", err)
+			}
 			dumpFailedResult(bencherror.PreTestErrs.Msgs)
 			return nil
 		}
@@ -181,18 +333,20 @@ var run = cli.Command{
 		bgCtx, bgCancel := context.WithCancel(ctx)
 		bgtester, err := newBgTester()
 		if err != nil {
-			dumpFailedResult(uniqueMsgs(bencherror.BenchmarkErrs.Msgs))
+			// contextを作った直後に返るので、cancelしないとcontextがリークする (go vet lostcancel)
+			bgCancel()
+			dumpFailedResult(summarizeMsgs(bencherror.BenchmarkErrs.Msgs))
 			return nil
 		}
 		go bgtester.run(bgCtx)
 
-		benchmarker := newBenchmarker()
+		benchmarker := newBenchmarker(phaseScenarios[scenario.PhaseLoad])
 		if err := benchmarker.run(benchCtx); err != nil {
 			lgr.Warnf("ベンチマークにてエラーが発生しました: %+v", err)
 		}
 		bgCancel()
 		if bencherror.BenchmarkErrs.IsFailure() {
-			dumpFailedResult(uniqueMsgs(bencherror.BenchmarkErrs.Msgs))
+			dumpFailedResult(summarizeMsgs(bencherror.BenchmarkErrs.Msgs))
 			return nil
 		}
 
@@ -200,9 +354,15 @@ var run = cli.Command{
 		// NOTE: bulkリクエストの遅延処理考慮で、５秒待つ
 		time.Sleep(5 * time.Second)
 		scenario.FinalCheck(ctx, testClient, paymentClient)
+		scenario.Run(ctx, phaseScenarios[scenario.PhaseFinalCheck])
+		if bencherror.FinalCheckErrs.Counters().Critical > 0 {
+			if err := alert.NotifyFinalCheckCritical(bencherror.FinalCheckErrs.Msgs); err != nil {
+				lgr.Warnf("finalcheckのクリティカルエラーを通知できませんでした: %+v", err)
+			}
+		}
 		if bencherror.FinalCheckErrs.IsFailure() {
 			lgr.Warnf("webappへのfinalcheckで失格判定: %+v", bencherror.FinalCheckErrs.InternalMsgs)
-			msgs := append(uniqueMsgs(bencherror.BenchmarkErrs.Msgs), bencherror.FinalCheckErrs.Msgs...)
+			msgs := append(summarizeMsgs(bencherror.BenchmarkErrs.Msgs), bencherror.FinalCheckErrs.Msgs...)
 			dumpFailedResult(msgs)
 			return nil
 		}
@@ -230,13 +390,39 @@ var run = cli.Command{
 		lgr.Infof("Final score (with penalty): %d", score)
 		scoreMsgs = append(scoreMsgs, fmt.Sprintf("ペナルティ: %d", bencherror.BenchmarkErrs.Penalty()))
 
+		counters := bencherror.BenchmarkErrs.Counters()
+		scoreMsgs = append(scoreMsgs, fmt.Sprintf("エラー件数: アプリケーション %d, タイムアウト %d, 一時的なエラー %d",
+			counters.Application, counters.Timeout, counters.Temporary))
+
+		// 複数の負荷走行対象がある場合、対象ごとの統計を表示する
+		if targetStats := isutrain.TargetStats(); len(targetStats) > 1 {
+			for _, stat := range targetStats {
+				lgr.Infow("負荷走行対象の統計",
+					"url", stat.URL,
+					"clients", stat.Clients,
+					"requests", stat.Requests,
+					"failures", stat.Failures,
+					"avg_latency_ms", stat.AvgLatencyMillis,
+				)
+				scoreMsgs = append(scoreMsgs, fmt.Sprintf("%s: リクエスト数 %d, 失敗 %d, 平均レスポンスタイム %dms",
+					stat.URL, stat.Requests, stat.Failures, stat.AvgLatencyMillis))
+			}
+		}
+
+		messages := append(summarizeMsgs(bencherror.BenchmarkErrs.Msgs), scoreMsgs...)
+		recordHistory(true, score, messages)
+		if err := alert.NotifyScore(score, messages); err != nil {
+			lgr.Warnf("スコアを通知できませんでした: %+v", err)
+		}
+
 		// 最終結果をstdoutへ書き出す
 		resultBytes, err := json.Marshal(&BenchResult{
 			Pass:          true,
 			Score:         score,
-			Messages:      append(uniqueMsgs(bencherror.BenchmarkErrs.Msgs), scoreMsgs...),
+			Messages:      messages,
 			AvailableDays: config.AvailableDays,
 			Language:      config.Language,
+			Targets:       isutrain.TargetStats(),
 		})
 		if err != nil {
 			lgr.Warn("ベンチマーク結果のMarshalに失敗しました: %+v", err)
@@ -18,54 +18,27 @@ var (
 
 type benchmarker struct {
 	sem *semaphore.Weighted
+
+	// ベンチ負荷の１単位で実行するシナリオ
+	scenarios []scenario.Scenario
 }
 
-func newBenchmarker() *benchmarker {
+func newBenchmarker(scenarios []scenario.Scenario) *benchmarker {
 	lgr := zap.S()
 
 	weight := int64(config.ReservationEndDate.Month())
 	lgr.Infof("負荷レベル Lv:%d", weight)
-	return &benchmarker{sem: semaphore.NewWeighted(weight)}
+	return &benchmarker{
+		sem:       semaphore.NewWeighted(weight),
+		scenarios: scenarios,
+	}
 }
 
 // ベンチ負荷の１単位. これの回転数を上げていく
 func (b *benchmarker) load(ctx context.Context) error {
 	defer b.sem.Release(1)
 
-	month := int(config.ReservationEndDate.Month())
-
-	scenario.NormalScenario(ctx)
-
-	scenario.NormalCancelScenario(ctx)
-
-	scenario.AttackReserveForOtherReservation(ctx)
-
-	scenario.AttackReserveRaceCondition(ctx)
-
-	scenario.AbnormalReserveWrongSection(ctx)
-
-	scenario.AbnormalReserveWrongSeat(ctx)
-
-	if month > 3 {
-		scenario.NormalManyAmbigiousSearchScenario(ctx, month*3)
-	}
-
-	if month > 3 {
-		scenario.NormalManyCancelScenario(ctx, month*3)
-	}
-
-	scenario.NormalVagueSearchScenario(ctx)
-
-	if config.IsGoldenweekStarted() {
-		scenario.SeasonGoldenWeekScenario(ctx, config.GoldenWeekStartDate, 5)
-	}
-	if config.IsGoldenweekEnded() {
-		scenario.SeasonGoldenWeekScenario(ctx, config.GoldenWeekEndDate, 5)
-	}
-
-	if config.IsOlympic() {
-		scenario.SeasonOlympicScenario(ctx, 5)
-	}
+	scenario.Run(ctx, b.scenarios)
 
 	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
@@ -11,31 +12,11 @@ import (
 	"go.uber.org/zap"
 )
 
-/**
-mysql> SELECT COUNT(*) FROM seat_master WHERE train_class="遅いやつ" AND seat_class="reserved" AND is_smoking_seat=0;
-+----------+
-| COUNT(*) |
-+----------+
-|       65 |
-+----------+
-1 row in set (0.01 sec)
-
-mysql> SELECT COUNT(*) FROM seat_master WHERE train_class="遅いやつ" AND seat_class="reserved" AND is_smoking_seat=1;
-+----------+
-| COUNT(*) |
-+----------+
-|        0 |
-+----------+
-1 row in set (0.01 sec)
-
-mysql>
-*/
-
 // BgChecker は、バックグラウンドでSeatAvailabilityの整合性チェックを行います
+// 期待する空席情報は、予約キャッシュと座席マスタから算出します
 type BgTester struct {
 	client *isutrain.Client
 
-	remainSeats                      int
 	reserveDate                      time.Time
 	reserveTrainClass                string
 	reserveTrainName                 string
@@ -67,7 +48,6 @@ func newBgTester() (*BgTester, error) {
 
 	return &BgTester{
 		client:            client,
-		remainSeats:       65,
 		reserveDate:       time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC),
 		reserveTrainClass: "遅いやつ",
 		reserveTrainName:  "163",
@@ -78,7 +58,8 @@ func newBgTester() (*BgTester, error) {
 	}, nil
 }
 
-func (t *BgTester) reserve(ctx context.Context) error {
+// reserve は、大人1人と子供(最大1人)で、空いている座席を予約します
+func (t *BgTester) reserve(ctx context.Context, remainSeats int) error {
 	lgr := zap.S()
 
 	searchTrainSeatsResp, err := t.client.SearchTrainSeats(ctx, t.reserveDate, t.reserveTrainClass, t.reserveTrainName,
@@ -87,11 +68,15 @@ func (t *BgTester) reserve(ctx context.Context) error {
 		return err
 	}
 
-	availSeats := scenario.FilterTrainSeats(searchTrainSeatsResp, 2)
+	child := 1
+	if remainSeats < 2 {
+		child = 0
+	}
+	availSeats := scenario.FilterTrainSeats(searchTrainSeatsResp, 1+child)
 
 	_, err = t.client.Reserve(ctx, t.reserveTrainClass, t.reserveTrainName,
 		t.reserveSeatClass, availSeats, t.reserveDeparture, t.reserveArrival, t.reserveDate,
-		t.reserveCarNum, 1, 1, isutrain.DisableAssertOpt())
+		t.reserveCarNum, child, 1, isutrain.DisableAssertOpt())
 	if err != nil {
 		return err
 	}
@@ -102,13 +87,25 @@ func (t *BgTester) reserve(ctx context.Context) error {
 	// }
 
 	lgr.Infof("%d個の座席を予約しました", len(availSeats))
-	t.remainSeats -= len(availSeats)
 
 	return nil
 }
 
-func (t *BgTester) bgtestSeatAvailability(ctx context.Context, wantReservedSeatAvailability string) error {
+// remainSeats は、予約キャッシュから算出した指定席(禁煙)の空席数を返します
+func (t *BgTester) remainSeats() (int, error) {
+	expected, ok, err := isutrain.ReservationCache.ExpectedSeatAvailability(time.Now(), t.reserveDate, t.reserveTrainClass, t.reserveTrainName, t.reserveDeparture, t.reserveArrival)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errors.New("予約の処理中に空席数を算出しようとしました")
+	}
+	return expected[isutrain.SaReserved], nil
+}
+
+func (t *BgTester) bgtestSeatAvailability(ctx context.Context) error {
 	endpointPath := endpoint.GetPath(endpoint.SearchTrains)
+	requestedAt := time.Now()
 	searchTrainsResp, err := t.client.SearchTrains(ctx, t.reserveDate, t.reserveDeparture, t.reserveArrival, t.reserveTrainClass, 1, 1)
 	if err != nil {
 		return err
@@ -124,43 +121,46 @@ func (t *BgTester) bgtestSeatAvailability(ctx context.Context, wantReservedSeatA
 		return nil
 	}
 
-	sa := targetTrain.SeatAvailability
-	if sa["reserved"] != wantReservedSeatAvailability {
-		return bencherror.BenchmarkErrs.AddError(bencherror.NewSimpleCriticalError("GET %s: seatAvailabilityが不正です: want=%s, got=%s", endpointPath, wantReservedSeatAvailability, sa["reserved"]))
+	expected, ok, err := isutrain.ReservationCache.ExpectedSeatAvailability(requestedAt, t.reserveDate, t.reserveTrainClass, t.reserveTrainName, t.reserveDeparture, t.reserveArrival)
+	if err != nil || !ok {
+		return err
+	}
+
+	want, got := expected.Symbol(isutrain.SaReserved), targetTrain.SeatAvailability[isutrain.SaReserved.String()]
+	if got != want {
+		return bencherror.BenchmarkErrs.AddError(bencherror.NewSimpleCriticalError("GET %s: seatAvailabilityが不正です: want=%s, got=%s", endpointPath, want, got))
 	}
 
 	return nil
 }
 
 func (t *BgTester) run(ctx context.Context) error {
+	ctx = bencherror.WithScenario(ctx, "BgTest")
+
 	lgr := zap.S()
 	defer lgr.Info("bgテスターの終了")
-	if err := t.bgtestSeatAvailability(ctx, "○"); err != nil {
-		return err
-	}
+	// 予約するたびに空席情報を確認し、空席が十分ある(○) → 残りわずか(△) → 満席(×) と変化することを確認する
+	for {
+		if err := t.bgtestSeatAvailability(ctx); err != nil {
+			return err
+		}
 
-	for t.remainSeats > 10 {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			t.reserve(ctx)
+		remainSeats, err := t.remainSeats()
+		if err != nil {
+			return err
+		}
+		if remainSeats <= 0 {
+			break
 		}
-	}
-	if err := t.bgtestSeatAvailability(ctx, "△"); err != nil {
-		return err
-	}
 
-	for t.remainSeats > 0 {
 		select {
 		case <-ctx.Done():
 			return nil
 		default:
-			t.reserve(ctx)
 		}
-	}
-	if err := t.bgtestSeatAvailability(ctx, "×"); err != nil {
-		return err
+		if err := t.reserve(ctx, remainSeats); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/chibiegg/isucon9-final/bench/internal/history"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/urfave/cli"
+	"go.uber.org/zap"
+)
+
+var (
+	errHistoryPathNotSpecified = errors.New("--history でベンチマーク結果の記録ファイルを指定してください")
+)
+
+var (
+	historyPath    string
+	historyLabel   string
+	historyLimit   int
+	benchStartedAt time.Time
+)
+
+var historyPathFlag = cli.StringFlag{
+	Name:        "history",
+	Usage:       "ベンチマーク結果を記録するJSONLファイル",
+	Destination: &historyPath,
+	EnvVar:      "BENCH_HISTORY_PATH",
+}
+
+// recordHistory は、--history が指定されていればベンチマーク結果を追記します
+// NOTE: 記録に失敗しても、ベンチマーク結果には影響させない
+func recordHistory(pass bool, score int64, messages []string) {
+	if historyPath == "" {
+		return
+	}
+
+	startedAt := benchStartedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+
+	targets := []*history.Target{}
+	for _, stat := range isutrain.TargetStats() {
+		targets = append(targets, &history.Target{
+			URL:              stat.URL,
+			Requests:         stat.Requests,
+			Failures:         stat.Failures,
+			AvgLatencyMillis: stat.AvgLatencyMillis,
+		})
+	}
+
+	err := history.Append(historyPath, &history.Record{
+		StartedAt:   startedAt,
+		FinishedAt:  time.Now(),
+		Label:       historyLabel,
+		BenchCommit: config.BenchCommit,
+		Pass:        pass,
+		Score:       score,
+		Messages:    messages,
+		Endpoints:   endpoint.Stats(),
+		Targets:     targets,
+	})
+	if err != nil {
+		zap.S().Warnf("ベンチマーク結果を記録できませんでした: %+v", err)
+	}
+}
+
+func formatStartedAt(record *history.Record) string {
+	return record.StartedAt.Local().Format("2006-01-02 15:04:05")
+}
+
+func formatPass(pass bool) string {
+	if pass {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+var showHistory = cli.Command{
+	Name:  "history",
+	Usage: "記録したベンチマーク結果の一覧",
+	Flags: []cli.Flag{
+		historyPathFlag,
+		cli.IntFlag{
+			Name:        "limit",
+			Value:       20,
+			Usage:       "表示する件数 (新しいものから)",
+			Destination: &historyLimit,
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		if historyPath == "" {
+			return cli.NewExitError(errHistoryPathNotSpecified, 1)
+		}
+		records, err := history.Load(historyPath)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		if historyLimit > 0 && len(records) > historyLimit {
+			records = records[len(records)-historyLimit:]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tLABEL\tCOMMIT\tRESULT\tSCORE\tREQUESTS\tTARGETS")
+		for _, record := range records {
+			var count int64
+			for _, stat := range record.Endpoints {
+				count += stat.Count
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n",
+				record.ID, formatStartedAt(record), record.Label, record.BenchCommit,
+				formatPass(record.Pass), record.Score, count, len(record.Targets))
+		}
+		return w.Flush()
+	},
+}
+
+// parseHistoryID は、比較するベンチマーク結果のIDを解釈します
+// 省略された場合は、最新から数えた結果を指します
+func parseHistoryID(s string, fromLatest int) (int, error) {
+	if s == "" {
+		return -fromLatest, nil
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("ベンチマーク結果のIDが不正です: %s", s)
+	}
+	return id, nil
+}
+
+var compareHistory = cli.Command{
+	Name:      "compare",
+	Usage:     "記録したベンチマーク結果をエンドポイントごとに比較する (省略時は最新の2件)",
+	ArgsUsage: "[BEFORE_ID] [AFTER_ID]",
+	Flags: []cli.Flag{
+		historyPathFlag,
+	},
+	Action: func(cliCtx *cli.Context) error {
+		if historyPath == "" {
+			return cli.NewExitError(errHistoryPathNotSpecified, 1)
+		}
+		records, err := history.Load(historyPath)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		beforeID, err := parseHistoryID(cliCtx.Args().Get(0), 1)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		afterID, err := parseHistoryID(cliCtx.Args().Get(1), 0)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		before, err := history.Find(records, beforeID)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("%s: id=%d", err.Error(), beforeID), 1)
+		}
+		after, err := history.Find(records, afterID)
+		if err != nil {
+			return cli.NewExitError(fmt.Sprintf("%s: id=%d", err.Error(), afterID), 1)
+		}
+
+		diff := history.Compare(before, after)
+
+		fmt.Printf("before: #%d %s %s (%s) %s score=%d\n", before.ID, formatStartedAt(before), before.Label, before.BenchCommit, formatPass(before.Pass), before.Score)
+		fmt.Printf("after:  #%d %s %s (%s) %s score=%d\n", after.ID, formatStartedAt(after), after.Label, after.BenchCommit, formatPass(after.Pass), after.Score)
+		fmt.Printf("score:  %+d\n\n", diff.ScoreDelta())
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ENDPOINT\tBEFORE\tAFTER\tDELTA\tRATIO\t")
+		for _, endpoint := range diff.Endpoints {
+			mark := ""
+			if endpoint.Regression {
+				mark = "REGRESSION"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%+d\t%+.1f%%\t%s\n",
+				endpoint.Path, endpoint.Before, endpoint.After, endpoint.Delta(), endpoint.Ratio()*100, mark)
+		}
+		if err := w.Flush(); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		if regressions := diff.Regressions(); len(regressions) > 0 {
+			fmt.Printf("\n%d個のエンドポイントで成功回数が減少しました\n", len(regressions))
+		}
+		return nil
+	},
+}
@@ -34,6 +34,11 @@ func cliMain() int {
 		run,
 		pretest,
 		bgtest,
+		replay,
+		runScenario,
+		mockServer,
+		showHistory,
+		compareHistory,
 	}
 
 	app.Action = func(cliCtx *cli.Context) error {
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/logger"
+	"github.com/chibiegg/isucon9-final/bench/mock"
+	"github.com/urfave/cli"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	mockListen        string
+	mockPaymentListen string
+	mockPaymentURL    string
+	mockInjectPaths   string
+	mockBugs          string
+	mockAdminToken    string
+
+	mockLoginDelay             time.Duration
+	mockListStationsDelay      time.Duration
+	mockSearchTrainsDelay      time.Duration
+	mockListTrainSeatsDelay    time.Duration
+	mockReserveDelay           time.Duration
+	mockCommitReservationDelay time.Duration
+	mockCancelReservationDelay time.Duration
+	mockListReservationDelay   time.Duration
+)
+
+var mockServer = cli.Command{
+	Name:  "mock-server",
+	Usage: "モックのwebappと課金APIをHTTPサーバとして起動",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "listen",
+			Usage:       "webappのモックを待ち受けるアドレス",
+			Value:       ":8000",
+			Destination: &mockListen,
+			EnvVar:      "BENCH_MOCK_LISTEN",
+		},
+		cli.StringFlag{
+			Name:        "payment-listen",
+			Usage:       "課金APIのモックを待ち受けるアドレス",
+			Value:       ":5000",
+			Destination: &mockPaymentListen,
+			EnvVar:      "BENCH_MOCK_PAYMENT_LISTEN",
+		},
+		cli.StringFlag{
+			Name:        "payment",
+			Usage:       "/api/settings で返す課金APIのURL",
+			Value:       "http://localhost:5000",
+			Destination: &mockPaymentURL,
+			EnvVar:      "BENCH_PAYMENT_URL",
+		},
+		cli.StringFlag{
+			Name:        "inject",
+			Usage:       "500エラーを返すパス (カンマ区切り)",
+			Destination: &mockInjectPaths,
+			EnvVar:      "BENCH_MOCK_INJECT",
+		},
+		cli.StringFlag{
+			Name:        "bug",
+			Usage:       "埋め込む不具合 (double-booking, wrong-fare, stale-availability, no-csrf-check, lockout-bypass, keep-payment, no-refund, unfair-waitlist, unjoined-occupancy, miss-contained をカンマ区切り)",
+			Destination: &mockBugs,
+			EnvVar:      "BENCH_MOCK_BUG",
+		},
+		cli.StringFlag{
+			Name:        "admin-token",
+			Usage:       "管理APIのトークン (未指定の場合、管理APIは404を返す)",
+			Destination: &mockAdminToken,
+			EnvVar:      "BENCH_MOCK_ADMIN_TOKEN",
+		},
+		cli.DurationFlag{
+			Name:        "login-delay",
+			Destination: &mockLoginDelay,
+			EnvVar:      "BENCH_MOCK_LOGIN_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "list-stations-delay",
+			Destination: &mockListStationsDelay,
+			EnvVar:      "BENCH_MOCK_LIST_STATIONS_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "search-trains-delay",
+			Destination: &mockSearchTrainsDelay,
+			EnvVar:      "BENCH_MOCK_SEARCH_TRAINS_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "list-train-seats-delay",
+			Destination: &mockListTrainSeatsDelay,
+			EnvVar:      "BENCH_MOCK_LIST_TRAIN_SEATS_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "reserve-delay",
+			Destination: &mockReserveDelay,
+			EnvVar:      "BENCH_MOCK_RESERVE_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "commit-reservation-delay",
+			Destination: &mockCommitReservationDelay,
+			EnvVar:      "BENCH_MOCK_COMMIT_RESERVATION_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "cancel-reservation-delay",
+			Destination: &mockCancelReservationDelay,
+			EnvVar:      "BENCH_MOCK_CANCEL_RESERVATION_DELAY",
+		},
+		cli.DurationFlag{
+			Name:        "list-reservation-delay",
+			Destination: &mockListReservationDelay,
+			EnvVar:      "BENCH_MOCK_LIST_RESERVATION_DELAY",
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		lgr, err := logger.InitZapLogger()
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		server, err := mock.NewServer()
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		m := server.Mock
+		m.LoginDelay = mockLoginDelay
+		m.ListStationsDelay = mockListStationsDelay
+		m.SearchTrainsDelay = mockSearchTrainsDelay
+		m.ListTrainSeatsDelay = mockListTrainSeatsDelay
+		m.ReserveDelay = mockReserveDelay
+		m.CommitReservationDelay = mockCommitReservationDelay
+		m.CancelReservationDelay = mockCancelReservationDelay
+		m.ListReservationDelay = mockListReservationDelay
+		m.AdminToken = mockAdminToken
+
+		injectPaths := map[string]bool{}
+		for _, path := range splitNames(mockInjectPaths) {
+			injectPaths[path] = true
+		}
+		m.Inject(func(path string) error {
+			if injectPaths[path] {
+				return fmt.Errorf("%s: 注入されたエラーです", path)
+			}
+			return nil
+		})
+
+		for _, name := range splitNames(mockBugs) {
+			bug, err := mock.ParseBug(name)
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			m.InjectBug(bug)
+		}
+
+		var eg errgroup.Group
+		eg.Go(func() error {
+			lgr.Infof("webappのモックを起動します: %s", mockListen)
+			return http.ListenAndServe(mockListen, server.IsutrainHandler(mockPaymentURL))
+		})
+		eg.Go(func() error {
+			lgr.Infof("課金APIのモックを起動します: %s", mockPaymentListen)
+			return http.ListenAndServe(mockPaymentListen, server.PaymentHandler())
+		})
+		if err := eg.Wait(); err != nil && err != http.ErrServerClosed {
+			return cli.NewExitError(err, 1)
+		}
+
+		return nil
+	},
+}
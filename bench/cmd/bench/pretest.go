@@ -7,6 +7,7 @@ import (
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
 	"github.com/chibiegg/isucon9-final/bench/internal/config"
 	"github.com/chibiegg/isucon9-final/bench/internal/logger"
+	"github.com/chibiegg/isucon9-final/bench/internal/traffic"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/chibiegg/isucon9-final/bench/payment"
 	"github.com/chibiegg/isucon9-final/bench/scenario"
@@ -35,6 +36,12 @@ var pretest = cli.Command{
 			Destination: &assetDir,
 			EnvVar:      "BENCH_ASSETDIR",
 		},
+		cli.StringFlag{
+			Name:        "record",
+			Usage:       "isutrainへのリクエストとレスポンスをJSONLで記録するファイル",
+			Destination: &recordPath,
+			EnvVar:      "BENCH_RECORD_PATH",
+		},
 	},
 	Action: func(cliCtx *cli.Context) error {
 		ctx := context.Background()
@@ -47,6 +54,15 @@ var pretest = cli.Command{
 
 		lgr.Info("===== Prepare benchmarker =====")
 
+		if recordPath != "" {
+			if err := traffic.Start(recordPath); err != nil {
+				lgr.Warnf("トラフィック記録ファイルを作成できませんでした: %+v", err)
+				dumpFailedResult([]string{})
+				return cli.NewExitError(err, 1)
+			}
+			defer traffic.Stop()
+		}
+
 		assets, err := assets.Load(assetDir)
 		if err != nil {
 			lgr.Warn("静的ファイルをローカルから読み出せませんでした: %+v", err)
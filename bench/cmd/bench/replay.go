@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/logger"
+	"github.com/chibiegg/isucon9-final/bench/internal/traffic"
+	"github.com/urfave/cli"
+)
+
+var (
+	replayFile       string
+	replayTarget     string
+	replaySpeed      float64
+	replayIgnoreKeys string
+	replayOutput     string
+)
+
+type ReplayResult struct {
+	Total      int `json:"total"`
+	Mismatched int `json:"mismatched"`
+	Errors     int `json:"errors"`
+}
+
+var replay = cli.Command{
+	Name:  "replay",
+	Usage: "記録したトラフィックを再送し、レスポンスを比較",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:        "file",
+			Usage:       "run --record で記録したファイル",
+			Destination: &replayFile,
+			EnvVar:      "BENCH_REPLAY_FILE",
+		},
+		cli.StringFlag{
+			Name:        "target",
+			Value:       "http://localhost",
+			Destination: &replayTarget,
+			EnvVar:      "BENCH_TARGET_URL",
+		},
+		cli.StringFlag{
+			Name:        "payment",
+			Usage:       "記録されたカード登録を再送する決済APIのURL (空の場合はカードトークンを差し替えない)",
+			Destination: &config.PaymentBaseURL,
+			EnvVar:      "BENCH_PAYMENT_URL",
+		},
+		cli.Float64Flag{
+			Name:        "speed",
+			Usage:       "再送速度の倍率 (0の場合は待ち合わせずに再送)",
+			Value:       1.0,
+			Destination: &replaySpeed,
+			EnvVar:      "BENCH_REPLAY_SPEED",
+		},
+		cli.StringFlag{
+			Name:        "ignore",
+			Usage:       "比較しないJSONのキー (カンマ区切り)",
+			Value:       "reservation_id,card_token",
+			Destination: &replayIgnoreKeys,
+			EnvVar:      "BENCH_REPLAY_IGNORE",
+		},
+		cli.StringFlag{
+			Name:        "output",
+			Usage:       "差分のあったリクエストをJSONLで書き出すファイル",
+			Destination: &replayOutput,
+			EnvVar:      "BENCH_REPLAY_OUTPUT",
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		ctx := context.Background()
+
+		lgr, err := logger.InitZapLogger()
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		if replayFile == "" {
+			return cli.NewExitError(errors.New("--file が指定されていません"), 1)
+		}
+
+		entries, err := traffic.LoadFile(replayFile)
+		if err != nil {
+			lgr.Warnf("トラフィック記録ファイルを読み出せませんでした: %+v", err)
+			return cli.NewExitError(err, 1)
+		}
+
+		replayer, err := traffic.NewReplayer(replayTarget, config.PaymentBaseURL, replaySpeed, config.APITimeout, strings.Split(replayIgnoreKeys, ","))
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		lgr.Infof("===== Replay %d requests =====", len(entries))
+		results, err := replayer.Replay(ctx, entries)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		var (
+			replayResult = &ReplayResult{Total: len(results)}
+			mismatched   []*traffic.Result
+		)
+		for _, result := range results {
+			if result.Error != "" {
+				replayResult.Errors++
+			}
+			if result.Mismatched() {
+				replayResult.Mismatched++
+				mismatched = append(mismatched, result)
+				lgr.Warnf("%s %s: %s", result.Entry.Request.Method, result.Entry.Request.URL, strings.Join(result.Diffs, ", "))
+			}
+		}
+
+		if replayOutput != "" {
+			if err := dumpReplayDiffs(replayOutput, mismatched); err != nil {
+				lgr.Warnf("差分を書き出せませんでした: %+v", err)
+			}
+		}
+
+		b, err := json.Marshal(replayResult)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		fmt.Println(string(b))
+
+		if replayResult.Mismatched > 0 {
+			return cli.NewExitError(fmt.Sprintf("%d件のレスポンスが記録と一致しません", replayResult.Mismatched), 1)
+		}
+
+		return nil
+	},
+}
+
+func dumpReplayDiffs(path string, results []*traffic.Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/logger"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/chibiegg/isucon9-final/bench/mock"
+	"github.com/chibiegg/isucon9-final/bench/payment"
+	"github.com/chibiegg/isucon9-final/bench/scenario"
+	"github.com/jarcoal/httpmock"
+	"github.com/urfave/cli"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	scenarioName     string
+	scenarioCount    int
+	scenarioParallel int
+)
+
+type ScenarioResult struct {
+	Pass     bool                     `json:"pass"`
+	Name     string                   `json:"name"`
+	Count    int                      `json:"count"`
+	Counters bencherror.ErrorCounters `json:"counters"`
+	Messages []string                 `json:"messages"`
+	Targets  []*isutrain.TargetStat   `json:"targets"`
+}
+
+var runScenario = cli.Command{
+	Name:  "scenario",
+	Usage: "指定したシナリオのみ実行",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:        "debug",
+			Destination: &config.Debug,
+			EnvVar:      "BENCH_DEBUG",
+		},
+		cli.StringFlag{
+			Name:        "payment",
+			Value:       "http://localhost:5000",
+			Destination: &config.PaymentBaseURL,
+			EnvVar:      "BENCH_PAYMENT_URL",
+		},
+		cli.StringFlag{
+			Name:        "target",
+			Value:       "http://localhost",
+			Usage:       "負荷走行対象のURL (カンマ区切りで複数指定すると、ユーザごとに振り分ける)",
+			Destination: &config.TargetBaseURL,
+			EnvVar:      "BENCH_TARGET_URL",
+		},
+		cli.StringFlag{
+			Name:        "admin-token",
+			Usage:       "webappの管理APIのトークン (ADMIN_TOKEN). 指定時のみ運行情報のシナリオを実行する",
+			Destination: &config.AdminToken,
+			EnvVar:      "BENCH_ADMIN_TOKEN",
+		},
+		cli.StringFlag{
+			Name:        "scenario-file",
+			Usage:       "追加で読み込むYAML定義のシナリオ",
+			Destination: &scenarioFile,
+			EnvVar:      "BENCH_SCENARIO_FILE",
+		},
+		cli.StringFlag{
+			Name:        "timetable-dir",
+			Usage:       "fixture_generator.pyが生成した列車・時刻表のSQLがあるディレクトリ (指定時のみ発着時刻を検証する)",
+			Destination: &timetableDir,
+			EnvVar:      "BENCH_TIMETABLE_DIR",
+		},
+		cli.StringFlag{
+			Name:        "evidence",
+			Usage:       "エラーの原因となったリクエストとレスポンスをJSONLで書き出すファイル",
+			Destination: &evidencePath,
+			EnvVar:      "BENCH_EVIDENCE_PATH",
+		},
+		cli.StringFlag{
+			Name:        "name",
+			Usage:       "実行するシナリオ名",
+			Destination: &scenarioName,
+		},
+		cli.IntFlag{
+			Name:        "count",
+			Usage:       "実行回数",
+			Value:       1,
+			Destination: &scenarioCount,
+		},
+		cli.IntFlag{
+			Name:        "parallel",
+			Usage:       "並列数",
+			Value:       1,
+			Destination: &scenarioParallel,
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		ctx := context.Background()
+
+		lgr, err := logger.InitZapLogger()
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		if evidencePath != "" {
+			defer func() {
+				if err := bencherror.WriteEvidences(evidencePath); err != nil {
+					lgr.Warnf("エビデンスを書き出せませんでした: %+v", err)
+				}
+			}()
+		}
+
+		if scenarioFile != "" {
+			if err := scenario.LoadYAMLFile(scenarioFile); err != nil {
+				lgr.Warnf("シナリオ定義を読み込めませんでした: %+v", err)
+				return cli.NewExitError(err, 1)
+			}
+		}
+
+		if err := loadTimetable(); err != nil {
+			lgr.Warnf("時刻表を読み込めませんでした: %+v", err)
+			return cli.NewExitError(err, 1)
+		}
+
+		s, ok := scenario.Lookup(scenarioName)
+		if !ok {
+			return cli.NewExitError(fmt.Sprintf("シナリオが登録されていません: %s", scenarioName), 1)
+		}
+		if scenarioCount <= 0 || scenarioParallel <= 0 {
+			return cli.NewExitError(errors.New("--count, --parallel は正の整数で指定してください"), 1)
+		}
+
+		initClient, err := isutrain.NewClientForInitialize()
+		if err != nil {
+			lgr.Warn("isutrainクライアント生成に失敗しました: %+v", err)
+			return cli.NewExitError(err, 1)
+		}
+
+		paymentClient, err := payment.NewClient()
+		if err != nil {
+			lgr.Warn("課金クライアント生成に失敗しました: %+v", err)
+			return cli.NewExitError(err, 1)
+		}
+
+		if config.Debug {
+			lgr.Warn("!!!!! Debug enabled !!!!!")
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			m, err := mock.Register()
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			m.AdminToken = config.AdminToken
+			initClient.ReplaceMockTransport()
+		}
+
+		lgr.Info("===== Initialize payment =====")
+		if err := paymentClient.Initialize(); err != nil {
+			lgr.Warnf("課金APIへの /initialize でエラーが発生: %s", err.Error())
+			dumpFailedResult(bencherror.InitializeErrs.Msgs)
+			return cli.NewExitError(err, 1)
+		}
+		lgr.Info("===== Initialize webapp =====")
+		initClient.Initialize(ctx)
+		if bencherror.InitializeErrs.IsError() {
+			lgr.Warnf("webappへの /initialize でエラーが発生: %+v", bencherror.InitializeErrs.InternalMsgs)
+			dumpFailedResult(bencherror.InitializeErrs.Msgs)
+			return cli.NewExitError("webappの初期化に失敗しました", 1)
+		}
+
+		// 前提条件を満たさないまま実行すると、何も検証せずに成功してしまう
+		if !s.CanRun() {
+			return cli.NewExitError(fmt.Sprintf("シナリオの前提条件を満たしていません: %s", s.Name()), 1)
+		}
+
+		lgr.Infof("===== Run %s (count=%d, parallel=%d) =====", s.Name(), scenarioCount, scenarioParallel)
+		var (
+			eg     errgroup.Group
+			countC = make(chan struct{})
+		)
+		for i := 0; i < scenarioParallel; i++ {
+			eg.Go(func() error {
+				for range countC {
+					s.Run(ctx)
+				}
+				return nil
+			})
+		}
+		for i := 0; i < scenarioCount; i++ {
+			countC <- struct{}{}
+		}
+		close(countC)
+		eg.Wait()
+
+		errs := s.Phase().Errs()
+		// 並行して実行した予約・確定・キャンセルが直列化可能か検証する
+		for _, err := range isutrain.ReservationHistory.Check() {
+			errs.AddError(err)
+		}
+		pass := !errs.IsError()
+		b, err := json.Marshal(&ScenarioResult{
+			Pass:     pass,
+			Name:     s.Name(),
+			Count:    scenarioCount,
+			Counters: errs.Counters(),
+			Messages: summarizeMsgs(errs.Msgs),
+			Targets:  isutrain.TargetStats(),
+		})
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		fmt.Println(string(b))
+
+		if !pass {
+			return cli.NewExitError(fmt.Sprintf("シナリオが失敗しました: %s", s.Name()), 1)
+		}
+		return nil
+	},
+}
@@ -23,6 +23,7 @@ import (
 
 var (
 	targetPort                    int
+	targetScheme                  string
 	portalBaseURI, paymentBaseURI string
 	benchmarkerPath               string
 	assetDir                      string
@@ -32,6 +33,8 @@ var (
 	retryLimit, retryInterval int
 
 	messageLimit int
+
+	historyPath string
 )
 
 var (
@@ -61,23 +64,36 @@ func joinN(messages []string, n int) string {
 // ベンチマーカー実行ファイルを実行
 func execBench(ctx context.Context, job *Job) (*Result, error) {
 	// ターゲットサーバを取得
-	targetServer, err := getTargetServer(job)
+	// 複数ある場合は全て渡し、ベンチマーカーがユーザごとに振り分ける
+	targetServers, err := getTargetServers(job)
 	if err != nil {
 		alert.NotifyWorkerErr(job.ID, job.Team.ID, job.Team.Name, err, "", "", "ターゲットサーバの取得に失敗しました: job=%d", job.ID)
 		log.Printf("failed to get target server: %s", err.Error())
 		return nil, err
 	}
 
-	targetURI := fmt.Sprintf("https://%s:%d", targetServer.GlobalIP, targetPort)
+	targetURIs := make([]string, 0, len(targetServers))
+	for _, targetServer := range targetServers {
+		targetURIs = append(targetURIs, fmt.Sprintf("%s://%s:%d", targetScheme, targetServer.GlobalIP, targetPort))
+	}
+	targetURI := strings.Join(targetURIs, ",")
 
-	var stdout, stderr bytes.Buffer
-	cmd := exec.CommandContext(ctx, benchmarkerPath, []string{
+	args := []string{
 		"run",
 		"--payment=" + paymentBaseURI,
 		"--target=" + targetURI,
 		"--assetdir=" + assetDir,
 		"--webhookurl=" + config.SlackWebhookURL,
-	}...)
+	}
+	if historyPath != "" {
+		args = append(args,
+			"--history="+historyPath,
+			fmt.Sprintf("--label=job-%d/%s", job.ID, job.Team.Name),
+		)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, benchmarkerPath, args...)
 	log.Printf("exec_path=%s", cmd.Path)
 	for _, arg := range cmd.Args {
 		log.Printf("\t- args=%s\n", arg)
@@ -122,6 +138,10 @@ func execBench(ctx context.Context, job *Job) (*Result, error) {
 		}, nil
 	}
 
+	for _, target := range result.Targets {
+		log.Printf("target=%s clients=%d requests=%d failures=%d avg_latency_ms=%d", target.URL, target.Clients, target.Requests, target.Failures, target.AvgLatencyMillis)
+	}
+
 	return &Result{
 		ID:       job.ID,
 		Stdout:   string(stdout.Bytes()),
@@ -136,7 +156,7 @@ func execBench(ctx context.Context, job *Job) (*Result, error) {
 var run = cli.Command{
 	Name:  "run",
 	Usage: "ベンチマークワーカー実行",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		cli.StringFlag{
 			Name:        "portal",
 			Value:       "http://localhost:8000",
@@ -155,6 +175,18 @@ var run = cli.Command{
 			Destination: &targetPort,
 			EnvVar:      "BENCHWORKER_TARGET_PORT",
 		},
+		cli.StringFlag{
+			Name:        "target-scheme",
+			Value:       "https",
+			Destination: &targetScheme,
+			EnvVar:      "BENCHWORKER_TARGET_SCHEME",
+		},
+		cli.StringFlag{
+			Name:        "queue-dir",
+			Usage:       "指定すると、ポータルの代わりにディレクトリのジョブキューからジョブを取り出し、結果を書き込む",
+			Destination: &queueDir,
+			EnvVar:      "BENCHWORKER_QUEUE_DIR",
+		},
 		cli.StringFlag{
 			Name:        "assetdir",
 			Value:       "/home/isucon/isutrain/assets",
@@ -190,11 +222,30 @@ var run = cli.Command{
 			Destination: &config.SlackWebhookURL,
 			EnvVar:      "BENCHWORKER_SLACK_WEBHOOK_URL",
 		},
-	},
+		cli.StringFlag{
+			Name:        "history",
+			Usage:       "指定すると、ベンチマーカーに結果をJSONLで記録させる",
+			Destination: &historyPath,
+			EnvVar:      "BENCHWORKER_HISTORY_PATH",
+		},
+	}, alert.Flags("BENCHWORKER")...),
 	Action: func(cliCtx *cli.Context) error {
 		ctx := context.Background()
 		var reportWg sync.WaitGroup
 
+		var (
+			portal            = newPortalQueue(portalBaseURI)
+			source JobSource  = portal
+			sink   ResultSink = portal
+		)
+		if queueDir != "" {
+			queue, err := newDirQueue(queueDir)
+			if err != nil {
+				return cli.NewExitError(err, 1)
+			}
+			source, sink = queue, queue
+		}
+
 		sigCh := make(chan os.Signal, 1)
 		defer close(sigCh)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
@@ -207,7 +258,7 @@ var run = cli.Command{
 			case <-sigCh:
 				break loop
 			case <-ticker.C:
-				job, err := dequeue(ctx)
+				job, err := source.Dequeue(ctx)
 				if err != nil {
 					// dequeueが失敗しても終了しない
 					continue
@@ -222,7 +273,7 @@ var run = cli.Command{
 					log.Printf("bench failed: %s\n", err.Error())
 					// FIXME: ベンチ失敗した時のaction
 					reportErr := reportRetrier.RunCtx(ctx, func(ctx context.Context) error {
-						return report(ctx, job.ID, &Result{
+						return sink.Report(ctx, job.ID, &Result{
 							ID:       job.ID,
 							Status:   StatusFailed,
 							IsPassed: false,
@@ -239,7 +290,7 @@ var run = cli.Command{
 				go func() {
 					defer reportWg.Done()
 					err = reportRetrier.RunCtx(ctx, func(ctx context.Context) error {
-						return report(ctx, job.ID, result)
+						return sink.Report(ctx, job.ID, result)
 					})
 					if err != nil {
 						alert.NotifyWorkerErr(job.ID, job.Team.ID, job.Team.Name, err, result.Stdout, result.Stderr, "リトライしましたが、ポータルへの報告が失敗しました")
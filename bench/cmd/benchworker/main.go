@@ -29,6 +29,8 @@ func cliMain() int {
 
 	app.Commands = []cli.Command{
 		run,
+		runPortalStub,
+		enqueue,
 	}
 
 	app.Action = func(cliCtx *cli.Context) error {
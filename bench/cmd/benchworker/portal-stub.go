@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+var (
+	queueDir        string
+	portalStubAddr  string
+	enqueueTeamID   int
+	enqueueTeamName string
+	enqueueTargets  string
+)
+
+// portalStub は、ポータルの内部APIのうち、ベンチワーカーが利用するものだけを提供するサーバです
+// ジョブはディレクトリのキューに置かれ、enqueue コマンドで追加します
+type portalStub struct {
+	queue *dirQueue
+}
+
+func (s *portalStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "internal/job":
+		s.list(w, r)
+	case r.Method == http.MethodPost && path == "internal/job/dequeue":
+		s.dequeue(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "internal/job/") && strings.HasSuffix(path, "/report"):
+		jobID, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "internal/job/"), "/report"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.report(w, r, jobID)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *portalStub) list(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.queue.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, jobs)
+}
+
+func (s *portalStub) dequeue(w http.ResponseWriter, r *http.Request) {
+	job, err := s.queue.Dequeue(r.Context())
+	if err == errJobNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("dequeue job id=%d team_id=%d", job.ID, job.Team.ID)
+	writeJSON(w, job)
+}
+
+func (s *portalStub) report(w http.ResponseWriter, r *http.Request, jobID int) {
+	var result *Result
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.queue.Report(r.Context(), jobID, result)
+	switch err {
+	case nil:
+	case errJobNotRunning:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errJobAlreadyReported:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("report job id=%d status=%s score=%d passed=%t", jobID, result.Status, result.Score, result.IsPassed)
+	writeJSON(w, map[string]interface{}{"id": jobID})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode response: %s", err.Error())
+	}
+}
+
+var queueDirFlag = cli.StringFlag{
+	Name:        "queue-dir",
+	Value:       "queue",
+	Usage:       "ジョブキューのディレクトリ",
+	Destination: &queueDir,
+	EnvVar:      "BENCHWORKER_QUEUE_DIR",
+}
+
+var runPortalStub = cli.Command{
+	Name:  "portal-stub",
+	Usage: "ディレクトリのジョブキューを、ポータルの内部APIとして提供する",
+	Flags: []cli.Flag{
+		queueDirFlag,
+		cli.StringFlag{
+			Name:        "listen",
+			Value:       ":8000",
+			Destination: &portalStubAddr,
+			EnvVar:      "BENCHWORKER_PORTAL_STUB_LISTEN",
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		queue, err := newDirQueue(queueDir)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		log.Printf("portal stub listening on %s (queue=%s)", portalStubAddr, queueDir)
+		if err := http.ListenAndServe(portalStubAddr, &portalStub{queue: queue}); err != nil {
+			return cli.NewExitError(err, 1)
+		}
+		return nil
+	},
+}
+
+var enqueue = cli.Command{
+	Name:  "enqueue",
+	Usage: "ディレクトリのジョブキューにベンチマークのジョブを追加する",
+	Flags: []cli.Flag{
+		queueDirFlag,
+		cli.IntFlag{
+			Name:        "team-id",
+			Value:       1,
+			Destination: &enqueueTeamID,
+		},
+		cli.StringFlag{
+			Name:        "team-name",
+			Value:       "local",
+			Destination: &enqueueTeamName,
+		},
+		cli.StringFlag{
+			Name:        "target",
+			Usage:       "ベンチマーク対象サーバのIPまたはホスト名 (カンマ区切り)",
+			Destination: &enqueueTargets,
+		},
+	},
+	Action: func(cliCtx *cli.Context) error {
+		servers := []*Server{}
+		for i, target := range strings.Split(enqueueTargets, ",") {
+			if target = strings.TrimSpace(target); target == "" {
+				continue
+			}
+			servers = append(servers, &Server{
+				ID:            i + 1,
+				Hostname:      target,
+				GlobalIP:      target,
+				IsBenchTarget: true,
+			})
+		}
+		if len(servers) == 0 {
+			return cli.NewExitError(errTargetServerNotFound, 1)
+		}
+
+		queue, err := newDirQueue(queueDir)
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		job, err := queue.Enqueue(&Job{
+			Team: &Team{
+				ID:      enqueueTeamID,
+				Name:    enqueueTeamName,
+				Servers: servers,
+			},
+		})
+		if err != nil {
+			return cli.NewExitError(err, 1)
+		}
+
+		fmt.Println(job.ID)
+		return nil
+	},
+}
@@ -48,15 +48,33 @@ type (
 		Stderr   string `json:"stderr"`
 	}
 	BenchResult struct {
-		Pass     bool     `json:"pass"`
-		Score    int      `json:"score"`
-		Messages []string `json:"messages"`
+		Pass     bool          `json:"pass"`
+		Score    int           `json:"score"`
+		Messages []string      `json:"messages"`
+		Targets  []*TargetStat `json:"targets"`
+	}
+	// TargetStat はベンチマーク対象サーバごとのリクエストの統計です
+	TargetStat struct {
+		URL              string `json:"url"`
+		Clients          int64  `json:"clients"`
+		Requests         int64  `json:"requests"`
+		Failures         int64  `json:"failures"`
+		AvgLatencyMillis int64  `json:"avg_latency_ms"`
 	}
 )
 
+// portalQueue は、ポータルサーバの内部APIを用いるジョブキューです
+type portalQueue struct {
+	baseURI string
+}
+
+func newPortalQueue(baseURI string) *portalQueue {
+	return &portalQueue{baseURI: baseURI}
+}
+
 // Dequeue は、ポータルサーバからジョブをdequeueします
-func dequeue(ctx context.Context) (*Job, error) {
-	uri := fmt.Sprintf("%s/internal/job/dequeue/", portalBaseURI)
+func (q *portalQueue) Dequeue(ctx context.Context) (*Job, error) {
+	uri := fmt.Sprintf("%s/internal/job/dequeue/", q.baseURI)
 
 	req, err := http.NewRequest(http.MethodPost, uri, nil)
 	if err != nil {
@@ -83,8 +101,8 @@ func dequeue(ctx context.Context) (*Job, error) {
 
 // Report は、ベンチマーク結果をポータルサーバに通知します
 // FIXME: リトライ
-func report(ctx context.Context, jobID int, result *Result) error {
-	uri := fmt.Sprintf("%s/internal/job/%d/report/", portalBaseURI, jobID)
+func (q *portalQueue) Report(ctx context.Context, jobID int, result *Result) error {
+	uri := fmt.Sprintf("%s/internal/job/%d/report/", q.baseURI, jobID)
 	log.Printf("portal uri = %s\n", uri)
 
 	var buf bytes.Buffer
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobSource は、実行するベンチマークのジョブを取り出します
+// 取り出せるジョブがない場合は errJobNotFound を返します
+type JobSource interface {
+	Dequeue(ctx context.Context) (*Job, error)
+}
+
+// ResultSink は、ベンチマーク結果を報告します
+type ResultSink interface {
+	Report(ctx context.Context, jobID int, result *Result) error
+}
+
+var (
+	errJobAlreadyReported = errors.New("ジョブは既に報告済みです")
+	errJobNotRunning      = errors.New("実行中のジョブではありません")
+)
+
+// ジョブの状態ごとのディレクトリ
+const (
+	dirQueuePending = "pending"
+	dirQueueRunning = "running"
+	dirQueueDone    = "done"
+)
+
+// dirQueue は、ディレクトリにジョブをJSONファイルとして置くジョブキューです
+// ジョブファイルは pending → running → done と移動します. 移動はrenameで行うので、複数のワーカーから同時に利用できます
+type dirQueue struct {
+	dir string
+}
+
+// QueuedJob は、ディレクトリのキューに置かれるジョブと、その結果です
+type QueuedJob struct {
+	Job        *Job       `json:"job"`
+	Result     *Result    `json:"result,omitempty"`
+	EnqueuedAt time.Time  `json:"enqueued_at"`
+	ReportedAt *time.Time `json:"reported_at,omitempty"`
+}
+
+func newDirQueue(dir string) (*dirQueue, error) {
+	for _, name := range []string{dirQueuePending, dirQueueRunning, dirQueueDone} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &dirQueue{dir: dir}, nil
+}
+
+func (q *dirQueue) path(state string, jobID int) string {
+	// ファイル名の辞書順がenqueue順になるよう、ゼロ埋めする
+	return filepath.Join(q.dir, state, fmt.Sprintf("%010d.json", jobID))
+}
+
+// jobIDs は、状態ごとのディレクトリにあるジョブIDを昇順で返します
+func (q *dirQueue) jobIDs(state string) ([]int, error) {
+	files, err := ioutil.ReadDir(filepath.Join(q.dir, state))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (q *dirQueue) read(path string) (*QueuedJob, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var queued *QueuedJob
+	if err := json.Unmarshal(b, &queued); err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// writeTemp は、ジョブを一時ファイルに書き出します
+func (q *dirQueue) writeTemp(queued *QueuedJob) (string, error) {
+	b, err := json.MarshalIndent(queued, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(q.dir, ".job-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// write は、一時ファイルに書き出してからrenameすることで、書きかけのファイルが読まれないようにします
+func (q *dirQueue) write(path string, queued *QueuedJob) error {
+	tmp, err := q.writeTemp(queued)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Enqueue は、新しいジョブIDを払い出してジョブを追加します
+func (q *dirQueue) Enqueue(job *Job) (*Job, error) {
+	var maxID int
+	for _, state := range []string{dirQueuePending, dirQueueRunning, dirQueueDone} {
+		ids, err := q.jobIDs(state)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) > 0 && ids[len(ids)-1] > maxID {
+			maxID = ids[len(ids)-1]
+		}
+	}
+
+	// 同時にenqueueされた場合に備え、既存のファイルを上書きしないlinkでジョブIDを確保する
+	for id := maxID + 1; ; id++ {
+		queued := *job
+		queued.ID = id
+		queued.Status = "waiting"
+
+		tmp, err := q.writeTemp(&QueuedJob{
+			Job:        &queued,
+			EnqueuedAt: time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = os.Link(tmp, q.path(dirQueuePending, id))
+		os.Remove(tmp)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &queued, nil
+	}
+}
+
+// Dequeue は、最も古いジョブを実行中にして返します
+func (q *dirQueue) Dequeue(ctx context.Context) (*Job, error) {
+	ids, err := q.jobIDs(dirQueuePending)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		running := q.path(dirQueueRunning, id)
+		// 他のワーカーが先に取り出した場合はrenameに失敗するので、次のジョブを試す
+		if err := os.Rename(q.path(dirQueuePending, id), running); err != nil {
+			continue
+		}
+		queued, err := q.read(running)
+		if err != nil {
+			return nil, err
+		}
+		queued.Job.Status = "running"
+		if err := q.write(running, queued); err != nil {
+			return nil, err
+		}
+		return queued.Job, nil
+	}
+
+	return nil, errJobNotFound
+}
+
+// Report は、実行中のジョブに結果を記録し、完了にします
+func (q *dirQueue) Report(ctx context.Context, jobID int, result *Result) error {
+	running, done := q.path(dirQueueRunning, jobID), q.path(dirQueueDone, jobID)
+	if _, err := os.Stat(done); err == nil {
+		return errJobAlreadyReported
+	}
+
+	queued, err := q.read(running)
+	if os.IsNotExist(err) {
+		return errJobNotRunning
+	}
+	if err != nil {
+		return err
+	}
+
+	queued.Job.Status = result.Status
+	queued.Job.Score = result.Score
+	queued.Job.Reason = result.Reason
+	queued.Result = result
+	reportedAt := time.Now()
+	queued.ReportedAt = &reportedAt
+	if err := q.write(done, queued); err != nil {
+		return err
+	}
+	return os.Remove(running)
+}
+
+// List は、全ての状態のジョブをジョブIDの昇順で返します
+func (q *dirQueue) List() ([]*QueuedJob, error) {
+	jobs := []*QueuedJob{}
+	for _, state := range []string{dirQueuePending, dirQueueRunning, dirQueueDone} {
+		ids, err := q.jobIDs(state)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			queued, err := q.read(q.path(state, id))
+			if err != nil {
+				// 状態の移動中に読もうとした場合は無視する
+				continue
+			}
+			jobs = append(jobs, queued)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Job.ID < jobs[j].Job.ID
+	})
+	return jobs, nil
+}
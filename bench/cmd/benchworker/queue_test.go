@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJob(target string) *Job {
+	return &Job{
+		Team: &Team{
+			ID:   1,
+			Name: "team1",
+			Servers: []*Server{
+				{ID: 1, GlobalIP: target, IsBenchTarget: true},
+			},
+		},
+	}
+}
+
+func TestDirQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchworker-queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := newDirQueue(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx := context.Background()
+
+	job1, err := queue.Enqueue(newTestJob("10.0.0.1"))
+	assert.NoError(t, err)
+	job2, err := queue.Enqueue(newTestJob("10.0.0.2"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, job1.ID)
+	assert.Equal(t, 2, job2.ID)
+
+	// 古いジョブから取り出す
+	job, err := queue.Dequeue(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, job.ID)
+		assert.Equal(t, "10.0.0.1", job.Team.Servers[0].GlobalIP)
+	}
+
+	assert.Equal(t, errJobNotRunning, queue.Report(ctx, 2, &Result{ID: 2}))
+	assert.NoError(t, queue.Report(ctx, 1, &Result{ID: 1, Status: StatusSuccess, Score: 100, IsPassed: true}))
+	assert.Equal(t, errJobAlreadyReported, queue.Report(ctx, 1, &Result{ID: 1}))
+
+	// 完了したジョブがあっても、ジョブIDは重複しない
+	job3, err := queue.Enqueue(newTestJob("10.0.0.3"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, job3.ID)
+	}
+
+	jobs, err := queue.List()
+	if assert.NoError(t, err) && assert.Len(t, jobs, 3) {
+		assert.Equal(t, StatusSuccess, jobs[0].Job.Status)
+		assert.Equal(t, 100, jobs[0].Job.Score)
+		assert.Equal(t, "waiting", jobs[1].Job.Status)
+		assert.Equal(t, "waiting", jobs[2].Job.Status)
+	}
+}
+
+func TestPortalStub(t *testing.T) {
+	dir, err := ioutil.TempDir("", "benchworker-queue")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	queue, err := newDirQueue(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := httptest.NewServer(&portalStub{queue: queue})
+	defer srv.Close()
+
+	// ベンチワーカーは、ポータルと同じ内部APIでスタブを利用できる
+	var (
+		ctx    = context.Background()
+		portal = newPortalQueue(srv.URL)
+	)
+
+	_, err = portal.Dequeue(ctx)
+	assert.Equal(t, errJobNotFound, err)
+
+	_, err = queue.Enqueue(newTestJob("10.0.0.1"))
+	assert.NoError(t, err)
+
+	job, err := portal.Dequeue(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1, job.ID)
+	assert.NoError(t, portal.Report(ctx, job.ID, &Result{ID: job.ID, Status: StatusSuccess, Score: 100, IsPassed: true}))
+	assert.Equal(t, errReportFailed, portal.Report(ctx, job.ID, &Result{ID: job.ID}))
+}
@@ -6,11 +6,16 @@ var (
 	errTargetServerNotFound = errors.New("ベンチマーク対象サーバが見つかりませんでした")
 )
 
-func getTargetServer(job *Job) (*Server, error) {
+// getTargetServers は、チームのサーバのうちベンチマーク対象のものを全て返します
+func getTargetServers(job *Job) ([]*Server, error) {
+	servers := []*Server{}
 	for _, server := range job.Team.Servers {
 		if server.IsBenchTarget {
-			return server, nil
+			servers = append(servers, server)
 		}
 	}
-	return nil, errTargetServerNotFound
+	if len(servers) == 0 {
+		return nil, errTargetServerNotFound
+	}
+	return servers, nil
 }
@@ -0,0 +1,171 @@
+package alert
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/urfave/cli"
+)
+
+// Level は通知の重要度です
+type Level string
+
+const (
+	LevelDanger  Level = "danger"
+	LevelWarning Level = "warning"
+)
+
+// Field は通知に付加する短い情報です
+type Field struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// Detail は通知に付加する長い情報です (標準出力など)
+type Detail struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// Alert は運営への通知です
+type Alert struct {
+	Title     string    `json:"title"`
+	Level     Level     `json:"level"`
+	Hostname  string    `json:"hostname"`
+	Fields    []*Field  `json:"fields"`
+	Details   []*Detail `json:"details"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newAlert(title string, level Level, err error) *Alert {
+	hostname, hostnameErr := os.Hostname()
+	if hostnameErr != nil {
+		hostname = "unknown"
+	}
+
+	a := &Alert{
+		Title:     title,
+		Level:     level,
+		Hostname:  hostname,
+		Fields:    []*Field{},
+		Details:   []*Detail{},
+		CreatedAt: time.Now(),
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	return a
+}
+
+// Alerter は通知の送り先です
+type Alerter interface {
+	Alert(a *Alert) error
+}
+
+// 通知先の設定
+// Slackは config.SlackWebhookURL を用います
+var (
+	WebhookURL string
+	SMTPAddr   string
+	MailFrom   string
+	MailTo     string
+	FilePath   string
+
+	RetryCount    = 10
+	RetryInterval = 1 * time.Second
+)
+
+// Flags は、通知先の設定を行うフラグを返します
+// 環境変数は envPrefix (BENCH, BENCHWORKER など) を前置した名前になります
+func Flags(envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "alert-webhook-url",
+			Usage:       "通知をJSONでPOSTするURL",
+			Destination: &WebhookURL,
+			EnvVar:      envPrefix + "_ALERT_WEBHOOK_URL",
+		},
+		cli.StringFlag{
+			Name:        "alert-smtp-addr",
+			Usage:       "通知をメールで送るSMTPサーバ (例: localhost:25)",
+			Destination: &SMTPAddr,
+			EnvVar:      envPrefix + "_ALERT_SMTP_ADDR",
+		},
+		cli.StringFlag{
+			Name:        "alert-mail-from",
+			Value:       "isutrain-bench@localhost",
+			Destination: &MailFrom,
+			EnvVar:      envPrefix + "_ALERT_MAIL_FROM",
+		},
+		cli.StringFlag{
+			Name:        "alert-mail-to",
+			Usage:       "通知メールの宛先 (カンマ区切り)",
+			Destination: &MailTo,
+			EnvVar:      envPrefix + "_ALERT_MAIL_TO",
+		},
+		cli.StringFlag{
+			Name:        "alert-file",
+			Usage:       "通知をJSONLで追記するファイル",
+			Destination: &FilePath,
+			EnvVar:      envPrefix + "_ALERT_FILE",
+		},
+		cli.IntFlag{
+			Name:        "alert-retry",
+			Value:       RetryCount,
+			Usage:       "通知に失敗した場合のリトライ回数",
+			Destination: &RetryCount,
+			EnvVar:      envPrefix + "_ALERT_RETRY",
+		},
+	}
+}
+
+// alerters は、設定された通知先を返します
+func alerters() []Alerter {
+	alerters := []Alerter{}
+	if config.SlackWebhookURL != "" {
+		alerters = append(alerters, &slackAlerter{webhookURL: config.SlackWebhookURL})
+	}
+	if WebhookURL != "" {
+		alerters = append(alerters, &webhookAlerter{url: WebhookURL})
+	}
+	if SMTPAddr != "" && MailTo != "" {
+		alerters = append(alerters, &mailAlerter{addr: SMTPAddr, from: MailFrom, to: splitList(MailTo)})
+	}
+	if FilePath != "" {
+		alerters = append(alerters, &fileAlerter{path: FilePath})
+	}
+	return alerters
+}
+
+// Notify は、設定された全ての通知先に通知します
+// 通知先ごとにリトライし、失敗した通知先があればエラーを返します
+func Notify(a *Alert) error {
+	errs := []string{}
+	for _, alerter := range alerters() {
+		alertRetrier := retrier.New(retrier.ConstantBackoff(RetryCount, RetryInterval), nil)
+		if err := alertRetrier.Run(func() error {
+			return alerter.Alert(a)
+		}); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
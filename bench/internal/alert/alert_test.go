@@ -0,0 +1,137 @@
+package alert
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetConfig() {
+	WebhookURL, SMTPAddr, MailTo, FilePath = "", "", "", ""
+	Rules, ScoreThreshold = "", 0
+	RetryCount, RetryInterval = 1, time.Millisecond
+}
+
+func TestNotifyFileAndWebhook(t *testing.T) {
+	defer resetConfig()
+	resetConfig()
+
+	dir, err := ioutil.TempDir("", "bench-alert")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	FilePath = filepath.Join(dir, "alert.jsonl")
+
+	received := []*Alert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a *Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, a)
+	}))
+	defer server.Close()
+	WebhookURL = server.URL
+
+	assert.NoError(t, Notify(newAlert("test", LevelWarning, nil)))
+	assert.NoError(t, Notify(newAlert("test2", LevelDanger, nil)))
+
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, "test", received[0].Title)
+		assert.Equal(t, LevelDanger, received[1].Level)
+	}
+
+	f, err := os.Open(FilePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	titles := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var a *Alert
+		if assert.NoError(t, json.Unmarshal(scanner.Bytes(), &a)) {
+			titles = append(titles, a.Title)
+		}
+	}
+	assert.Equal(t, []string{"test", "test2"}, titles)
+}
+
+func TestNotifyWebhookFailure(t *testing.T) {
+	defer resetConfig()
+	resetConfig()
+	RetryCount = 2
+
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	WebhookURL = server.URL
+
+	assert.Error(t, Notify(newAlert("test", LevelWarning, nil)))
+	assert.Equal(t, 3, count, "初回 + リトライ2回")
+}
+
+func TestBenchRules(t *testing.T) {
+	defer resetConfig()
+	resetConfig()
+
+	dir, err := ioutil.TempDir("", "bench-alert")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	FilePath = filepath.Join(dir, "alert.jsonl")
+
+	countAlerts := func() int {
+		b, err := ioutil.ReadFile(FilePath)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		assert.NoError(t, err)
+		return strings.Count(string(b), "\n")
+	}
+
+	// ルール未指定の場合は通知しない
+	assert.NoError(t, NotifyPretestFailed([]string{"failed"}))
+	assert.NoError(t, NotifyScore(0, nil))
+	assert.Equal(t, 0, countAlerts())
+
+	Rules = "pretest-failed, score-below"
+	ScoreThreshold = 1000
+	assert.NoError(t, ValidateRules())
+
+	assert.NoError(t, NotifyPretestFailed([]string{"failed"}))
+	assert.NoError(t, NotifyFinalCheckCritical([]string{"critical"}))
+	assert.NoError(t, NotifyScore(1000, nil))
+	assert.Equal(t, 1, countAlerts())
+	assert.NoError(t, NotifyScore(999, nil))
+	assert.Equal(t, 2, countAlerts())
+
+	Rules = "pretest-failed,unknown"
+	assert.Error(t, ValidateRules())
+}
+
+func TestMailMessage(t *testing.T) {
+	m := &mailAlerter{from: "bench@localhost", to: []string{"a@example.com", "b@example.com"}}
+	a := newAlert("スコアが閾値を下回りました", LevelWarning, nil)
+	a.Details = append(a.Details, &Detail{Title: "メッセージ", Text: "line1\nline2"})
+
+	msg := string(m.message(a))
+	assert.Contains(t, msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, msg, "Subject: =?utf-8?q?")
+	assert.Contains(t, msg, "line1\r\nline2\r\n")
+}
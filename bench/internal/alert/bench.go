@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/urfave/cli"
+)
+
+// Rule は通知するベンチマークのイベントです
+type Rule string
+
+const (
+	// RulePretestFailed は、pretestで失格した場合に通知します
+	RulePretestFailed Rule = "pretest-failed"
+	// RuleFinalCheckCritical は、finalcheckでクリティカルエラーが発生した場合に通知します
+	RuleFinalCheckCritical Rule = "finalcheck-critical"
+	// RuleScoreBelow は、スコアが ScoreThreshold 未満の場合に通知します
+	RuleScoreBelow Rule = "score-below"
+)
+
+// ベンチマークのイベントの通知設定
+// NOTE: 競技中は全チームのベンチマークが通知されてしまうので、デフォルトでは通知しません
+var (
+	Rules          string
+	ScoreThreshold int64
+)
+
+// BenchFlags は、ベンチマークのイベントの通知設定を行うフラグを返します
+func BenchFlags(envPrefix string) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "alert-rules",
+			Usage:       "通知するイベント (pretest-failed, finalcheck-critical, score-below をカンマ区切り)",
+			Destination: &Rules,
+			EnvVar:      envPrefix + "_ALERT_RULES",
+		},
+		cli.Int64Flag{
+			Name:        "alert-score-threshold",
+			Usage:       "score-below で通知するスコアの閾値",
+			Destination: &ScoreThreshold,
+			EnvVar:      envPrefix + "_ALERT_SCORE_THRESHOLD",
+		},
+	}
+}
+
+// ValidateRules は、通知するイベントの指定が正しいか検証します
+func ValidateRules() error {
+	for _, rule := range splitList(Rules) {
+		switch Rule(rule) {
+		case RulePretestFailed, RuleFinalCheckCritical, RuleScoreBelow:
+		default:
+			return fmt.Errorf("不明な通知ルールです: %s", rule)
+		}
+	}
+	return nil
+}
+
+func ruleEnabled(rule Rule) bool {
+	for _, r := range splitList(Rules) {
+		if Rule(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func newBenchAlert(title string, level Level, rule Rule, messages []string) *Alert {
+	a := newAlert(title, level, nil)
+	a.Fields = append(a.Fields,
+		&Field{Title: "ルール", Value: string(rule)},
+		&Field{Title: "ベンチマーク対象", Value: config.TargetBaseURL},
+		&Field{Title: "ベンチマーカー", Value: config.BenchCommit},
+	)
+	if len(messages) > 0 {
+		a.Details = append(a.Details, &Detail{Title: "メッセージ", Text: strings.Join(messages, "\n")})
+	}
+	return a
+}
+
+// NotifyPretestFailed は、pretestでの失格を通知します
+func NotifyPretestFailed(messages []string) error {
+	if !ruleEnabled(RulePretestFailed) {
+		return nil
+	}
+	return Notify(newBenchAlert("pretestで失格しました", LevelDanger, RulePretestFailed, messages))
+}
+
+// NotifyFinalCheckCritical は、finalcheckでのクリティカルエラーを通知します
+func NotifyFinalCheckCritical(messages []string) error {
+	if !ruleEnabled(RuleFinalCheckCritical) {
+		return nil
+	}
+	return Notify(newBenchAlert("finalcheckでクリティカルエラーが発生しました", LevelDanger, RuleFinalCheckCritical, messages))
+}
+
+// NotifyScore は、スコアが閾値を下回っていれば通知します
+func NotifyScore(score int64, messages []string) error {
+	if !ruleEnabled(RuleScoreBelow) || score >= ScoreThreshold {
+		return nil
+	}
+	a := newBenchAlert(fmt.Sprintf("スコアが閾値を下回りました: score=%d, threshold=%d", score, ScoreThreshold), LevelWarning, RuleScoreBelow, messages)
+	a.Fields = append(a.Fields, &Field{Title: "スコア", Value: fmt.Sprintf("%d", score)})
+	return Notify(a)
+}
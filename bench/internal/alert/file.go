@@ -0,0 +1,33 @@
+package alert
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// fileAlerter は、通知をJSONLでファイルに追記します
+type fileAlerter struct {
+	path string
+}
+
+var fileMu sync.Mutex
+
+func (f *fileAlerter) Alert(a *Alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(b, '\n'))
+	return err
+}
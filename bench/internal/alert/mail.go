@@ -0,0 +1,46 @@
+package alert
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+// mailAlerter は、SMTPサーバ経由でメールを送ります
+// NOTE: 認証なしで中継できるローカルのSMTPサーバを想定しています
+type mailAlerter struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (m *mailAlerter) Alert(a *Alert) error {
+	return smtp.SendMail(m.addr, nil, m.from, m.to, m.message(a))
+}
+
+func (m *mailAlerter) message(a *Alert) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("[%s] %s", a.Level, a.Title)))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	fmt.Fprintf(&buf, "%s\r\n\r\n", a.Title)
+	fmt.Fprintf(&buf, "ホスト名: %s\r\n", a.Hostname)
+	fmt.Fprintf(&buf, "日時: %s\r\n", a.CreatedAt.Format("2006-01-02 15:04:05"))
+	for _, field := range a.Fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", field.Title, field.Value)
+	}
+	if a.Error != "" {
+		fmt.Fprintf(&buf, "\r\nエラー情報:\r\n%s\r\n", a.Error)
+	}
+	for _, detail := range a.Details {
+		fmt.Fprintf(&buf, "\r\n%s:\r\n%s\r\n", detail.Title, strings.Replace(detail.Text, "\n", "\r\n", -1))
+	}
+	return buf.Bytes()
+}
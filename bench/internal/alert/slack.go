@@ -2,95 +2,55 @@ package alert
 
 import (
 	"fmt"
-	"os"
-	"time"
 
-	"github.com/chibiegg/isucon9-final/bench/internal/config"
-	"github.com/eapache/go-resiliency/retrier"
 	"github.com/nlopes/slack"
 )
 
-func notifyErr(title string, err error, attachments []slack.Attachment) error {
-	if len(config.SlackWebhookURL) == 0 {
-		return nil
-	}
+// slackAlerter は、SlackのIncoming Webhookに通知します
+type slackAlerter struct {
+	webhookURL string
+}
 
-	if err != nil {
-		attachments = append(attachments, slack.Attachment{
-			Color: "danger",
-			Title: "エラー情報",
-			Text:  err.Error(),
-		})
+func (s *slackAlerter) Alert(a *Alert) error {
+	fields := []slack.AttachmentField{
+		slack.AttachmentField{
+			Title: "ホスト名",
+			Value: a.Hostname,
+			Short: true,
+		},
 	}
-
-	var (
-		retryCnt      = 10
-		retryInterval = 1 * time.Second
-	)
-	postRetrier := retrier.New(retrier.ConstantBackoff(retryCnt, retryInterval), nil)
-	return postRetrier.Run(func() error {
-		return slack.PostWebhook(config.SlackWebhookURL, &slack.WebhookMessage{
-			Text:        fmt.Sprintf("<!channel> %s", title),
-			Attachments: attachments,
+	for _, field := range a.Fields {
+		fields = append(fields, slack.AttachmentField{
+			Title: field.Title,
+			Value: field.Value,
+			Short: true,
 		})
-	})
-}
-
-func NotifyWorkerErr(jobID int, teamID int, teamName string, err error, stdout, stderr string, msg string, args ...interface{}) error {
-	hostname, hostnameErr := os.Hostname()
-	if hostnameErr != nil {
-		return hostnameErr
 	}
 
 	attachments := []slack.Attachment{
 		slack.Attachment{
-			Color: "danger",
-			Title: "補足情報",
-			Fields: []slack.AttachmentField{
-				slack.AttachmentField{
-					Title: "ホスト名",
-					Value: hostname,
-					Short: true,
-				},
-				slack.AttachmentField{
-					Title: "ジョブID",
-					Value: fmt.Sprintf("%d", jobID),
-					Short: true,
-				},
-				slack.AttachmentField{
-					Title: "チームID",
-					Value: fmt.Sprintf("%d", teamID),
-					Short: true,
-				},
-				slack.AttachmentField{
-					Title: "チーム名",
-					Value: teamName,
-					Short: true,
-				},
-				slack.AttachmentField{
-					Title: "メッセージ",
-					Value: fmt.Sprintf(msg, args...),
-					Short: true,
-				},
-			},
+			Color:  string(a.Level),
+			Title:  "補足情報",
+			Fields: fields,
 		},
 	}
-
-	if len(stdout) > 0 {
+	for _, detail := range a.Details {
 		attachments = append(attachments, slack.Attachment{
-			Color: "danger",
-			Title: "標準出力",
-			Text:  string(stdout),
+			Color: string(a.Level),
+			Title: detail.Title,
+			Text:  detail.Text,
 		})
 	}
-
-	if len(stderr) > 0 {
+	if a.Error != "" {
 		attachments = append(attachments, slack.Attachment{
-			Color: "danger",
-			Title: "標準エラー出力",
-			Text:  string(stderr),
+			Color: string(a.Level),
+			Title: "エラー情報",
+			Text:  a.Error,
 		})
 	}
 
-	return notifyErr("workerでエラー発生", err, attachments)
+	return slack.PostWebhook(s.webhookURL, &slack.WebhookMessage{
+		Text:        fmt.Sprintf("<!channel> %s", a.Title),
+		Attachments: attachments,
+	})
 }
@@ -0,0 +1,34 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookAlerter は、通知をJSONでPOSTします
+type webhookAlerter struct {
+	url string
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (w *webhookAlerter) Alert(a *Alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(w.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhookへの通知に失敗しました: status=%d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package alert
+
+import "fmt"
+
+// NotifyWorkerErr は、benchworkerでのエラーを通知します
+func NotifyWorkerErr(jobID int, teamID int, teamName string, err error, stdout, stderr string, msg string, args ...interface{}) error {
+	a := newAlert("workerでエラー発生", LevelDanger, err)
+	a.Fields = append(a.Fields,
+		&Field{Title: "ジョブID", Value: fmt.Sprintf("%d", jobID)},
+		&Field{Title: "チームID", Value: fmt.Sprintf("%d", teamID)},
+		&Field{Title: "チーム名", Value: teamName},
+		&Field{Title: "メッセージ", Value: fmt.Sprintf(msg, args...)},
+	)
+
+	if len(stdout) > 0 {
+		a.Details = append(a.Details, &Detail{Title: "標準出力", Text: stdout})
+	}
+
+	if len(stderr) > 0 {
+		a.Details = append(a.Details, &Detail{Title: "標準エラー出力", Text: stderr})
+	}
+
+	return Notify(a)
+}
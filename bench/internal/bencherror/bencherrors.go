@@ -21,6 +21,9 @@ type BenchErrors struct {
 	Msgs         []string
 	InternalMsgs []string
 
+	// アプリケーションエラーとクリティカルエラーの原因となったリクエストとレスポンス
+	evidences []*Evidence
+
 	criticalCnt    uint64
 	applicationCnt uint64
 	timeoutCnt     uint64
@@ -91,9 +94,11 @@ func (errs *BenchErrors) AddError(err error) error {
 		case errCritical:
 			errs.Msgs = append(errs.Msgs, msg+" (critical error)")
 			errs.criticalCnt++
+			errs.addEvidence(extractEvidence(err, msg, code))
 		case errApplication:
 			errs.Msgs = append(errs.Msgs, msg)
 			errs.applicationCnt++
+			errs.addEvidence(extractEvidence(err, msg, code))
 		case errTimeout:
 			errs.Msgs = append(errs.Msgs, msg+" (タイムアウトしました)")
 			errs.timeoutCnt++
@@ -103,12 +108,50 @@ func (errs *BenchErrors) AddError(err error) error {
 		default:
 			errs.Msgs = append(errs.Msgs, msg+" 運営に確認をお願いいたします")
 			errs.criticalCnt++
+			errs.addEvidence(extractEvidence(err, msg, code))
 		}
 	}
 
 	return err
 }
 
+func (errs *BenchErrors) addEvidence(evidence *Evidence) {
+	if len(errs.evidences) >= maxEvidences {
+		return
+	}
+	errs.evidences = append(errs.evidences, evidence)
+}
+
+// Evidences はエラーのエビデンスを返します
+func (errs *BenchErrors) Evidences() []*Evidence {
+	errs.mu.RLock()
+	defer errs.mu.RUnlock()
+
+	evidences := make([]*Evidence, len(errs.evidences))
+	copy(evidences, errs.evidences)
+	return evidences
+}
+
+// ErrorCounters はエラー種別ごとの件数です
+type ErrorCounters struct {
+	Critical    uint64 `json:"critical"`
+	Application uint64 `json:"application"`
+	Timeout     uint64 `json:"timeout"`
+	Temporary   uint64 `json:"temporary"`
+}
+
+func (errs *BenchErrors) Counters() ErrorCounters {
+	errs.mu.RLock()
+	defer errs.mu.RUnlock()
+
+	return ErrorCounters{
+		Critical:    errs.criticalCnt,
+		Application: errs.applicationCnt,
+		Timeout:     errs.timeoutCnt,
+		Temporary:   errs.temporaryCnt,
+	}
+}
+
 func (errs *BenchErrors) DumpCounters() {
 	errs.mu.Lock()
 	defer errs.mu.Unlock()
@@ -0,0 +1,209 @@
+package bencherror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/morikuni/failure"
+)
+
+// エビデンスとして残すボディの最大長
+const maxEvidenceBodyLength = 512
+
+// 1つのBenchErrorsが保持するエビデンスの最大件数
+const maxEvidences = 1000
+
+// failure.Contextのキー
+const (
+	evidenceKeyScenario     = "scenario"
+	evidenceKeyTimestamp    = "timestamp"
+	evidenceKeyMethod       = "method"
+	evidenceKeyPath         = "path"
+	evidenceKeyQuery        = "query"
+	evidenceKeyRequestBody  = "request_body"
+	evidenceKeyStatus       = "status"
+	evidenceKeyResponseBody = "response_body"
+)
+
+// Evidence はエラーの原因となったリクエストとレスポンスの記録です
+type Evidence struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Scenario     string    `json:"scenario,omitempty"`
+	Message      string    `json:"message"`
+	Code         string    `json:"code"`
+	Method       string    `json:"method,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	Query        string    `json:"query,omitempty"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+}
+
+type scenarioKey struct{}
+
+// WithScenario はエビデンスに記録するシナリオ名をcontextに設定します
+func WithScenario(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, scenarioKey{}, name)
+}
+
+func scenarioOf(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(scenarioKey{}).(string)
+	return name
+}
+
+// EvidenceBody はエビデンスのためにボディを保持したまま読み出せるようにしたhttp.Response.Bodyです
+type EvidenceBody struct {
+	*bytes.Reader
+	b []byte
+}
+
+func NewEvidenceBody(b []byte) *EvidenceBody {
+	return &EvidenceBody{
+		Reader: bytes.NewReader(b),
+		b:      b,
+	}
+}
+
+func (b *EvidenceBody) Bytes() []byte {
+	return b.b
+}
+
+func (b *EvidenceBody) Close() error {
+	return nil
+}
+
+// WithEvidence はリクエストとレスポンスの内容をfailure.Contextとしてエラーに付加します
+// NOTE: respがnilの場合(リクエスト失敗時など)は、リクエストの内容のみ付加します
+func WithEvidence(err error, req *http.Request, resp *http.Response) error {
+	if err == nil || req == nil {
+		return err
+	}
+
+	ctx := failure.Context{
+		evidenceKeyTimestamp: time.Now().Format(time.RFC3339Nano),
+		evidenceKeyMethod:    req.Method,
+		evidenceKeyPath:      req.URL.Path,
+	}
+	if scenario := scenarioOf(req.Context()); scenario != "" {
+		ctx[evidenceKeyScenario] = scenario
+	}
+	if req.URL.RawQuery != "" {
+		ctx[evidenceKeyQuery] = req.URL.RawQuery
+	}
+	if body := requestBodyOf(req); body != "" {
+		ctx[evidenceKeyRequestBody] = body
+	}
+	if resp != nil {
+		ctx[evidenceKeyStatus] = strconv.Itoa(resp.StatusCode)
+		if body, ok := resp.Body.(*EvidenceBody); ok && len(body.Bytes()) > 0 {
+			ctx[evidenceKeyResponseBody] = truncateEvidence(body.Bytes())
+		}
+	}
+
+	return failure.Custom(err, ctx)
+}
+
+func requestBodyOf(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+
+	return truncateEvidence(b)
+}
+
+func truncateEvidence(b []byte) string {
+	if len(b) > maxEvidenceBodyLength {
+		return string(b[:maxEvidenceBodyLength]) + "...(truncated)"
+	}
+	return string(b)
+}
+
+// extractEvidence はエラーに付加されたfailure.Contextからエビデンスを作成します
+func extractEvidence(err error, msg string, code failure.Code) *Evidence {
+	type contextGetter interface {
+		GetContext() failure.Context
+	}
+
+	evidence := &Evidence{
+		Timestamp: time.Now(),
+		Message:   msg,
+		Code:      code.ErrorCode(),
+	}
+
+	i := failure.NewIterator(err)
+	for i.Next() {
+		g, ok := i.Error().(contextGetter)
+		if !ok {
+			continue
+		}
+		ctx := g.GetContext()
+		if _, ok := ctx[evidenceKeyMethod]; !ok {
+			continue
+		}
+
+		if t, err := time.Parse(time.RFC3339Nano, ctx[evidenceKeyTimestamp]); err == nil {
+			evidence.Timestamp = t
+		}
+		evidence.Scenario = ctx[evidenceKeyScenario]
+		evidence.Method = ctx[evidenceKeyMethod]
+		evidence.Path = ctx[evidenceKeyPath]
+		evidence.Query = ctx[evidenceKeyQuery]
+		evidence.RequestBody = ctx[evidenceKeyRequestBody]
+		evidence.StatusCode, _ = strconv.Atoi(ctx[evidenceKeyStatus])
+		evidence.ResponseBody = ctx[evidenceKeyResponseBody]
+		break
+	}
+
+	return evidence
+}
+
+// WriteEvidences は各フェーズで集めたエビデンスをJSONLでファイルに書き出します
+func WriteEvidences(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, phase := range []struct {
+		name string
+		errs *BenchErrors
+	}{
+		{"initialize", InitializeErrs},
+		{"pretest", PreTestErrs},
+		{"benchmark", BenchmarkErrs},
+		{"finalcheck", FinalCheckErrs},
+	} {
+		for _, evidence := range phase.errs.Evidences() {
+			if err := enc.Encode(&struct {
+				Phase string `json:"phase"`
+				*Evidence
+			}{phase.name, evidence}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
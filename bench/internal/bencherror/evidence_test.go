@@ -0,0 +1,48 @@
+package bencherror
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEvidence(t *testing.T) {
+	ctx := WithScenario(context.Background(), "NormalScenario")
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/api/train/reserve?foo=bar", strings.NewReader(`{"adult": 1}`))
+	req = req.WithContext(ctx)
+	req.GetBody = func() (body io.ReadCloser, err error) {
+		return ioutil.NopCloser(strings.NewReader(`{"adult": 1}`)), nil
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Body:       NewEvidenceBody([]byte(strings.Repeat("x", maxEvidenceBodyLength+1))),
+	}
+
+	errs := NewBenchErrors()
+	err := errs.AddError(WithEvidence(NewSimpleApplicationError("POST /api/train/reserve: 予約に失敗しました"), req, resp))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"POST /api/train/reserve: 予約に失敗しました"}, errs.Msgs)
+
+	evidences := errs.Evidences()
+	assert.Len(t, evidences, 1)
+	evidence := evidences[0]
+	assert.Equal(t, "NormalScenario", evidence.Scenario)
+	assert.Equal(t, http.MethodPost, evidence.Method)
+	assert.Equal(t, "/api/train/reserve", evidence.Path)
+	assert.Equal(t, "foo=bar", evidence.Query)
+	assert.Equal(t, `{"adult": 1}`, evidence.RequestBody)
+	assert.Equal(t, http.StatusBadRequest, evidence.StatusCode)
+	assert.True(t, strings.HasSuffix(evidence.ResponseBody, "...(truncated)"))
+	assert.Equal(t, "error application", evidence.Code)
+	assert.False(t, evidence.Timestamp.IsZero())
+
+	// タイムアウトはエビデンスとして残さない
+	errs.AddError(WithEvidence(NewTimeoutError(context.DeadlineExceeded, "タイムアウト"), req, nil))
+	assert.Len(t, errs.Evidences(), 1)
+}
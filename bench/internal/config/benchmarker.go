@@ -20,3 +20,11 @@ const (
 var Debug bool
 var SlackWebhookURL string
 var Language = "unknown"
+
+// AdminToken は webapp の管理API (/api/admin/*) のトークンです
+// 空の場合、管理APIを使うシナリオは実行しません
+var AdminToken string
+
+// BenchCommit はベンチマーカーのビルド元のコミットです
+// make build で -ldflags により埋め込まれます
+var BenchCommit = "unknown"
@@ -1,6 +1,20 @@
 package config
 
+import "strings"
+
 var (
+	// TargetBaseURL は負荷走行対象のURLです. カンマ区切りで複数指定できます
 	TargetBaseURL  = "http://localhost"
 	PaymentBaseURL = "http://localhost:5000"
 )
+
+// TargetBaseURLs は、負荷走行対象のURLを指定された順に返します
+func TargetBaseURLs() []string {
+	urls := []string{}
+	for _, u := range strings.Split(TargetBaseURL, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
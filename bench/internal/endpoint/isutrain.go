@@ -2,6 +2,8 @@ package endpoint
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 )
@@ -19,6 +21,12 @@ const (
 	SearchTrains
 	ListTrainSeats
 	ListReservations
+	ChangePassword
+	ChangeEmail
+	DeleteUser
+	UpdateTrainOperation
+	RegisterWaitlist
+	ListWaitlist
 )
 
 var isutrainEndpoints = []*Endpoint{
@@ -33,16 +41,24 @@ var isutrainEndpoints = []*Endpoint{
 	&Endpoint{path: "/api/train/search", weight: 3},
 	&Endpoint{path: "/api/train/seats", weight: 3},
 	&Endpoint{path: "/api/user/reservations", weight: 1},
+	&Endpoint{path: "/api/user/password", weight: 1},
+	&Endpoint{path: "/api/user/email", weight: 1},
+	&Endpoint{path: "/api/user", weight: 1},
+	&Endpoint{path: "/api/admin/operations", weight: 0},
+	&Endpoint{path: "/api/train/waitlist", weight: 1},
+	&Endpoint{path: "/api/user/waitlist", weight: 1},
 }
 
 const (
 	CancelReservation EndpointIdx = iota
 	ShowReservation
+	CancelWaitlist
 )
 
 var isutrainDynamicEndpoints = []*Endpoint{
 	&Endpoint{path: "/api/user/reservations/%d/cancel", weight: 1},
 	&Endpoint{path: "/api/user/reservations/%d", weight: 1},
+	&Endpoint{path: "/api/user/waitlist/%d/cancel", weight: 1},
 }
 
 func GetPath(idx EndpointIdx) string {
@@ -95,3 +111,31 @@ func CalcFinalEndpointCount() (count int64) {
 	}
 	return
 }
+
+// EndpointStat はエンドポイントごとの成功回数とスコアです
+type EndpointStat struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+	Score int64  `json:"score"`
+}
+
+// Stats は、全エンドポイントの成功回数とスコアを返します
+// 動的なパスは、パラメータを {id} に置き換えたパスで返します
+func Stats() []*EndpointStat {
+	stats := []*EndpointStat{}
+	for _, endpoint := range isutrainEndpoints {
+		stats = append(stats, &EndpointStat{
+			Path:  endpoint.path,
+			Count: atomic.LoadInt64(&endpoint.count),
+			Score: endpoint.score(),
+		})
+	}
+	for _, endpoint := range isutrainDynamicEndpoints {
+		stats = append(stats, &EndpointStat{
+			Path:  strings.Replace(endpoint.path, "%d", "{id}", -1),
+			Count: atomic.LoadInt64(&endpoint.count),
+			Score: endpoint.score(),
+		})
+	}
+	return stats
+}
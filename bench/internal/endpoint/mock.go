@@ -2,6 +2,7 @@ package endpoint
 
 const (
 	// Mock
-	IsutrainMockShowReservationPath   = `=~^/api/user/reservations/(\d+)`
-	IsutrainMockCancelReservationPath = `=~^/reservation/(\d+)/cancel\z`
+	IsutrainMockShowReservationPath   = `=~^/api/user/reservations/(\d+)\z`
+	IsutrainMockCancelReservationPath = `=~^/api/user/reservations/(\d+)/cancel\z`
+	IsutrainMockCancelWaitlistPath    = `=~^/api/user/waitlist/(\d+)/cancel\z`
 )
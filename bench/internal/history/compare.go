@@ -0,0 +1,81 @@
+package history
+
+// 成功回数がこの割合以上減ったエンドポイントを、性能が劣化したものとみなす
+const regressionThreshold = 0.05
+
+// EndpointDiff は、2回のベンチマーク結果のエンドポイントごとの差分です
+type EndpointDiff struct {
+	Path   string
+	Before int64
+	After  int64
+	// Regression は、成功回数が regressionThreshold 以上減ったかどうかです
+	Regression bool
+}
+
+// Delta は成功回数の増減です
+func (d *EndpointDiff) Delta() int64 {
+	return d.After - d.Before
+}
+
+// Ratio は成功回数の増減率です. 比較元が0回の場合は0を返します
+func (d *EndpointDiff) Ratio() float64 {
+	if d.Before == 0 {
+		return 0
+	}
+	return float64(d.Delta()) / float64(d.Before)
+}
+
+// Diff は、2回のベンチマーク結果の差分です
+type Diff struct {
+	Before, After *Record
+	Endpoints     []*EndpointDiff
+}
+
+// ScoreDelta はスコアの増減です
+func (d *Diff) ScoreDelta() int64 {
+	return d.After.Score - d.Before.Score
+}
+
+// Regressions は、性能が劣化したエンドポイントを返します
+func (d *Diff) Regressions() []*EndpointDiff {
+	regressions := []*EndpointDiff{}
+	for _, endpoint := range d.Endpoints {
+		if endpoint.Regression {
+			regressions = append(regressions, endpoint)
+		}
+	}
+	return regressions
+}
+
+// Compare は、before から after へのエンドポイントごとの成功回数の変化を算出します
+// エンドポイントは before の順に並べ、after にのみ存在するものは末尾に追加します
+func Compare(before, after *Record) *Diff {
+	var (
+		diffs  = []*EndpointDiff{}
+		byPath = map[string]*EndpointDiff{}
+	)
+	for _, endpoint := range before.Endpoints {
+		diff := &EndpointDiff{Path: endpoint.Path, Before: endpoint.Count}
+		diffs = append(diffs, diff)
+		byPath[endpoint.Path] = diff
+	}
+	for _, endpoint := range after.Endpoints {
+		diff, ok := byPath[endpoint.Path]
+		if !ok {
+			diff = &EndpointDiff{Path: endpoint.Path}
+			diffs = append(diffs, diff)
+			byPath[endpoint.Path] = diff
+		}
+		diff.After = endpoint.Count
+	}
+
+	for _, diff := range diffs {
+		diff.Regression = diff.Before > 0 && diff.Ratio() <= -regressionThreshold
+	}
+
+	return &Diff{
+		Before:    before,
+		After:     after,
+		Endpoints: diffs,
+	}
+}
@@ -0,0 +1,108 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+)
+
+var (
+	ErrRecordNotFound = errors.New("ベンチマーク結果が見つかりませんでした")
+)
+
+// Target はベンチマーク対象のURLと、リクエストの統計です
+type Target struct {
+	URL              string `json:"url"`
+	Requests         int64  `json:"requests"`
+	Failures         int64  `json:"failures"`
+	AvgLatencyMillis int64  `json:"avg_latency_ms"`
+}
+
+// Record は、1回のベンチマーク結果です
+type Record struct {
+	// ID は記録ファイル中の行番号 (1始まり) です. 読み込み時に設定されます
+	ID int `json:"-"`
+
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Label はブランチ名やジョブIDなど、実行を識別するための任意の文字列です
+	Label       string `json:"label"`
+	BenchCommit string `json:"bench_commit"`
+
+	Pass      bool                     `json:"pass"`
+	Score     int64                    `json:"score"`
+	Messages  []string                 `json:"messages"`
+	Endpoints []*endpoint.EndpointStat `json:"endpoints"`
+	Targets   []*Target                `json:"targets"`
+}
+
+// Append は、ベンチマーク結果を記録ファイルにJSONLで追記します
+func Append(path string, record *Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Load は、記録ファイルから全てのベンチマーク結果を古い順に読み込みます
+func Load(path string) ([]*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := []*Record{}
+	scanner := bufio.NewScanner(f)
+	// メッセージが多い結果に備えて、1行の上限を引き上げる
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record *Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		record.ID = line
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Find は、IDに一致するベンチマーク結果を返します
+// IDが0以下の場合は、最新から数えた結果を返します (0が最新、-1がその一つ前)
+func Find(records []*Record, id int) (*Record, error) {
+	if id <= 0 {
+		idx := len(records) - 1 + id
+		if idx < 0 || idx >= len(records) {
+			return nil, ErrRecordNotFound
+		}
+		return records[idx], nil
+	}
+
+	for _, record := range records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+	return nil, ErrRecordNotFound
+}
@@ -0,0 +1,79 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bench-history")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	for _, label := range []string{"first", "second", "third"} {
+		assert.NoError(t, Append(path, &Record{Label: label, Pass: true, Score: 100}))
+	}
+
+	records, err := Load(path)
+	if !assert.NoError(t, err) || !assert.Len(t, records, 3) {
+		return
+	}
+	assert.Equal(t, 1, records[0].ID)
+	assert.Equal(t, "first", records[0].Label)
+
+	record, err := Find(records, 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "second", record.Label)
+	}
+	record, err = Find(records, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "third", record.Label, "0は最新")
+	}
+	record, err = Find(records, -1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "second", record.Label, "-1は最新の一つ前")
+	}
+	_, err = Find(records, 4)
+	assert.Equal(t, ErrRecordNotFound, err)
+	_, err = Find(records, -3)
+	assert.Equal(t, ErrRecordNotFound, err)
+}
+
+func TestCompare(t *testing.T) {
+	before := &Record{
+		Score: 1000,
+		Endpoints: []*endpoint.EndpointStat{
+			{Path: "/api/train/search", Count: 100},
+			{Path: "/api/train/reserve", Count: 100},
+			{Path: "/api/stations", Count: 0},
+		},
+	}
+	after := &Record{
+		Score: 900,
+		Endpoints: []*endpoint.EndpointStat{
+			{Path: "/api/train/search", Count: 120},
+			{Path: "/api/train/reserve", Count: 95},
+			{Path: "/api/stations", Count: 10},
+			{Path: "/api/user/reservations/{id}", Count: 5},
+		},
+	}
+
+	diff := Compare(before, after)
+	assert.Equal(t, int64(-100), diff.ScoreDelta())
+	if assert.Len(t, diff.Endpoints, 4) {
+		assert.Equal(t, &EndpointDiff{Path: "/api/train/search", Before: 100, After: 120}, diff.Endpoints[0])
+		assert.Equal(t, &EndpointDiff{Path: "/api/train/reserve", Before: 100, After: 95, Regression: true}, diff.Endpoints[1])
+		assert.Equal(t, &EndpointDiff{Path: "/api/stations", Before: 0, After: 10}, diff.Endpoints[2])
+		assert.Equal(t, &EndpointDiff{Path: "/api/user/reservations/{id}", Before: 0, After: 5}, diff.Endpoints[3])
+	}
+	assert.Len(t, diff.Regressions(), 1)
+	assert.InDelta(t, -0.05, diff.Endpoints[1].Ratio(), 1e-9)
+}
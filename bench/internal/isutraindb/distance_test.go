@@ -7,8 +7,8 @@ import (
 )
 
 func TestGetDistanceFare(t *testing.T) {
-	for station1 := range distanceMap {
-		for station2 := range distanceMap {
+	for station1 := range stationMap {
+		for station2 := range stationMap {
 			if station1 == station2 {
 				continue
 			}
@@ -23,8 +23,8 @@ func TestGetDistanceFare(t *testing.T) {
 }
 
 func TestGetDistance(t *testing.T) {
-	for station1 := range distanceMap {
-		for station2 := range distanceMap {
+	for station1 := range stationMap {
+		for station2 := range stationMap {
 			if station1 == station2 {
 				continue
 			}
@@ -34,3 +34,32 @@ func TestGetDistance(t *testing.T) {
 		}
 	}
 }
+
+func TestGetDistanceFare_Boundary(t *testing.T) {
+	tests := []struct {
+		distance float64
+		want     int
+	}{
+		{distance: 49.9, want: 2500},
+		{distance: 50, want: 3000},
+		{distance: 74.9, want: 3000},
+		{distance: 75, want: 3700},
+		{distance: 1000, want: 20000},
+		{distance: 1024.983484, want: 20000},
+	}
+
+	origStationMap := stationMap
+	defer func() {
+		stationMap = origStationMap
+	}()
+
+	for _, tt := range tests {
+		stationMap = map[string]*Station{
+			"A": &Station{Name: "A", Distance: 0},
+			"B": &Station{Name: "B", Distance: tt.distance},
+		}
+		fare, err := GetDistanceFare("A", "B")
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, fare, "distance=%f", tt.distance)
+	}
+}
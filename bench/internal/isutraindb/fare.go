@@ -6,82 +6,43 @@ import (
 	"go.uber.org/zap"
 )
 
-type FareMultiplierQuery struct {
-	TrainClass string
-	SeatClass  string
-}
-
-var (
-	fareMultiplierMap = map[FareMultiplierQuery]float64{
-		FareMultiplierQuery{TrainClass: "最速", SeatClass: "premium"}:        3.0,
-		FareMultiplierQuery{TrainClass: "最速", SeatClass: "reserved"}:       1.875,
-		FareMultiplierQuery{TrainClass: "最速", SeatClass: "non-reserved"}:   1.5,
-		FareMultiplierQuery{TrainClass: "中間", SeatClass: "premium"}:        2.0,
-		FareMultiplierQuery{TrainClass: "中間", SeatClass: "reserved"}:       1.25,
-		FareMultiplierQuery{TrainClass: "中間", SeatClass: "non-reserved"}:   1.0,
-		FareMultiplierQuery{TrainClass: "遅いやつ", SeatClass: "premium"}:      1.6,
-		FareMultiplierQuery{TrainClass: "遅いやつ", SeatClass: "reserved"}:     1.0,
-		FareMultiplierQuery{TrainClass: "遅いやつ", SeatClass: "non-reserved"}: 0.8,
-	}
+//go:generate go run ./gen -sqldir ../../../webapp/sql -o master_gen.go
 
-	seasons = []time.Time{
-		// 正月
-		time.Date(2020, 1, 01, 0, 0, 0, 0, time.UTC),
-		time.Date(2020, 1, 06, 0, 0, 0, 0, time.UTC),
-		// 春休み
-		time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC),
-		time.Date(2020, 4, 01, 0, 0, 0, 0, time.UTC),
-		// GW
-		time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC),
-		time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC),
-		// 夏休み
-		time.Date(2020, 8, 07, 0, 0, 0, 0, time.UTC),
-		time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC),
-		// 年越し
-		time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC),
-	}
-)
+// Fare は fare_master の運賃倍率です
+type Fare struct {
+	TrainClass     string
+	SeatClass      string
+	StartDate      time.Time
+	FareMultiplier float64
+}
 
 // GetFareMultiplier は列車や座席種別、期間倍率を元に、運賃倍率を返します
+// 適用開始日が利用日以前となる中で、最も新しい倍率になります
 func GetFareMultiplier(trainClass, seatClass string, useAt time.Time) float64 {
 	lgr := zap.S()
 
-	// FIXME: ok チェック
-	fareMultiplier := fareMultiplierMap[FareMultiplierQuery{TrainClass: trainClass, SeatClass: seatClass}]
-
-	var seasonMultiplier float64
-	switch {
-	case !useAt.Before(seasons[0]) && useAt.Before(seasons[1]):
-		seasonMultiplier = 5.0
-	case !useAt.Before(seasons[1]) && useAt.Before(seasons[2]):
-		seasonMultiplier = 1.0
-	case !useAt.Before(seasons[2]) && useAt.Before(seasons[3]):
-		seasonMultiplier = 3.0
-	case !useAt.Before(seasons[3]) && useAt.Before(seasons[4]):
-		seasonMultiplier = 1.0
-	case !useAt.Before(seasons[4]) && useAt.Before(seasons[5]):
-		seasonMultiplier = 5.0
-	case !useAt.Before(seasons[5]) && useAt.Before(seasons[6]):
-		seasonMultiplier = 1.0
-	case !useAt.Before(seasons[6]) && useAt.Before(seasons[7]):
-		seasonMultiplier = 3.0
-	case !useAt.Before(seasons[7]) && useAt.Before(seasons[8]):
-		seasonMultiplier = 1.0
-	case !useAt.Before(seasons[8]):
-		seasonMultiplier = 5.0
+	var fareMultiplier float64
+	for _, fare := range fareMaster {
+		if fare.TrainClass != trainClass || fare.SeatClass != seatClass {
+			continue
+		}
+		if useAt.Before(fare.StartDate) {
+			continue
+		}
+		fareMultiplier = fare.FareMultiplier
 	}
 
-	if fareMultiplier == 0 || seasonMultiplier == 0 {
-		lgr.Warnw("運賃倍率もしくは期間倍率が不正です",
-			"fare_multiplier", fareMultiplier,
-			"season_multiplier", seasonMultiplier,
+	if fareMultiplier == 0 {
+		lgr.Warnw("運賃倍率が不正です",
+			"train_class", trainClass,
+			"seat_class", seatClass,
+			"use_at", useAt,
 		)
 	}
 
-	return fareMultiplier * seasonMultiplier
+	return fareMultiplier
 }
 
-
 func GetFare(reservationID int, t time.Time, departure, arrival string, trainClass, seatClass string) (int, error) {
 	var (
 		date              = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
@@ -107,4 +68,4 @@ func GetFare(reservationID int, t time.Time, departure, arrival string, trainCla
 	)
 
 	return int(float64(distanceFare) * fareMultiplier), nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,77 @@
+// gen は、webappのマスタデータ (webapp/sql/*.sql) から isutraindb のマスタデータを生成します
+//
+//	$ go generate ./internal/isutraindb
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb/sqlmaster"
+)
+
+func main() {
+	var (
+		sqlDir = flag.String("sqldir", "../../../webapp/sql", "webappのSQLディレクトリ")
+		output = flag.String("o", "master_gen.go", "出力ファイル")
+	)
+	flag.Parse()
+
+	stations, err := sqlmaster.LoadStations(*sqlDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fares, err := sqlmaster.LoadFares(*sqlDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	distanceFares, err := sqlmaster.LoadDistanceFares(*sqlDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by gen/main.go from webapp/sql. DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package isutraindb")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, `import "time"`)
+	fmt.Fprintln(&buf)
+
+	fmt.Fprintf(&buf, "// stationMaster は %s の station_master です\n", sqlmaster.StationFile)
+	fmt.Fprintln(&buf, "var stationMaster = []*Station{")
+	for i, station := range stations {
+		fmt.Fprintf(&buf, "{ID: %d, Name: %q, Distance: %f, StopInfo: StopInfo{IsStopExpress: %t, IsStopSemiExpress: %t, IsStopLocal: %t}},\n",
+			i+1, station.Name, station.Distance, station.IsStopExpress, station.IsStopSemiExpress, station.IsStopLocal)
+	}
+	fmt.Fprintln(&buf, "}")
+	fmt.Fprintln(&buf)
+
+	fmt.Fprintf(&buf, "// fareMaster は %s の fare_master です\n", sqlmaster.FareFile)
+	fmt.Fprintln(&buf, "var fareMaster = []*Fare{")
+	for _, fare := range fares {
+		fmt.Fprintf(&buf, "{TrainClass: %q, SeatClass: %q, StartDate: time.Date(%d, %d, %d, 0, 0, 0, 0, time.UTC), FareMultiplier: %.3f},\n",
+			fare.TrainClass, fare.SeatClass, fare.StartDate.Year(), fare.StartDate.Month(), fare.StartDate.Day(), fare.FareMultiplier)
+	}
+	fmt.Fprintln(&buf, "}")
+	fmt.Fprintln(&buf)
+
+	fmt.Fprintf(&buf, "// distanceFareMaster は %s の distance_fare_master です\n", sqlmaster.DistanceFareFile)
+	fmt.Fprintln(&buf, "var distanceFareMaster = []*DistanceFare{")
+	for _, distanceFare := range distanceFares {
+		fmt.Fprintf(&buf, "{Distance: %f, Fare: %d},\n", distanceFare.Distance, distanceFare.Fare)
+	}
+	fmt.Fprintln(&buf, "}")
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*output, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
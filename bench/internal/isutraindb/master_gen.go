@@ -0,0 +1,190 @@
+// Code generated by gen/main.go from webapp/sql. DO NOT EDIT.
+
+package isutraindb
+
+import "time"
+
+// stationMaster は 91_station.sql の station_master です
+var stationMaster = []*Station{
+	{ID: 1, Name: "東京", Distance: 0.000000, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 2, Name: "古岡", Distance: 12.745608, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 3, Name: "絵寒町", Distance: 32.107649, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 4, Name: "沙芦公園", Distance: 45.037138, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 5, Name: "形顔", Distance: 52.773422, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 6, Name: "油交", Distance: 60.930427, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 7, Name: "通墨山", Distance: 72.915666, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 8, Name: "初野", Distance: 80.517696, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 9, Name: "樺威学園", Distance: 96.053004, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 10, Name: "塩鮫公園", Distance: 112.665386, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 11, Name: "山田", Distance: 119.444708, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 12, Name: "表岡", Distance: 131.462232, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 13, Name: "並取", Distance: 149.826976, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 14, Name: "細野", Distance: 166.909255, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 15, Name: "住郷", Distance: 182.323457, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 16, Name: "管英", Distance: 188.887999, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 17, Name: "気川", Distance: 207.599747, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 18, Name: "桐飛", Distance: 217.900353, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 19, Name: "樫曲町", Distance: 229.697609, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 20, Name: "依酒山", Distance: 244.770170, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 21, Name: "堀切町", Distance: 251.948590, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 22, Name: "葉千", Distance: 269.009280, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 23, Name: "奥山", Distance: 275.384825, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 24, Name: "鯉秋寺", Distance: 284.952294, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 25, Name: "伍出", Distance: 291.499545, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 26, Name: "杏高公園", Distance: 310.086023, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 27, Name: "荒川", Distance: 325.553902, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 28, Name: "磯川", Distance: 334.561908, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 29, Name: "茶川", Distance: 343.842013, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 30, Name: "八実学園", Distance: 355.192588, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 31, Name: "梓金", Distance: 374.584703, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 32, Name: "鯉田", Distance: 381.847874, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 33, Name: "鳴門", Distance: 393.244289, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 34, Name: "曲徳町", Distance: 411.802367, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 35, Name: "彩岬山", Distance: 420.375925, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 36, Name: "根永", Distance: 428.829478, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 37, Name: "鹿近川", Distance: 445.676144, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 38, Name: "結広", Distance: 457.246917, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 39, Name: "庵金公園", Distance: 474.044387, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 40, Name: "近岡", Distance: 487.270404, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 41, Name: "威香", Distance: 504.163580, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 42, Name: "名古屋", Distance: 519.612391, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 43, Name: "錦太学園", Distance: 531.408202, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 44, Name: "和錦台", Distance: 548.584849, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 45, Name: "稲冬台", Distance: 554.215596, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 46, Name: "松港山", Distance: 572.885503, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 47, Name: "甘桜", Distance: 584.344724, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 48, Name: "根左海岸", Distance: 603.713433, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 49, Name: "島威寺", Distance: 614.711098, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 50, Name: "月朱野", Distance: 633.406177, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 51, Name: "芋呉川", Distance: 640.097895, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 52, Name: "木南", Distance: 657.573946, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 53, Name: "鳩平ヶ丘", Distance: 677.211495, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 54, Name: "維荻学園", Distance: 689.581633, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 55, Name: "保池", Distance: 696.405431, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 56, Name: "九野", Distance: 711.087956, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 57, Name: "桜田", Distance: 728.268005, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 58, Name: "霞苑野", Distance: 735.983348, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 59, Name: "夷太寺", Distance: 744.581560, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 60, Name: "甘野", Distance: 751.340202, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 61, Name: "遠山", Distance: 770.125141, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 62, Name: "銀正", Distance: 788.163214, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 63, Name: "末国", Distance: 799.939778, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 64, Name: "泉別川", Distance: 807.476895, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 65, Name: "京都", Distance: 819.772794, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 66, Name: "桜内", Distance: 833.349255, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 67, Name: "荻葛ヶ丘", Distance: 839.298450, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 68, Name: "雨墨", Distance: 853.080719, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 69, Name: "桂綾寺", Distance: 863.842723, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 70, Name: "宇治", Distance: 869.266132, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 71, Name: "塚手海岸", Distance: 878.247393, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 72, Name: "垣通海岸", Distance: 893.724394, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 73, Name: "雨稲ヶ丘", Distance: 900.098745, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 74, Name: "森果川", Distance: 909.518544, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 75, Name: "舟田", Distance: 919.249073, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 76, Name: "形利", Distance: 938.540025, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 77, Name: "午万台", Distance: 954.151248, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 78, Name: "早森野", Distance: 966.498192, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true}},
+	{ID: 79, Name: "桐氷野", Distance: 975.568259, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 80, Name: "条川", Distance: 990.339004, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 81, Name: "菊岡", Distance: 1005.597665, StopInfo: StopInfo{IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true}},
+	{ID: 82, Name: "大阪", Distance: 1024.983484, StopInfo: StopInfo{IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true}},
+}
+
+// fareMaster は 92_fare.sql の fare_master です
+var fareMaster = []*Fare{
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 15.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 9.375},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 7.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 10.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 6.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 8.000},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.000},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.875},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.600},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), FareMultiplier: 0.800},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 9.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.625},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 6.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.750},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.800},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 3, 13, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.400},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.875},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.600},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), FareMultiplier: 0.800},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 15.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 9.375},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 7.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 10.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 6.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 8.000},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 4, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.000},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.875},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.600},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 5, 11, 0, 0, 0, 0, time.UTC), FareMultiplier: 0.800},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 9.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.625},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 6.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.750},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.800},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 7, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.400},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 3.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.875},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 2.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.600},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 1.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 8, 24, 0, 0, 0, 0, time.UTC), FareMultiplier: 0.800},
+	{TrainClass: "最速", SeatClass: "premium", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 15.000},
+	{TrainClass: "最速", SeatClass: "reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 9.375},
+	{TrainClass: "最速", SeatClass: "non-reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 7.500},
+	{TrainClass: "中間", SeatClass: "premium", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 10.000},
+	{TrainClass: "中間", SeatClass: "reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 6.250},
+	{TrainClass: "中間", SeatClass: "non-reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "premium", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 8.000},
+	{TrainClass: "遅いやつ", SeatClass: "reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 5.000},
+	{TrainClass: "遅いやつ", SeatClass: "non-reserved", StartDate: time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), FareMultiplier: 4.000},
+}
+
+// distanceFareMaster は 99_fixture.sql の distance_fare_master です
+var distanceFareMaster = []*DistanceFare{
+	{Distance: 0.000000, Fare: 2500},
+	{Distance: 50.000000, Fare: 3000},
+	{Distance: 75.000000, Fare: 3700},
+	{Distance: 100.000000, Fare: 4500},
+	{Distance: 150.000000, Fare: 5200},
+	{Distance: 200.000000, Fare: 6000},
+	{Distance: 300.000000, Fare: 7200},
+	{Distance: 400.000000, Fare: 8300},
+	{Distance: 500.000000, Fare: 12000},
+	{Distance: 1000.000000, Fare: 20000},
+}
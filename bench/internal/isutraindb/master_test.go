@@ -0,0 +1,98 @@
+package isutraindb
+
+import (
+	"testing"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb/sqlmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+// webappのマスタデータ
+// NOTE: 食い違った場合は go generate ./internal/isutraindb で再生成してください
+const webappSQLDir = "../../../webapp/sql"
+
+func TestMaster_Station(t *testing.T) {
+	stations, err := sqlmaster.LoadStations(webappSQLDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.Len(t, stationMaster, len(stations)) {
+		return
+	}
+	for i, station := range stations {
+		assert.Equal(t, &Station{
+			ID:       i + 1,
+			Name:     station.Name,
+			Distance: station.Distance,
+			StopInfo: StopInfo{
+				IsStopExpress:     station.IsStopExpress,
+				IsStopSemiExpress: station.IsStopSemiExpress,
+				IsStopLocal:       station.IsStopLocal,
+			},
+		}, stationMaster[i])
+	}
+}
+
+func TestMaster_Fare(t *testing.T) {
+	fares, err := sqlmaster.LoadFares(webappSQLDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.Len(t, fareMaster, len(fares)) {
+		return
+	}
+	for i, fare := range fares {
+		assert.Equal(t, &Fare{
+			TrainClass:     fare.TrainClass,
+			SeatClass:      fare.SeatClass,
+			StartDate:      fare.StartDate,
+			FareMultiplier: fare.FareMultiplier,
+		}, fareMaster[i])
+	}
+}
+
+func TestMaster_DistanceFare(t *testing.T) {
+	distanceFares, err := sqlmaster.LoadDistanceFares(webappSQLDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !assert.Len(t, distanceFareMaster, len(distanceFares)) {
+		return
+	}
+	for i, distanceFare := range distanceFares {
+		assert.Equal(t, &DistanceFare{
+			Distance: distanceFare.Distance,
+			Fare:     distanceFare.Fare,
+		}, distanceFareMaster[i])
+	}
+}
+
+func TestMaster_Seat(t *testing.T) {
+	seats, err := sqlmaster.LoadSeats(webappSQLDir)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	type seatKey struct {
+		trainClass string
+		carNum     int
+	}
+	want := map[seatKey][]*Seat{}
+	for _, seat := range seats {
+		key := seatKey{trainClass: seat.TrainClass, carNum: seat.CarNumber}
+		want[key] = append(want[key], &Seat{
+			Row:           seat.SeatRow,
+			Column:        seat.SeatColumn,
+			SeatClass:     seat.SeatClass,
+			IsSmokingSeat: seat.IsSmokingSeat,
+		})
+	}
+
+	for key, wantSeats := range want {
+		assert.Equal(t, wantSeats[0].SeatClass, GetSeatClass(key.trainClass, key.carNum), "%s %d号車", key.trainClass, key.carNum)
+		assert.ElementsMatch(t, wantSeats, GetSeats(key.trainClass, key.carNum), "%s %d号車", key.trainClass, key.carNum)
+	}
+}
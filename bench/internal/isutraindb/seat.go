@@ -106,3 +106,59 @@ func GetSeatClass(trainClass string, carNum int) string {
 		return ""
 	}
 }
+
+// 号車ごとの座席の列数 (seat_master)
+// NOTE: 列車種別によらず共通
+var carRowsMap = map[int]int{
+	1: 13, 2: 20, 3: 16, 4: 20, 5: 16, 6: 20, 7: 16, 8: 17,
+	9: 17, 10: 17, 11: 16, 12: 20, 13: 16, 14: 20, 15: 16, 16: 13,
+}
+
+// GetCarRows は、号車の座席の列数を返します
+func GetCarRows(carNum int) int {
+	return carRowsMap[carNum]
+}
+
+// 16列の号車は、11列目以降が喫煙席
+const smokingSeatRowFrom = 11
+
+var (
+	seatColumns        = []string{"A", "B", "C", "D", "E"}
+	premiumSeatColumns = []string{"A", "B", "C", "D"}
+)
+
+// Seat は seat_master の座席情報です
+type Seat struct {
+	Row           int
+	Column        string
+	SeatClass     string
+	IsSmokingSeat bool
+}
+
+// GetSeats は、列車クラスと車両番号から、号車の座席一覧を列・席の順に返します
+func GetSeats(trainClass string, carNum int) []*Seat {
+	rows, ok := carRowsMap[carNum]
+	if !ok {
+		return []*Seat{}
+	}
+
+	seatClass := GetSeatClass(trainClass, carNum)
+	columns := seatColumns
+	if seatClass == "premium" {
+		columns = premiumSeatColumns
+	}
+
+	seats := make([]*Seat, 0, rows*len(columns))
+	for row := 1; row <= rows; row++ {
+		for _, column := range columns {
+			seats = append(seats, &Seat{
+				Row:           row,
+				Column:        column,
+				SeatClass:     seatClass,
+				IsSmokingSeat: rows == 16 && row >= smokingSeatRowFrom,
+			})
+		}
+	}
+
+	return seats
+}
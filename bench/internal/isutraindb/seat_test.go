@@ -28,3 +28,20 @@ func TestGetSeatClass(t *testing.T) {
 	assert.Equal(t, 19, seatClassCounter["reserved"])
 	assert.Equal(t, 9, seatClassCounter["premium"])
 }
+
+func TestGetSeats(t *testing.T) {
+	seats := GetSeats("最速", 3)
+	assert.Len(t, seats, 16*5)
+	assert.Equal(t, "non-reserved", seats[0].SeatClass)
+	assert.False(t, seats[10*5-1].IsSmokingSeat)
+	assert.True(t, seats[10*5].IsSmokingSeat)
+
+	seats = GetSeats("中間", 8)
+	assert.Len(t, seats, 17*4)
+	for _, seat := range seats {
+		assert.Equal(t, "premium", seat.SeatClass)
+		assert.False(t, seat.IsSmokingSeat)
+	}
+
+	assert.Empty(t, GetSeats("最速", 17))
+}
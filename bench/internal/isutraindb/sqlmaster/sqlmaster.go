@@ -0,0 +1,418 @@
+// Package sqlmaster は、webappのマスタデータ (webapp/sql/*.sql) を読み込みます
+// ベンチマーカーの isutraindb は、このパッケージで読み込んだ内容から生成されます
+package sqlmaster
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// マスタデータのファイル名
+const (
+	StationFile      = "91_station.sql"
+	FareFile         = "92_fare.sql"
+	SeatFile         = "93_seat.sql"
+	DistanceFareFile = "99_fixture.sql"
+
+	// NOTE: 列車と時刻表はfixture_generator.pyで生成され、リポジトリには含まれません
+	TrainFile                 = "90_train.sql"
+	TrainTimetableFilePattern = "94_*_train_timetable.sql"
+)
+
+// ParseClock は "15:04:05" 形式の時刻を、0時からの経過時間として返します
+func ParseClock(s string) (time.Duration, error) {
+	var h, m, sec int
+	if _, err := fmt.Sscanf(s, "%d:%d:%d", &h, &m, &sec); err != nil {
+		return 0, fmt.Errorf("時刻の形式が不正です: %s", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, nil
+}
+
+type Station struct {
+	Name              string
+	Distance          float64
+	IsStopExpress     bool
+	IsStopSemiExpress bool
+	IsStopLocal       bool
+}
+
+type Fare struct {
+	TrainClass     string
+	SeatClass      string
+	StartDate      time.Time
+	FareMultiplier float64
+}
+
+type DistanceFare struct {
+	Distance float64
+	Fare     int
+}
+
+// Train は train_master の列車です
+type Train struct {
+	Date         time.Time
+	DepartureAt  time.Duration
+	TrainClass   string
+	TrainName    string
+	StartStation string
+	LastStation  string
+	IsNobori     bool
+}
+
+// TrainTimetable は train_timetable_master の停車駅の時刻です
+type TrainTimetable struct {
+	Date       time.Time
+	TrainClass string
+	TrainName  string
+	Station    string
+	Arrival    time.Duration
+	Departure  time.Duration
+}
+
+type Seat struct {
+	TrainClass    string
+	CarNumber     int
+	SeatColumn    string
+	SeatRow       int
+	SeatClass     string
+	IsSmokingSeat bool
+}
+
+var insertRe = regexp.MustCompile(`INSERT INTO\s+` + "`?" + `(\w+)` + "`?" + `\s*\(([^)]*)\)\s*VALUES(.*)`)
+
+// row はINSERT文の1行分の値です
+type row struct {
+	columns map[string]int
+	values  []string
+}
+
+func (r *row) str(column string) (string, error) {
+	i, ok := r.columns[column]
+	if !ok {
+		return "", fmt.Errorf("カラム %s がありません", column)
+	}
+	return r.values[i], nil
+}
+
+func (r *row) int(column string) (int, error) {
+	v, err := r.str(column)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
+
+func (r *row) float(column string) (float64, error) {
+	v, err := r.str(column)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(v, 64)
+}
+
+// date は "2006-01-02" 形式の日付を、UTCの0時として返します
+func (r *row) date(column string) (time.Time, error) {
+	v, err := r.str(column)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse("2006-01-02", strings.Replace(v, "/", "-", -1))
+}
+
+// clock は "15:04:05" 形式の時刻を、0時からの経過時間として返します
+func (r *row) clock(column string) (time.Duration, error) {
+	v, err := r.str(column)
+	if err != nil {
+		return 0, err
+	}
+	return ParseClock(v)
+}
+
+func (r *row) bool(column string) (bool, error) {
+	v, err := r.int(column)
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// scanRows はSQLファイルから、テーブルへのINSERT文の値を1行ずつ読み込みます
+// NOTE: 列車の時刻表など巨大なファイルも扱うため、ファイル全体をメモリに載せずに読み込みます
+func scanRows(path, table string, f func(r *row) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var (
+		scanner = bufio.NewScanner(file)
+		columns map[string]int
+		count   int
+	)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := insertRe.FindStringSubmatch(line); m != nil {
+			columns = nil
+			if m[1] == table {
+				columns = map[string]int{}
+				for i, column := range splitValues(m[2]) {
+					columns[column] = i
+				}
+			}
+			line = m[3]
+		}
+		if columns == nil {
+			continue
+		}
+
+		for rest := line; ; {
+			begin := strings.Index(rest, "(")
+			if begin < 0 {
+				break
+			}
+			end := strings.Index(rest[begin:], ")")
+			if end < 0 {
+				return fmt.Errorf("%s: 値が閉じられていません: %s", path, line)
+			}
+			values := splitValues(rest[begin+1 : begin+end])
+			if len(values) != len(columns) {
+				return fmt.Errorf("%s: カラム数と値の数が一致しません: %s", path, line)
+			}
+			if err := f(&row{columns: columns, values: values}); err != nil {
+				return fmt.Errorf("%s: %s: %s", path, line, err.Error())
+			}
+			count++
+			rest = rest[begin+end+1:]
+		}
+
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			columns = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s: %s へのINSERT文がありません", path, table)
+	}
+
+	return nil
+}
+
+func splitValues(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		values = append(values, strings.Trim(strings.TrimSpace(v), "\"'`"))
+	}
+	return values
+}
+
+// LoadStations は station_master を、ID順に読み込みます
+func LoadStations(sqlDir string) ([]*Station, error) {
+	stations := []*Station{}
+	err := scanRows(filepath.Join(sqlDir, StationFile), "station_master", func(r *row) error {
+		var (
+			station = &Station{}
+			err     error
+		)
+		if station.Name, err = r.str("name"); err != nil {
+			return err
+		}
+		if station.Distance, err = r.float("distance"); err != nil {
+			return err
+		}
+		if station.IsStopExpress, err = r.bool("is_stop_express"); err != nil {
+			return err
+		}
+		if station.IsStopSemiExpress, err = r.bool("is_stop_semi_express"); err != nil {
+			return err
+		}
+		if station.IsStopLocal, err = r.bool("is_stop_local"); err != nil {
+			return err
+		}
+		stations = append(stations, station)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stations, nil
+}
+
+// LoadFares は fare_master を読み込みます
+func LoadFares(sqlDir string) ([]*Fare, error) {
+	fares := []*Fare{}
+	err := scanRows(filepath.Join(sqlDir, FareFile), "fare_master", func(r *row) error {
+		var (
+			fare = &Fare{}
+			err  error
+		)
+		if fare.TrainClass, err = r.str("train_class"); err != nil {
+			return err
+		}
+		if fare.SeatClass, err = r.str("seat_class"); err != nil {
+			return err
+		}
+		if fare.StartDate, err = r.date("start_date"); err != nil {
+			return err
+		}
+		if fare.FareMultiplier, err = r.float("fare_multiplier"); err != nil {
+			return err
+		}
+		fares = append(fares, fare)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fares, nil
+}
+
+// LoadDistanceFares は distance_fare_master を読み込みます
+func LoadDistanceFares(sqlDir string) ([]*DistanceFare, error) {
+	distanceFares := []*DistanceFare{}
+	err := scanRows(filepath.Join(sqlDir, DistanceFareFile), "distance_fare_master", func(r *row) error {
+		var (
+			distanceFare = &DistanceFare{}
+			err          error
+		)
+		if distanceFare.Distance, err = r.float("distance"); err != nil {
+			return err
+		}
+		if distanceFare.Fare, err = r.int("fare"); err != nil {
+			return err
+		}
+		distanceFares = append(distanceFares, distanceFare)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return distanceFares, nil
+}
+
+// LoadSeats は seat_master を読み込みます
+func LoadSeats(sqlDir string) ([]*Seat, error) {
+	seats := []*Seat{}
+	err := scanRows(filepath.Join(sqlDir, SeatFile), "seat_master", func(r *row) error {
+		var (
+			seat = &Seat{}
+			err  error
+		)
+		if seat.TrainClass, err = r.str("train_class"); err != nil {
+			return err
+		}
+		if seat.CarNumber, err = r.int("car_number"); err != nil {
+			return err
+		}
+		if seat.SeatColumn, err = r.str("seat_column"); err != nil {
+			return err
+		}
+		if seat.SeatRow, err = r.int("seat_row"); err != nil {
+			return err
+		}
+		if seat.SeatClass, err = r.str("seat_class"); err != nil {
+			return err
+		}
+		if seat.IsSmokingSeat, err = r.bool("is_smoking_seat"); err != nil {
+			return err
+		}
+		seats = append(seats, seat)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return seats, nil
+}
+
+// ScanTrains は train_master を1件ずつ読み込みます
+func ScanTrains(fixtureDir string, f func(train *Train) error) error {
+	return scanRows(filepath.Join(fixtureDir, TrainFile), "train_master", func(r *row) error {
+		var (
+			train = &Train{}
+			err   error
+		)
+		if train.Date, err = r.date("date"); err != nil {
+			return err
+		}
+		if train.DepartureAt, err = r.clock("departure_at"); err != nil {
+			return err
+		}
+		if train.TrainClass, err = r.str("train_class"); err != nil {
+			return err
+		}
+		if train.TrainName, err = r.str("train_name"); err != nil {
+			return err
+		}
+		if train.StartStation, err = r.str("start_station"); err != nil {
+			return err
+		}
+		if train.LastStation, err = r.str("last_station"); err != nil {
+			return err
+		}
+		if train.IsNobori, err = r.bool("is_nobori"); err != nil {
+			return err
+		}
+		return f(train)
+	})
+}
+
+// ScanTrainTimetables は train_timetable_master を1件ずつ読み込みます
+// NOTE: 時刻表は複数のファイルに分割されているため、ファイル名順に読み込みます
+func ScanTrainTimetables(fixtureDir string, f func(timetable *TrainTimetable) error) error {
+	paths, err := filepath.Glob(filepath.Join(fixtureDir, TrainTimetableFilePattern))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%s: 時刻表のファイルがありません", fixtureDir)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		err := scanRows(path, "train_timetable_master", func(r *row) error {
+			var (
+				timetable = &TrainTimetable{}
+				err       error
+			)
+			if timetable.Date, err = r.date("date"); err != nil {
+				return err
+			}
+			if timetable.TrainClass, err = r.str("train_class"); err != nil {
+				return err
+			}
+			if timetable.TrainName, err = r.str("train_name"); err != nil {
+				return err
+			}
+			if timetable.Station, err = r.str("station"); err != nil {
+				return err
+			}
+			if timetable.Arrival, err = r.clock("arrival"); err != nil {
+				return err
+			}
+			if timetable.Departure, err = r.clock("departure"); err != nil {
+				return err
+			}
+			return f(timetable)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,8 @@
+use isutrain;
+SET CHARACTER_SET_CLIENT = utf8;
+SET CHARACTER_SET_CONNECTION = utf8;
+
+INSERT INTO train_master(date,train_class,train_name,departure_at,start_station,last_station,is_nobori) VALUES
+	("2020-01-01","遅いやつ",1,"06:00:00","東京","油交","0"),
+	("2020-01-01","遅いやつ",2,"06:00:00","油交","東京","1"),
+	("2020-01-02","遅いやつ",1,"06:10:00","東京","形顔","0");
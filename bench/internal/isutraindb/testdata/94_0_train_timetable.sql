@@ -0,0 +1,14 @@
+use isutrain;
+SET CHARACTER_SET_CLIENT = utf8;
+SET CHARACTER_SET_CONNECTION = utf8;
+
+INSERT INTO train_timetable_master(date,train_class,train_name,station,arrival,departure) VALUES
+	("2020-01-01","遅いやつ","1","東京","06:00:00","06:02:00"),
+	("2020-01-01","遅いやつ","1","古岡","06:08:23","06:10:23"),
+	("2020-01-01","遅いやつ","1","絵寒町","06:20:04","06:22:04"),
+	("2020-01-01","遅いやつ","1","沙芦公園","06:29:51","06:31:51"),
+	("2020-01-01","遅いやつ","1","形顔","06:36:30","06:38:30"),
+	("2020-01-01","遅いやつ","1","油交","06:43:26","06:45:26"),
+	("2020-01-01","遅いやつ","2","東京","06:00:00","06:02:00"),
+	("2020-01-01","遅いやつ","2","古岡","06:08:23","06:10:23"),
+	("2020-01-01","遅いやつ","2","油交","06:43:26","06:45:26");
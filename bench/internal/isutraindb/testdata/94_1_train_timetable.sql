@@ -0,0 +1,7 @@
+use isutrain;
+SET CHARACTER_SET_CLIENT = utf8;
+SET CHARACTER_SET_CONNECTION = utf8;
+
+INSERT INTO train_timetable_master(date,train_class,train_name,station,arrival,departure) VALUES
+	("2020-01-02","遅いやつ","1","東京","06:10:00","06:12:00"),
+	("2020-01-02","遅いやつ","1","形顔","06:46:30","06:48:30");
@@ -0,0 +1,67 @@
+package isutraindb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTimetable(t *testing.T) {
+	defer func() { timetable = nil }()
+
+	assert.False(t, HasTimetable())
+	if !assert.NoError(t, LoadTimetable("testdata")) {
+		return
+	}
+	assert.True(t, HasTimetable())
+
+	useAt := time.Date(2020, 1, 1, 6, 5, 0, 0, time.UTC)
+	train, ok := GetTrain(useAt, "遅いやつ", "1")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "東京", train.StartStation)
+	assert.Equal(t, "油交", train.LastStation)
+	assert.False(t, train.IsNobori)
+	assert.Equal(t, 6*time.Hour, train.DepartureAt)
+	assert.Len(t, train.Stops, 6)
+
+	stop, ok := train.Stop("古岡")
+	if assert.True(t, ok) {
+		assert.Equal(t, 6*time.Hour+8*time.Minute+23*time.Second, stop.Arrival)
+		assert.Equal(t, 6*time.Hour+10*time.Minute+23*time.Second, stop.Departure)
+	}
+	_, ok = train.Stop("大阪")
+	assert.False(t, ok)
+
+	assert.True(t, train.DepartsAfter("古岡", useAt))
+	assert.False(t, train.DepartsAfter("古岡", time.Date(2020, 1, 1, 6, 10, 23, 0, time.UTC)))
+	assert.False(t, train.DepartsAfter("大阪", useAt))
+
+	// 分割された時刻表ファイルも読み込まれる
+	train, ok = GetTrain(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), "遅いやつ", "1")
+	if assert.True(t, ok) {
+		assert.Equal(t, "形顔", train.LastStation)
+		assert.Len(t, train.Stops, 2)
+	}
+
+	// 日付はタイムゾーンによらず、時刻をそのままJSTとして判定する
+	_, ok = GetTrain(time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC), "遅いやつ", "2")
+	assert.True(t, ok)
+	_, ok = GetTrain(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), "遅いやつ", "2")
+	assert.False(t, ok)
+}
+
+func TestTrain_IsOnRoute(t *testing.T) {
+	kudari := &Train{StartStation: "東京", LastStation: "油交"}
+	assert.True(t, kudari.IsOnRoute("東京", "油交"))
+	assert.True(t, kudari.IsOnRoute("古岡", "形顔"))
+	assert.False(t, kudari.IsOnRoute("形顔", "古岡"))
+	assert.False(t, kudari.IsOnRoute("古岡", "大阪"))
+
+	nobori := &Train{StartStation: "油交", LastStation: "東京", IsNobori: true}
+	assert.True(t, nobori.IsOnRoute("形顔", "古岡"))
+	assert.False(t, nobori.IsOnRoute("古岡", "形顔"))
+	assert.False(t, nobori.IsOnRoute("大阪", "古岡"))
+}
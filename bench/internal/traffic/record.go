@@ -0,0 +1,112 @@
+package traffic
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Request は記録されたリクエストです
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	// Cookies は送信時点でcookie jarから付与されたcookieです
+	Cookies []string `json:"cookies,omitempty"`
+	Body    string   `json:"body,omitempty"`
+}
+
+// Response は記録されたレスポンスです
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	// SetCookies はレスポンスでcookie jarに設定されたcookieです
+	SetCookies []string `json:"set_cookies,omitempty"`
+	Body       string   `json:"body,omitempty"`
+}
+
+// Entry はリクエスト１つ分の記録です
+type Entry struct {
+	// SessionID は記録元セッションの識別子で、リプレイ時はセッションごとにcookie jarを分けます
+	SessionID uint64    `json:"session_id"`
+	StartedAt time.Time `json:"started_at"`
+	// Elapsed はリクエストからレスポンス受信完了までの時間です
+	Elapsed  time.Duration `json:"elapsed"`
+	Request  *Request      `json:"request"`
+	Response *Response     `json:"response,omitempty"`
+	// Error はリクエストが失敗した場合のエラーです
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder はEntryをJSONLで書き出します
+type Recorder struct {
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	return &Recorder{
+		f:   f,
+		w:   w,
+		enc: json.NewEncoder(w),
+	}, nil
+}
+
+func (r *Recorder) Record(entry *Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(entry)
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// Load はJSONLで記録されたEntryを読み出します
+func Load(r io.Reader) ([]*Entry, error) {
+	var (
+		entries []*Entry
+		dec     = json.NewDecoder(r)
+	)
+	for {
+		var entry *Entry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func LoadFile(path string) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
@@ -0,0 +1,514 @@
+package traffic
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result はリプレイしたリクエスト１つ分の結果です
+type Result struct {
+	Entry      *Entry   `json:"entry"`
+	StatusCode int      `json:"status_code"`
+	Body       string   `json:"body,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Diffs      []string `json:"diffs,omitempty"`
+	// Skipped は、使われなかったカード登録など再送しなかったリクエストです
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func (r *Result) Mismatched() bool {
+	return len(r.Diffs) > 0
+}
+
+// Replayer は記録されたリクエストを別のターゲットへ再送し、レスポンスを比較します
+type Replayer struct {
+	target *url.URL
+	// paymentTarget は記録されたカード登録を再送する決済APIです. nilの場合はカードトークンを差し替えません
+	paymentTarget *url.URL
+	// speed は再送速度の倍率です. 0以下の場合、待ち合わせずに再送します
+	speed   float64
+	timeout time.Duration
+	// ignoreKeys はレスポンスボディの比較で無視するJSONのキーです
+	ignoreKeys map[string]struct{}
+}
+
+func NewReplayer(targetBaseURL, paymentBaseURL string, speed float64, timeout time.Duration, ignoreKeys []string) (*Replayer, error) {
+	u, err := url.Parse(targetBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	var paymentURL *url.URL
+	if paymentBaseURL != "" {
+		paymentURL, err = url.Parse(paymentBaseURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys := map[string]struct{}{}
+	for _, key := range ignoreKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = struct{}{}
+		}
+	}
+
+	return &Replayer{
+		target:        u,
+		paymentTarget: paymentURL,
+		speed:         speed,
+		timeout:       timeout,
+		ignoreKeys:    keys,
+	}, nil
+}
+
+// replayState は１回のリプレイで、記録時の値からリプレイ先の値への対応を保持します
+// 予約IDやカードトークンはリプレイ先で払い出し直されるため、記録されたままでは後続のリクエストが別の予約を指してしまう
+type replayState struct {
+	entries []*Entry
+	results []*Result
+
+	mu             sync.Mutex
+	reservationIDs map[string]string
+
+	// cardMu はカード登録の再送を直列化します
+	cardMu        sync.Mutex
+	cardTokens    map[string]string
+	cardEntries   map[string]int
+	paymentClient *http.Client
+}
+
+func (s *replayState) reservationID(recorded string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live, ok := s.reservationIDs[recorded]
+	return live, ok
+}
+
+// learnReservationIDs は記録時とリプレイ時のレスポンスボディを並べて辿り、予約IDの対応を記録します
+func (s *replayState) learnReservationIDs(want, got interface{}) {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for k, wv := range w {
+			gv, ok := g[k]
+			if !ok {
+				continue
+			}
+			if k == "reservation_id" {
+				s.mu.Lock()
+				s.reservationIDs[fmt.Sprint(wv)] = fmt.Sprint(gv)
+				s.mu.Unlock()
+				continue
+			}
+			s.learnReservationIDs(wv, gv)
+		}
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return
+		}
+		for i := range w {
+			if i < len(g) {
+				s.learnReservationIDs(w[i], g[i])
+			}
+		}
+	}
+}
+
+// Replay はセッションごとに記録順でリクエストを再送します
+// 記録時のセッション間の並行性は、開始時刻のオフセットを倍率で伸縮して再現します
+// 決済APIへのカード登録は、そのトークンを使うリクエストの直前に再送し、トークンを差し替えます
+func (r *Replayer) Replay(ctx context.Context, entries []*Entry) ([]*Result, error) {
+	if len(entries) == 0 {
+		return []*Result{}, nil
+	}
+
+	paymentClient, err := r.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		origin   = entries[0].StartedAt
+		sessions = map[uint64][]int{}
+		results  = make([]*Result, len(entries))
+		state    = &replayState{
+			entries:        entries,
+			results:        results,
+			reservationIDs: map[string]string{},
+			cardTokens:     map[string]string{},
+			cardEntries:    map[string]int{},
+			paymentClient:  paymentClient,
+		}
+	)
+	for i, entry := range entries {
+		if entry.StartedAt.Before(origin) {
+			origin = entry.StartedAt
+		}
+		if entry.SessionID == PaymentSessionID {
+			if token := responseString(entry.Response, "card_token"); token != "" {
+				state.cardEntries[token] = i
+			}
+			continue
+		}
+		sessions[entry.SessionID] = append(sessions[entry.SessionID], i)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		startAt = time.Now()
+	)
+	for _, idxs := range sessions {
+		httpClient, err := r.newHTTPClient()
+		if err != nil {
+			return nil, err
+		}
+
+		wg.Add(1)
+		go func(idxs []int) {
+			defer wg.Done()
+			for _, idx := range idxs {
+				entry := entries[idx]
+				if err := r.wait(ctx, startAt, entry.StartedAt.Sub(origin)); err != nil {
+					results[idx] = &Result{Entry: entry, Error: err.Error()}
+					continue
+				}
+				results[idx] = r.replayEntry(ctx, httpClient, r.target, entry, state)
+			}
+		}(idxs)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result == nil {
+			results[i] = &Result{Entry: entries[i], Skipped: true}
+		}
+	}
+
+	return results, nil
+}
+
+// liveCardToken は記録されたカードトークンを、リプレイ先の決済APIに登録し直したトークンに差し替えます
+// 登録し直せない場合は、記録されたトークンをそのまま返します
+func (r *Replayer) liveCardToken(ctx context.Context, state *replayState, recorded string) string {
+	state.cardMu.Lock()
+	defer state.cardMu.Unlock()
+
+	if live, ok := state.cardTokens[recorded]; ok {
+		return live
+	}
+	idx, ok := state.cardEntries[recorded]
+	if !ok || r.paymentTarget == nil {
+		return recorded
+	}
+
+	result := r.replayEntry(ctx, state.paymentClient, r.paymentTarget, state.entries[idx], state)
+	state.results[idx] = result
+
+	live := recorded
+	var resp map[string]interface{}
+	if json.Unmarshal([]byte(result.Body), &resp) == nil {
+		if token, ok := resp["card_token"].(string); ok && token != "" {
+			live = token
+		}
+	}
+	state.cardTokens[recorded] = live
+	return live
+}
+
+// rewritePath は、パス中の記録時の予約ID (/reservations/{id}) をリプレイ先の予約IDに差し替えます
+func (r *Replayer) rewritePath(state *replayState, path string) string {
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] != "reservations" {
+			continue
+		}
+		if live, ok := state.reservationID(segments[i]); ok {
+			segments[i] = live
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// rewriteBody は、リクエストボディの予約IDとカードトークンをリプレイ先の値に差し替えます
+func (r *Replayer) rewriteBody(ctx context.Context, state *replayState, body string) string {
+	var req map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		return body
+	}
+
+	rewritten := false
+	if v, ok := req["reservation_id"]; ok {
+		if live, ok := state.reservationID(fmt.Sprint(v)); ok {
+			if _, isNumber := v.(json.Number); isNumber {
+				req["reservation_id"] = json.Number(live)
+			} else {
+				req["reservation_id"] = live
+			}
+			rewritten = true
+		}
+	}
+	if token, ok := req["card_token"].(string); ok && token != "" {
+		if live := r.liveCardToken(ctx, state, token); live != token {
+			req["card_token"] = live
+			rewritten = true
+		}
+	}
+	if !rewritten {
+		return body
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return body
+	}
+	return string(b)
+}
+
+// decodeJSON は、予約IDなどの数値を記録された表記のまま扱えるよう、json.Numberとして読み出します
+func decodeJSON(s string) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// responseString はレスポンスボディのJSONから、文字列のキーの値を返します
+func responseString(resp *Response, key string) string {
+	if resp == nil {
+		return ""
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		return ""
+	}
+	v, _ := body[key].(string)
+	return v
+}
+
+func (r *Replayer) newHTTPClient() (*http.Client, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+		Jar:     jar,
+		Timeout: r.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+func (r *Replayer) wait(ctx context.Context, startAt time.Time, offset time.Duration) error {
+	if r.speed <= 0 {
+		return ctx.Err()
+	}
+
+	d := time.Until(startAt.Add(time.Duration(float64(offset) / r.speed)))
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (r *Replayer) replayEntry(ctx context.Context, httpClient *http.Client, target *url.URL, entry *Entry, state *replayState) *Result {
+	result := &Result{Entry: entry}
+
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	u.Path = r.rewritePath(state, u.Path)
+
+	body := r.rewriteBody(ctx, state, entry.Request.Body)
+	req, err := http.NewRequest(entry.Request.Method, u.String(), strings.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req = req.WithContext(ctx)
+	for k, v := range entry.Request.Header {
+		// NOTE: cookieはリプレイ側のcookie jarに任せる
+		if http.CanonicalHeaderKey(k) == "Cookie" {
+			continue
+		}
+		req.Header[k] = append([]string(nil), v...)
+	}
+	resubmitCookieHeaders(req, httpClient.Jar, entry)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		if entry.Response != nil {
+			result.Diffs = append(result.Diffs, fmt.Sprintf("リクエストに失敗しました: %s", err.Error()))
+		}
+		return result
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.StatusCode = resp.StatusCode
+	result.Body = truncate(b)
+
+	if entry.Response == nil {
+		result.Diffs = append(result.Diffs, fmt.Sprintf("記録時は失敗したリクエストが成功しました: %s", entry.Error))
+		return result
+	}
+	if entry.Response.StatusCode != resp.StatusCode {
+		result.Diffs = append(result.Diffs, fmt.Sprintf("status: %d != %d", entry.Response.StatusCode, resp.StatusCode))
+	}
+	result.Diffs = append(result.Diffs, r.DiffBody(entry.Response.Body, result.Body)...)
+
+	wantJSON, wantErr := decodeJSON(entry.Response.Body)
+	gotJSON, gotErr := decodeJSON(result.Body)
+	if wantErr == nil && gotErr == nil {
+		state.learnReservationIDs(wantJSON, gotJSON)
+	}
+
+	return result
+}
+
+// DiffBody はレスポンスボディを比較し、差分を返します
+// JSONとして解釈できる場合は、ignoreKeysを除いて構造的に比較します
+func (r *Replayer) DiffBody(want, got string) []string {
+	var wantJSON, gotJSON interface{}
+	if json.Unmarshal([]byte(want), &wantJSON) != nil || json.Unmarshal([]byte(got), &gotJSON) != nil {
+		if want != got {
+			return []string{"body: 内容が一致しません"}
+		}
+		return nil
+	}
+
+	return r.diffJSON("$", wantJSON, gotJSON)
+}
+
+func (r *Replayer) diffJSON(path string, want, got interface{}) []string {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: 型が一致しません", path)}
+		}
+
+		keys := []string{}
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, k := range keys {
+			if _, ok := r.ignoreKeys[k]; ok {
+				continue
+			}
+			childPath := path + "." + k
+			wv, wok := w[k]
+			gv, gok := g[k]
+			switch {
+			case !gok:
+				diffs = append(diffs, fmt.Sprintf("%s: キーが存在しません", childPath))
+			case !wok:
+				diffs = append(diffs, fmt.Sprintf("%s: 想定外のキーです", childPath))
+			default:
+				diffs = append(diffs, r.diffJSON(childPath, wv, gv)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: 型が一致しません", path)}
+		}
+		if len(w) != len(g) {
+			return []string{fmt.Sprintf("%s: 要素数が一致しません: %d != %d", path, len(w), len(g))}
+		}
+
+		var diffs []string
+		for i := range w {
+			diffs = append(diffs, r.diffJSON(fmt.Sprintf("%s[%d]", path, i), w[i], g[i])...)
+		}
+		return diffs
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return []string{fmt.Sprintf("%s: %v != %v", path, want, got)}
+		}
+		return nil
+	}
+}
+
+// resubmitCookieHeaders は、記録時のcookieの値をヘッダで送っていた場合 (double submitのCSRFトークンなど)、
+// リプレイ側のcookie jarの値に差し替えます
+func resubmitCookieHeaders(req *http.Request, jar http.CookieJar, entry *Entry) {
+	if jar == nil {
+		return
+	}
+
+	current := map[string]string{}
+	for _, cookie := range jar.Cookies(req.URL) {
+		current[cookie.Name] = cookie.Value
+	}
+
+	for _, recorded := range entry.Request.Cookies {
+		kv := strings.SplitN(recorded, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			continue
+		}
+		value, ok := current[kv[0]]
+		if !ok {
+			continue
+		}
+		for k, vs := range req.Header {
+			for i, v := range vs {
+				if v == kv[1] {
+					req.Header[k][i] = value
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package traffic
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 記録対象のボディの最大長
+const maxBodyLength = 1 << 20
+
+// PaymentSessionID は決済APIへのリクエストを記録するセッションの識別子です
+// 決済APIへのリクエストはisutrainのセッションに属さないため、セッションとして割り振られない0を用います
+const PaymentSessionID uint64 = 0
+
+var (
+	mu       sync.RWMutex
+	recorder *Recorder
+
+	sessionID uint64
+)
+
+// Start は記録を開始します
+func Start(path string) error {
+	r, err := NewRecorder(path)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	recorder = r
+
+	return nil
+}
+
+// Stop は記録を終了し、ファイルを閉じます
+func Stop() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if recorder == nil {
+		return nil
+	}
+	err := recorder.Close()
+	recorder = nil
+
+	return err
+}
+
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return recorder != nil
+}
+
+// NewSessionID はセッションに割り振る識別子を返します
+func NewSessionID() uint64 {
+	return atomic.AddUint64(&sessionID, 1)
+}
+
+// Do はリクエストを発行し、記録が有効であればリクエストとレスポンスを記録します
+// NOTE: 記録のためにレスポンスボディは読み出され、同じ内容で差し替えられます
+func Do(id uint64, httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return httpClient.Do(req)
+	}
+
+	entry := &Entry{
+		SessionID: id,
+		StartedAt: time.Now(),
+		Request: &Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: cloneHeader(req.Header),
+			Body:   requestBody(req),
+		},
+	}
+	if httpClient.Jar != nil {
+		for _, cookie := range httpClient.Jar.Cookies(req.URL) {
+			entry.Request.Cookies = append(entry.Request.Cookies, cookie.String())
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		entry.Elapsed = time.Since(entry.StartedAt)
+		entry.Error = err.Error()
+		record(entry)
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	entry.Elapsed = time.Since(entry.StartedAt)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	entry.Response = &Response{
+		StatusCode: resp.StatusCode,
+		Header:     cloneHeader(resp.Header),
+		SetCookies: resp.Header["Set-Cookie"],
+		Body:       truncate(b),
+	}
+	record(entry)
+
+	return resp, nil
+}
+
+func record(entry *Entry) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if recorder == nil {
+		return
+	}
+	// NOTE: 記録の失敗でベンチマークを止めないよう、エラーは無視する
+	recorder.Record(entry)
+}
+
+func requestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+
+	return truncate(b)
+}
+
+func cloneHeader(h http.Header) http.Header {
+	cloned := make(http.Header, len(h))
+	for k, v := range h {
+		cloned[k] = append([]string(nil), v...)
+	}
+	return cloned
+}
+
+func truncate(b []byte) string {
+	if len(b) > maxBodyLength {
+		b = b[:maxBodyLength]
+	}
+	return string(b)
+}
@@ -0,0 +1,206 @@
+package traffic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var body = `{"reservation_id": 1, "is_ok": true}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "traffic")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traffic.jsonl")
+	assert.NoError(t, Start(path))
+
+	jar, err := cookiejar.New(&cookiejar.Options{})
+	assert.NoError(t, err)
+	httpClient := &http.Client{Jar: jar}
+	id := NewSessionID()
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/train/reserve", strings.NewReader(`{"seat_class": "premium"}`))
+		assert.NoError(t, err)
+		resp, err := Do(id, httpClient, req)
+		assert.NoError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		if i == 1 {
+			assert.Equal(t, body, string(b))
+		}
+	}
+	assert.NoError(t, Stop())
+
+	entries, err := LoadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, `{"seat_class": "premium"}`, entries[0].Request.Body)
+	assert.Equal(t, http.StatusUnauthorized, entries[0].Response.StatusCode)
+	assert.Len(t, entries[0].Response.SetCookies, 1)
+	assert.Len(t, entries[1].Request.Cookies, 1)
+
+	replayer, err := NewReplayer(server.URL, "", 0, 5*time.Second, nil)
+	assert.NoError(t, err)
+	results, err := replayer.Replay(context.Background(), entries)
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.False(t, result.Mismatched(), result.Diffs)
+	}
+
+	body = `{"reservation_id": 2, "is_ok": false}`
+	results, err = replayer.Replay(context.Background(), entries)
+	assert.NoError(t, err)
+	assert.False(t, results[0].Mismatched())
+	assert.Equal(t, []string{"$.is_ok: true != false", "$.reservation_id: 1 != 2"}, results[1].Diffs)
+}
+
+func TestDiffBody(t *testing.T) {
+	replayer, err := NewReplayer("http://localhost", "", 1, time.Second, []string{"reservation_id"})
+	assert.NoError(t, err)
+
+	assert.Empty(t, replayer.DiffBody(`{"reservation_id": 1, "amount": 100}`, `{"amount": 100, "reservation_id": 3}`))
+	assert.Equal(t, []string{"$.seats: 要素数が一致しません: 1 != 2"}, replayer.DiffBody(`{"seats": [1]}`, `{"seats": [1, 2]}`))
+	assert.Equal(t, []string{"$.amount: キーが存在しません", "$.is_ok: 想定外のキーです"}, replayer.DiffBody(`{"amount": 1}`, `{"is_ok": true}`))
+	assert.Empty(t, replayer.DiffBody(`plain`, `plain`))
+	assert.Equal(t, []string{"body: 内容が一致しません"}, replayer.DiffBody(`plain`, `other`))
+}
+
+func TestResubmitCookieHeaders(t *testing.T) {
+	jar, err := cookiejar.New(&cookiejar.Options{})
+	assert.NoError(t, err)
+	u, err := url.Parse("http://localhost/api/train/reserve")
+	assert.NoError(t, err)
+	jar.SetCookies(u, []*http.Cookie{{Name: "XSRF-TOKEN", Value: "replayed"}})
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("X-XSRF-TOKEN", "recorded")
+	req.Header.Set("Content-Type", "application/json")
+
+	resubmitCookieHeaders(req, jar, &Entry{Request: &Request{Cookies: []string{"XSRF-TOKEN=recorded"}}})
+	assert.Equal(t, "replayed", req.Header.Get("X-XSRF-TOKEN"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+}
+
+// newReservationServer は、予約IDとカードトークンを払い出し、払い出していない値を使うリクエストを拒否するサーバです
+func newReservationServer(firstID int, tokenPrefix string) *httptest.Server {
+	var (
+		mu           sync.Mutex
+		nextID       = firstID
+		reservations = map[string]bool{}
+		tokens       = map[string]bool{}
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var req struct {
+			ReservationID json.Number `json:"reservation_id"`
+			CardToken     string      `json:"card_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch {
+		case r.URL.Path == "/card":
+			token := fmt.Sprintf("%s-%d", tokenPrefix, len(tokens))
+			tokens[token] = true
+			fmt.Fprintf(w, `{"card_token": %q, "is_ok": true}`, token)
+		case r.URL.Path == "/api/train/reserve":
+			id := strconv.Itoa(nextID)
+			nextID++
+			reservations[id] = true
+			fmt.Fprintf(w, `{"reservation_id": %s, "is_ok": true}`, id)
+		case r.URL.Path == "/api/train/reservation/commit":
+			if !reservations[req.ReservationID.String()] || !tokens[req.CardToken] {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			w.Write([]byte(`{"is_ok": true}`))
+		case strings.HasPrefix(r.URL.Path, "/api/user/reservations/"):
+			id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/user/reservations/"), "/cancel")
+			if !reservations[id] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			w.Write([]byte(`{"is_ok": true}`))
+		}
+	}))
+}
+
+func TestReplayRemapsReservationIDsAndCardTokens(t *testing.T) {
+	recorded := newReservationServer(1, "recorded")
+	defer recorded.Close()
+
+	dir, err := ioutil.TempDir("", "traffic")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "traffic.jsonl")
+	assert.NoError(t, Start(path))
+
+	do := func(id uint64, method, uri, body string) string {
+		req, err := http.NewRequest(method, uri, strings.NewReader(body))
+		assert.NoError(t, err)
+		resp, err := Do(id, http.DefaultClient, req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var res struct {
+			ReservationID json.Number `json:"reservation_id"`
+			CardToken     string      `json:"card_token"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		return res.ReservationID.String() + res.CardToken
+	}
+	id := NewSessionID()
+	token := do(PaymentSessionID, http.MethodPost, recorded.URL+"/card", `{}`)
+	reservationID := do(id, http.MethodPost, recorded.URL+"/api/train/reserve", `{}`)
+	do(id, http.MethodPost, recorded.URL+"/api/train/reservation/commit", fmt.Sprintf(`{"reservation_id": %s, "card_token": %q}`, reservationID, token))
+	do(id, http.MethodPost, recorded.URL+"/api/user/reservations/"+reservationID+"/cancel", `{}`)
+	// 使われないカード登録は再送しない
+	do(PaymentSessionID, http.MethodPost, recorded.URL+"/card", `{}`)
+	assert.NoError(t, Stop())
+
+	entries, err := LoadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 5)
+
+	// 予約IDとトークンが記録時と異なるリプレイ先
+	live := newReservationServer(100, "live")
+	defer live.Close()
+
+	replayer, err := NewReplayer(live.URL, live.URL, 0, 5*time.Second, []string{"reservation_id", "card_token"})
+	assert.NoError(t, err)
+	results, err := replayer.Replay(context.Background(), entries)
+	assert.NoError(t, err)
+	for i, result := range results {
+		assert.False(t, result.Mismatched(), "%d: %v", i, result.Diffs)
+	}
+	assert.False(t, results[0].Skipped)
+	assert.True(t, results[4].Skipped)
+}
@@ -2,17 +2,33 @@ package isutrain
 
 import (
 	"context"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb/sqlmaster"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// ログイン
+
+// assertLoginLocked は、ロックアウト中のレスポンスに再試行できるまでの秒数が含まれるか検証します
+func assertLoginLocked(endpointPath string, resp *http.Response) error {
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || retryAfter <= 0 {
+		return bencherror.NewSimpleApplicationError("POST %s: Retry-Afterヘッダが不正です: %q", endpointPath, resp.Header.Get("Retry-After"))
+	}
+	return nil
+}
+
 // 列車検索
 
-func assertSearchTrains(ctx context.Context, endpointPath string, resp SearchTrainsResponse) error {
+func assertSearchTrains(ctx context.Context, endpointPath string, requestedAt, useAt time.Time, from, to string, resp SearchTrainsResponse) error {
 	if resp == nil {
 		return bencherror.NewSimpleCriticalError("GET %s: レスポンスが空です", endpointPath)
 	}
@@ -37,6 +53,92 @@ func assertSearchTrains(ctx context.Context, endpointPath string, resp SearchTra
 		if ok := IsValidStation(train.Arrival); !ok {
 			return bencherror.NewSimpleCriticalError("GET %s: 不正な駅です: %s", endpointPath, train.Arrival)
 		}
+		if train.Departure != from || train.Arrival != to {
+			return bencherror.NewSimpleCriticalError("GET %s: 検索条件と異なる区間の列車が返されました: %s %s %s~%s", endpointPath, train.Class, train.Name, train.Departure, train.Arrival)
+		}
+		if isutraindb.HasTimetable() {
+			if err := assertTrainTimetable(endpointPath, useAt, train); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 空席情報は、列車を1つ選んで検証する
+	return assertSeatAvailability(endpointPath, requestedAt, useAt, resp[rand.Intn(len(resp))])
+}
+
+// verifiesSeatOccupancy は、空席情報・座席の予約状況を予約キャッシュと突き合わせて検証するかを返します
+// 他の日や別の区間の予約を数えてしまう座席の検索は、Golangの参考実装のみ修正しているので、Golangの実装に限って検証する
+func verifiesSeatOccupancy() bool {
+	return config.Language == "golang"
+}
+
+// assertSeatAvailability は、空席情報が予約キャッシュから算出した期待値と一致するか検証します
+func assertSeatAvailability(endpointPath string, requestedAt, useAt time.Time, train *Train) error {
+	if train.TrainStatus == TrainStatusCancelled {
+		// 運休の列車は予約できない
+		for _, sa := range []SeatAvailability{SaPremium, SaPremiumSmoke, SaReserved, SaReservedSmoke, SaNonReserved} {
+			if got := train.SeatAvailability[sa.String()]; got != "×" {
+				return bencherror.NewSimpleCriticalError("GET %s: 運休の列車 %s %s の空席情報(%s)が不正です: want=×, got=%s", endpointPath, train.Class, train.Name, sa, got)
+			}
+		}
+		return nil
+	}
+
+	if !verifiesSeatOccupancy() {
+		return nil
+	}
+
+	expected, ok, err := ReservationCache.ExpectedSeatAvailability(requestedAt, useAt, train.Class, train.Name, train.Departure, train.Arrival)
+	if err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "GET %s: 空席情報の期待値算出でエラーが発生しました", endpointPath))
+		return nil
+	}
+	if !ok {
+		// 予約・キャンセルが処理中の列車は検証しない
+		return nil
+	}
+
+	for _, sa := range []SeatAvailability{SaPremium, SaPremiumSmoke, SaReserved, SaReservedSmoke, SaNonReserved} {
+		if want, got := expected.Symbol(sa), train.SeatAvailability[sa.String()]; got != want {
+			return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s の空席情報(%s)が不正です: want=%s, got=%s", endpointPath, train.Class, train.Name, sa, want, got)
+		}
+	}
+
+	return nil
+}
+
+// assertTrainTimetable は、列車が時刻表に存在し、時刻が時刻表と一致するか検証します
+func assertTrainTimetable(endpointPath string, useAt time.Time, train *Train) error {
+	dbTrain, ok := isutraindb.GetTrain(useAt, train.Class, train.Name)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("GET %s: 存在しない列車が返されました: %s %s", endpointPath, train.Class, train.Name)
+	}
+	if train.Start != dbTrain.StartStation || train.Last != dbTrain.LastStation {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s の始発駅・終着駅が不正です: got=%s~%s, want=%s~%s", endpointPath, train.Class, train.Name, train.Start, train.Last, dbTrain.StartStation, dbTrain.LastStation)
+	}
+	if !dbTrain.IsOnRoute(train.Departure, train.Arrival) {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s は %s~%s を運行しません", endpointPath, train.Class, train.Name, train.Departure, train.Arrival)
+	}
+
+	departure, ok := dbTrain.Stop(train.Departure)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s は %s に停車しません", endpointPath, train.Class, train.Name, train.Departure)
+	}
+	arrival, ok := dbTrain.Stop(train.Arrival)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s は %s に停車しません", endpointPath, train.Class, train.Name, train.Arrival)
+	}
+	if departedAt, err := sqlmaster.ParseClock(train.DepartedAt); err != nil || departedAt != departure.Departure {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s の出発時刻が不正です: %s", endpointPath, train.Class, train.Name, train.DepartedAt)
+	}
+	if arrivedAt, err := sqlmaster.ParseClock(train.ArrivedAt); err != nil || arrivedAt != arrival.Arrival {
+		return bencherror.NewSimpleCriticalError("GET %s: 列車 %s %s の到着時刻が不正です: %s", endpointPath, train.Class, train.Name, train.ArrivedAt)
+	}
+
+	// 乗車日時より後に出発する列車のみ返されるはず
+	if !dbTrain.DepartsAfter(train.Departure, useAt) {
+		return bencherror.NewSimpleCriticalError("GET %s: 乗車日時より前に出発する列車が返されました: %s %s %s発", endpointPath, train.Class, train.Name, train.DepartedAt)
 	}
 
 	return nil
@@ -44,7 +146,7 @@ func assertSearchTrains(ctx context.Context, endpointPath string, resp SearchTra
 
 // 座席検索
 
-func assertSearchTrainSeats(ctx context.Context, endpointPath string, resp *SearchTrainSeatsResponse) error {
+func assertSearchTrainSeats(ctx context.Context, endpointPath string, requestedAt, date time.Time, departure, arrival string, resp *SearchTrainSeatsResponse) error {
 	if resp == nil {
 		return bencherror.NewSimpleCriticalError("GET %s: レスポンスが空です", endpointPath)
 	}
@@ -67,6 +169,65 @@ func assertSearchTrainSeats(ctx context.Context, endpointPath string, resp *Sear
 		dedup[*seat] = struct{}{}
 	}
 
+	// 座席は seat_master と一致するはず
+	masterSeats := isutraindb.GetSeats(resp.TrainClass, resp.CarNumber)
+	if len(resp.Seats) != len(masterSeats) {
+		return bencherror.NewSimpleCriticalError("GET %s: %d号車の座席数が不正です: want=%d, got=%d", endpointPath, resp.CarNumber, len(masterSeats), len(resp.Seats))
+	}
+	masterSeatMap := map[seatKey]*isutraindb.Seat{}
+	for _, seat := range masterSeats {
+		masterSeatMap[seatKey{resp.CarNumber, seat.Row, seat.Column}] = seat
+	}
+	for _, seat := range resp.Seats {
+		masterSeat, ok := masterSeatMap[seatKey{resp.CarNumber, seat.Row, seat.Column}]
+		if !ok {
+			return bencherror.NewSimpleCriticalError("GET %s: %d号車に存在しない座席が含まれています: %d%s", endpointPath, resp.CarNumber, seat.Row, seat.Column)
+		}
+		if seat.Class != masterSeat.SeatClass || seat.IsSmokingSeat != masterSeat.IsSmokingSeat {
+			return bencherror.NewSimpleCriticalError("GET %s: %d号車 %d%s の座席種別が不正です", endpointPath, resp.CarNumber, seat.Row, seat.Column)
+		}
+	}
+
+	return assertOccupiedSeats(endpointPath, requestedAt, date, departure, arrival, resp)
+}
+
+// assertOccupiedSeats は、座席の予約状況が予約キャッシュから算出した期待値と一致するか検証します
+func assertOccupiedSeats(endpointPath string, requestedAt, date time.Time, departure, arrival string, resp *SearchTrainSeatsResponse) error {
+	if resp.TrainStatus == TrainStatusCancelled {
+		// 運休の列車は全ての座席が予約済みになる
+		for _, seat := range resp.Seats {
+			if !seat.IsOccupied {
+				return bencherror.NewSimpleCriticalError("GET %s: 運休の列車の座席が空席として返されました: %s %s %d号車 %d%s", endpointPath, resp.TrainClass, resp.TrainName, resp.CarNumber, seat.Row, seat.Column)
+			}
+		}
+		return nil
+	}
+
+	if !verifiesSeatOccupancy() {
+		return nil
+	}
+
+	occupied, exact, ok, err := ReservationCache.expectedOccupiedSeats(requestedAt, date, resp.TrainClass, resp.TrainName, resp.CarNumber, departure, arrival)
+	if err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "GET %s: 座席の予約状況の期待値算出でエラーが発生しました", endpointPath))
+		return nil
+	}
+	if !ok {
+		// 予約・キャンセルが処理中の列車は検証しない
+		return nil
+	}
+
+	for _, seat := range resp.Seats {
+		want := occupied[seatKey{resp.CarNumber, seat.Row, seat.Column}]
+		if want && !seat.IsOccupied {
+			return bencherror.NewSimpleCriticalError("GET %s: 予約済みの座席が空席として返されました: %s %s %d号車 %d%s", endpointPath, resp.TrainClass, resp.TrainName, resp.CarNumber, seat.Row, seat.Column)
+		}
+		// 座席を指定しない予約があると、どの座席が割り当てられたかわからない
+		if exact && !want && seat.IsOccupied {
+			return bencherror.NewSimpleCriticalError("GET %s: 空いている座席が予約済みとして返されました: %s %s %d号車 %d%s", endpointPath, resp.TrainClass, resp.TrainName, resp.CarNumber, seat.Row, seat.Column)
+		}
+	}
+
 	return nil
 }
 
@@ -124,13 +285,21 @@ func assertReserve(ctx context.Context, endpointPath string, client *Client, req
 		}
 
 		if len(reservation.Seats) != cache.SeatCount() {
-			return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 座席が期待数確保できていません: want=%d, got=%d", cache.SeatCount(), len(reservation.Seats))
+			return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 座席が期待数確保できていません: want=%d, got=%d", endpointPath, resp.ReservationID, cache.SeatCount(), len(reservation.Seats))
 		}
 
 		if amount != reservation.Amount {
 			return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの amountが一致しません: want=%d, got=%d", endpointPath, reservation.ReservationID, amount, reservation.Amount)
 		}
 
+		if err := assertReservationCars(endpointPath, req, resp, reservation); err != nil {
+			return err
+		}
+
+		if req.Preferences != nil && len(req.Seats) == 0 && req.SeatClass != "non-reserved" {
+			return assertSeatPreferences(endpointPath, req, resp, reservation)
+		}
+
 		return nil
 	})
 
@@ -141,6 +310,63 @@ func assertReserve(ctx context.Context, endpointPath string, client *Client, req
 	return nil
 }
 
+// assertReservationCars は、予約した座席の号車を検証します
+// 号車をまたぐ予約は、allow_split を指定したあいまい予約で、座席クラスが同じ隣り合う号車の場合のみ許されます
+func assertReservationCars(endpointPath string, req *ReserveRequest, resp *ReserveResponse, reservation *Reservation) error {
+	if req.SeatClass == "non-reserved" {
+		return nil
+	}
+
+	cars := map[int]bool{}
+	minCar, maxCar := 0, 0
+	for _, seat := range reservation.Seats {
+		carNum := reservation.SeatCarNumber(seat)
+		if !IsValidCarNumber(carNum) {
+			return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 車両番号が不正です: %d", endpointPath, resp.ReservationID, carNum)
+		}
+		if isutraindb.GetSeatClass(req.TrainClass, carNum) != req.SeatClass {
+			return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの %d号車の座席クラスが不正です: want=%s", endpointPath, resp.ReservationID, carNum, req.SeatClass)
+		}
+		cars[carNum] = true
+		if minCar == 0 || carNum < minCar {
+			minCar = carNum
+		}
+		if carNum > maxCar {
+			maxCar = carNum
+		}
+	}
+	if len(cars) <= 1 {
+		return nil
+	}
+
+	if !req.AllowSplit || len(req.Seats) > 0 {
+		return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 座席が1つの号車にまとめられていません: %d〜%d号車", endpointPath, resp.ReservationID, minCar, maxCar)
+	}
+	// 全ての号車の座席クラスは検証済みなので、連続していれば座席クラスの異なる号車はまたいでいない
+	if maxCar-minCar+1 != len(cars) {
+		return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 号車が隣り合っていません: %d〜%d号車のうち%d両", endpointPath, resp.ReservationID, minCar, maxCar, len(cars))
+	}
+
+	return nil
+}
+
+// assertSeatPreferences は、あいまい予約で確保した座席が座席の希望に沿っているか検証します
+func assertSeatPreferences(endpointPath string, req *ReserveRequest, resp *ReserveResponse, reservation *Reservation) error {
+	if !req.Preferences.InCarRange(reservation.CarNumber) {
+		return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 号車が希望の範囲外です: car_from=%d, car_to=%d, got=%d", endpointPath, resp.ReservationID, req.Preferences.CarFrom, req.Preferences.CarTo, reservation.CarNumber)
+	}
+
+	satisfied := req.Preferences.Satisfied(req.SeatClass, reservation.CarNumber, reservation.Seats)
+	if req.Preferences.Required && !satisfied.SatisfiesAll(req.Preferences) {
+		return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 座席が必須の希望を満たしていません: want=%+v, got=%+v", endpointPath, resp.ReservationID, req.Preferences, satisfied)
+	}
+	if resp.Preferences == nil || *resp.Preferences != *satisfied {
+		return bencherror.NewSimpleCriticalError("POST %s: 予約 %dの 満たした希望が不正です: want=%+v, got=%+v", endpointPath, resp.ReservationID, satisfied, resp.Preferences)
+	}
+
+	return nil
+}
+
 func assertCanReserve(ctx context.Context, endpointPath string, req *ReserveRequest, resp *ReserveResponse) error {
 	lgr := zap.S()
 
@@ -0,0 +1,110 @@
+package isutrain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertTrainTimetable(t *testing.T) {
+	if !assert.NoError(t, isutraindb.LoadTimetable("../internal/isutraindb/testdata")) {
+		return
+	}
+
+	var (
+		useAt = time.Date(2020, 1, 1, 6, 5, 0, 0, time.UTC)
+		path  = "/api/train/search"
+	)
+	newTrain := func() *Train {
+		return &Train{
+			Class:      "遅いやつ",
+			Name:       "1",
+			Start:      "東京",
+			Last:       "油交",
+			Departure:  "古岡",
+			Arrival:    "形顔",
+			DepartedAt: "06:10:23",
+			ArrivedAt:  "06:36:30",
+		}
+	}
+
+	assert.NoError(t, assertTrainTimetable(path, useAt, newTrain()))
+
+	train := newTrain()
+	train.Name = "3"
+	assert.Error(t, assertTrainTimetable(path, useAt, train), "存在しない列車")
+
+	train = newTrain()
+	train.Last = "大阪"
+	assert.Error(t, assertTrainTimetable(path, useAt, train), "終着駅が異なる")
+
+	train = newTrain()
+	train.Departure, train.Arrival = "形顔", "古岡"
+	assert.Error(t, assertTrainTimetable(path, useAt, train), "進行方向が逆")
+
+	train = newTrain()
+	train.DepartedAt = "06:10:00"
+	assert.Error(t, assertTrainTimetable(path, useAt, train), "出発時刻が異なる")
+
+	train = newTrain()
+	train.ArrivedAt = "06:38:30"
+	assert.Error(t, assertTrainTimetable(path, useAt, train), "到着時刻は発車時刻ではなく到着時刻")
+
+	lateUseAt := time.Date(2020, 1, 1, 6, 10, 23, 0, time.UTC)
+	assert.Error(t, assertTrainTimetable(path, lateUseAt, newTrain()), "乗車日時ちょうどに出発する列車は返されない")
+}
+
+func TestAssertSeatAvailability_Cancelled(t *testing.T) {
+	var (
+		useAt = time.Date(2020, 1, 1, 6, 5, 0, 0, time.UTC)
+		path  = "/api/train/search"
+	)
+	train := &Train{
+		Class:       "最速",
+		Name:        "1",
+		Departure:   "東京",
+		Arrival:     "大阪",
+		TrainStatus: TrainStatusCancelled,
+		SeatAvailability: map[string]string{
+			SaPremium.String():       "×",
+			SaPremiumSmoke.String():  "×",
+			SaReserved.String():      "×",
+			SaReservedSmoke.String(): "×",
+			SaNonReserved.String():   "×",
+		},
+	}
+	assert.NoError(t, assertSeatAvailability(path, useAt, useAt, train))
+
+	train.SeatAvailability[SaNonReserved.String()] = "○"
+	assert.Error(t, assertSeatAvailability(path, useAt, useAt, train), "運休の列車に空席がある")
+}
+
+func TestAssertReservationCars(t *testing.T) {
+	var (
+		path = "/api/train/reserve"
+		resp = &ReserveResponse{ReservationID: 1}
+	)
+	newReservation := func(cars ...int) *Reservation {
+		reservation := &Reservation{CarNumber: cars[0]}
+		for i, carNum := range cars {
+			reservation.Seats = append(reservation.Seats, &ReservationSeat{CarNumber: carNum, SeatRow: i + 1, SeatColumn: "A"})
+		}
+		return reservation
+	}
+	req := &ReserveRequest{TrainClass: "最速", SeatClass: "premium"}
+
+	assert.NoError(t, assertReservationCars(path, req, resp, newReservation(8, 8)))
+	assert.NoError(t, assertReservationCars(path, req, resp, &Reservation{CarNumber: 8, Seats: ReservationSeats{{SeatRow: 1, SeatColumn: "A"}}}), "座席ごとの号車を返さない")
+	assert.Error(t, assertReservationCars(path, req, resp, newReservation(8, 9)), "allow_splitなしで号車をまたぐ")
+	assert.Error(t, assertReservationCars(path, req, resp, newReservation(4, 4)), "座席クラスが異なる")
+
+	req.AllowSplit = true
+	assert.NoError(t, assertReservationCars(path, req, resp, newReservation(8, 9, 10)))
+	assert.Error(t, assertReservationCars(path, req, resp, newReservation(8, 10)), "号車が隣り合っていない")
+	assert.Error(t, assertReservationCars(path, req, resp, newReservation(10, 11)), "座席クラスの異なる号車をまたぐ")
+
+	req.Seats = TrainSeats{{Row: 1, Column: "A"}, {Row: 2, Column: "A"}}
+	assert.Error(t, assertReservationCars(path, req, resp, newReservation(8, 9)), "座席指定の予約は号車をまたがない")
+}
@@ -0,0 +1,246 @@
+package isutrain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+)
+
+// 空席情報の記号
+const (
+	availabilityAvailable = "○"
+	availabilityFew       = "△"
+	availabilitySoldOut   = "×"
+)
+
+// 空席数がこれ未満なら残りわずか(△)
+const availabilityFewThreshold = 10
+
+// availabilitySymbol は空席数を空席情報の記号に変換します
+func availabilitySymbol(availableSeats int) string {
+	switch {
+	case availableSeats <= 0:
+		return availabilitySoldOut
+	case availableSeats < availabilityFewThreshold:
+		return availabilityFew
+	default:
+		return availabilityAvailable
+	}
+}
+
+// trainKey は予約キャッシュで列車を識別します
+type trainKey struct {
+	date       string
+	trainClass string
+	trainName  string
+}
+
+// newTrainKey は列車の識別子を作成します
+// NOTE: 日付はタイムゾーンによらず、時刻をそのままJSTとして扱います (util.FormatISO8601)
+func newTrainKey(date time.Time, trainClass, trainName string) trainKey {
+	return trainKey{
+		date:       date.Format("2006/01/02"),
+		trainClass: trainClass,
+		trainName:  trainName,
+	}
+}
+
+// trainActivity は列車の予約と、予約・キャンセルの処理状況です
+type trainActivity struct {
+	reservations []*ReservationCacheEntry
+
+	// 処理中の予約・キャンセルの数
+	// レスポンスを受け取れなかったものは完了しないので、以降この列車の空席情報は検証しません
+	inflight int
+	// 繰り上げ・取り消しを確認していないキャンセル待ちの数
+	// キャンセルで繰り上げられた予約の座席がわからないので、この列車の空席情報は検証しません
+	waiting int
+	// 最後に予約・キャンセルが開始、完了した時刻
+	changedAt time.Time
+}
+
+// trainActivity は列車の処理状況を返します
+// NOTE: 呼び出し元でロックを取得すること
+func (r *reservationCache) trainActivity(key trainKey) *trainActivity {
+	activity, ok := r.trains[key]
+	if !ok {
+		activity = &trainActivity{}
+		r.trains[key] = activity
+	}
+	return activity
+}
+
+// beginChange は列車の予約状況を変更するリクエストの開始を記録し、完了を記録する関数を返します
+// 完了は、予約キャッシュへ結果を反映した後に記録すること
+func (r *reservationCache) beginChange(date time.Time, trainClass, trainName string) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	activity := r.trainActivity(newTrainKey(date, trainClass, trainName))
+	activity.inflight++
+	activity.changedAt = time.Now()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			activity.inflight--
+			activity.changedAt = time.Now()
+		})
+	}
+}
+
+// beginCancel は予約のキャンセルの開始を記録し、完了を記録する関数を返します
+func (r *reservationCache) beginCancel(reservationID int) func() {
+	reservation, ok := r.Reservation(reservationID)
+	if !ok {
+		return func() {}
+	}
+	return r.beginChange(reservation.Date, reservation.TrainClass, reservation.TrainName)
+}
+
+// stableReservations は、requestedAt 以降に予約状況が変化していない場合に、列車の区間と重なる指定席の予約を返します
+// NOTE: 呼び出し元でロックを取得すること
+func (r *reservationCache) stableReservations(requestedAt, date time.Time, trainClass, trainName, departure, arrival string) ([]*ReservationCacheEntry, bool, error) {
+	activity, ok := r.trains[newTrainKey(date, trainClass, trainName)]
+	if !ok {
+		return []*ReservationCacheEntry{}, true, nil
+	}
+	if activity.inflight > 0 || activity.waiting > 0 || activity.changedAt.After(requestedAt) {
+		return nil, false, nil
+	}
+
+	reservations := []*ReservationCacheEntry{}
+	for _, reservation := range activity.reservations {
+		if canceled, ok := r.canceledReservations[reservation.ID]; ok && canceled == reservation {
+			continue
+		}
+		if reservation.SeatClass == "non-reserved" {
+			continue
+		}
+		overwrap, err := IsSectionOverwrap(reservation.Departure, reservation.Arrival, departure, arrival)
+		if err != nil {
+			return nil, false, err
+		}
+		if overwrap {
+			reservations = append(reservations, reservation)
+		}
+	}
+
+	return reservations, true, nil
+}
+
+// ExpectedSeatAvailability は、予約キャッシュと座席マスタから算出した、座席種別ごとの空席数です
+type ExpectedSeatAvailability map[SeatAvailability]int
+
+// Symbol は空席情報の記号を返します
+func (e ExpectedSeatAvailability) Symbol(sa SeatAvailability) string {
+	if sa == SaNonReserved {
+		return availabilityAvailable
+	}
+	return availabilitySymbol(e[sa])
+}
+
+// seatAvailabilityKey は座席種別と喫煙席かどうかから、空席情報のキーを返します
+func seatAvailabilityKey(seatClass string, isSmokingSeat bool) SeatAvailability {
+	switch {
+	case seatClass == "premium" && isSmokingSeat:
+		return SaPremiumSmoke
+	case seatClass == "premium":
+		return SaPremium
+	case seatClass == "reserved" && isSmokingSeat:
+		return SaReservedSmoke
+	case seatClass == "reserved":
+		return SaReserved
+	default:
+		return SaNonReserved
+	}
+}
+
+// ExpectedSeatAvailability は、列車の区間の空席数の期待値を算出します
+// requestedAt 以降に列車の予約・キャンセルがあった場合や処理中の場合、期待値が定まらないので ok=false を返します
+func (r *reservationCache) ExpectedSeatAvailability(requestedAt, date time.Time, trainClass, trainName, departure, arrival string) (expected ExpectedSeatAvailability, ok bool, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reservations, ok, err := r.stableReservations(requestedAt, date, trainClass, trainName, departure, arrival)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	expected = ExpectedSeatAvailability{
+		SaPremium:       0,
+		SaPremiumSmoke:  0,
+		SaReserved:      0,
+		SaReservedSmoke: 0,
+	}
+	seatMap := map[seatKey]*isutraindb.Seat{}
+	for carNum := 1; carNum <= 16; carNum++ {
+		for _, seat := range isutraindb.GetSeats(trainClass, carNum) {
+			sa := seatAvailabilityKey(seat.SeatClass, seat.IsSmokingSeat)
+			if sa == SaNonReserved {
+				continue
+			}
+			expected[sa]++
+			seatMap[seatKey{carNum, seat.Row, seat.Column}] = seat
+		}
+	}
+
+	occupied := map[seatKey]bool{}
+	for _, reservation := range reservations {
+		// 座席を指定しない予約は、webappが禁煙席から座席を割り当てる
+		if len(reservation.Seats) == 0 {
+			expected[seatAvailabilityKey(reservation.SeatClass, false)] -= reservation.SeatCount()
+			continue
+		}
+		for _, seat := range reservation.Seats {
+			key := seatKey{reservation.CarNum, seat.Row, seat.Column}
+			masterSeat, ok := seatMap[key]
+			if !ok || occupied[key] {
+				continue
+			}
+			occupied[key] = true
+			expected[seatAvailabilityKey(masterSeat.SeatClass, masterSeat.IsSmokingSeat)]--
+		}
+	}
+
+	return expected, true, nil
+}
+
+// seatKey は列車内の座席を識別します
+type seatKey struct {
+	carNum int
+	row    int
+	column string
+}
+
+// expectedOccupiedSeats は、号車の区間で予約済みの座席を算出します
+// 座席を指定しない予約が区間に含まれる場合、割り当てられた座席がわからないので exact=false を返します
+func (r *reservationCache) expectedOccupiedSeats(requestedAt, date time.Time, trainClass, trainName string, carNum int, departure, arrival string) (occupied map[seatKey]bool, exact bool, ok bool, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	reservations, ok, err := r.stableReservations(requestedAt, date, trainClass, trainName, departure, arrival)
+	if err != nil || !ok {
+		return nil, false, ok, err
+	}
+
+	occupied, exact = map[seatKey]bool{}, true
+	for _, reservation := range reservations {
+		if len(reservation.Seats) == 0 {
+			exact = false
+			continue
+		}
+		if reservation.CarNum != carNum {
+			continue
+		}
+		for _, seat := range reservation.Seats {
+			occupied[seatKey{carNum, seat.Row, seat.Column}] = true
+		}
+	}
+
+	return occupied, exact, true, nil
+}
@@ -0,0 +1,161 @@
+package isutrain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilitySymbol(t *testing.T) {
+	assert.Equal(t, "×", availabilitySymbol(0))
+	assert.Equal(t, "△", availabilitySymbol(1))
+	assert.Equal(t, "△", availabilitySymbol(9))
+	assert.Equal(t, "○", availabilitySymbol(10))
+}
+
+func TestReservationMem_ExpectedSeatAvailability(t *testing.T) {
+	var (
+		mem  = newReservationCache()
+		user = &User{Email: "user1@example.com", Password: "user1"}
+		date = time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	)
+	newReq := func(trainName, departure, arrival string, seats TrainSeats) *ReserveRequest {
+		return &ReserveRequest{
+			Date:       util.FormatISO8601(date),
+			TrainClass: "遅いやつ",
+			TrainName:  trainName,
+			SeatClass:  "reserved",
+			CarNum:     16,
+			Departure:  departure,
+			Arrival:    arrival,
+			Adult:      1,
+			Child:      1,
+			Seats:      seats,
+		}
+	}
+
+	// 区間が重なる座席指定の予約
+	assert.NoError(t, mem.Add(user, newReq("163", "東京", "大阪", TrainSeats{{Row: 1, Column: "A"}, {Row: 1, Column: "B"}}), 1))
+	// キャンセルされた予約
+	assert.NoError(t, mem.Add(user, newReq("163", "古岡", "大阪", TrainSeats{{Row: 2, Column: "A"}, {Row: 2, Column: "B"}}), 2))
+	assert.NoError(t, mem.Cancel(2))
+	// 区間が重ならない予約
+	assert.NoError(t, mem.Add(user, newReq("163", "名古屋", "大阪", TrainSeats{{Row: 3, Column: "A"}, {Row: 3, Column: "B"}}), 3))
+	// 別の列車の予約
+	assert.NoError(t, mem.Add(user, newReq("165", "東京", "大阪", TrainSeats{{Row: 4, Column: "A"}, {Row: 4, Column: "B"}}), 4))
+
+	expected, ok, err := mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, 65-2, expected[SaReserved])
+		assert.Equal(t, "○", expected.Symbol(SaReserved))
+		assert.Equal(t, "○", expected.Symbol(SaNonReserved))
+	}
+
+	occupied, exact, ok, err := mem.expectedOccupiedSeats(time.Now(), date, "遅いやつ", "163", 16, "古岡", "名古屋")
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.True(t, exact)
+		assert.Equal(t, map[seatKey]bool{
+			{16, 1, "A"}: true,
+			{16, 1, "B"}: true,
+		}, occupied)
+	}
+
+	// 座席を指定しない予約は、どの座席が割り当てられたかわからない
+	assert.NoError(t, mem.Add(user, newReq("163", "東京", "名古屋", TrainSeats{}), 5))
+
+	expected, ok, err = mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.Equal(t, 65-4, expected[SaReserved])
+	}
+
+	_, exact, ok, err = mem.expectedOccupiedSeats(time.Now(), date, "遅いやつ", "163", 16, "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, exact)
+}
+
+func TestReservationMem_ExpectedSeatAvailability_Inflight(t *testing.T) {
+	var (
+		mem  = newReservationCache()
+		date = time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	)
+
+	requestedAt := time.Now()
+	done := mem.beginChange(date, "遅いやつ", "163")
+
+	// 予約の処理中は期待値が定まらない
+	_, ok, err := mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 別の列車には影響しない
+	_, ok, err = mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "165", "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	done()
+
+	// 予約の処理中に送ったリクエストは検証できない
+	_, ok, err = mem.ExpectedSeatAvailability(requestedAt, date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestReservationMem_ExpectedSeatAvailability_Waitlist(t *testing.T) {
+	var (
+		mem  = newReservationCache()
+		user = &User{Email: "user1@example.com", Password: "user1"}
+		date = time.Date(2020, 1, 1, 20, 0, 0, 0, time.UTC)
+	)
+	newReq := func() *WaitlistRequest {
+		return &WaitlistRequest{
+			Date:       util.FormatISO8601(date),
+			TrainClass: "遅いやつ",
+			TrainName:  "163",
+			SeatClass:  "reserved",
+			Departure:  "東京",
+			Arrival:    "大阪",
+			Adult:      1,
+		}
+	}
+	assert.NoError(t, mem.AddWaitlist(user, newReq(), 1))
+	assert.NoError(t, mem.AddWaitlist(user, newReq(), 2))
+
+	// キャンセル待ちが残っている間は、繰り上げられた予約がわからないので検証しない
+	_, ok, err := mem.ExpectedSeatAvailability(time.Now(), date, "遅いやつ", "163", "古岡", "名古屋")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// 繰り上げられた予約は座席とともに予約キャッシュに追加する
+	assert.True(t, mem.IsWaiting(1))
+	assert.NoError(t, mem.PromoteWaitlist(1, &Reservation{
+		ReservationID: 10,
+		CarNumber:     16,
+		Seats:         ReservationSeats{{SeatRow: 1, SeatColumn: "A"}},
+	}))
+	assert.False(t, mem.IsWaiting(1))
+	reservation, ok := mem.Reservation(10)
+	if assert.True(t, ok) {
+		assert.Equal(t, user, reservation.User)
+		assert.Equal(t, 16, reservation.CarNum)
+	}
+
+	mem.CancelWaitlist(2)
+	assert.False(t, mem.IsWaiting(2))
+
+	occupied, exact, ok, err := mem.expectedOccupiedSeats(time.Now().Add(time.Second), date, "遅いやつ", "163", 16, "古岡", "名古屋")
+	assert.NoError(t, err)
+	if assert.True(t, ok) {
+		assert.True(t, exact)
+		assert.Equal(t, map[seatKey]bool{{16, 1, "A"}: true}, occupied)
+	}
+}
@@ -31,14 +31,17 @@ func NewClient() (*Client, error) {
 		return nil, bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "Isutrainクライアントが作成できません. 運営に確認をお願いいたします"))
 	}
 
-	u, err := url.Parse(config.TargetBaseURL)
+	// ユーザのセッションを維持するため、クライアントごとに負荷走行対象を固定する
+	t, err := targets.assign()
 	if err != nil {
 		return nil, bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "Isutrainクライアントが作成できません. 運営に確認をお願いいたします"))
 	}
+	sess.target = t
 
+	u := *t.baseURL
 	return &Client{
 		sess:    sess,
-		baseURL: u,
+		baseURL: &u,
 	}, nil
 }
 
@@ -48,17 +51,25 @@ func NewClientForInitialize() (*Client, error) {
 		return nil, bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "Isutrainクライアントが作成できません. 運営に確認をお願いいたします"))
 	}
 
-	u, err := url.Parse(config.TargetBaseURL)
+	// /initialize は先頭の負荷走行対象にのみ送る
+	t, err := targets.primary()
 	if err != nil {
 		return nil, bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "Isutrainクライアントが作成できません. 運営に確認をお願いいたします"))
 	}
 
+	u := *t.baseURL
 	return &Client{
 		sess:    sess,
-		baseURL: u,
+		baseURL: &u,
 	}, nil
 }
 
+// CSRFToken は、webappから発行されたCSRFトークンを返します
+// CSRF対策を実装していないwebappでは空文字列を返します
+func (c *Client) CSRFToken() string {
+	return c.sess.csrfToken(c.baseURL)
+}
+
 // ReplaceMockTransport は、clientの利用するhttp.RoundTripperを、DefaultTransportに差し替えます
 // NOTE: httpmockはhttp.DefaultTransportを利用するため、モックテストの時この関数を利用する
 func (c *Client) ReplaceMockTransport() {
@@ -92,29 +103,29 @@ func (c *Client) Initialize(ctx context.Context) {
 	var initializeResp *InitializeResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&initializeResp); err != nil {
-			bencherror.BenchmarkErrs.AddError(bencherror.NewCriticalError(err, "POST %s: レスポンスの形式が不正です", endpointPath))
+			bencherror.BenchmarkErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: レスポンスの形式が不正です", endpointPath), req, resp))
 			return
 		}
 
 		if initializeResp.AvailableDays <= 0 {
-			bencherror.InitializeErrs.AddError(bencherror.NewCriticalError(err, "POST %s: 予約可能日数は正の整数値でなければなりません: got=%d", endpointPath, initializeResp.AvailableDays))
+			bencherror.InitializeErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: 予約可能日数は正の整数値でなければなりません: got=%d", endpointPath, initializeResp.AvailableDays), req, resp))
 			return
 		}
 
 		config.Language = initializeResp.Language
 		if len(initializeResp.Language) == 0 {
-			bencherror.InitializeErrs.AddError(bencherror.NewSimpleCriticalError("POST %s: languageが指定されていません", endpointPath))
+			bencherror.InitializeErrs.AddError(bencherror.WithEvidence(bencherror.NewSimpleCriticalError("POST %s: languageが指定されていません", endpointPath), req, resp))
 			return
 		}
 
 		if err := config.SetAvailReserveDays(initializeResp.AvailableDays); err != nil {
-			bencherror.InitializeErrs.AddError(bencherror.NewCriticalError(err, "POST %s: 予約可能日数の設定に失敗しました", endpointPath))
+			bencherror.InitializeErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: 予約可能日数の設定に失敗しました", endpointPath), req, resp))
 			return
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, successCode); err != nil {
-		bencherror.InitializeErrs.AddError(bencherror.NewCriticalError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK))
+		bencherror.InitializeErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK), req, resp))
 		return
 	}
 
@@ -143,12 +154,12 @@ func (c *Client) Settings(ctx context.Context) (*SettingsResponse, error) {
 	var settings *SettingsResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&settings); err != nil {
-			return nil, bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath)
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, successCode); err != nil {
-		return nil, bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK)
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK), req, resp)
 	}
 
 	return settings, nil
@@ -185,7 +196,7 @@ func (c *Client) Signup(ctx context.Context, email, password string, opt ...Clie
 	defer resp.Body.Close()
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.Signup)
@@ -229,8 +240,14 @@ func (c *Client) Login(ctx context.Context, email, password string, opt ...Clien
 		c.loginUser = loginUser
 	}
 
+	if opts.autoAssert && resp.StatusCode == http.StatusTooManyRequests {
+		if err := assertLoginLocked(endpointPath, resp); err != nil {
+			return bencherror.WithEvidence(err, req, resp)
+		}
+	}
+
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK)
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.Login)
@@ -258,7 +275,7 @@ func (c *Client) Logout(ctx context.Context, opt ...ClientOption) error {
 	defer resp.Body.Close()
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK)
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, http.StatusOK), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.Logout)
@@ -266,6 +283,374 @@ func (c *Client) Logout(ctx context.Context, opt ...ClientOption) error {
 	return nil
 }
 
+// ChangePassword はログイン中のユーザのパスワードを変更します
+func (c *Client) ChangePassword(ctx context.Context, currentPassword, newPassword string, opt ...ClientOption) error {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.ChangePassword)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	b, err := json.Marshal(&ChangePasswordRequest{
+		CurrentPassword: currentPassword,
+		NewPassword:     newPassword,
+	})
+	if err != nil {
+		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+
+	req, err := c.sess.newRequest(ctx, http.MethodPost, u.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == successCode && c.loginUser != nil {
+		user := &User{Email: c.loginUser.Email, Password: newPassword}
+		ReservationCache.UpdateUser(c.loginUser.Email, user)
+		c.loginUser = user
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.ChangePassword)
+
+	return nil
+}
+
+// ChangeEmail はログイン中のユーザのメールアドレスを変更します
+func (c *Client) ChangeEmail(ctx context.Context, email, password string, opt ...ClientOption) error {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.ChangeEmail)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	b, err := json.Marshal(&ChangeEmailRequest{
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+
+	req, err := c.sess.newRequest(ctx, http.MethodPost, u.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == successCode && c.loginUser != nil {
+		user := &User{Email: email, Password: c.loginUser.Password}
+		ReservationCache.UpdateUser(c.loginUser.Email, user)
+		c.loginUser = user
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.ChangeEmail)
+
+	return nil
+}
+
+// DeleteUser はログイン中のユーザを退会させます
+// 退会したユーザの予約は、全てキャンセルされたものとして扱います
+func (c *Client) DeleteUser(ctx context.Context, password string, opt ...ClientOption) error {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.DeleteUser)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	b, err := json.Marshal(&DeleteUserRequest{
+		Password: password,
+	})
+	if err != nil {
+		return bencherror.NewApplicationError(err, "DELETE %s: リクエストに失敗しました", endpointPath)
+	}
+
+	req, err := c.sess.newRequest(ctx, http.MethodDelete, u.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return bencherror.NewApplicationError(err, "DELETE %s: リクエストに失敗しました", endpointPath)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	// 退会は、ユーザの全ての予約のキャンセルとして履歴に記録する
+	reservationIDs := []int{}
+	if c.loginUser != nil {
+		reservationIDs = ReservationCache.activeUserReservationIDs(c.loginUser.Email)
+	}
+	var (
+		dones = make([]func(), len(reservationIDs))
+		ops   = make([]*historyOp, len(reservationIDs))
+	)
+	for i, reservationID := range reservationIDs {
+		dones[i] = ReservationCache.beginCancel(reservationID)
+		ops[i] = ReservationHistory.begin(historyOpCancel, reservationID, nil)
+	}
+	defer func() {
+		for _, done := range dones {
+			done()
+		}
+	}()
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return bencherror.NewWrapError(err, "DELETE %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+	for i, reservationID := range reservationIDs {
+		ReservationHistory.complete(ops[i], resp.StatusCode, reservationID)
+	}
+
+	if resp.StatusCode == successCode && c.loginUser != nil {
+		ReservationCache.DeleteUser(c.loginUser.Email)
+		c.loginUser = nil
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "DELETE %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.DeleteUser)
+
+	return nil
+}
+
+// UpdateTrainOperation は、管理APIで列車の運行情報を設定します
+// 運休にした列車の予約は webapp 側で払い戻されますが、ReservationCache には反映しません
+func (c *Client) UpdateTrainOperation(ctx context.Context, operation *TrainOperationRequest, opt ...ClientOption) (*TrainOperationResponse, error) {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.UpdateTrainOperation)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	b, err := json.Marshal(operation)
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "PUT %s: リクエストに失敗しました", endpointPath)
+	}
+
+	req, err := c.sess.newRequest(ctx, http.MethodPut, u.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "PUT %s: リクエストに失敗しました", endpointPath)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.AdminToken)
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return nil, bencherror.NewWrapError(err, "PUT %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+
+	var operationResp TrainOperationResponse
+	if resp.StatusCode == successCode {
+		if err := json.NewDecoder(resp.Body).Decode(&operationResp); err != nil {
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "PUT %s: Unmarshalに失敗しました", endpointPath), req, resp)
+		}
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "PUT %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.UpdateTrainOperation)
+
+	return &operationResp, nil
+}
+
+// RegisterWaitlist は、満席の列車のキャンセル待ちを登録します
+// 登録したキャンセル待ちは ReservationCache に記録し、すぐに繰り上げられた場合は予約を追加します
+func (c *Client) RegisterWaitlist(ctx context.Context, waitlistReq *WaitlistRequest, opt ...ClientOption) (*WaitlistResponse, error) {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.RegisterWaitlist)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	b, err := json.Marshal(waitlistReq)
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+
+	date, err := util.ParseISO8601(waitlistReq.Date)
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+
+	req, err := c.sess.newRequest(ctx, http.MethodPost, u.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	// 登録時に繰り上げられることがあるので、予約キャッシュに反映するまでこの列車の空席情報は検証しない
+	// NOTE: レスポンスを受け取れなかった場合、繰り上げられたかわからないので完了としない
+	done := ReservationCache.beginChange(date, waitlistReq.TrainClass, waitlistReq.TrainName)
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return nil, bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+	defer done()
+
+	var waitlistResp WaitlistResponse
+	if resp.StatusCode == successCode {
+		if err := json.NewDecoder(resp.Body).Decode(&waitlistResp); err != nil {
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath), req, resp)
+		}
+
+		if err := ReservationCache.AddWaitlist(c.loginUser, waitlistReq, waitlistResp.WaitlistID); err != nil {
+			bencherror.SystemErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: キャンセル待ちを予約キャッシュに記録できませんでした", endpointPath), req, resp))
+		}
+		if err := c.cachePromotedWaitlist(ctx, &waitlistResp); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.RegisterWaitlist)
+
+	return &waitlistResp, nil
+}
+
+// ListWaitlist は、ログイン中のユーザのキャンセル待ちを登録順に返します
+// 繰り上げられたキャンセル待ちは、予約詳細で座席を取得して ReservationCache に追加します
+func (c *Client) ListWaitlist(ctx context.Context, opt ...ClientOption) (ListWaitlistResponse, error) {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetPath(endpoint.ListWaitlist)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	req, err := c.sess.newRequest(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, bencherror.NewApplicationError(err, "GET %s: リクエストに失敗しました", endpointPath)
+	}
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return nil, bencherror.NewWrapError(err, "GET %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+
+	var listWaitlistResp ListWaitlistResponse
+	if resp.StatusCode == successCode {
+		if err := json.NewDecoder(resp.Body).Decode(&listWaitlistResp); err != nil {
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: JSONのUnmarshalに失敗しました", endpointPath), req, resp)
+		}
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncPathCounter(endpoint.ListWaitlist)
+
+	for _, entry := range listWaitlistResp {
+		switch entry.Status {
+		case WaitlistStatusPromoted:
+			if err := c.cachePromotedWaitlist(ctx, entry); err != nil {
+				return nil, err
+			}
+		case WaitlistStatusCancelled, WaitlistStatusExpired:
+			// 運休で取り消されたものや、繰り上げを確認する前に確定期限を過ぎたものを含む
+			ReservationCache.CancelWaitlist(entry.WaitlistID)
+		}
+	}
+
+	return listWaitlistResp, nil
+}
+
+// CancelWaitlist は、キャンセル待ちを取り消します
+func (c *Client) CancelWaitlist(ctx context.Context, waitlistID int, opt ...ClientOption) error {
+	var (
+		successCode  = http.StatusOK
+		opts         = newClientOptions(successCode, opt...)
+		endpointPath = endpoint.GetDynamicPath(endpoint.CancelWaitlist, waitlistID)
+		u            = *c.baseURL
+	)
+	u.Path = filepath.Join(u.Path, endpointPath)
+
+	req, err := c.sess.newRequest(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	opts.applyCSRFToken(req)
+
+	resp, err := c.sess.do(req)
+	if err != nil {
+		return bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == successCode {
+		ReservationCache.CancelWaitlist(waitlistID)
+	}
+
+	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
+	}
+
+	endpoint.IncDynamicPathCounter(endpoint.CancelWaitlist)
+
+	return nil
+}
+
+// cachePromotedWaitlist は、繰り上げられたキャンセル待ちの予約を予約詳細で取得し、ReservationCache に追加します
+func (c *Client) cachePromotedWaitlist(ctx context.Context, entry *WaitlistResponse) error {
+	if entry.Status != WaitlistStatusPromoted || !ReservationCache.IsWaiting(entry.WaitlistID) {
+		return nil
+	}
+
+	reservation, err := c.ShowReservation(ctx, entry.ReservationID)
+	if err != nil {
+		return err
+	}
+	if err := ReservationCache.PromoteWaitlist(entry.WaitlistID, reservation); err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "キャンセル待ち %d から繰り上げられた予約を予約キャッシュに追加できませんでした", entry.WaitlistID))
+	}
+
+	return nil
+}
+
 // ListStations は駅一覧列挙APIです
 func (c *Client) ListStations(ctx context.Context, opt ...ClientOption) (ListStationsResponse, error) {
 	var (
@@ -290,12 +675,12 @@ func (c *Client) ListStations(ctx context.Context, opt ...ClientOption) (ListSta
 	var listStationsResp ListStationsResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&listStationsResp); err != nil {
-			return ListStationsResponse{}, bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath)
+			return ListStationsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return ListStationsResponse{}, bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return ListStationsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.ListStations)
@@ -327,6 +712,7 @@ func (c *Client) SearchTrains(ctx context.Context, useAt time.Time, from, to, tr
 	query.Set("child", strconv.Itoa(child))
 	req.URL.RawQuery = query.Encode()
 
+	requestedAt := time.Now()
 	resp, err := c.sess.do(req)
 	if err != nil {
 		return SearchTrainsResponse{}, bencherror.NewWrapError(err, "GET %s: 列車検索リクエストに失敗しました", endpointPath)
@@ -336,18 +722,18 @@ func (c *Client) SearchTrains(ctx context.Context, useAt time.Time, from, to, tr
 	var searchTrainsResp SearchTrainsResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&searchTrainsResp); err != nil {
-			return SearchTrainsResponse{}, bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath)
+			return SearchTrainsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if opts.autoAssert && resp.StatusCode == successCode {
-		if err := assertSearchTrains(ctx, endpointPath, searchTrainsResp); err != nil {
-			return nil, err
+		if err := assertSearchTrains(ctx, endpointPath, requestedAt, useAt, from, to, searchTrainsResp); err != nil {
+			return nil, bencherror.WithEvidence(err, req, resp)
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return SearchTrainsResponse{}, bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return SearchTrainsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.SearchTrains)
@@ -390,6 +776,7 @@ func (c *Client) SearchTrainSeats(ctx context.Context, date time.Time, trainClas
 		"to", arrival,
 	)
 
+	requestedAt := time.Now()
 	resp, err := c.sess.do(req)
 	if err != nil {
 		lgr.Warnf("座席列挙リクエスト失敗: %+v", err)
@@ -401,20 +788,20 @@ func (c *Client) SearchTrainSeats(ctx context.Context, date time.Time, trainClas
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&searchTrainSeatsResp); err != nil {
 			lgr.Warnf("座席列挙Unmarshal失敗: %+v", err)
-			return nil, bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath)
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: レスポンスのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	// NotFound、あるいはBadRequestの場合、座席を得ることはできない
 	if opts.autoAssert && resp.StatusCode == successCode {
-		if err := assertSearchTrainSeats(ctx, endpointPath, searchTrainSeatsResp); err != nil {
-			return nil, err
+		if err := assertSearchTrainSeats(ctx, endpointPath, requestedAt, date, departure, arrival, searchTrainSeatsResp); err != nil {
+			return nil, bencherror.WithEvidence(err, req, resp)
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
 		lgr.Warnf("座席列挙 ステータスコードが不正: %+v", err)
-		return nil, bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.ListTrainSeats)
@@ -456,6 +843,8 @@ func (c *Client) Reserve(
 		Adult:         adult,
 		Column:        "", // FIXME: カラムを選べるように
 		Seats:         seats,
+		Preferences:   opts.seatPreferences,
+		AllowSplit:    opts.allowSplit,
 	}
 
 	b, err := json.Marshal(reserveReq)
@@ -472,6 +861,13 @@ func (c *Client) Reserve(
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	// 予約キャッシュに反映するまで、この列車の空席情報は検証しない
+	// NOTE: レスポンスを受け取れなかった場合、予約されたかわからないので完了としない
+	done := ReservationCache.beginChange(useAt, trainClass, trainName)
+	// NOTE: 予約IDを受け取れなかった場合、履歴の検証には用いない
+	op := ReservationHistory.begin(historyOpReserve, 0, reserveReq)
 
 	resp, err := c.sess.do(req)
 	if err != nil {
@@ -484,22 +880,26 @@ func (c *Client) Reserve(
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&reserveResp); err != nil {
 			lgr.Warnf("予約リクエストのUnmarshal失敗: %+v", err)
-			return nil, bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath)
+			return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
+		ReservationHistory.complete(op, resp.StatusCode, reserveResp.ReservationID)
+	} else {
+		ReservationHistory.complete(op, resp.StatusCode, 0)
 	}
 
 	if opts.autoAssert && resp.StatusCode == successCode {
 		if err := assertCanReserve(ctx, endpointPath, reserveReq, reserveResp); err != nil {
-			return nil, err
+			return nil, bencherror.WithEvidence(err, req, resp)
 		}
 	}
 
 	if resp.StatusCode == successCode {
 		ReservationCache.Add(c.loginUser, reserveReq, reserveResp.ReservationID)
 	}
+	done()
 	if opts.autoAssert && resp.StatusCode == successCode {
 		if err := assertReserve(ctx, endpointPath, c, reserveReq, reserveResp); err != nil {
-			return nil, err
+			return nil, bencherror.WithEvidence(err, req, resp)
 		}
 	}
 	if resp.StatusCode == successCode {
@@ -512,7 +912,7 @@ func (c *Client) Reserve(
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return nil, bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return nil, bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.Reserve)
@@ -551,34 +951,38 @@ func (c *Client) CommitReservation(ctx context.Context, reservationID int, cardT
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	opts.applyCSRFToken(req)
+
+	op := ReservationHistory.begin(historyOpCommit, reservationID, nil)
 
 	resp, err := c.sess.do(req)
 	if err != nil {
 		return bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
 	}
 	defer resp.Body.Close()
+	ReservationHistory.complete(op, resp.StatusCode, reservationID)
 
 	var commitReservationResp *CommitReservationResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&commitReservationResp); err != nil {
-			return bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath)
+			return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if opts.autoAssert && resp.StatusCode == successCode {
 		if err := assertCommitReservation(ctx, endpointPath, commitReservationResp); err != nil {
-			return err
+			return bencherror.WithEvidence(err, req, resp)
 		}
 	}
 
 	if resp.StatusCode == successCode {
 		if err := ReservationCache.Commit(reservationID); err != nil {
-			bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "POST %s: 存在しない予約へのCommitを行おうとしました", endpointPath))
+			bencherror.SystemErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "POST %s: 存在しない予約へのCommitを行おうとしました", endpointPath), req, resp))
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.CommitReservation)
@@ -609,12 +1013,12 @@ func (c *Client) ListReservations(ctx context.Context, opt ...ClientOption) (Lis
 	var listReservationResp ListReservationsResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&listReservationResp); err != nil {
-			return ListReservationsResponse{}, bencherror.NewApplicationError(err, "GET %s: 予約のMarshalに失敗しました", endpointPath)
+			return ListReservationsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: 予約のMarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return ListReservationsResponse{}, bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return ListReservationsResponse{}, bencherror.WithEvidence(bencherror.NewApplicationError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncPathCounter(endpoint.ListReservations)
@@ -676,35 +1080,42 @@ func (c *Client) CancelReservation(ctx context.Context, reservationID int, opt .
 	if err != nil {
 		return bencherror.NewApplicationError(err, "POST %s: リクエストに失敗しました", endpointPath)
 	}
+	opts.applyCSRFToken(req)
+
+	// 予約キャッシュに反映するまで、この列車の空席情報は検証しない
+	done := ReservationCache.beginCancel(reservationID)
+	op := ReservationHistory.begin(historyOpCancel, reservationID, nil)
 
 	resp, err := c.sess.do(req)
 	if err != nil {
 		return bencherror.NewWrapError(err, "POST %s: リクエストに失敗しました", endpointPath)
 	}
 	defer resp.Body.Close()
+	ReservationHistory.complete(op, resp.StatusCode, reservationID)
 
 	var cancelReservationResponse *CancelReservationResponse
 	if resp.StatusCode == successCode {
 		if err := json.NewDecoder(resp.Body).Decode(&cancelReservationResponse); err != nil {
-			return bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath)
+			return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: JSONのUnmarshalに失敗しました", endpointPath), req, resp)
 		}
 	}
 
 	if opts.autoAssert && resp.StatusCode == successCode {
 		if err := assertCancelReservation(ctx, endpointPath, c, reservationID, cancelReservationResponse); err != nil {
-			return err
+			return bencherror.WithEvidence(err, req, resp)
 		}
 	}
 
 	if resp.StatusCode == successCode {
 		if err := ReservationCache.Cancel(reservationID); err != nil {
 			// FIXME: こういうベンチマーカーの異常は、利用者向けには一般的なメッセージで運営に連絡して欲しいと書き、運営向けにSlackに通知する
-			bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "存在しない予約のCancelを実施しようとしました"))
+			bencherror.SystemErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "存在しない予約のCancelを実施しようとしました"), req, resp))
 		}
 	}
+	done()
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, opts.wantStatusCode); err != nil {
-		return bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode)
+		return bencherror.WithEvidence(bencherror.NewApplicationError(err, "POST %s: ステータスコードが不正です: got=%d, want=%d", endpointPath, resp.StatusCode, opts.wantStatusCode), req, resp)
 	}
 
 	endpoint.IncDynamicPathCounter(endpoint.CancelReservation)
@@ -731,7 +1142,7 @@ func (c *Client) DownloadAsset(ctx context.Context, path string) ([]byte, error)
 	defer resp.Body.Close()
 
 	if err := bencherror.NewHTTPStatusCodeError(req, resp, successCode); err != nil {
-		return []byte{}, bencherror.PreTestErrs.AddError(bencherror.NewCriticalError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", path, resp.StatusCode, http.StatusOK))
+		return []byte{}, bencherror.PreTestErrs.AddError(bencherror.WithEvidence(bencherror.NewCriticalError(err, "GET %s: ステータスコードが不正です: got=%d, want=%d", path, resp.StatusCode, http.StatusOK), req, resp))
 	}
 
 	return ioutil.ReadAll(resp.Body)
@@ -0,0 +1,406 @@
+package isutrain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrHistoryDoubleBooking     = errors.New("区間の重なる予約が同じ座席で同時に成功しました")
+	ErrHistoryNotLinearizable   = errors.New("予約・確定・キャンセルの履歴を矛盾なく並べることができません")
+	ErrHistoryOperationTooEarly = errors.New("予約の完了前に、予約への操作が完了しています")
+	ErrHistoryDuplicatedID      = errors.New("同じ予約IDが複数の予約に払い出されました")
+)
+
+// 座席ごとの履歴の探索で訪れる状態数の上限
+// 上限を超えた場合は、判定できないものとして扱います
+const historySearchLimit = 100000
+
+var (
+	// ReservationHistory は、予約・確定・キャンセルの操作履歴です
+	// ベンチマーク終了後に、webappの予約処理が直列化可能 (linearizable) か検証するために用いられます
+	ReservationHistory = newReservationHistory()
+)
+
+// historyOpKind は操作の種類です
+type historyOpKind int
+
+const (
+	historyOpReserve historyOpKind = iota
+	historyOpCommit
+	historyOpCancel
+)
+
+func (k historyOpKind) String() string {
+	switch k {
+	case historyOpReserve:
+		return "reserve"
+	case historyOpCommit:
+		return "commit"
+	case historyOpCancel:
+		return "cancel"
+	default:
+		return "unknown"
+	}
+}
+
+// historyOpResult は操作の結果です
+type historyOpResult int
+
+const (
+	// レスポンスを受け取れなかったなど、webappに反映されたかわからない
+	historyOpIndeterminate historyOpResult = iota
+	historyOpOK
+	historyOpFailed
+)
+
+// historyOp は、ひとつの操作の呼び出しと完了の記録です
+type historyOp struct {
+	kind          historyOpKind
+	reservationID int
+	// 予約の場合のリクエスト
+	reserveReq *ReserveRequest
+
+	invokedAt   time.Time
+	completedAt time.Time
+	result      historyOpResult
+}
+
+func (op *historyOp) String() string {
+	return fmt.Sprintf("%s(%d)", op.kind, op.reservationID)
+}
+
+type reservationHistory struct {
+	mu  sync.Mutex
+	ops []*historyOp
+}
+
+func newReservationHistory() *reservationHistory {
+	return &reservationHistory{
+		ops: []*historyOp{},
+	}
+}
+
+// begin は操作の呼び出しを記録します
+// レスポンスを受け取ったら、返された操作について complete を呼び出すこと
+func (h *reservationHistory) begin(kind historyOpKind, reservationID int, reserveReq *ReserveRequest) *historyOp {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	op := &historyOp{
+		kind:          kind,
+		reservationID: reservationID,
+		reserveReq:    reserveReq,
+		invokedAt:     time.Now(),
+	}
+	h.ops = append(h.ops, op)
+	return op
+}
+
+// complete は操作の完了を記録します
+// ステータスコードが4xxであれば、webappに反映されていないものとして扱います
+func (h *reservationHistory) complete(op *historyOp, statusCode int, reservationID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	op.completedAt = time.Now()
+	switch {
+	case statusCode == http.StatusOK:
+		op.result = historyOpOK
+		op.reservationID = reservationID
+	case statusCode >= 400 && statusCode < 500:
+		op.result = historyOpFailed
+	default:
+		op.result = historyOpIndeterminate
+	}
+}
+
+// historySeat は履歴を分割する単位となる座席です
+type historySeat struct {
+	date       string
+	trainClass string
+	trainName  string
+	carNum     int
+	seatRow    int
+	seatColumn string
+}
+
+func (s historySeat) String() string {
+	return fmt.Sprintf("%s %s %s %d号車 %d%s", s.date, s.trainClass, s.trainName, s.carNum, s.seatRow, s.seatColumn)
+}
+
+// Check は、記録した履歴が直列化可能か検証します
+// 座席ごとに履歴を分割し、各操作の呼び出しから完了までの間に、操作が一瞬で行われたとみなせる順序を探索します
+func (h *reservationHistory) Check() []error {
+	h.mu.Lock()
+	ops := make([]*historyOp, 0, len(h.ops))
+	for _, op := range h.ops {
+		// 失敗した操作は何も変更しないので、どの順序にも矛盾しない
+		if op.result == historyOpFailed {
+			continue
+		}
+		copied := *op
+		ops = append(ops, &copied)
+	}
+	h.mu.Unlock()
+
+	errs := []error{}
+
+	// 予約IDから予約操作を引けるようにする
+	// 結果のわからない予約は予約IDがわからないので対象外
+	reserves := map[int]*historyOp{}
+	for _, op := range ops {
+		if op.kind != historyOpReserve || op.result != historyOpOK {
+			continue
+		}
+		if _, ok := reserves[op.reservationID]; ok {
+			errs = append(errs, bencherror.NewCriticalError(ErrHistoryDuplicatedID, "同じ予約IDが複数の予約に払い出されました: 予約=%d", op.reservationID))
+			continue
+		}
+		reserves[op.reservationID] = op
+	}
+
+	partitions := map[historySeat][]*historyOp{}
+	for _, op := range ops {
+		var reserve *historyOp
+		if op.kind == historyOpReserve {
+			if op.result != historyOpOK {
+				continue
+			}
+			reserve = op
+		} else {
+			r, ok := reserves[op.reservationID]
+			if !ok {
+				continue
+			}
+			reserve = r
+			if op.result == historyOpOK && op.completedAt.Before(reserve.invokedAt) {
+				errs = append(errs, bencherror.NewCriticalError(ErrHistoryOperationTooEarly, "予約の完了前に、予約への操作が完了しています: 予約=%d, 操作=%s", op.reservationID, op.kind))
+				continue
+			}
+			// 結果のわからない確定は状態を変えないので対象外
+			if op.kind == historyOpCommit && op.result == historyOpIndeterminate {
+				continue
+			}
+		}
+
+		// 自由席や、座席を指定しない予約は座席がわからないので対象外
+		req := reserve.reserveReq
+		if req.SeatClass == "non-reserved" {
+			continue
+		}
+		for _, seat := range req.Seats {
+			key := historySeat{
+				date:       req.Date,
+				trainClass: req.TrainClass,
+				trainName:  req.TrainName,
+				carNum:     req.CarNum,
+				seatRow:    seat.Row,
+				seatColumn: seat.Column,
+			}
+			partitions[key] = append(partitions[key], op)
+		}
+	}
+
+	// エラーの順序を安定させるため、座席順に検証する
+	seats := make([]historySeat, 0, len(partitions))
+	for seat := range partitions {
+		seats = append(seats, seat)
+	}
+	sort.Slice(seats, func(i, j int) bool {
+		return seats[i].String() < seats[j].String()
+	})
+
+	lgr := zap.S()
+	for _, seat := range seats {
+		seatOps := partitions[seat]
+		checker := newSeatHistoryChecker(seatOps, reserves)
+		linearizable, err := checker.check()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if checker.visited > historySearchLimit {
+			lgr.Warnf("座席の履歴が長すぎるため、直列化可能か判定できませんでした: 座席=%s, 操作数=%d", seat, len(seatOps))
+			continue
+		}
+		if !linearizable {
+			errs = append(errs, checker.explain(seat))
+		}
+	}
+
+	return errs
+}
+
+// seatHistoryChecker は、ひとつの座席の履歴が直列化可能か探索します
+type seatHistoryChecker struct {
+	ops      []*historyOp
+	reserves map[int]*historyOp
+
+	// 探索済みの状態 (直列化済みの操作の集合)
+	seen    map[string]bool
+	visited int
+}
+
+func newSeatHistoryChecker(ops []*historyOp, reserves map[int]*historyOp) *seatHistoryChecker {
+	sorted := make([]*historyOp, len(ops))
+	copy(sorted, ops)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].invokedAt.Before(sorted[j].invokedAt)
+	})
+	return &seatHistoryChecker{
+		ops:      sorted,
+		reserves: reserves,
+		seen:     map[string]bool{},
+	}
+}
+
+func (c *seatHistoryChecker) check() (bool, error) {
+	return c.search(make([]bool, len(c.ops)))
+}
+
+// isPending は、操作がまだ直列化されておらず、必ず直列化しなければならないかを返します
+// 結果のわからない操作は、反映されなかったものとして直列化しなくてもよい
+func (c *seatHistoryChecker) isPending(linearized []bool, i int) bool {
+	return !linearized[i] && c.ops[i].result == historyOpOK
+}
+
+func (c *seatHistoryChecker) search(linearized []bool) (bool, error) {
+	var (
+		key  strings.Builder
+		done = true
+		// 直列化していない操作のうち、最も早く完了した時刻
+		earliest time.Time
+	)
+	for i, ok := range linearized {
+		if ok {
+			key.WriteByte('1')
+		} else {
+			key.WriteByte('0')
+		}
+		if c.isPending(linearized, i) {
+			done = false
+			if earliest.IsZero() || c.ops[i].completedAt.Before(earliest) {
+				earliest = c.ops[i].completedAt
+			}
+		}
+	}
+	if done {
+		return true, nil
+	}
+	if c.seen[key.String()] || c.visited > historySearchLimit {
+		return false, nil
+	}
+	c.seen[key.String()] = true
+	c.visited++
+
+	for i, op := range c.ops {
+		if linearized[i] {
+			continue
+		}
+		// 他の操作の完了後に呼び出された操作は、その操作より先に直列化できない
+		if op.invokedAt.After(earliest) {
+			continue
+		}
+		ok, err := c.canApply(linearized, op)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+
+		linearized[i] = true
+		ok, err = c.search(linearized)
+		linearized[i] = false
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// active は、直列化済みの操作を適用した時点で有効な予約を返します
+func (c *seatHistoryChecker) active(linearized []bool) map[int]bool {
+	active := map[int]bool{}
+	for i, op := range c.ops {
+		if linearized[i] && op.kind == historyOpReserve {
+			active[op.reservationID] = true
+		}
+	}
+	for i, op := range c.ops {
+		if linearized[i] && op.kind == historyOpCancel {
+			delete(active, op.reservationID)
+		}
+	}
+	return active
+}
+
+// canApply は、直列化済みの操作の後に、操作を適用できるかを返します
+func (c *seatHistoryChecker) canApply(linearized []bool, op *historyOp) (bool, error) {
+	active := c.active(linearized)
+	switch op.kind {
+	case historyOpReserve:
+		for reservationID := range active {
+			other := c.reserves[reservationID].reserveReq
+			overwrap, err := IsSectionOverwrap(other.Departure, other.Arrival, op.reserveReq.Departure, op.reserveReq.Arrival)
+			if err != nil {
+				return false, err
+			}
+			if overwrap {
+				return false, nil
+			}
+		}
+		return true, nil
+	case historyOpCommit, historyOpCancel:
+		// キャンセル済みの予約は有効でないので、確定やキャンセルはできない
+		return active[op.reservationID], nil
+	default:
+		return false, nil
+	}
+}
+
+// explain は、直列化できなかった履歴をエラーにします
+// キャンセルを含まない履歴で区間の重なる予約が成功していれば、二重予約として報告します
+func (c *seatHistoryChecker) explain(seat historySeat) error {
+	var (
+		hasCancel bool
+		reserves  []*historyOp
+		opStrs    []string
+	)
+	for _, op := range c.ops {
+		if op.kind == historyOpCancel {
+			hasCancel = true
+		}
+		if op.kind == historyOpReserve {
+			reserves = append(reserves, op)
+		}
+		opStrs = append(opStrs, op.String())
+	}
+
+	if !hasCancel {
+		for i := 0; i < len(reserves); i++ {
+			for j := i + 1; j < len(reserves); j++ {
+				a, b := reserves[i].reserveReq, reserves[j].reserveReq
+				overwrap, err := IsSectionOverwrap(a.Departure, a.Arrival, b.Departure, b.Arrival)
+				if err != nil || !overwrap {
+					continue
+				}
+				return bencherror.NewCriticalError(ErrHistoryDoubleBooking, "区間の重なる予約が同じ座席で同時に成功しました: 予約=%d,%d 座席=%s",
+					reserves[i].reservationID, reserves[j].reservationID, seat)
+			}
+		}
+	}
+
+	return bencherror.NewCriticalError(ErrHistoryNotLinearizable, "予約・確定・キャンセルの履歴を矛盾なく並べることができません: 座席=%s, 履歴=%s",
+		seat, strings.Join(opStrs, ","))
+}
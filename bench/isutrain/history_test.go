@@ -0,0 +1,107 @@
+package isutrain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/morikuni/failure"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservationHistory_Check(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time {
+		return base.Add(time.Duration(sec) * time.Second)
+	}
+	reserve := func(id int, departure, arrival string, invoked, completed int) *historyOp {
+		return &historyOp{
+			kind:          historyOpReserve,
+			reservationID: id,
+			reserveReq: &ReserveRequest{
+				Date:       "2020/01/01",
+				TrainClass: "遅いやつ",
+				TrainName:  "163",
+				SeatClass:  "reserved",
+				CarNum:     16,
+				Departure:  departure,
+				Arrival:    arrival,
+				Seats:      TrainSeats{{Row: 1, Column: "A"}},
+			},
+			invokedAt:   at(invoked),
+			completedAt: at(completed),
+			result:      historyOpOK,
+		}
+	}
+	cancel := func(id int, invoked, completed int) *historyOp {
+		return &historyOp{
+			kind:          historyOpCancel,
+			reservationID: id,
+			invokedAt:     at(invoked),
+			completedAt:   at(completed),
+			result:        historyOpOK,
+		}
+	}
+	check := func(ops ...*historyOp) []error {
+		h := newReservationHistory()
+		h.ops = ops
+		return h.Check()
+	}
+
+	// 区間が重ならない予約は同時に成功してよい
+	assert.Empty(t, check(
+		reserve(1, "東京", "古岡", 0, 2),
+		reserve(2, "名古屋", "大阪", 1, 3),
+	))
+
+	// 区間の重なる予約が同時に成功した
+	errs := check(
+		reserve(1, "東京", "大阪", 0, 2),
+		reserve(2, "名古屋", "大阪", 1, 3),
+	)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrHistoryDoubleBooking, failure.CauseOf(errs[0]))
+	}
+
+	// キャンセルと並行した予約は、キャンセル後に処理されたとみなせる
+	assert.Empty(t, check(
+		reserve(1, "東京", "大阪", 0, 1),
+		cancel(1, 2, 4),
+		reserve(2, "名古屋", "大阪", 3, 5),
+	))
+
+	// キャンセルの完了前に予約が完了した
+	errs = check(
+		reserve(1, "東京", "大阪", 0, 1),
+		reserve(2, "名古屋", "大阪", 2, 3),
+		cancel(1, 4, 5),
+	)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrHistoryNotLinearizable, failure.CauseOf(errs[0]))
+	}
+
+	// 予約の呼び出し前にキャンセルが完了した
+	errs = check(
+		cancel(1, 0, 1),
+		reserve(1, "東京", "大阪", 2, 3),
+	)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrHistoryOperationTooEarly, failure.CauseOf(errs[0]))
+	}
+
+	// 結果のわからないキャンセルは、反映されたとみなしてもよい
+	indeterminate := cancel(1, 2, 0)
+	indeterminate.result = historyOpIndeterminate
+	assert.Empty(t, check(
+		reserve(1, "東京", "大阪", 0, 1),
+		indeterminate,
+		reserve(2, "名古屋", "大阪", 3, 4),
+	))
+
+	// 失敗した予約は何も変更しない
+	failed := reserve(2, "名古屋", "大阪", 1, 3)
+	failed.result = historyOpFailed
+	assert.Empty(t, check(
+		reserve(1, "東京", "大阪", 0, 2),
+		failed,
+	))
+}
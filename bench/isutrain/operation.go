@@ -0,0 +1,30 @@
+package isutrain
+
+// 列車の運行状態
+const (
+	TrainStatusNormal    = "normal"
+	TrainStatusDelayed   = "delayed"
+	TrainStatusCancelled = "cancelled"
+)
+
+// 運行情報API /api/admin/operations
+type (
+	TrainOperationRequest struct {
+		Date         string `json:"date"`
+		TrainClass   string `json:"train_class"`
+		TrainName    string `json:"train_name"`
+		Status       string `json:"status"`
+		DelayMinutes int    `json:"delay_minutes"`
+	}
+
+	TrainOperationResponse struct {
+		Date         string `json:"date"`
+		TrainClass   string `json:"train_class"`
+		TrainName    string `json:"train_name"`
+		Status       string `json:"status"`
+		DelayMinutes int    `json:"delay_minutes"`
+		// 運休により払い戻した予約と、rejectedにした予約の件数
+		Refunded int `json:"refunded,omitempty"`
+		Rejected int `json:"rejected,omitempty"`
+	}
+)
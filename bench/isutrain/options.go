@@ -1,5 +1,7 @@
 package isutrain
 
+import "net/http"
+
 type ClientOption func(o *ClientOptions)
 
 type ClientOptions struct {
@@ -12,6 +14,14 @@ type ClientOptions struct {
 	// 検索結果の座席数をアサーションするか否か
 	seatCount       int
 	assertSeatCount bool
+
+	// webappに送るCSRFトークン. nilの場合はcookieのトークンを送る
+	csrfToken *string
+
+	// あいまい予約の座席の希望
+	seatPreferences *SeatPreferences
+	// あいまい予約で隣り合う号車に分けて予約するか
+	allowSplit bool
 }
 
 func newClientOptions(statusCode int, opts ...ClientOption) *ClientOptions {
@@ -59,3 +69,36 @@ func EnableAssertSeatCountOpt(count int) ClientOption {
 		o.assertSeatCount = true
 	}
 }
+
+// CSRFTokenOpt は、webappに送るCSRFトークンを差し替えます
+// 空文字列を指定した場合は、トークンを送りません
+func CSRFTokenOpt(token string) ClientOption {
+	return func(o *ClientOptions) {
+		o.csrfToken = &token
+	}
+}
+
+// SeatPreferencesOpt は、あいまい予約に座席の希望を指定します
+func SeatPreferencesOpt(preferences *SeatPreferences) ClientOption {
+	return func(o *ClientOptions) {
+		o.seatPreferences = preferences
+	}
+}
+
+// AllowSplitOpt は、あいまい予約で1つの号車にまとめて予約できない場合に、隣り合う号車に分けて予約させます
+func AllowSplitOpt() ClientOption {
+	return func(o *ClientOptions) {
+		o.allowSplit = true
+	}
+}
+
+func (o *ClientOptions) applyCSRFToken(req *http.Request) {
+	if o.csrfToken == nil {
+		return
+	}
+	if *o.csrfToken == "" {
+		req.Header.Del(CSRFHeaderName)
+		return
+	}
+	req.Header.Set(CSRFHeaderName, *o.csrfToken)
+}
@@ -0,0 +1,107 @@
+package isutrain
+
+import "github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+
+// あいまい予約の座席の希望
+type (
+	SeatPreferences struct {
+		// Window は窓側 (指定席はA/E, プレミアム席はA/D) の希望です
+		Window bool `json:"window"`
+		// Aisle は通路側 (指定席はC/D, プレミアム席はB/C) の希望です
+		Aisle bool `json:"aisle"`
+		// NearExit は出入口に近い席 (号車の最前列・最後列) の希望です
+		NearExit bool `json:"near_exit"`
+		// CarFrom, CarTo は号車の範囲です. 0なら制限しません
+		CarFrom int `json:"car_from"`
+		CarTo   int `json:"car_to"`
+		// Required なら、 Window, Aisle, NearExit を満たせない場合は予約されません
+		Required bool `json:"required"`
+	}
+
+	SatisfiedPreferences struct {
+		Window   bool `json:"window"`
+		Aisle    bool `json:"aisle"`
+		NearExit bool `json:"near_exit"`
+	}
+)
+
+func IsWindowSeat(seatClass, column string) bool {
+	if seatClass == "premium" {
+		return column == "A" || column == "D"
+	}
+	return column == "A" || column == "E"
+}
+
+func IsAisleSeat(seatClass, column string) bool {
+	if seatClass == "premium" {
+		return column == "B" || column == "C"
+	}
+	return column == "C" || column == "D"
+}
+
+func isNearExitSeat(carNum, row int) bool {
+	return row == 1 || row == isutraindb.GetCarRows(carNum)
+}
+
+// InCarRange は、号車が希望の範囲に含まれるかを返します
+func (p *SeatPreferences) InCarRange(carNum int) bool {
+	if p.CarFrom > 0 && carNum < p.CarFrom {
+		return false
+	}
+	if p.CarTo > 0 && carNum > p.CarTo {
+		return false
+	}
+	return true
+}
+
+// Score は、座席が満たす希望の数を返します
+func (p *SeatPreferences) Score(seatClass string, carNum, row int, column string) int {
+	score := 0
+	if p.Window && IsWindowSeat(seatClass, column) {
+		score++
+	}
+	if p.Aisle && IsAisleSeat(seatClass, column) {
+		score++
+	}
+	if p.NearExit && isNearExitSeat(carNum, row) {
+		score++
+	}
+	return score
+}
+
+// WantScore は、希望した項目の数を返します
+func (p *SeatPreferences) WantScore() int {
+	score := 0
+	for _, requested := range []bool{p.Window, p.Aisle, p.NearExit} {
+		if requested {
+			score++
+		}
+	}
+	return score
+}
+
+// Satisfied は、全ての座席が満たした希望を返します. 希望していない項目は false になります
+func (p *SeatPreferences) Satisfied(seatClass string, carNum int, seats ReservationSeats) *SatisfiedPreferences {
+	satisfied := &SatisfiedPreferences{
+		Window:   p.Window,
+		Aisle:    p.Aisle,
+		NearExit: p.NearExit,
+	}
+	for _, seat := range seats {
+		if !IsWindowSeat(seatClass, seat.SeatColumn) {
+			satisfied.Window = false
+		}
+		if !IsAisleSeat(seatClass, seat.SeatColumn) {
+			satisfied.Aisle = false
+		}
+		if !isNearExitSeat(carNum, seat.SeatRow) {
+			satisfied.NearExit = false
+		}
+	}
+	return satisfied
+}
+
+// SatisfiesAll は、希望した項目を全て満たしたかを返します
+func (s *SatisfiedPreferences) SatisfiesAll(p *SeatPreferences) bool {
+	return s.Window == p.Window && s.Aisle == p.Aisle && s.NearExit == p.NearExit
+}
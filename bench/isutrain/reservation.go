@@ -23,12 +23,18 @@ type (
 		Adult         int        `json:"adult"`
 		Column        string     `json:"Column"`
 		Seats         TrainSeats `json:"seats"`
+		// Preferences は、あいまい予約の座席の希望です
+		Preferences *SeatPreferences `json:"preferences,omitempty"`
+		// AllowSplit なら、あいまい予約で1つの号車にまとめて予約できない場合に隣り合う号車に分けて予約されます
+		AllowSplit bool `json:"allow_split,omitempty"`
 	}
 
 	ReserveResponse struct {
 		ReservationID int  `json:"reservation_id"`
 		Amount        int  `json:"amount"`
 		IsOk          bool `json:"is_ok"`
+		// Preferences は、予約した全ての座席が満たした希望です
+		Preferences *SatisfiedPreferences `json:"preferences,omitempty"`
 	}
 )
 
@@ -53,6 +59,10 @@ type (
 		DepartureTime string           `json:"departure_time"`
 		ArrivalTime   string           `json:"arrival_time"`
 		Seats         ReservationSeats `json:"seats"`
+		TrainStatus   string           `json:"train_status,omitempty"`
+		DelayMinutes  int              `json:"delay_minutes,omitempty"`
+		// Refunded は、運休により払い戻された予約かどうかです
+		Refunded bool `json:"refunded,omitempty"`
 	}
 
 	ReservationSeat struct {
@@ -64,6 +74,15 @@ type (
 	ReservationSeats []*ReservationSeat
 )
 
+// SeatCarNumber は座席の号車を返します
+// 座席ごとの号車が返されない場合は、予約の号車とみなします
+func (r *Reservation) SeatCarNumber(seat *ReservationSeat) int {
+	if seat.CarNumber != 0 {
+		return seat.CarNumber
+	}
+	return r.CarNumber
+}
+
 // 隣り合うパターンを見つけたら加算する
 func (seats ReservationSeats) GetNeighborSeatsBonus() int {
 	m := map[int]int{}
@@ -84,6 +84,10 @@ type reservationCache struct {
 	reservations         map[int]*ReservationCacheEntry
 	commitedReservations map[int]*ReservationCacheEntry
 	canceledReservations map[int]*ReservationCacheEntry
+	// 列車ごとの予約と、予約・キャンセルの処理状況
+	trains map[trainKey]*trainActivity
+	// waitlistID -> 繰り上げを確認していないキャンセル待ち
+	waitlist map[int]*waitlistCacheEntry
 }
 
 func newReservationCache() *reservationCache {
@@ -91,6 +95,8 @@ func newReservationCache() *reservationCache {
 		reservations:         map[int]*ReservationCacheEntry{},
 		commitedReservations: map[int]*ReservationCacheEntry{},
 		canceledReservations: map[int]*ReservationCacheEntry{},
+		trains:               map[trainKey]*trainActivity{},
+		waitlist:             map[int]*waitlistCacheEntry{},
 	}
 }
 
@@ -134,45 +140,13 @@ func (r *reservationCache) CanReserve(req *ReserveRequest) (bool, error) {
 	lgr := zap.S()
 
 	canReserveWithOverwrap := func(reservation *ReservationCacheEntry) (bool, error) {
-		reqKudari, err := isKudari(req.Departure, req.Arrival)
+		overwrap, err := IsSectionOverwrap(reservation.Departure, reservation.Arrival, req.Departure, req.Arrival)
 		if err != nil {
-			lgr.Warnf("予約可能判定の 下り判定でエラーが発生: %+v", err)
+			lgr.Warnf("予約可能判定の 区間重複判定でエラーが発生: %+v", err)
 			return false, err
 		}
 
-		resKudari, err := isKudari(reservation.Departure, reservation.Arrival)
-		if err != nil {
-			lgr.Warnf("予約可能判定の 下り判定でエラーが発生: %+v", err)
-			return false, err
-		}
-
-		// 上りと下りが一致しなければ、予約として被らない
-		if reqKudari != resKudari {
-			return true, nil
-		}
-
-		if reqKudari {
-			overwrap, err := isKudariOverwrap(reservation.Departure, reservation.Arrival, req.Departure, req.Arrival)
-			if err != nil {
-				return false, nil
-			}
-
-			if overwrap {
-				return false, nil
-			}
-		} else {
-			// NOTE: 下りベースの判定関数を用いるため、上りの場合は乗車・降車を入れ替えて渡す
-			overwrap, err := isKudariOverwrap(reservation.Arrival, reservation.Departure, req.Arrival, req.Departure)
-			if err != nil {
-				return false, nil
-			}
-
-			if overwrap {
-				return false, nil
-			}
-		}
-
-		return true, nil
+		return !overwrap, nil
 	}
 
 	eg := errgroup.Group{}
@@ -233,7 +207,7 @@ func (r *reservationCache) Add(user *User, req *ReserveRequest, reservationID in
 	}
 
 	// TODO: webappから意図的にreservationIDを細工して変に整合性つけることができないか考える
-	r.reservations[reservationID] = &ReservationCacheEntry{
+	entry := &ReservationCacheEntry{
 		User:       user,
 		ID:         reservationID,
 		Date:       date,
@@ -247,6 +221,10 @@ func (r *reservationCache) Add(user *User, req *ReserveRequest, reservationID in
 		Adult:      req.Adult,
 		Child:      req.Child,
 	}
+	r.reservations[reservationID] = entry
+	activity := r.trainActivity(newTrainKey(date, req.TrainClass, req.TrainName))
+	activity.reservations = append(activity.reservations, entry)
+
 	lgr.Infow("予約キャッシュ追加",
 		"user", user,
 		"id", reservationID,
@@ -304,6 +282,46 @@ func (r *reservationCache) Cancel(reservationID int) error {
 	return nil
 }
 
+// UserReservations は、ユーザごとの予約です
+type UserReservations struct {
+	User *User
+	// キャンセルされていない予約
+	Reservations []*ReservationCacheEntry
+	// キャンセルされた予約
+	Canceled []*ReservationCacheEntry
+}
+
+// UserReservations は、予約をユーザごとにまとめて返します
+func (r *reservationCache) UserReservations() []*UserReservations {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		userReservations = []*UserReservations{}
+		emailIdx         = map[string]int{}
+	)
+	for _, reservation := range r.reservations {
+		if reservation.User == nil {
+			continue
+		}
+
+		idx, ok := emailIdx[reservation.User.Email]
+		if !ok {
+			idx = len(userReservations)
+			emailIdx[reservation.User.Email] = idx
+			userReservations = append(userReservations, &UserReservations{User: reservation.User})
+		}
+
+		if _, ok := r.canceledReservations[reservation.ID]; ok {
+			userReservations[idx].Canceled = append(userReservations[idx].Canceled, reservation)
+		} else {
+			userReservations[idx].Reservations = append(userReservations[idx].Reservations, reservation)
+		}
+	}
+
+	return userReservations
+}
+
 func (r *reservationCache) RangeCommited(f func(reservation *ReservationCacheEntry)) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -321,3 +339,49 @@ func (r *reservationCache) RangeCanceled(f func(reservation *ReservationCacheEnt
 		f(reservation)
 	}
 }
+
+// activeUserReservationIDs は、ユーザのキャンセルされていない予約のIDを返します
+func (r *reservationCache) activeUserReservationIDs(email string) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := []int{}
+	for id, reservation := range r.reservations {
+		if reservation.User == nil || reservation.User.Email != email {
+			continue
+		}
+		if _, ok := r.canceledReservations[id]; ok {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// UpdateUser は、メールアドレスやパスワードを変更したユーザの予約を、変更後のユーザに付け替えます
+func (r *reservationCache) UpdateUser(email string, user *User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reservation := range r.reservations {
+		if reservation.User != nil && reservation.User.Email == email {
+			reservation.User = user
+		}
+	}
+}
+
+// DeleteUser は、退会したユーザの予約を全てキャンセル済みにします
+// 退会したユーザではログインできないので、UserReservations の対象から外します
+func (r *reservationCache) DeleteUser(email string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, reservation := range r.reservations {
+		if reservation.User == nil || reservation.User.Email != email {
+			continue
+		}
+		r.canceledReservations[id] = reservation
+		delete(r.commitedReservations, id)
+		reservation.User = nil
+	}
+}
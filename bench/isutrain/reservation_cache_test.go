@@ -449,3 +449,82 @@ func TestReservationMem_CanReserve_Nobori(t *testing.T) {
 		log.Println("=============")
 	}
 }
+
+func TestReservationMem_UserReservations(t *testing.T) {
+	mem := newReservationCache()
+
+	var (
+		user1 = &User{Email: "user1@example.com", Password: "user1"}
+		user2 = &User{Email: "user2@example.com", Password: "user2"}
+		req   = &ReserveRequest{
+			Date:       util.FormatISO8601(time.Now()),
+			Departure:  "東京",
+			Arrival:    "大阪",
+			TrainClass: "test1",
+			TrainName:  "test1",
+		}
+	)
+	assert.NoError(t, mem.Add(user1, req, 1))
+	assert.NoError(t, mem.Add(user1, req, 2))
+	assert.NoError(t, mem.Add(user2, req, 3))
+	assert.NoError(t, mem.Cancel(2))
+
+	userReservations := mem.UserReservations()
+	assert.Len(t, userReservations, 2)
+	for _, r := range userReservations {
+		switch r.User.Email {
+		case user1.Email:
+			assert.Len(t, r.Reservations, 1)
+			assert.Len(t, r.Canceled, 1)
+			assert.Equal(t, 2, r.Canceled[0].ID)
+		case user2.Email:
+			assert.Len(t, r.Reservations, 1)
+			assert.Empty(t, r.Canceled)
+		default:
+			t.Errorf("unexpected user: %s", r.User.Email)
+		}
+	}
+}
+
+func TestReservationCache_UpdateAndDeleteUser(t *testing.T) {
+	mem := newReservationCache()
+
+	var (
+		user  = &User{Email: "hoge@example.com", Password: "hoge"}
+		other = &User{Email: "fuga@example.com", Password: "fuga"}
+		req   = &ReserveRequest{
+			Date:       util.FormatISO8601(time.Now()),
+			Departure:  "東京",
+			Arrival:    "大阪",
+			TrainClass: "最速",
+			TrainName:  "1",
+		}
+	)
+	assert.NoError(t, mem.Add(user, req, 1))
+	assert.NoError(t, mem.Add(user, req, 2))
+	assert.NoError(t, mem.Add(other, req, 3))
+	assert.NoError(t, mem.Commit(1))
+	assert.NoError(t, mem.Commit(3))
+	assert.NoError(t, mem.Cancel(2))
+
+	assert.ElementsMatch(t, []int{1}, mem.activeUserReservationIDs(user.Email))
+
+	changed := &User{Email: "piyo@example.com", Password: "piyo"}
+	mem.UpdateUser(user.Email, changed)
+	assert.Empty(t, mem.activeUserReservationIDs(user.Email))
+	assert.ElementsMatch(t, []int{1}, mem.activeUserReservationIDs(changed.Email))
+
+	mem.DeleteUser(changed.Email)
+	assert.Equal(t, 1, mem.CommitedLen())
+	canceled := []int{}
+	mem.RangeCanceled(func(reservation *ReservationCacheEntry) {
+		canceled = append(canceled, reservation.ID)
+	})
+	assert.ElementsMatch(t, []int{1, 2}, canceled)
+
+	// 退会したユーザは予約の整合性チェックの対象外
+	userReservations := mem.UserReservations()
+	if assert.Len(t, userReservations, 1) {
+		assert.Equal(t, other.Email, userReservations[0].User.Email)
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
 	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/traffic"
 	"golang.org/x/xerrors"
 )
 
@@ -18,8 +22,19 @@ var (
 	ErrRedirect = errors.New("redirectが検出されました")
 )
 
+// webappがCSRF対策に用いるcookieとヘッダ
+// NOTE: フロントエンドのaxiosのデフォルトに合わせている
+const (
+	CSRFCookieName = "XSRF-TOKEN"
+	CSRFHeaderName = "X-XSRF-TOKEN"
+)
+
 type Session struct {
+	// id はトラフィック記録時に、セッションごとのcookie jarを区別するための識別子
+	id         uint64
 	httpClient *http.Client
+	// target はリクエストの統計を記録する負荷走行対象
+	target *target
 }
 
 func NewSession() (*Session, error) {
@@ -29,6 +44,7 @@ func NewSession() (*Session, error) {
 	}
 
 	return &Session{
+		id: traffic.NewSessionID(),
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -47,6 +63,7 @@ func NewSession() (*Session, error) {
 
 func newSessionForInitialize() (*Session, error) {
 	return &Session{
+		id: traffic.NewSessionID(),
 		httpClient: &http.Client{
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{
@@ -73,23 +90,64 @@ func (sess *Session) newRequest(ctx context.Context, method, uri string, body io
 	req = req.WithContext(ctx)
 	req.Header.Add("User-Agent", config.UserAgent)
 
+	// ブラウザと同様に、状態を変更するリクエストではCSRFトークンを送る
+	if method != http.MethodGet {
+		if token := sess.csrfToken(req.URL); token != "" {
+			req.Header.Set(CSRFHeaderName, token)
+		}
+	}
+
 	return req, nil
 }
 
+// csrfToken は、webappから発行されたCSRFトークンをcookieから取得します
+// NOTE: CSRF対策を実装していないwebappでは空文字列を返す
+func (sess *Session) csrfToken(u *url.URL) string {
+	if sess.httpClient.Jar == nil {
+		return ""
+	}
+	for _, cookie := range sess.httpClient.Jar.Cookies(u) {
+		if cookie.Name == CSRFCookieName {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// NOTE: エラー発生時のエビデンスとしてレスポンスボディを残すため、ボディは読み出した上で bencherror.EvidenceBody に差し替える
 func (sess *Session) do(req *http.Request) (*http.Response, error) {
-	resp, err := sess.httpClient.Do(req)
-	if err != nil {
-		var netErr net.Error
-		if xerrors.As(err, &netErr) {
-			if netErr.Timeout() {
-				return nil, bencherror.NewTimeoutError(err, "アプリケーションへのリクエストがタイムアウトしました")
-			} else if netErr.Temporary() {
-				return nil, bencherror.NewTemporaryError(err, "アプリケーションへのリクエストで一時的エラーが発生しました")
-			}
+	startedAt := time.Now()
+	resp, err := traffic.Do(sess.id, sess.httpClient, req)
+	if sess.target != nil {
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
 		}
+		sess.target.record(time.Since(startedAt), statusCode)
+	}
+	if err != nil {
+		return nil, bencherror.WithEvidence(wrapRequestError(err), req, nil)
+	}
 
-		return nil, bencherror.NewApplicationError(err, "アプリケーションへのリクエストが失敗しました")
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, bencherror.WithEvidence(wrapRequestError(err), req, nil)
 	}
+	resp.Body = bencherror.NewEvidenceBody(body)
 
 	return resp, nil
 }
+
+func wrapRequestError(err error) error {
+	var netErr net.Error
+	if xerrors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return bencherror.NewTimeoutError(err, "アプリケーションへのリクエストがタイムアウトしました")
+		} else if netErr.Temporary() {
+			return bencherror.NewTemporaryError(err, "アプリケーションへのリクエストで一時的エラーが発生しました")
+		}
+	}
+
+	return bencherror.NewApplicationError(err, "アプリケーションへのリクエストが失敗しました")
+}
@@ -123,3 +123,26 @@ func TestKudari(t *testing.T) {
 		assert.Equal(t, tt.wantIsKudari, kudari)
 	}
 }
+
+func TestIsSectionOverwrap(t *testing.T) {
+	tests := []struct {
+		aDeparture     string
+		aArrival       string
+		bDeparture     string
+		bArrival       string
+		wantIsOverwrap bool
+	}{
+		{"東京", "大阪", "初野", "山田", true},
+		{"大阪", "東京", "山田", "初野", true},
+		{"東京", "山田", "山田", "大阪", false},
+		{"大阪", "山田", "山田", "東京", false},
+		// 上りと下りは重ならない
+		{"東京", "大阪", "大阪", "東京", false},
+	}
+
+	for _, tt := range tests {
+		overwrap, err := IsSectionOverwrap(tt.aDeparture, tt.aArrival, tt.bDeparture, tt.bArrival)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.wantIsOverwrap, overwrap, "a=%s-%s b=%s-%s", tt.aDeparture, tt.aArrival, tt.bDeparture, tt.bArrival)
+	}
+}
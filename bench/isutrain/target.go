@@ -0,0 +1,143 @@
+package isutrain
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+)
+
+var (
+	ErrTargetNotFound = errors.New("負荷走行対象が指定されていません")
+)
+
+// target は負荷走行対象のひとつです
+// クライアントは作成時にひとつの対象を割り当てられ、以降のリクエストは全てその対象へ送ります
+// NOTE: セッションのcookieは、ログインした対象でのみ有効であることを想定しています
+type target struct {
+	baseURL *url.URL
+
+	clients  int64
+	requests int64
+	failures int64
+	// レスポンスを受け取るまでの時間の合計 (ナノ秒)
+	latency int64
+}
+
+// TargetStat は負荷走行対象ごとのリクエストの統計です
+type TargetStat struct {
+	URL      string `json:"url"`
+	Clients  int64  `json:"clients"`
+	Requests int64  `json:"requests"`
+	// レスポンスを受け取れなかったリクエストと、ステータスコードが5xxのリクエストの数
+	Failures int64 `json:"failures"`
+	// レスポンスを受け取るまでの平均時間 (ミリ秒)
+	AvgLatencyMillis int64 `json:"avg_latency_ms"`
+}
+
+func (t *target) record(elapsed time.Duration, statusCode int) {
+	atomic.AddInt64(&t.requests, 1)
+	atomic.AddInt64(&t.latency, int64(elapsed))
+	if statusCode == 0 || statusCode >= 500 {
+		atomic.AddInt64(&t.failures, 1)
+	}
+}
+
+func (t *target) stat() *TargetStat {
+	var (
+		requests = atomic.LoadInt64(&t.requests)
+		latency  = atomic.LoadInt64(&t.latency)
+		stat     = &TargetStat{
+			URL:      t.baseURL.String(),
+			Clients:  atomic.LoadInt64(&t.clients),
+			Requests: requests,
+			Failures: atomic.LoadInt64(&t.failures),
+		}
+	)
+	if requests > 0 {
+		stat.AvgLatencyMillis = int64(time.Duration(latency/requests) / time.Millisecond)
+	}
+	return stat
+}
+
+var targets = &targetSet{}
+
+// targetSet は負荷走行対象の一覧です
+// config.TargetBaseURL が変更された場合、統計をリセットして読み込み直します
+type targetSet struct {
+	mu      sync.Mutex
+	source  string
+	targets []*target
+	next    int
+}
+
+func (s *targetSet) load() ([]*target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.loadLocked()
+}
+
+// NOTE: 呼び出し元でロックを取得すること
+func (s *targetSet) loadLocked() ([]*target, error) {
+	if s.targets != nil && s.source == config.TargetBaseURL {
+		return s.targets, nil
+	}
+
+	loaded := []*target{}
+	for _, rawURL := range config.TargetBaseURLs() {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, &target{baseURL: u})
+	}
+	if len(loaded) == 0 {
+		return nil, ErrTargetNotFound
+	}
+
+	s.source, s.targets, s.next = config.TargetBaseURL, loaded, 0
+	return s.targets, nil
+}
+
+// primary は先頭の負荷走行対象を返します
+// /initialize など、一度だけ送るべきリクエストに用います
+func (s *targetSet) primary() (*target, error) {
+	loaded, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return loaded[0], nil
+}
+
+// assign は、ラウンドロビンでクライアントに負荷走行対象を割り当てます
+func (s *targetSet) assign() (*target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	t := loaded[s.next%len(loaded)]
+	s.next++
+	atomic.AddInt64(&t.clients, 1)
+	return t, nil
+}
+
+// TargetStats は、負荷走行対象ごとのリクエストの統計を返します
+func TargetStats() []*TargetStat {
+	loaded, err := targets.load()
+	if err != nil {
+		return []*TargetStat{}
+	}
+
+	stats := make([]*TargetStat, 0, len(loaded))
+	for _, t := range loaded {
+		stats = append(stats, t.stat())
+	}
+	return stats
+}
@@ -0,0 +1,65 @@
+package isutrain
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTargetSet_Assign(t *testing.T) {
+	defer func(orig string) { config.TargetBaseURL = orig }(config.TargetBaseURL)
+	config.TargetBaseURL = "http://isu1, http://isu2,,http://isu3"
+
+	set := &targetSet{}
+	assigned := []string{}
+	for i := 0; i < 4; i++ {
+		target, err := set.assign()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assigned = append(assigned, target.baseURL.String())
+	}
+	assert.Equal(t, []string{"http://isu1", "http://isu2", "http://isu3", "http://isu1"}, assigned)
+
+	primary, err := set.primary()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://isu1", primary.baseURL.String())
+	}
+
+	// 対象が変わったら読み込み直す
+	config.TargetBaseURL = "http://isu4"
+	target, err := set.assign()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://isu4", target.baseURL.String())
+	}
+
+	config.TargetBaseURL = ""
+	_, err = set.assign()
+	assert.Equal(t, ErrTargetNotFound, err)
+}
+
+func TestTarget_Stat(t *testing.T) {
+	defer func(orig string) { config.TargetBaseURL = orig }(config.TargetBaseURL)
+	config.TargetBaseURL = "http://isu1"
+
+	set := &targetSet{}
+	target, err := set.assign()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	target.record(10*time.Millisecond, http.StatusOK)
+	target.record(30*time.Millisecond, http.StatusInternalServerError)
+	target.record(20*time.Millisecond, 0)
+
+	assert.Equal(t, &TargetStat{
+		URL:              "http://isu1",
+		Clients:          1,
+		Requests:         3,
+		Failures:         2,
+		AvgLatencyMillis: 20,
+	}, target.stat())
+}
@@ -17,6 +17,8 @@ type (
 		ArrivedAt        string            `json:"arrival_time"`
 		SeatAvailability map[string]string `json:"seat_availability"`
 		FareInformation  map[string]int    `json:"seat_fare"`
+		TrainStatus      string            `json:"train_status,omitempty"`
+		DelayMinutes     int               `json:"delay_minutes,omitempty"`
 	}
 
 	SearchTrainsResponse []*Train
@@ -31,6 +33,9 @@ type (
 		CarNumber  int        `json:"car_number"`
 		Seats      TrainSeats `json:"seats"`
 		Cars       TrainCars  `json:"cars"`
+		// 運行情報 (運休の場合、全ての座席が埋まっている)
+		TrainStatus  string `json:"train_status,omitempty"`
+		DelayMinutes int    `json:"delay_minutes,omitempty"`
 	}
 
 	TrainSeats []*TrainSeat
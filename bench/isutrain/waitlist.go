@@ -0,0 +1,173 @@
+package isutrain
+
+import (
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/util"
+	"go.uber.org/zap"
+)
+
+// キャンセル待ちのステータス
+const (
+	WaitlistStatusWaiting   = "waiting"
+	WaitlistStatusPromoted  = "promoted"
+	WaitlistStatusCancelled = "cancelled"
+	WaitlistStatusExpired   = "expired"
+)
+
+// キャンセル待ちAPI /api/train/waitlist, /api/user/waitlist
+type (
+	WaitlistRequest struct {
+		// Date は ISO8601 形式の乗車日時です
+		Date          string `json:"date"`
+		TrainName     string `json:"train_name"`
+		TrainClass    string `json:"train_class"`
+		IsSmokingSeat bool   `json:"is_smoking_seat"`
+		SeatClass     string `json:"seat_class"`
+		Departure     string `json:"departure"`
+		Arrival       string `json:"arrival"`
+		Child         int    `json:"child"`
+		Adult         int    `json:"adult"`
+	}
+
+	WaitlistResponse struct {
+		WaitlistID    int    `json:"waitlist_id"`
+		Date          string `json:"date"`
+		TrainClass    string `json:"train_class"`
+		TrainName     string `json:"train_name"`
+		Departure     string `json:"departure"`
+		Arrival       string `json:"arrival"`
+		SeatClass     string `json:"seat_class"`
+		IsSmokingSeat bool   `json:"is_smoking_seat"`
+		Adult         int    `json:"adult"`
+		Child         int    `json:"child"`
+		Status        string `json:"status"`
+		// 同じ列車のキャンセル待ちのうち何番目か (waitingのみ)
+		Position int `json:"position,omitempty"`
+		// 繰り上げられた予約 (promotedのみ)
+		ReservationID int `json:"reservation_id,omitempty"`
+	}
+
+	ListWaitlistResponse []*WaitlistResponse
+)
+
+// Find は、キャンセル待ちIDで一覧から探します
+func (list ListWaitlistResponse) Find(waitlistID int) (*WaitlistResponse, bool) {
+	for _, entry := range list {
+		if entry.WaitlistID == waitlistID {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// waitlistCacheEntry は、ベンチマーカーが登録し、繰り上げを確認していないキャンセル待ちです
+type waitlistCacheEntry struct {
+	user *User
+	req  *WaitlistRequest
+	key  trainKey
+}
+
+// AddWaitlist は、待っているキャンセル待ちを記録します
+// キャンセル待ちが残っている列車は、他のユーザのキャンセルで予約が繰り上げられても把握できないので、空席情報を検証しません
+func (r *reservationCache) AddWaitlist(user *User, req *WaitlistRequest, waitlistID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	date, err := util.ParseISO8601(req.Date)
+	if err != nil {
+		return err
+	}
+
+	entry := &waitlistCacheEntry{
+		user: user,
+		req:  req,
+		key:  newTrainKey(date, req.TrainClass, req.TrainName),
+	}
+	r.waitlist[waitlistID] = entry
+	activity := r.trainActivity(entry.key)
+	activity.waiting++
+	activity.changedAt = time.Now()
+
+	return nil
+}
+
+// IsWaiting は、キャンセル待ちの繰り上げ・取り消しを確認していないかを返します
+func (r *reservationCache) IsWaiting(waitlistID int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.waitlist[waitlistID]
+	return ok
+}
+
+// PromoteWaitlist は、キャンセル待ちから繰り上げられた予約を予約キャッシュに追加します
+// 既に追加したキャンセル待ちは無視します
+func (r *reservationCache) PromoteWaitlist(waitlistID int, reservation *Reservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lgr := zap.S()
+
+	waiting, ok := r.waitlist[waitlistID]
+	if !ok {
+		return nil
+	}
+	date, err := util.ParseISO8601(waiting.req.Date)
+	if err != nil {
+		return err
+	}
+
+	seats := TrainSeats{}
+	for _, seat := range reservation.Seats {
+		seats = append(seats, &TrainSeat{Row: seat.SeatRow, Column: seat.SeatColumn})
+	}
+	entry := &ReservationCacheEntry{
+		User:       waiting.user,
+		ID:         reservation.ReservationID,
+		Date:       date,
+		Departure:  waiting.req.Departure,
+		Arrival:    waiting.req.Arrival,
+		TrainClass: waiting.req.TrainClass,
+		TrainName:  waiting.req.TrainName,
+		CarNum:     reservation.CarNumber,
+		SeatClass:  waiting.req.SeatClass,
+		Seats:      seats,
+		Adult:      waiting.req.Adult,
+		Child:      waiting.req.Child,
+	}
+	r.reservations[entry.ID] = entry
+	activity := r.trainActivity(waiting.key)
+	activity.reservations = append(activity.reservations, entry)
+	r.resolveWaitlist(waitlistID)
+
+	lgr.Infow("キャンセル待ちの繰り上げを予約キャッシュに追加",
+		"waitlist_id", waitlistID,
+		"id", entry.ID,
+		"carNum", entry.CarNum,
+		"seats", entry.Seats,
+	)
+
+	return nil
+}
+
+// CancelWaitlist は、取り消されたキャンセル待ちの記録を削除します
+func (r *reservationCache) CancelWaitlist(waitlistID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resolveWaitlist(waitlistID)
+}
+
+// resolveWaitlist は、繰り上げ・取り消しを確認したキャンセル待ちの記録を削除します
+// NOTE: 呼び出し元でロックを取得すること
+func (r *reservationCache) resolveWaitlist(waitlistID int) {
+	waiting, ok := r.waitlist[waitlistID]
+	if !ok {
+		return
+	}
+	delete(r.waitlist, waitlistID)
+	activity := r.trainActivity(waiting.key)
+	activity.waiting--
+	activity.changedAt = time.Now()
+}
@@ -2,20 +2,74 @@ package mock
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
+	"math"
 	"net/http"
+	"net/http/httptest"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
-	"net/http/httptest"
-
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
 	"github.com/chibiegg/isucon9-final/bench/internal/util"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/gorilla/sessions"
-	"github.com/jarcoal/httpmock"
 )
 
+var jst = time.FixedZone("Asia/Tokyo", 9*60*60)
+
+// Bug はモックに意図的に埋め込む不具合です
+// ベンチマーカーのアサーションが不具合を検出できるかテストするために利用します
+type Bug int
+
+const (
+	// BugDoubleBooking は、予約済みの座席かチェックせずに予約を受け付けます
+	BugDoubleBooking Bug = iota + 1
+	// BugWrongFare は、子供を大人と同じ運賃で計算します
+	BugWrongFare
+	// BugStaleAvailability は、予約状況を反映せずに空席情報を返します
+	BugStaleAvailability
+	// BugNoCSRFCheck は、CSRFトークンを検証せずにリクエストを受け付けます
+	BugNoCSRFCheck
+	// BugLockoutBypass は、ロックアウト中でも正しいパスワードならログインを受け付けます
+	BugLockoutBypass
+	// BugKeepPaymentOnDelete は、退会時に決済をキャンセルせずに予約を削除します
+	BugKeepPaymentOnDelete
+	// BugNoRefund は、列車を運休にしても予約を払い戻しません
+	BugNoRefund
+	// BugUnfairWaitlist は、キャンセル待ちを登録の新しい順に繰り上げます
+	BugUnfairWaitlist
+	// BugUnjoinedOccupancy は、予約と座席の予約を結合せずに座席の予約状況を求め、他の列車の予約の座席も予約済みとして返します
+	BugUnjoinedOccupancy
+	// BugMissContainedSection は、乗車区間の内側に収まる予約を区間の重なりとみなさずに空席情報を返します
+	BugMissContainedSection
+)
+
+var bugNames = map[string]Bug{
+	"double-booking":     BugDoubleBooking,
+	"wrong-fare":         BugWrongFare,
+	"stale-availability": BugStaleAvailability,
+	"no-csrf-check":      BugNoCSRFCheck,
+	"lockout-bypass":     BugLockoutBypass,
+	"keep-payment":       BugKeepPaymentOnDelete,
+	"no-refund":          BugNoRefund,
+	"unfair-waitlist":    BugUnfairWaitlist,
+	"unjoined-occupancy": BugUnjoinedOccupancy,
+	"miss-contained":     BugMissContainedSection,
+}
+
+// ParseBug は名前から不具合を取得します
+func ParseBug(name string) (Bug, error) {
+	bug, ok := bugNames[name]
+	if !ok {
+		return 0, fmt.Errorf("不明な不具合です: %s", name)
+	}
+	return bug, nil
+}
+
 // Mock は `isutrain` のモック実装です
+// 駅・列車・座席・ユーザ・予約をメモリ上に保持し、webappと同様に振る舞います
 type Mock struct {
 	LoginDelay             time.Duration
 	ListStationsDelay      time.Duration
@@ -26,11 +80,22 @@ type Mock struct {
 	CancelReservationDelay time.Duration
 	ListReservationDelay   time.Duration
 
+	// LoginLockoutThreshold 回続けてログインに失敗したアカウントは、LoginLockoutDuration の間ロックアウトされます
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+
+	// AdminToken は管理APIのトークンです. 空の場合、管理APIは404を返します
+	AdminToken string
+
 	sessionName string
 	session     *sessions.CookieStore
 
 	injectFunc func(path string) error
 
+	bugMu sync.RWMutex
+	bugs  map[Bug]bool
+
+	state       *fakeState
 	paymentMock *paymentMock
 }
 
@@ -43,9 +108,13 @@ func NewMock(paymentMock *paymentMock) (*Mock, error) {
 		injectFunc: func(path string) error {
 			return nil
 		},
-		paymentMock: paymentMock,
-		sessionName: "session_isutrain",
-		session:     sessions.NewCookieStore([]byte(randomStr)),
+		LoginLockoutThreshold: 5,
+		LoginLockoutDuration:  time.Minute,
+		bugs:                  map[Bug]bool{},
+		state:                 newFakeState(),
+		paymentMock:           paymentMock,
+		sessionName:           "session_isutrain",
+		session:               sessions.NewCookieStore([]byte(randomStr)),
 	}, nil
 }
 
@@ -58,38 +127,193 @@ func (m *Mock) getSession(req *http.Request) (*sessions.Session, error) {
 	return session, nil
 }
 
+// getUser はセッションからログイン中のユーザを取得します
+func (m *Mock) getUser(req *http.Request) (*fakeUser, bool) {
+	session, err := m.getSession(req)
+	if err != nil {
+		return nil, false
+	}
+	userID, ok := session.Values["user_id"].(int)
+	if !ok {
+		return nil, false
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	user, ok := m.state.usersByID[userID]
+	return user, ok
+}
+
+// validCSRFToken は、リクエストのCSRFトークンがセッションのトークンと一致するか検証します
+func (m *Mock) validCSRFToken(req *http.Request) bool {
+	if m.hasBug(BugNoCSRFCheck) {
+		return true
+	}
+
+	session, err := m.getSession(req)
+	if err != nil {
+		return false
+	}
+	token, ok := session.Values["csrf_token"].(string)
+	if !ok || token == "" {
+		return false
+	}
+	return req.Header.Get(isutrain.CSRFHeaderName) == token
+}
+
 func (m *Mock) Inject(f func(path string) error) {
 	m.injectFunc = f
 }
 
-func (m *Mock) Initialize(req *http.Request) ([]byte, int) {
-	if err := m.injectFunc(req.URL.Path); err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+// InjectBug はモックに不具合を埋め込みます
+func (m *Mock) InjectBug(bugs ...Bug) {
+	m.bugMu.Lock()
+	defer m.bugMu.Unlock()
+
+	for _, bug := range bugs {
+		m.bugs[bug] = true
 	}
+}
 
-	b, err := json.Marshal(&isutrain.InitializeResponse{
-		AvailableDays: 30,
-		Language:      "golang",
+func (m *Mock) hasBug(bug Bug) bool {
+	m.bugMu.RLock()
+	defer m.bugMu.RUnlock()
+
+	return m.bugs[bug]
+}
+
+// shownOccupiedSeats は、列車検索と座席列挙で予約済みとして返す座席です
+// 不具合を埋め込んだ場合は、webappの予約状況のクエリの不具合を再現します
+// NOTE: 呼び出し元でロックを取得すること
+func (m *Mock) shownOccupiedSeats(date time.Time, trainClass, trainName, departure, arrival string) (map[fakeSeatKey]bool, error) {
+	if m.hasBug(BugStaleAvailability) {
+		return map[fakeSeatKey]bool{}, nil
+	}
+	if !m.hasBug(BugUnjoinedOccupancy) && !m.hasBug(BugMissContainedSection) {
+		return m.state.occupiedSeats(date, trainClass, trainName, departure, arrival)
+	}
+
+	from, to := m.state.stationMap[departure], m.state.stationMap[arrival]
+	// 進行方向の距離. 上りは距離が減る方向に進む
+	position := func(station string) float64 {
+		distance := m.state.stationMap[station].Distance
+		if from.Distance > to.Distance {
+			return -distance
+		}
+		return distance
+	}
+
+	occupied := map[fakeSeatKey]bool{}
+	for _, reservation := range m.state.reservations {
+		if reservation.CarNum == 0 {
+			continue
+		}
+		if m.hasBug(BugUnjoinedOccupancy) {
+			// どの予約の座席かを区別できず、座席の予約があれば予約済みになる
+			for _, seat := range reservation.Seats {
+				occupied[fakeSeatKey{carNum: seat.CarNumber, row: seat.SeatRow, column: seat.SeatColumn}] = true
+			}
+			continue
+		}
+		if !reservation.Date.Equal(date) || reservation.TrainClass != trainClass || reservation.TrainName != trainName {
+			continue
+		}
+
+		overwrap, err := isutrain.IsSectionOverwrap(departure, arrival, reservation.Departure, reservation.Arrival)
+		if err != nil {
+			return nil, err
+		}
+		// 乗車駅を過ぎてから乗車し、降車駅までに降車する予約を見落とす
+		if position(departure) < position(reservation.Departure) && position(reservation.Arrival) <= position(arrival) {
+			overwrap = false
+		}
+		if !overwrap {
+			continue
+		}
+		for _, seat := range reservation.Seats {
+			occupied[fakeSeatKey{carNum: seat.CarNumber, row: seat.SeatRow, column: seat.SeatColumn}] = true
+		}
+	}
+
+	return occupied, nil
+}
+
+func errorResponse(status int, message string) ([]byte, int) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"is_error": true,
+		"message":  message,
+	})
+	return b, status
+}
+
+func messageResponse(message string) ([]byte, int) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"is_error": false,
+		"message":  message,
 	})
+	return b, http.StatusOK
+}
+
+func jsonResponse(v interface{}) ([]byte, int) {
+	b, err := json.Marshal(v)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+		return errorResponse(http.StatusInternalServerError, err.Error())
 	}
-
 	return b, http.StatusOK
 }
 
+// parseDate はISO8601形式の時刻をJSTとしてパースします
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(jst), nil
+}
+
+// truncateDate はJSTの日付を、UTCの0時として返します
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (m *Mock) Initialize(req *http.Request) ([]byte, int) {
+	m.state.reset()
+
+	return jsonResponse(&isutrain.InitializeResponse{
+		AvailableDays: 30,
+		Language:      "golang",
+	})
+}
+
 // Signup はユーザ登録を行います
 func (m *Mock) Signup(req *http.Request) ([]byte, int) {
 	user := &isutrain.User{}
 	if err := json.NewDecoder(req.Body).Decode(&user); err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+		return errorResponse(http.StatusBadRequest, err.Error())
 	}
 
 	if len(user.Email) == 0 || len(user.Password) == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+		return errorResponse(http.StatusBadRequest, "user registration failed")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if _, ok := m.state.users[user.Email]; ok {
+		return errorResponse(http.StatusBadRequest, "user registration failed")
 	}
 
-	return []byte(http.StatusText(http.StatusOK)), http.StatusOK
+	m.state.lastUserID++
+	fakeUser := &fakeUser{
+		ID:       m.state.lastUserID,
+		Email:    user.Email,
+		Password: user.Password,
+	}
+	m.state.users[fakeUser.Email] = fakeUser
+	m.state.usersByID[fakeUser.ID] = fakeUser
+
+	return messageResponse("registration complete")
 }
 
 // Login はログイン処理結果を返します
@@ -104,356 +328,943 @@ func (m *Mock) Login(req *http.Request) (*httptest.ResponseRecorder, int) {
 		return wr, http.StatusBadRequest
 	}
 
-	if len(user.Email) == 0 || len(user.Password) == 0 {
-		wr.Write([]byte(http.StatusText(http.StatusBadRequest)))
-		return wr, http.StatusBadRequest
+	now := time.Now()
+	m.state.mu.Lock()
+	fakeUser, ok := m.state.users[user.Email]
+	locked := ok && fakeUser.LockedUntil.After(now)
+	if locked && !(m.hasBug(BugLockoutBypass) && fakeUser.Password == user.Password) {
+		m.state.mu.Unlock()
+		wr.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(fakeUser.LockedUntil.Sub(now).Seconds()))))
+		b, status := errorResponse(http.StatusTooManyRequests, "too many login attempts")
+		wr.Write(b)
+		return wr, status
 	}
+	if !ok || fakeUser.Password != user.Password {
+		// アカウントごとに失敗回数を数え、閾値に達したらロックアウトする
+		if ok && m.LoginLockoutThreshold > 0 {
+			fakeUser.FailedLogins++
+			if fakeUser.FailedLogins >= m.LoginLockoutThreshold {
+				fakeUser.FailedLogins = 0
+				fakeUser.LockedUntil = now.Add(m.LoginLockoutDuration)
+			}
+		}
+		m.state.mu.Unlock()
+		b, status := errorResponse(http.StatusForbidden, "authentication failed")
+		wr.Write(b)
+		return wr, status
+	}
+	fakeUser.FailedLogins = 0
+	m.state.mu.Unlock()
 
 	session, err := m.getSession(req)
 	if err != nil {
 		wr.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return wr, http.StatusInternalServerError
 	}
-
-	csrfToken, err := util.SecureRandomStr(20)
+	csrfToken, err := util.SecureRandomStr(32)
 	if err != nil {
 		wr.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return wr, http.StatusInternalServerError
 	}
+	session.Values["user_id"] = fakeUser.ID
+	session.Values["csrf_token"] = csrfToken
+	http.SetCookie(wr, &http.Cookie{Name: isutrain.CSRFCookieName, Value: csrfToken, Path: "/"})
 
 	if err := session.Save(req, wr); err != nil {
 		wr.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return wr, http.StatusInternalServerError
 	}
-	http.SetCookie(wr, &http.Cookie{
-		Name:  "csrf_token",
-		Value: csrfToken,
-		Path:  "/",
-	})
-	http.SetCookie(wr, &http.Cookie{
-		Name:  "mock",
-		Value: "true",
-		Path:  "/",
-	})
 
-	wr.Write([]byte(http.StatusText(http.StatusOK)))
-	return wr, http.StatusOK
+	b, status := messageResponse("autheticated")
+	wr.Write(b)
+	return wr, status
 }
 
 func (m *Mock) Logout(req *http.Request) (*httptest.ResponseRecorder, int) {
-	// <-time.After()
-
 	wr := httptest.NewRecorder()
 
+	if !m.validCSRFToken(req) {
+		b, status := errorResponse(http.StatusForbidden, "invalid csrf token")
+		wr.Write(b)
+		return wr, status
+	}
+
 	session, err := m.getSession(req)
 	if err != nil {
 		wr.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return wr, http.StatusInternalServerError
 	}
-	session.Values[m.sessionName] = ""
-	session.Values["csrf_token"] = ""
-	session.Values["mock"] = ""
+	delete(session.Values, "user_id")
 
 	if err := session.Save(req, wr); err != nil {
 		wr.Write([]byte(http.StatusText(http.StatusInternalServerError)))
 		return wr, http.StatusInternalServerError
 	}
 
-	return wr, http.StatusOK
+	b, status := messageResponse("logged out")
+	wr.Write(b)
+	return wr, status
+}
+
+// ChangePassword はログイン中のユーザのパスワードを変更します
+func (m *Mock) ChangePassword(req *http.Request) ([]byte, int) {
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	changeReq := &isutrain.ChangePasswordRequest{}
+	if err := json.NewDecoder(req.Body).Decode(changeReq); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	if len(changeReq.NewPassword) == 0 {
+		return errorResponse(http.StatusBadRequest, "new password is empty")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if user.Password != changeReq.CurrentPassword {
+		return errorResponse(http.StatusForbidden, "authentication failed")
+	}
+	user.Password = changeReq.NewPassword
+
+	return messageResponse("password changed")
+}
+
+// ChangeEmail はログイン中のユーザのメールアドレスを変更します
+func (m *Mock) ChangeEmail(req *http.Request) ([]byte, int) {
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	changeReq := &isutrain.ChangeEmailRequest{}
+	if err := json.NewDecoder(req.Body).Decode(changeReq); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	if len(changeReq.Email) == 0 {
+		return errorResponse(http.StatusBadRequest, "email is empty")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if user.Password != changeReq.Password {
+		return errorResponse(http.StatusForbidden, "authentication failed")
+	}
+	if _, ok := m.state.users[changeReq.Email]; ok {
+		return errorResponse(http.StatusConflict, "email already exists")
+	}
+	delete(m.state.users, user.Email)
+	user.Email = changeReq.Email
+	m.state.users[user.Email] = user
+
+	return messageResponse("email changed")
+}
+
+// DeleteUser はログイン中のユーザを退会させ、全ての予約を削除します
+func (m *Mock) DeleteUser(req *http.Request) (*httptest.ResponseRecorder, int) {
+	wr := httptest.NewRecorder()
+	writeError := func(status int, message string) (*httptest.ResponseRecorder, int) {
+		b, status := errorResponse(status, message)
+		wr.Write(b)
+		return wr, status
+	}
+
+	if !m.validCSRFToken(req) {
+		return writeError(http.StatusForbidden, "invalid csrf token")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return writeError(http.StatusUnauthorized, "no session")
+	}
+
+	deleteReq := &isutrain.DeleteUserRequest{}
+	if err := json.NewDecoder(req.Body).Decode(deleteReq); err != nil {
+		return writeError(http.StatusBadRequest, err.Error())
+	}
+
+	m.state.mu.Lock()
+	if user.Password != deleteReq.Password {
+		m.state.mu.Unlock()
+		return writeError(http.StatusForbidden, "authentication failed")
+	}
+	for id, entry := range m.state.waitlist {
+		if entry.UserID == user.ID {
+			delete(m.state.waitlist, id)
+		}
+	}
+	deleted := []*fakeReservation{}
+	for id, reservation := range m.state.reservations {
+		if reservation.UserID != user.ID {
+			continue
+		}
+		if reservation.Status == reservationStatusDone && !m.hasBug(BugKeepPaymentOnDelete) {
+			m.paymentMock.cancelPayment(reservation.PaymentID)
+		}
+		delete(m.state.reservations, id)
+		deleted = append(deleted, reservation)
+	}
+	delete(m.state.users, user.Email)
+	delete(m.state.usersByID, user.ID)
+	// 空いた座席をキャンセル待ちに繰り上げる
+	for _, reservation := range deleted {
+		if err := m.promoteWaitlist(reservation.Date, reservation.TrainClass, reservation.TrainName); err != nil {
+			m.state.mu.Unlock()
+			return writeError(http.StatusInternalServerError, err.Error())
+		}
+	}
+	m.state.mu.Unlock()
+
+	session, err := m.getSession(req)
+	if err != nil {
+		return writeError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	session.Options.MaxAge = -1
+	if err := session.Save(req, wr); err != nil {
+		return writeError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	b, status := messageResponse("user deleted")
+	wr.Write(b)
+	return wr, status
 }
 
 func (m *Mock) ListStations(req *http.Request) ([]byte, int) {
 	<-time.After(m.ListStationsDelay)
-	b, err := json.Marshal(isutrain.ListStationsResponse{
-		&isutrain.Station{ID: 1, Name: "東京", Distance: 10.5, IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: false},
-	})
-	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+
+	resp := isutrain.ListStationsResponse{}
+	for _, station := range m.state.stations {
+		resp = append(resp, &isutrain.Station{
+			ID:                station.ID,
+			Name:              station.Name,
+			IsStopExpress:     station.IsStopExpress,
+			IsStopSemiExpress: station.IsStopSemiExpress,
+			IsStopLocal:       station.IsStopLocal,
+		})
 	}
 
-	return b, http.StatusOK
+	return jsonResponse(resp)
+}
+
+// availability は空席数を空席情報の記号に変換します
+func availability(availableSeats int) string {
+	switch {
+	case availableSeats == 0:
+		return "×"
+	case availableSeats < 10:
+		return "△"
+	default:
+		return "○"
+	}
 }
 
 // SearchTrains は新幹線検索結果を返します
 func (m *Mock) SearchTrains(req *http.Request) ([]byte, int) {
 	<-time.After(m.SearchTrainsDelay)
 	query := req.URL.Query()
-	if query == nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
 
-	// TODO: 検索クエリを受け取る
-	// いつ(use_at)、どこからどこまで(from, to), 人数(number of people) で結果が帰って来れば良い
-	// 日付を投げてきていて、DB称号可能などこからどこまでがあればいい
-	// どこからどこまでは駅名を書く(IDはユーザから見たらまだわからない)
-	useAt, err := util.ParseISO8601(query.Get("use_at"))
+	useAt, err := parseDate(query.Get("use_at"))
 	if err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-	if useAt.IsZero() {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+		return errorResponse(http.StatusBadRequest, err.Error())
 	}
 
 	var (
-		from = query.Get("from")
-		to   = query.Get("to")
+		trainClass = query.Get("train_class")
+		adult, _   = strconv.Atoi(query.Get("adult"))
+		child, _   = strconv.Atoi(query.Get("child"))
+		date       = truncateDate(useAt)
+		clock      = useAt.Sub(time.Date(useAt.Year(), useAt.Month(), useAt.Day(), 0, 0, 0, 0, jst))
 	)
-	if len(from) == 0 || len(to) == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+
+	from, ok := m.state.stationMap[query.Get("from")]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, "fromStation: no rows")
+	}
+	to, ok := m.state.stationMap[query.Get("to")]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, "toStation: no rows")
 	}
 
 	var (
-		seatAvailability = map[string]string{
-			string(isutrain.SaPremium):       "○",
-			string(isutrain.SaPremiumSmoke):  "×",
-			string(isutrain.SaReserved):      "△",
-			string(isutrain.SaReservedSmoke): "○",
-			string(isutrain.SaNonReserved):   "○",
-		}
-		fareInformation = map[string]int{
-			string(isutrain.SaPremium):       24000,
-			string(isutrain.SaPremiumSmoke):  24500,
-			string(isutrain.SaReserved):      19000,
-			string(isutrain.SaReservedSmoke): 19500,
-			string(isutrain.SaNonReserved):   15000,
-		}
+		isNobori = m.state.isNobori(from, to)
+		usable   = m.state.usableTrainClasses(from, to)
 	)
-	b, err := json.Marshal(isutrain.SearchTrainsResponse{
-		&isutrain.Train{
-			Class:            "最速",
-			Name:             "96号",
-			Start:            "1",
-			Last:             "2",
-			Departure:        "東京",
-			Arrival:          "名古屋",
-			DepartedAt:       util.FormatISO8601(time.Now()),
-			ArrivedAt:        util.FormatISO8601(time.Now()),
-			SeatAvailability: seatAvailability,
-			FareInformation:  fareInformation,
-		},
-		&isutrain.Train{
-			Class:            "最速",
-			Name:             "96号",
-			Start:            "3",
-			Last:             "4",
-			Departure:        "名古屋",
-			Arrival:          "大阪",
-			DepartedAt:       util.FormatISO8601(time.Now()),
-			ArrivedAt:        util.FormatISO8601(time.Now()),
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	resp := isutrain.SearchTrainsResponse{}
+	for _, train := range m.state.trains {
+		if train.IsNobori != isNobori || !usable[train.Class] {
+			continue
+		}
+		if trainClass != "" && train.Class != trainClass {
+			continue
+		}
+
+		departure, arrival := train.stops[from.Name], train.stops[to.Name]
+		// 乗りたい時刻より出発時刻が前なので除外
+		if departure.departure <= clock {
+			continue
+		}
+
+		seatAvailability := map[string]string{
+			string(isutrain.SaNonReserved): "○",
+		}
+		occupied, err := m.shownOccupiedSeats(date, train.Class, train.Name, from.Name, to.Name)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, err.Error())
+		}
+		for _, sa := range []struct {
+			key       isutrain.SeatAvailability
+			seatClass string
+			isSmoking bool
+		}{
+			{isutrain.SaPremium, "premium", false},
+			{isutrain.SaPremiumSmoke, "premium", true},
+			{isutrain.SaReserved, "reserved", false},
+			{isutrain.SaReservedSmoke, "reserved", true},
+		} {
+			availableSeats := 0
+			for carNum := 1; carNum <= 16; carNum++ {
+				for _, seat := range isutraindb.GetSeats(train.Class, carNum) {
+					if seat.SeatClass != sa.seatClass || seat.IsSmokingSeat != sa.isSmoking {
+						continue
+					}
+					if !occupied[fakeSeatKey{carNum: carNum, row: seat.Row, column: seat.Column}] {
+						availableSeats++
+					}
+				}
+			}
+			seatAvailability[string(sa.key)] = availability(availableSeats)
+		}
+
+		fareInformation := map[string]int{}
+		for _, fi := range []struct {
+			key       isutrain.FareInformation
+			seatClass string
+		}{
+			{isutrain.FiPremium, "premium"},
+			{isutrain.FiPremiumSmoke, "premium"},
+			{isutrain.FiReserved, "reserved"},
+			{isutrain.FiReservedSmoke, "reserved"},
+			{isutrain.FiNonReserved, "non-reserved"},
+		} {
+			fare, err := isutraindb.GetFare(0, date, from.Name, to.Name, train.Class, fi.seatClass)
+			if err != nil {
+				return errorResponse(http.StatusBadRequest, err.Error())
+			}
+			fareInformation[string(fi.key)] = fare*adult + fare/2*child
+		}
+
+		// 運休の列車は予約できない
+		trainStatus, delayMinutes := m.state.trainStatus(date, train.Class, train.Name)
+		if trainStatus == isutrain.TrainStatusCancelled {
+			for key := range seatAvailability {
+				seatAvailability[key] = "×"
+			}
+		}
+
+		resp = append(resp, &isutrain.Train{
+			Class:            train.Class,
+			Name:             train.Name,
+			Start:            train.Start,
+			Last:             train.Last,
+			Departure:        from.Name,
+			Arrival:          to.Name,
+			DepartedAt:       formatClock(departure.departure),
+			ArrivedAt:        formatClock(arrival.arrival),
 			SeatAvailability: seatAvailability,
 			FareInformation:  fareInformation,
-		},
-	})
-	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+			TrainStatus:      trainStatus,
+			DelayMinutes:     delayMinutes,
+		})
+		if len(resp) >= 10 {
+			break
+		}
 	}
 
-	return b, http.StatusOK
+	return jsonResponse(resp)
 }
 
 // SearchTrainSeats は列車の席一覧を返します
 func (m *Mock) SearchTrainSeats(req *http.Request) ([]byte, int) {
 	<-time.After(m.ListTrainSeatsDelay)
 	q := req.URL.Query()
-	if q == nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
 
-	// 列車特定情報を受け取る
-	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	date, err := parseDate(q.Get("date"))
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
 	var (
-		trainClass              = q.Get("train_class")
-		trainName               = q.Get("train_name")
-		carNumber, carNumberErr = strconv.Atoi(q.Get("car_number"))
-		date, dateErr           = time.Parse(time.RFC3339, q.Get("date"))
-		fromName                = q.Get("from")
-		toName                  = q.Get("to")
+		trainClass   = q.Get("train_class")
+		trainName    = q.Get("train_name")
+		carNumber, _ = strconv.Atoi(q.Get("car_number"))
 	)
-	if len(trainClass) == 0 || len(trainName) == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-	if len(fromName) == 0 || len(toName) == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-	if carNumberErr != nil || carNumber == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-	if dateErr != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-	date = date.In(jst)
-
-	// 適当な席を返す
-	b, err := json.Marshal(&isutrain.SearchTrainSeatsResponse{
-		Date:       "2006/01/02",
-		TrainClass: "最速",
-		TrainName:  "dummy",
-		CarNumber:  1,
-		Seats: isutrain.TrainSeats{
-			&isutrain.TrainSeat{
-				Row:           1,
-				Column:        "A",
-				Class:         "premium",
-				IsSmokingSeat: true,
-				IsOccupied:    false,
-			},
-		},
-		Cars: isutrain.TrainCars{
-			&isutrain.TrainCar{
-				CarNumber: 1,
-				SeatClass: "premium",
-			},
-		},
+
+	train, ok := m.state.train(trainClass, trainName)
+	if !ok {
+		return errorResponse(http.StatusNotFound, "列車が存在しません")
+	}
+	from, ok := m.state.stationMap[q.Get("from")]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, "fromStation: no rows")
+	}
+	to, ok := m.state.stationMap[q.Get("to")]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, "toStation: no rows")
+	}
+	if !m.state.usableTrainClasses(from, to)[train.Class] {
+		return errorResponse(http.StatusBadRequest, "invalid train_class")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	occupied, err := m.shownOccupiedSeats(truncateDate(date), train.Class, train.Name, from.Name, to.Name)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	// 運休の列車は全席予約できない
+	trainStatus, delayMinutes := m.state.trainStatus(truncateDate(date), train.Class, train.Name)
+	cancelled := trainStatus == isutrain.TrainStatusCancelled
+
+	seats := isutrain.TrainSeats{}
+	for _, seat := range isutraindb.GetSeats(train.Class, carNumber) {
+		seats = append(seats, &isutrain.TrainSeat{
+			Row:           seat.Row,
+			Column:        seat.Column,
+			Class:         seat.SeatClass,
+			IsSmokingSeat: seat.IsSmokingSeat,
+			IsOccupied:    cancelled || occupied[fakeSeatKey{carNum: carNumber, row: seat.Row, column: seat.Column}],
+		})
+	}
+
+	cars := isutrain.TrainCars{}
+	for carNum := 1; carNum <= 16; carNum++ {
+		cars = append(cars, &isutrain.TrainCar{
+			CarNumber: carNum,
+			SeatClass: isutraindb.GetSeatClass(train.Class, carNum),
+		})
+	}
+
+	return jsonResponse(&isutrain.SearchTrainSeatsResponse{
+		Date:         date.Format("2006/01/02"),
+		TrainClass:   train.Class,
+		TrainName:    train.Name,
+		CarNumber:    carNumber,
+		Seats:        seats,
+		Cars:         cars,
+		TrainStatus:  trainStatus,
+		DelayMinutes: delayMinutes,
 	})
+}
+
+// findVagueSeats は、座席指定のない予約のために、1つの号車でまとめて予約できる座席を探します
+// 座席の希望があれば、希望を多く満たす席を選び、全て満たせる号車を優先します
+// allow_split なら、1つの号車にまとめて予約できない場合に隣り合う号車に分けて予約します
+// 返す座席は、号車 (CarNumber) を含みます
+// NOTE: 呼び出し元でロックを取得すること
+func (m *Mock) findVagueSeats(date time.Time, reserveReq *isutrain.ReserveRequest) (int, []*isutrain.ReservationSeat, *isutrain.SatisfiedPreferences, error) {
+	occupied, err := m.state.occupiedSeats(date, reserveReq.TrainClass, reserveReq.TrainName, reserveReq.Departure, reserveReq.Arrival)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+		return 0, nil, nil, err
 	}
 
-	return b, http.StatusOK
+	var (
+		want        = reserveReq.Adult + reserveReq.Child
+		preferences = reserveReq.Preferences
+		// 座席の希望を全て満たす号車がない場合に予約する、最初に席を確保できた号車
+		fallbackCarNum      int
+		fallbackSeats       []*isutrain.ReservationSeat
+		fallbackPreferences *isutrain.SatisfiedPreferences
+		// 号車をまたいで予約する場合に使う、座席クラスが一致する号車ごとの空席
+		freeSeatsByCar = map[int][]*isutrain.ReservationSeat{}
+	)
+	for carNum := 1; carNum <= 16; carNum++ {
+		if preferences != nil && !preferences.InCarRange(carNum) {
+			continue
+		}
+
+		seats := []*isutrain.ReservationSeat{}
+		for _, seat := range isutraindb.GetSeats(reserveReq.TrainClass, carNum) {
+			if seat.SeatClass != reserveReq.SeatClass || seat.IsSmokingSeat != reserveReq.IsSmokingSeat {
+				continue
+			}
+			if _, ok := freeSeatsByCar[carNum]; !ok {
+				freeSeatsByCar[carNum] = []*isutrain.ReservationSeat{}
+			}
+			if occupied[fakeSeatKey{carNum: carNum, row: seat.Row, column: seat.Column}] {
+				continue
+			}
+			if preferences != nil && preferences.Required && preferences.Score(reserveReq.SeatClass, carNum, seat.Row, seat.Column) < preferences.WantScore() {
+				continue
+			}
+			seats = append(seats, &isutrain.ReservationSeat{CarNumber: carNum, SeatRow: seat.Row, SeatColumn: seat.Column})
+		}
+		if _, ok := freeSeatsByCar[carNum]; ok {
+			freeSeatsByCar[carNum] = seats
+		}
+		if len(seats) < want {
+			continue
+		}
+		if preferences == nil {
+			return carNum, seats[:want], nil, nil
+		}
+
+		sort.SliceStable(seats, func(i, j int) bool {
+			return preferences.Score(reserveReq.SeatClass, carNum, seats[i].SeatRow, seats[i].SeatColumn) > preferences.Score(reserveReq.SeatClass, carNum, seats[j].SeatRow, seats[j].SeatColumn)
+		})
+		seats = seats[:want]
+		satisfied := preferences.Satisfied(reserveReq.SeatClass, carNum, seats)
+		if satisfied.SatisfiesAll(preferences) {
+			return carNum, seats, satisfied, nil
+		}
+		if fallbackSeats == nil {
+			fallbackCarNum, fallbackSeats, fallbackPreferences = carNum, seats, satisfied
+		}
+	}
+
+	if fallbackSeats == nil && reserveReq.AllowSplit {
+		if seats := splitVagueSeats(freeSeatsByCar, want); seats != nil {
+			return seats[0].CarNumber, seats, nil, nil
+		}
+	}
+
+	return fallbackCarNum, fallbackSeats, fallbackPreferences, nil
+}
+
+// splitVagueSeats は、隣り合う号車に分けて n 席を選びます
+// 号車の数が最も少なく、同じなら号車番号が小さい連続した号車を選び、前の号車から順に席を埋めます
+func splitVagueSeats(cars map[int][]*isutrain.ReservationSeat, n int) []*isutrain.ReservationSeat {
+	bestFrom, bestTo := 0, 0
+	for from := 1; from <= 16; from++ {
+		free := 0
+		for to := from; to <= 16; to++ {
+			seats, ok := cars[to]
+			if !ok {
+				break
+			}
+			free += len(seats)
+			if free < n {
+				continue
+			}
+			if bestFrom == 0 || to-from < bestTo-bestFrom {
+				bestFrom, bestTo = from, to
+			}
+			break
+		}
+	}
+	if bestFrom == 0 {
+		return nil
+	}
+
+	picked := []*isutrain.ReservationSeat{}
+	for carNum := bestFrom; carNum <= bestTo && len(picked) < n; carNum++ {
+		seats := cars[carNum]
+		if len(seats) > n-len(picked) {
+			seats = seats[:n-len(picked)]
+		}
+		picked = append(picked, seats...)
+	}
+	return picked
+}
+
+// reservationAmount は予約の運賃を計算します. 子供は大人の半額です
+func (m *Mock) reservationAmount(date time.Time, trainClass, departure, arrival, seatClass string, adult, child int) (int, error) {
+	fare, err := isutraindb.GetFare(0, date, departure, arrival, trainClass, seatClass)
+	if err != nil {
+		return 0, err
+	}
+	if m.hasBug(BugWrongFare) {
+		return (adult + child) * fare, nil
+	}
+	return adult*fare + (child*fare)/2, nil
 }
 
 // Reserve は座席予約を実施し、結果を返します
 func (m *Mock) Reserve(req *http.Request) ([]byte, int) {
 	<-time.After(m.ReserveDelay)
 
-	// 予約情報を受け取って、予約できたかを返す
-	b, err := ioutil.ReadAll(req.Body)
-	if err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
 	}
 
 	// 複数の座席指定で予約するかもしれない
 	// なので、予約には複数の座席予約が紐づいている
 	var reserveReq *isutrain.ReserveRequest
-	if err := json.Unmarshal(b, &reserveReq); err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+	if err := json.NewDecoder(req.Body).Decode(&reserveReq); err != nil {
+		return errorResponse(http.StatusBadRequest, "JSON parseに失敗しました")
 	}
 
-	if len(reserveReq.TrainClass) == 0 || len(reserveReq.TrainName) == 0 {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
 	}
 
-	b, err = json.Marshal(&isutrain.ReserveResponse{
-		ReservationID: 1111,
-		Amount:        20250,
-		IsOk:          true,
-	})
+	useAt, err := parseDate(reserveReq.Date)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+		return errorResponse(http.StatusBadRequest, "時刻のparseに失敗しました")
 	}
+	date := truncateDate(useAt)
 
-	// NOTE: とりあえず、パラメータガン無視でPOSTできるところ先にやる
-	return b, http.StatusOK
+	train, ok := m.state.train(reserveReq.TrainClass, reserveReq.TrainName)
+	if !ok {
+		return errorResponse(http.StatusNotFound, "列車データがみつかりません")
+	}
+	from, ok := m.state.stationMap[reserveReq.Departure]
+	if !ok {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("乗車駅データがみつかりません %s", reserveReq.Departure))
+	}
+	to, ok := m.state.stationMap[reserveReq.Arrival]
+	if !ok {
+		return errorResponse(http.StatusNotFound, fmt.Sprintf("降車駅データがみつかりません %s", reserveReq.Arrival))
+	}
+	if !isStopStation(train.Class, from) || !isStopStation(train.Class, to) {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("%sの止まらない駅です", train.Class))
+	}
+	if from.Name == to.Name || train.IsNobori != m.state.isNobori(from, to) {
+		return errorResponse(http.StatusBadRequest, "リクエストされた区間に列車が運行していない区間が含まれています")
+	}
+	if !isutrain.IsValidSeatClass(reserveReq.SeatClass) {
+		return errorResponse(http.StatusBadRequest, "リクエストされた座席クラスが不明です")
+	}
+	if reserveReq.Adult+reserveReq.Child <= 0 {
+		return errorResponse(http.StatusBadRequest, "人数が不正です")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if trainStatus, _ := m.state.trainStatus(date, train.Class, train.Name); trainStatus == isutrain.TrainStatusCancelled {
+		return errorResponse(http.StatusBadRequest, "運休のため予約できません")
+	}
+
+	var (
+		carNum    = reserveReq.CarNum
+		seats     = []*isutrain.ReservationSeat{}
+		satisfied *isutrain.SatisfiedPreferences
+	)
+	switch {
+	case reserveReq.SeatClass == "non-reserved":
+		// 自由席は座席を指定できないので、ダミーの座席で予約する
+		carNum = 0
+		for i := 0; i < reserveReq.Adult+reserveReq.Child; i++ {
+			seats = append(seats, &isutrain.ReservationSeat{})
+		}
+	case len(reserveReq.Seats) == 0:
+		if preferences := reserveReq.Preferences; preferences != nil {
+			if preferences.Window && preferences.Aisle {
+				return errorResponse(http.StatusBadRequest, "窓側と通路側は同時に指定できません")
+			}
+			if preferences.CarFrom < 0 || preferences.CarTo < 0 || preferences.CarFrom > 16 || preferences.CarTo > 16 || (preferences.CarFrom > 0 && preferences.CarTo > 0 && preferences.CarFrom > preferences.CarTo) {
+				return errorResponse(http.StatusBadRequest, "号車の範囲が不正です")
+			}
+			if reserveReq.Column != "" {
+				return errorResponse(http.StatusBadRequest, "Columnとpreferencesは同時に指定できません")
+			}
+		}
+		if reserveReq.AllowSplit && (reserveReq.Preferences != nil || reserveReq.Column != "") {
+			return errorResponse(http.StatusBadRequest, "allow_splitはColumn・preferencesと同時に指定できません")
+		}
+		carNum, seats, satisfied, err = m.findVagueSeats(date, reserveReq)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, err.Error())
+		}
+		if len(seats) == 0 {
+			return errorResponse(http.StatusNotFound, "あいまい座席予約ができませんでした。指定した席、もしくは1車両内に希望の席数をご用意できませんでした。")
+		}
+	default:
+		seatMaster := map[fakeSeatKey]*isutraindb.Seat{}
+		for _, seat := range isutraindb.GetSeats(train.Class, carNum) {
+			seatMaster[fakeSeatKey{carNum: carNum, row: seat.Row, column: seat.Column}] = seat
+		}
+
+		occupied, err := m.state.occupiedSeats(date, train.Class, train.Name, from.Name, to.Name)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, err.Error())
+		}
+		for _, seat := range reserveReq.Seats {
+			key := fakeSeatKey{carNum: carNum, row: seat.Row, column: seat.Column}
+			if master, ok := seatMaster[key]; !ok || master.SeatClass != reserveReq.SeatClass {
+				return errorResponse(http.StatusNotFound, "リクエストされた座席情報は存在しません。号車・喫煙席・座席クラスなど組み合わせを見直してください")
+			}
+			if occupied[key] && !m.hasBug(BugDoubleBooking) {
+				return errorResponse(http.StatusBadRequest, "リクエストに既に予約された席が含まれています")
+			}
+			seats = append(seats, &isutrain.ReservationSeat{CarNumber: carNum, SeatRow: seat.Row, SeatColumn: seat.Column})
+		}
+	}
+
+	amount, err := m.reservationAmount(date, train.Class, from.Name, to.Name, reserveReq.SeatClass, reserveReq.Adult, reserveReq.Child)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+
+	m.state.lastReservationID++
+	reservation := &fakeReservation{
+		ID:         m.state.lastReservationID,
+		UserID:     user.ID,
+		Date:       date,
+		TrainClass: train.Class,
+		TrainName:  train.Name,
+		Departure:  from.Name,
+		Arrival:    to.Name,
+		Status:     reservationStatusRequesting,
+		Adult:      reserveReq.Adult,
+		Child:      reserveReq.Child,
+		Amount:     amount,
+		CarNum:     carNum,
+		Seats:      seats,
+	}
+	m.state.reservations[reservation.ID] = reservation
+
+	return jsonResponse(&isutrain.ReserveResponse{
+		ReservationID: reservation.ID,
+		Amount:        reservation.Amount,
+		IsOk:          true,
+		Preferences:   satisfied,
+	})
 }
 
 // CommitReservation は予約を確定します
 func (m *Mock) CommitReservation(req *http.Request) ([]byte, int) {
 	<-time.After(m.CommitReservationDelay)
-	// 予約IDを受け取って、確定するだけ
 
-	var reservation *isutrain.CommitReservationRequest
-	if err := json.NewDecoder(req.Body).Decode(&reservation); err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
 	}
 
-	// FIXME: ちゃんとした決済情報を追加する
-	m.paymentMock.addPaymentInformation()
+	var commitReq *isutrain.CommitReservationRequest
+	if err := json.NewDecoder(req.Body).Decode(&commitReq); err != nil {
+		return errorResponse(http.StatusBadRequest, "JSON parseに失敗しました")
+	}
 
-	b, err := json.Marshal(&isutrain.CommitReservationResponse{
-		IsOK: true,
-	})
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	reservation, ok := m.state.reservations[commitReq.ReservationID]
+	if !ok || reservation.UserID != user.ID {
+		return errorResponse(http.StatusNotFound, "予約情報がみつかりません")
+	}
+	if reservation.Status == reservationStatusRejected {
+		return errorResponse(http.StatusBadRequest, "運休のため予約を確定できません")
+	}
+	if reservation.Status != reservationStatusRequesting {
+		return errorResponse(http.StatusBadRequest, "当該の予約はすでに決済済みです")
+	}
+
+	paymentID, err := m.paymentMock.addPaymentInformation(commitReq.CardToken, reservation.ID, reservation.Amount)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+		return errorResponse(http.StatusInternalServerError, "決済に失敗しました")
 	}
+	reservation.Status = reservationStatusDone
+	reservation.PaymentID = paymentID
 
-	return b, http.StatusOK
+	return jsonResponse(&isutrain.CommitReservationResponse{
+		IsOK: true,
+	})
 }
 
 // CancelReservation は予約をキャンセルします
 func (m *Mock) CancelReservation(req *http.Request) ([]byte, int) {
 	<-time.After(m.CancelReservationDelay)
-	// 予約IDを受け取って
 
-	_, err := httpmock.GetSubmatchAsUint(req, 1)
-	if err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
 	}
 
-	b, err := json.Marshal(&isutrain.CancelReservationResponse{
-		IsOK: true,
-	})
+	reservationID, err := reservationIDFromPath(req)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+		return errorResponse(http.StatusBadRequest, "incorrect item id")
 	}
 
-	return b, http.StatusNoContent
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	reservation, ok := m.state.reservations[reservationID]
+	if !ok || reservation.UserID != user.ID {
+		return errorResponse(http.StatusNotFound, "予約情報がみつかりません")
+	}
+	// 運休で払い戻し済みの予約は、決済をキャンセルしない
+	if reservation.Status == reservationStatusDone && !reservation.Refunded {
+		if ok := m.paymentMock.cancelPayment(reservation.PaymentID); !ok {
+			return errorResponse(http.StatusInternalServerError, "決済のキャンセルに失敗しました")
+		}
+	}
+	delete(m.state.reservations, reservation.ID)
+
+	// 空いた座席をキャンセル待ちに繰り上げる
+	if err := m.promoteWaitlist(reservation.Date, reservation.TrainClass, reservation.TrainName); err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return jsonResponse(&isutrain.CancelReservationResponse{
+		IsOK: true,
+	})
 }
 
 // ListReservations はアカウントにひもづく予約履歴を返します
 func (m *Mock) ListReservations(req *http.Request) ([]byte, int) {
 	<-time.After(m.ListReservationDelay)
-	b, err := json.Marshal(isutrain.ListReservationsResponse{
-		&isutrain.Reservation{
-			ReservationID: 1111,
-			Date:          util.FormatISO8601(time.Now()),
-			TrainClass:    "遅いやつ",
-			TrainName:     "1号",
-			CarNumber:     4,
-			SeatClass:     "premium",
-			Amount:        20250,
-			Adult:         1,
-			Child:         1,
-			Departure:     "東京",
-			Arrival:       "大阪",
-			DepartureTime: util.FormatISO8601(time.Now()),
-			ArrivalTime:   util.FormatISO8601(time.Now()),
-			Seats: []*isutrain.ReservationSeat{
-				&isutrain.ReservationSeat{
-					ReservationID: 1111,
-					CarNumber:     4,
-					SeatRow:       1,
-					SeatColumn:    "A",
-				},
-			},
-		},
-	})
-	if err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
 	}
 
-	return b, http.StatusOK
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	resp := isutrain.ListReservationsResponse{}
+	for _, reservation := range m.state.userReservations(user.ID) {
+		reservationResp, err := m.state.reservationResponse(reservation)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, err.Error())
+		}
+		resp = append(resp, reservationResp)
+	}
+
+	return jsonResponse(resp)
 }
 
 func (m *Mock) ShowReservation(req *http.Request) ([]byte, int) {
+	reservationID, err := reservationIDFromPath(req)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "incorrect item id")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	reservation, ok := m.state.reservations[reservationID]
+	if !ok || reservation.UserID != user.ID {
+		return errorResponse(http.StatusNotFound, "Reservation not found")
+	}
 
-	reservationID, err := httpmock.GetSubmatchAsInt(req, 1)
+	resp, err := m.state.reservationResponse(reservation)
 	if err != nil {
-		return []byte(http.StatusText(http.StatusBadRequest)), http.StatusBadRequest
-	}
-
-	b, err := json.Marshal(&isutrain.Reservation{
-		ReservationID: int(reservationID),
-		Date:          util.FormatISO8601(time.Now()),
-		TrainClass:    "遅いやつ",
-		TrainName:     "1号",
-		CarNumber:     4,
-		SeatClass:     "premium",
-		Amount:        20250,
-		Adult:         1,
-		Child:         1,
-		Departure:     "東京",
-		Arrival:       "大阪",
-		DepartureTime: util.FormatISO8601(time.Now()),
-		ArrivalTime:   util.FormatISO8601(time.Now()),
-		Seats: []*isutrain.ReservationSeat{
-			&isutrain.ReservationSeat{
-				ReservationID: int(reservationID),
-				CarNumber:     4,
-				SeatRow:       1,
-				SeatColumn:    "A",
-			},
-		},
-	})
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
 
-	return b, http.StatusOK
+	return jsonResponse(resp)
+}
+
+// adminAuthorized は管理APIのトークンを検証し、失敗した場合のレスポンスを返します
+func (m *Mock) adminAuthorized(req *http.Request) ([]byte, int, bool) {
+	if m.AdminToken == "" {
+		b, status := errorResponse(http.StatusNotFound, "not found")
+		return b, status, false
+	}
+	if req.Header.Get("Authorization") != "Bearer "+m.AdminToken {
+		b, status := errorResponse(http.StatusUnauthorized, "invalid admin token")
+		return b, status, false
+	}
+	return nil, 0, true
+}
+
+// UpdateTrainOperation は列車の運行情報を設定します
+// 運休にした場合、決済済みの予約を払い戻し、未決済の予約をrejectedにします
+func (m *Mock) UpdateTrainOperation(req *http.Request) ([]byte, int) {
+	if b, status, ok := m.adminAuthorized(req); !ok {
+		return b, status
+	}
+
+	operationReq := &isutrain.TrainOperationRequest{}
+	if err := json.NewDecoder(req.Body).Decode(operationReq); err != nil {
+		return errorResponse(http.StatusBadRequest, "JSON parseに失敗しました")
+	}
+	date, err := time.Parse("2006-01-02", operationReq.Date)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "invalid date")
+	}
+	switch operationReq.Status {
+	case isutrain.TrainStatusNormal, isutrain.TrainStatusCancelled:
+		operationReq.DelayMinutes = 0
+	case isutrain.TrainStatusDelayed:
+		if operationReq.DelayMinutes <= 0 {
+			return errorResponse(http.StatusBadRequest, "delay_minutes must be positive")
+		}
+	default:
+		return errorResponse(http.StatusBadRequest, "unknown status")
+	}
+	if _, ok := m.state.train(operationReq.TrainClass, operationReq.TrainName); !ok {
+		return errorResponse(http.StatusNotFound, "列車が存在しません")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if trainStatus, _ := m.state.trainStatus(date, operationReq.TrainClass, operationReq.TrainName); trainStatus == isutrain.TrainStatusCancelled && operationReq.Status != isutrain.TrainStatusCancelled {
+		return errorResponse(http.StatusConflict, "運休にした列車は元に戻せません")
+	}
+
+	resp := &isutrain.TrainOperationResponse{
+		Date:         operationReq.Date,
+		TrainClass:   operationReq.TrainClass,
+		TrainName:    operationReq.TrainName,
+		Status:       operationReq.Status,
+		DelayMinutes: operationReq.DelayMinutes,
+	}
+
+	key := operationKey(date, operationReq.TrainClass, operationReq.TrainName)
+	if operationReq.Status == isutrain.TrainStatusNormal {
+		delete(m.state.operations, key)
+		return jsonResponse(resp)
+	}
+	m.state.operations[key] = &fakeTrainOperation{
+		Status:       operationReq.Status,
+		DelayMinutes: operationReq.DelayMinutes,
+	}
+
+	if operationReq.Status == isutrain.TrainStatusCancelled {
+		for _, entry := range m.state.trainWaitlist(date, operationReq.TrainClass, operationReq.TrainName) {
+			entry.Status = isutrain.WaitlistStatusCancelled
+		}
+		for _, reservation := range m.state.reservations {
+			if !reservation.Date.Equal(date) || reservation.TrainClass != operationReq.TrainClass || reservation.TrainName != operationReq.TrainName {
+				continue
+			}
+			switch {
+			case reservation.Status == reservationStatusDone && !reservation.Refunded:
+				if !m.hasBug(BugNoRefund) {
+					m.paymentMock.cancelPayment(reservation.PaymentID)
+				}
+				reservation.Refunded = true
+				resp.Refunded++
+			case reservation.Status == reservationStatusRequesting:
+				reservation.Status = reservationStatusRejected
+				resp.Rejected++
+			}
+		}
+	}
+
+	return jsonResponse(resp)
 }
@@ -0,0 +1,461 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testUserID int
+
+func newTestClient(t *testing.T) *isutrain.Client {
+	client, err := isutrain.NewClient()
+	assert.NoError(t, err)
+	client.ReplaceMockTransport()
+
+	testUserID++
+	email, password := fmt.Sprintf("mock%d@example.com", testUserID), "password"
+	assert.NoError(t, client.Signup(context.Background(), email, password))
+	assert.NoError(t, client.Login(context.Background(), email, password))
+
+	return client
+}
+
+func TestMock_Reservation(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx    = context.Background()
+		client = newTestClient(t)
+		useAt  = time.Date(2020, 1, 1, 5, 0, 0, 0, jst)
+	)
+
+	trains, err := client.SearchTrains(ctx, useAt, "東京", "大阪", "最速", 1, 1)
+	assert.NoError(t, err)
+	if !assert.Len(t, trains, 10) {
+		return
+	}
+	train := trains[0]
+	assert.Equal(t, "最速", train.Class)
+	assert.Equal(t, "06:00:00", train.DepartedAt)
+	assert.Equal(t, "○", train.SeatAvailability[string(isutrain.SaPremium)])
+
+	seatsResp, err := client.SearchTrainSeats(ctx, useAt, train.Class, train.Name, 8, "東京", "大阪")
+	assert.NoError(t, err)
+	assert.Len(t, seatsResp.Seats, 17*4)
+	assert.Len(t, seatsResp.Cars, 16)
+
+	seats := isutrain.TrainSeats{{Row: 1, Column: "A"}, {Row: 1, Column: "B"}}
+	reserveResp, err := client.Reserve(ctx, train.Class, train.Name, isutraindb.GetSeatClass(train.Class, 8), seats, "東京", "大阪", useAt, 8, 1, 1)
+	assert.NoError(t, err)
+
+	// 予約済みの座席は埋まっている
+	seatsResp, err = client.SearchTrainSeats(ctx, useAt, train.Class, train.Name, 8, "名古屋", "大阪")
+	assert.NoError(t, err)
+	assert.True(t, seatsResp.Seats[0].IsOccupied)
+	assert.False(t, seatsResp.Seats[2].IsOccupied)
+
+	assert.NoError(t, client.CommitReservation(ctx, reserveResp.ReservationID, "token"))
+
+	reservation, err := client.ShowReservation(ctx, reserveResp.ReservationID)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, reservation.CarNumber)
+	assert.Equal(t, "premium", reservation.SeatClass)
+	assert.Len(t, reservation.Seats, 2)
+
+	assert.NoError(t, client.CancelReservation(ctx, reserveResp.ReservationID))
+
+	reservations, err := client.ListReservations(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, reservations, 0)
+
+	// 別のユーザの予約は見えない
+	_, err = newTestClient(t).ShowReservation(ctx, reserveResp.ReservationID, isutrain.StatusCodeOpt(http.StatusNotFound))
+	assert.NoError(t, err)
+}
+
+func TestMock_BugDoubleBooking(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx       = context.Background()
+		useAt     = time.Date(2020, 1, 2, 5, 0, 0, 0, jst)
+		seats     = isutrain.TrainSeats{{Row: 2, Column: "C"}}
+		seatClass = isutraindb.GetSeatClass("最速", 4)
+	)
+
+	_, err = newTestClient(t).Reserve(ctx, "最速", "1号", seatClass, seats, "東京", "大阪", useAt, 4, 0, 1)
+	assert.NoError(t, err)
+
+	// 予約済みの座席は予約できない
+	_, err = newTestClient(t).Reserve(ctx, "最速", "1号", seatClass, seats, "東京", "名古屋", useAt, 4, 0, 1, isutrain.StatusCodeOpt(http.StatusBadRequest))
+	assert.NoError(t, err)
+
+	// 不具合を埋め込むと、ベンチマーカーが二重予約を検出する
+	m.InjectBug(BugDoubleBooking)
+	_, err = newTestClient(t).Reserve(ctx, "最速", "1号", seatClass, seats, "東京", "名古屋", useAt, 4, 0, 1)
+	assert.Error(t, err)
+}
+
+func TestMock_BugWrongFare(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx       = context.Background()
+		useAt     = time.Date(2020, 1, 3, 5, 0, 0, 0, jst)
+		seatClass = isutraindb.GetSeatClass("最速", 5)
+	)
+
+	_, err = newTestClient(t).Reserve(ctx, "最速", "1号", seatClass, isutrain.TrainSeats{{Row: 1, Column: "A"}, {Row: 1, Column: "B"}}, "東京", "大阪", useAt, 5, 1, 1)
+	assert.NoError(t, err)
+
+	m.InjectBug(BugWrongFare)
+	_, err = newTestClient(t).Reserve(ctx, "最速", "1号", seatClass, isutrain.TrainSeats{{Row: 2, Column: "A"}, {Row: 2, Column: "B"}}, "東京", "大阪", useAt, 5, 1, 1)
+	assert.Error(t, err)
+}
+
+func TestMock_BugStaleAvailability(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// 座席の予約状況はGolangの実装に限って検証する
+	defer func(language string) { config.Language = language }(config.Language)
+	config.Language = "golang"
+
+	m, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx       = context.Background()
+		client    = newTestClient(t)
+		useAt     = time.Date(2020, 1, 4, 5, 0, 0, 0, jst)
+		seatClass = isutraindb.GetSeatClass("最速", 6)
+	)
+
+	_, err = client.Reserve(ctx, "最速", "1号", seatClass, isutrain.TrainSeats{{Row: 1, Column: "A"}, {Row: 1, Column: "B"}}, "東京", "大阪", useAt, 6, 1, 1)
+	assert.NoError(t, err)
+
+	// 予約が反映された座席情報は、予約キャッシュから算出した期待値と一致する
+	_, err = client.SearchTrainSeats(ctx, useAt, "最速", "1号", 6, "東京", "大阪")
+	assert.NoError(t, err)
+
+	// 不具合を埋め込むと、ベンチマーカーが予約済みの座席が空席として返されたことを検出する
+	m.InjectBug(BugStaleAvailability)
+	_, err = client.SearchTrainSeats(ctx, useAt, "最速", "1号", 6, "東京", "大阪")
+	assert.Error(t, err)
+}
+
+func TestMock_BugUnjoinedOccupancy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// 座席の予約状況はGolangの実装に限って検証する
+	defer func(language string) { config.Language = language }(config.Language)
+	config.Language = "golang"
+
+	m, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx       = context.Background()
+		client    = newTestClient(t)
+		useAt     = time.Date(2020, 1, 7, 5, 0, 0, 0, jst)
+		otherDay  = time.Date(2020, 1, 8, 5, 0, 0, 0, jst)
+		seatClass = isutraindb.GetSeatClass("最速", 6)
+	)
+
+	_, err = client.Reserve(ctx, "最速", "1号", seatClass, isutrain.TrainSeats{{Row: 1, Column: "A"}, {Row: 1, Column: "B"}}, "東京", "大阪", useAt, 6, 1, 1)
+	assert.NoError(t, err)
+
+	// 別の日の同じ列車の座席は空席になる
+	_, err = client.SearchTrainSeats(ctx, otherDay, "最速", "1号", 6, "東京", "大阪")
+	assert.NoError(t, err)
+
+	// 不具合を埋め込むと、ベンチマーカーが他の日の予約の座席が予約済みとして返されたことを検出する
+	m.InjectBug(BugUnjoinedOccupancy)
+	_, err = client.SearchTrainSeats(ctx, otherDay, "最速", "1号", 6, "東京", "大阪")
+	assert.Error(t, err)
+
+	// 座席の検索を修正していない実装は検証しない
+	config.Language = "python"
+	_, err = client.SearchTrainSeats(ctx, otherDay, "最速", "1号", 6, "東京", "大阪")
+	assert.NoError(t, err)
+}
+
+func TestMock_BugMissContainedSection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// 座席の予約状況はGolangの実装に限って検証する
+	defer func(language string) { config.Language = language }(config.Language)
+	config.Language = "golang"
+
+	m, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx       = context.Background()
+		client    = newTestClient(t)
+		useAt     = time.Date(2020, 1, 9, 5, 0, 0, 0, jst)
+		seatClass = isutraindb.GetSeatClass("最速", 6)
+	)
+
+	_, err = client.Reserve(ctx, "最速", "1号", seatClass, isutrain.TrainSeats{{Row: 1, Column: "A"}}, "名古屋", "京都", useAt, 6, 0, 1)
+	assert.NoError(t, err)
+
+	// 乗車区間の内側に収まる予約の座席は予約済みになる
+	_, err = client.SearchTrainSeats(ctx, useAt, "最速", "1号", 6, "東京", "大阪")
+	assert.NoError(t, err)
+
+	// 不具合を埋め込むと、ベンチマーカーが予約済みの座席が空席として返されたことを検出する
+	m.InjectBug(BugMissContainedSection)
+	_, err = client.SearchTrainSeats(ctx, useAt, "最速", "1号", 6, "東京", "大阪")
+	assert.Error(t, err)
+
+	// 乗車区間と一部だけ重なる予約は見落とさない
+	_, err = client.SearchTrainSeats(ctx, useAt, "最速", "1号", 6, "京都", "大阪")
+	assert.NoError(t, err)
+}
+
+// reserveSmokingSeats は、列車の指定席の喫煙席を全て予約し、先頭の n 席は1席ずつの予約にします
+func reserveSmokingSeats(t *testing.T, client *isutrain.Client, useAt time.Time, trainName string, n int) []int {
+	ctx := context.Background()
+
+	singles := []int{}
+	for carNum := 1; carNum <= 16; carNum++ {
+		seats := isutrain.TrainSeats{}
+		for _, seat := range isutraindb.GetSeats("最速", carNum) {
+			if seat.SeatClass != "reserved" || !seat.IsSmokingSeat {
+				continue
+			}
+			if len(singles) < n {
+				resp, err := client.Reserve(ctx, "最速", trainName, "reserved", isutrain.TrainSeats{{Row: seat.Row, Column: seat.Column}}, "東京", "大阪", useAt, carNum, 0, 1)
+				assert.NoError(t, err)
+				singles = append(singles, resp.ReservationID)
+				continue
+			}
+			seats = append(seats, &isutrain.TrainSeat{Row: seat.Row, Column: seat.Column})
+		}
+		if len(seats) > 0 {
+			_, err := client.Reserve(ctx, "最速", trainName, "reserved", seats, "東京", "大阪", useAt, carNum, 0, len(seats))
+			assert.NoError(t, err)
+		}
+	}
+
+	return singles
+}
+
+func TestMock_WaitlistConcurrentCancel(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx    = context.Background()
+		useAt  = time.Date(2020, 1, 4, 5, 0, 0, 0, jst)
+		holder = newTestClient(t)
+	)
+	singles := reserveSmokingSeats(t, holder, useAt, "1号", 4)
+
+	waitlistReq := &isutrain.WaitlistRequest{
+		Date:          useAt.Format(time.RFC3339),
+		TrainClass:    "最速",
+		TrainName:     "1号",
+		SeatClass:     "reserved",
+		IsSmokingSeat: true,
+		Departure:     "東京",
+		Arrival:       "名古屋",
+		Adult:         1,
+	}
+	waiters := []*isutrain.Client{}
+	for i := 0; i < 6; i++ {
+		waiter := newTestClient(t)
+		resp, err := waiter.RegisterWaitlist(ctx, waitlistReq)
+		assert.NoError(t, err)
+		assert.Equal(t, isutrain.WaitlistStatusWaiting, resp.Status)
+		assert.Equal(t, i+1, resp.Position)
+		waiters = append(waiters, waiter)
+	}
+
+	// 同時にキャンセルしても、登録順に繰り上がり、同じ座席は割り当てられない
+	var wg sync.WaitGroup
+	for _, reservationID := range singles {
+		wg.Add(1)
+		go func(reservationID int) {
+			defer wg.Done()
+			assert.NoError(t, holder.CancelReservation(ctx, reservationID))
+		}(reservationID)
+	}
+	wg.Wait()
+
+	seats := map[string]bool{}
+	for i, waiter := range waiters {
+		list, err := waiter.ListWaitlist(ctx)
+		assert.NoError(t, err)
+		if !assert.Len(t, list, 1) {
+			continue
+		}
+		if i >= len(singles) {
+			assert.Equal(t, isutrain.WaitlistStatusWaiting, list[0].Status)
+			assert.Equal(t, i-len(singles)+1, list[0].Position)
+			continue
+		}
+
+		assert.Equal(t, isutrain.WaitlistStatusPromoted, list[0].Status)
+		reservation, err := waiter.ShowReservation(ctx, list[0].ReservationID)
+		if assert.NoError(t, err) && assert.Len(t, reservation.Seats, 1) {
+			seats[fmt.Sprintf("%d-%d%s", reservation.CarNumber, reservation.Seats[0].SeatRow, reservation.Seats[0].SeatColumn)] = true
+		}
+	}
+	assert.Len(t, seats, len(singles))
+
+	// 取り消したキャンセル待ちは繰り上がらない
+	list, err := waiters[4].ListWaitlist(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, waiters[4].CancelWaitlist(ctx, list[0].WaitlistID))
+	assert.NoError(t, waiters[4].CancelWaitlist(ctx, list[0].WaitlistID, isutrain.StatusCodeOpt(http.StatusBadRequest)))
+
+	list, err = waiters[5].ListWaitlist(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, list[0].Position)
+	assert.NoError(t, waiters[0].CancelWaitlist(ctx, list[0].WaitlistID, isutrain.StatusCodeOpt(http.StatusNotFound)))
+}
+
+func TestMock_ReserveSeatPreferences(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx    = context.Background()
+		client = newTestClient(t)
+		useAt  = time.Date(2020, 1, 5, 5, 0, 0, 0, jst)
+	)
+	reserve := func(preferences *isutrain.SeatPreferences, opt ...isutrain.ClientOption) (*isutrain.ReserveResponse, error) {
+		opt = append(opt, isutrain.SeatPreferencesOpt(preferences))
+		return client.Reserve(ctx, "最速", "1号", "reserved", nil, "東京", "大阪", useAt, 0, 0, 2, opt...)
+	}
+	showSeats := func(reservationID int) (int, []string) {
+		reservation, err := client.ShowReservation(ctx, reservationID)
+		assert.NoError(t, err)
+		seats := []string{}
+		for _, seat := range reservation.Seats {
+			seats = append(seats, fmt.Sprintf("%d%s", seat.SeatRow, seat.SeatColumn))
+		}
+		return reservation.CarNumber, seats
+	}
+
+	// 11号車の禁煙席の出入口側は1列目のみ、12号車は1列目と20列目
+	required := &isutrain.SeatPreferences{Window: true, NearExit: true, CarFrom: 11, CarTo: 12, Required: true}
+	for _, want := range []struct {
+		carNum int
+		seats  []string
+	}{
+		{11, []string{"1A", "1E"}},
+		{12, []string{"1A", "1E"}},
+		{12, []string{"20A", "20E"}},
+	} {
+		resp, err := reserve(required)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, &isutrain.SatisfiedPreferences{Window: true, NearExit: true}, resp.Preferences)
+		carNum, seats := showSeats(resp.ReservationID)
+		assert.Equal(t, want.carNum, carNum)
+		assert.Equal(t, want.seats, seats)
+	}
+
+	// 必須の希望を満たす席がなければ予約できない
+	_, err = reserve(required, isutrain.StatusCodeOpt(http.StatusNotFound))
+	assert.NoError(t, err)
+
+	// 必須でなければ、満たせる希望だけ満たす
+	resp, err := reserve(&isutrain.SeatPreferences{Window: true, NearExit: true, CarFrom: 11, CarTo: 12})
+	assert.NoError(t, err)
+	assert.Equal(t, &isutrain.SatisfiedPreferences{NearExit: true}, resp.Preferences)
+	carNum, seats := showSeats(resp.ReservationID)
+	assert.Equal(t, 11, carNum)
+	assert.Equal(t, []string{"1B", "1C"}, seats)
+
+	// 窓側と通路側は同時に指定できない
+	_, err = reserve(&isutrain.SeatPreferences{Window: true, Aisle: true}, isutrain.StatusCodeOpt(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
+
+func TestMock_ReserveAllowSplit(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	_, err := Register()
+	assert.NoError(t, err)
+
+	var (
+		ctx    = context.Background()
+		client = newTestClient(t)
+		useAt  = time.Date(2020, 1, 6, 5, 0, 0, 0, jst)
+	)
+
+	// プレミアム席の8〜10号車の空席を、それぞれ5席、7席、3席にする
+	for carNum, free := range map[int]int{8: 5, 9: 7, 10: 3} {
+		seats := isutrain.TrainSeats{}
+		for _, seat := range isutraindb.GetSeats("最速", carNum)[free:] {
+			seats = append(seats, &isutrain.TrainSeat{Row: seat.Row, Column: seat.Column})
+		}
+		_, err := client.Reserve(ctx, "最速", "1号", "premium", seats, "東京", "大阪", useAt, carNum, 0, len(seats))
+		assert.NoError(t, err)
+	}
+
+	// 1つの号車にまとめて予約できない
+	_, err = client.Reserve(ctx, "最速", "1号", "premium", nil, "東京", "大阪", useAt, 0, 2, 10, isutrain.StatusCodeOpt(http.StatusNotFound))
+	assert.NoError(t, err)
+
+	// allow_split なら隣り合う8号車と9号車に分けて予約する
+	resp, err := client.Reserve(ctx, "最速", "1号", "premium", nil, "東京", "大阪", useAt, 0, 2, 10, isutrain.AllowSplitOpt())
+	if !assert.NoError(t, err) {
+		return
+	}
+	reservation, err := client.ShowReservation(ctx, resp.ReservationID)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, reservation.CarNumber)
+	cars := map[int]int{}
+	for _, seat := range reservation.Seats {
+		cars[seat.CarNumber]++
+	}
+	assert.Equal(t, map[int]int{8: 5, 9: 7}, cars)
+
+	// 残りの3席は10号車にまとめて予約できる
+	resp, err = client.Reserve(ctx, "最速", "1号", "premium", nil, "東京", "大阪", useAt, 0, 0, 3, isutrain.AllowSplitOpt())
+	assert.NoError(t, err)
+	reservation, err = client.ShowReservation(ctx, resp.ReservationID)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, reservation.CarNumber)
+
+	// 座席の希望と同時には指定できない
+	_, err = client.Reserve(ctx, "最速", "1号", "premium", nil, "東京", "大阪", useAt, 0, 0, 1, isutrain.AllowSplitOpt(), isutrain.SeatPreferencesOpt(&isutrain.SeatPreferences{Window: true}), isutrain.StatusCodeOpt(http.StatusBadRequest))
+	assert.NoError(t, err)
+}
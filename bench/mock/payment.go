@@ -2,20 +2,21 @@ package mock
 
 import (
 	"encoding/json"
-	"math/rand"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/chibiegg/isucon9-final/bench/internal/util"
 	"github.com/chibiegg/isucon9-final/bench/payment"
 )
 
 // NOTE: https://github.com/grpc-ecosystem/grpc-gateway/blob/master/runtime/errors.go#L17,L54
 
 type paymentMock struct {
-	mu           sync.Mutex
-	result       *payment.PaymentResult
-	reservations map[string]*payment.PaymentInformation
+	mu     sync.Mutex
+	result *payment.PaymentResult
+	// paymentID -> 決済情報
+	payments map[string]*payment.PaymentInformation
 }
 
 func newPaymentMock() *paymentMock {
@@ -23,24 +24,56 @@ func newPaymentMock() *paymentMock {
 		result: &payment.PaymentResult{
 			RawData: []*payment.RawData{},
 		},
+		payments: map[string]*payment.PaymentInformation{},
 	}
 }
 
-func (m *paymentMock) addPaymentInformation() {
+// addPaymentInformation は予約の決済を記録し、決済IDを返します
+func (m *paymentMock) addPaymentInformation(cardToken string, reservationID, amount int) (string, error) {
+	paymentID, err := util.SecureRandomStr(16)
+	if err != nil {
+		return "", err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	paymentInfo := &payment.PaymentInformation{
+		CardToken:     cardToken,
+		ReservationID: reservationID,
+		Datetime:      time.Now(),
+		Amount:        int64(amount),
+		IsCanceled:    false,
+	}
+	m.payments[paymentID] = paymentInfo
 	m.result.RawData = append(m.result.RawData, &payment.RawData{
-		PaymentInfo: &payment.PaymentInformation{
-			CardToken:  "XXXXXXXXXXXX",
-			Datetime:   time.Now(),
-			Amount:     int64(rand.Intn(200)),
-			IsCanceled: rand.Intn(10000)%2 == 0,
-		},
+		PaymentInfo: paymentInfo,
 	})
+
+	return paymentID, nil
+}
+
+// cancelPayment は決済をキャンセル済みにします
+func (m *paymentMock) cancelPayment(paymentID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paymentInfo, ok := m.payments[paymentID]
+	if !ok {
+		return false
+	}
+	paymentInfo.IsCanceled = true
+
+	return true
 }
 
 func (m *paymentMock) Initialize() ([]byte, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.result.RawData = []*payment.RawData{}
+	m.payments = map[string]*payment.PaymentInformation{}
+
 	return []byte(http.StatusText(http.StatusOK)), http.StatusOK
 }
 
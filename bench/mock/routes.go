@@ -0,0 +1,183 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/jarcoal/httpmock"
+)
+
+// route はモックのエンドポイントです
+// pathが "=~" で始まる場合は正規表現として扱います (httpmockと同じ記法)
+type route struct {
+	method    string
+	path      string
+	rx        *regexp.Regexp
+	responder httpmock.Responder
+}
+
+func newRoute(method, path string, responder httpmock.Responder) *route {
+	r := &route{
+		method:    method,
+		path:      path,
+		responder: responder,
+	}
+	if strings.HasPrefix(path, "=~") {
+		r.rx = regexp.MustCompile(strings.TrimPrefix(path, "=~"))
+	}
+	return r
+}
+
+func (r *route) match(req *http.Request) bool {
+	if r.method != req.Method {
+		return false
+	}
+	if r.rx != nil {
+		return r.rx.MatchString(req.URL.Path)
+	}
+	return r.path == req.URL.Path
+}
+
+// mockURL はhttpmockに登録するURLを返します
+func (r *route) mockURL(baseURL string) string {
+	if r.rx != nil {
+		return r.path
+	}
+	return fmt.Sprintf("%s%s", baseURL, r.path)
+}
+
+// reservationIDFromPath は、予約詳細・予約キャンセルのパスから予約IDを取得します
+func reservationIDFromPath(req *http.Request) (int, error) {
+	for _, path := range []string{endpoint.IsutrainMockShowReservationPath, endpoint.IsutrainMockCancelReservationPath} {
+		sm := regexp.MustCompile(strings.TrimPrefix(path, "=~")).FindStringSubmatch(req.URL.Path)
+		if len(sm) == 2 {
+			return strconv.Atoi(sm[1])
+		}
+	}
+	return 0, fmt.Errorf("予約IDが含まれていません: %s", req.URL.Path)
+}
+
+func bytesResponder(f func(req *http.Request) ([]byte, int)) httpmock.Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		body, status := f(req)
+		return httpmock.NewBytesResponse(status, body), nil
+	}
+}
+
+func assetResponder(path string) httpmock.Responder {
+	_, file, _, _ := runtime.Caller(0)
+	testDir := filepath.Join(filepath.Dir(file), "testdata")
+	return func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadFile(filepath.Join(testDir, path))
+		if err != nil {
+			return httpmock.NewBytesResponse(http.StatusInternalServerError, []byte(http.StatusText(http.StatusInternalServerError))), err
+		}
+		return httpmock.NewBytesResponse(http.StatusOK, b), nil
+	}
+}
+
+// injectResponder は、Injectで指定されたエラーが発生した場合に500を返します
+func (m *Mock) injectResponder(responder httpmock.Responder) httpmock.Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		if err := m.injectFunc(req.URL.Path); err != nil {
+			return httpmock.NewBytesResponse(http.StatusInternalServerError, []byte(http.StatusText(http.StatusInternalServerError))), nil
+		}
+		return responder(req)
+	}
+}
+
+// isutrainRoutes は `isutrain` のエンドポイントを返します
+func (m *Mock) isutrainRoutes(paymentBaseURL string) []*route {
+	routes := []*route{
+		newRoute("GET", endpoint.GetPath(endpoint.Settings), bytesResponder(func(req *http.Request) ([]byte, int) {
+			b, err := json.Marshal(map[string]interface{}{
+				"payment_api": paymentBaseURL,
+			})
+			if err != nil {
+				return []byte(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError
+			}
+			return b, http.StatusOK
+		})),
+		newRoute("GET", endpoint.GetPath(endpoint.ListStations), bytesResponder(m.ListStations)),
+		newRoute("GET", endpoint.GetPath(endpoint.SearchTrains), bytesResponder(m.SearchTrains)),
+		newRoute("GET", endpoint.GetPath(endpoint.ListTrainSeats), bytesResponder(m.SearchTrainSeats)),
+		newRoute("GET", endpoint.GetPath(endpoint.ListReservations), bytesResponder(m.ListReservations)),
+		newRoute("GET", endpoint.IsutrainMockShowReservationPath, bytesResponder(m.ShowReservation)),
+		newRoute("GET", endpoint.GetPath(endpoint.ListWaitlist), bytesResponder(m.ListWaitlist)),
+
+		newRoute("POST", endpoint.GetPath(endpoint.Initialize), bytesResponder(m.Initialize)),
+		newRoute("POST", endpoint.GetPath(endpoint.Signup), bytesResponder(m.Signup)),
+		newRoute("POST", endpoint.GetPath(endpoint.Login), func(req *http.Request) (*http.Response, error) {
+			wr, status := m.Login(req)
+			resp := httpmock.NewBytesResponse(status, wr.Body.Bytes())
+			resp.Header.Add("X-Test-Header", "hoge")
+			for headerKey, header := range wr.Header() {
+				for _, headerValue := range header {
+					resp.Header.Add(headerKey, headerValue)
+				}
+			}
+			return resp, nil
+		}),
+		newRoute("POST", endpoint.GetPath(endpoint.Logout), func(req *http.Request) (*http.Response, error) {
+			wr, status := m.Logout(req)
+			resp := httpmock.NewBytesResponse(status, wr.Body.Bytes())
+			for headerKey, header := range wr.Header() {
+				for _, headerValue := range header {
+					resp.Header.Add(headerKey, headerValue)
+				}
+			}
+			return resp, nil
+		}),
+		newRoute("POST", endpoint.GetPath(endpoint.Reserve), bytesResponder(m.Reserve)),
+		newRoute("POST", endpoint.GetPath(endpoint.CommitReservation), bytesResponder(m.CommitReservation)),
+		newRoute("POST", endpoint.IsutrainMockCancelReservationPath, bytesResponder(m.CancelReservation)),
+		newRoute("POST", endpoint.GetPath(endpoint.RegisterWaitlist), bytesResponder(m.RegisterWaitlist)),
+		newRoute("POST", endpoint.IsutrainMockCancelWaitlistPath, bytesResponder(m.CancelWaitlist)),
+		newRoute("POST", endpoint.GetPath(endpoint.ChangePassword), bytesResponder(m.ChangePassword)),
+		newRoute("POST", endpoint.GetPath(endpoint.ChangeEmail), bytesResponder(m.ChangeEmail)),
+		newRoute("PUT", endpoint.GetPath(endpoint.UpdateTrainOperation), bytesResponder(m.UpdateTrainOperation)),
+		newRoute("DELETE", endpoint.GetPath(endpoint.DeleteUser), func(req *http.Request) (*http.Response, error) {
+			wr, status := m.DeleteUser(req)
+			resp := httpmock.NewBytesResponse(status, wr.Body.Bytes())
+			for headerKey, header := range wr.Header() {
+				for _, headerValue := range header {
+					resp.Header.Add(headerKey, headerValue)
+				}
+			}
+			return resp, nil
+		}),
+	}
+	for _, r := range routes {
+		r.responder = m.injectResponder(r.responder)
+	}
+
+	// Assets
+	for _, path := range []string{"/css/app.css", "/img/logo.svg", "/js/app.js", "/js/chunk.js", "/favicon.ico", "/index.html"} {
+		routes = append(routes, newRoute("GET", path, assetResponder(path)))
+	}
+
+	return routes
+}
+
+// paymentRoutes は課金APIのエンドポイントを返します
+func (m *paymentMock) paymentRoutes() []*route {
+	return []*route{
+		newRoute("POST", endpoint.PaymentInitializePath, bytesResponder(func(req *http.Request) ([]byte, int) {
+			return m.Initialize()
+		})),
+		newRoute("GET", endpoint.PaymentResultPath, bytesResponder(func(req *http.Request) ([]byte, int) {
+			return m.GetResult()
+		})),
+		newRoute("POST", endpoint.PaymentRegistCardPath, bytesResponder(func(req *http.Request) ([]byte, int) {
+			return m.RegistCard()
+		})),
+	}
+}
@@ -0,0 +1,68 @@
+package mock
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Server はモックを実際のHTTPサーバとして提供します
+// NOTE: httpmockを利用できない、ベンチマーカーの外部 (フロントエンドやcurlなど) から利用するためのものです
+type Server struct {
+	Mock        *Mock
+	paymentMock *paymentMock
+}
+
+func NewServer() (*Server, error) {
+	paymentMock := newPaymentMock()
+	isutrainMock, err := NewMock(paymentMock)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		Mock:        isutrainMock,
+		paymentMock: paymentMock,
+	}, nil
+}
+
+// IsutrainHandler は `isutrain` のハンドラを返します
+func (s *Server) IsutrainHandler(paymentBaseURL string) http.Handler {
+	return routeHandler(s.Mock.isutrainRoutes(paymentBaseURL))
+}
+
+// PaymentHandler は課金APIのハンドラを返します
+func (s *Server) PaymentHandler() http.Handler {
+	return routeHandler(s.paymentMock.paymentRoutes())
+}
+
+type routeHandler []*route
+
+func (routes routeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, r := range routes {
+		if !r.match(req) {
+			continue
+		}
+
+		resp, err := r.responder(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer resp.Body.Close()
+
+		for headerKey, header := range resp.Header {
+			for _, headerValue := range header {
+				w.Header().Add(headerKey, headerValue)
+			}
+		}
+		if w.Header().Get("Content-Type") == "" && strings.HasPrefix(req.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	http.NotFound(w, req)
+}
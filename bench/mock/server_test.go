@@ -0,0 +1,64 @@
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	server, err := NewServer()
+	assert.NoError(t, err)
+	server.Mock.Inject(func(path string) error {
+		if path == endpoint.GetPath(endpoint.SearchTrains) {
+			return errors.New("テスト用のエラーです")
+		}
+		return nil
+	})
+
+	ts := httptest.NewServer(server.IsutrainHandler("http://localhost:5000"))
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	assert.NoError(t, err)
+	client := &http.Client{Jar: jar}
+
+	body := []byte(`{"email":"server@example.com","password":"password"}`)
+	resp, err := client.Post(ts.URL+endpoint.GetPath(endpoint.Signup), "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = client.Post(ts.URL+endpoint.GetPath(endpoint.Login), "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	// ログイン後はセッションで予約一覧を取得できる
+	resp, err = client.Get(ts.URL + endpoint.GetPath(endpoint.ListReservations))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	resp.Body.Close()
+
+	resp, err = client.Get(ts.URL + endpoint.GetDynamicPath(endpoint.ShowReservation, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = client.Get(ts.URL + endpoint.GetPath(endpoint.SearchTrains))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp.Body.Close()
+
+	resp, err = client.Get(ts.URL + "/not-found")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp.Body.Close()
+}
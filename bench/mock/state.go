@@ -0,0 +1,276 @@
+package mock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+)
+
+// 予約のステータス
+const (
+	reservationStatusRequesting = "requesting"
+	reservationStatusDone       = "done"
+	// 列車が運休になり、確定できなくなった予約
+	reservationStatusRejected = "rejected"
+)
+
+type fakeUser struct {
+	ID       int
+	Email    string
+	Password string
+
+	FailedLogins int
+	LockedUntil  time.Time
+}
+
+type fakeReservation struct {
+	ID     int
+	UserID int
+
+	// 乗車日 (JSTの日付を、UTCの0時として保持)
+	Date       time.Time
+	TrainClass string
+	TrainName  string
+	Departure  string
+	Arrival    string
+
+	Status    string
+	PaymentID string
+	// 運休により払い戻し済み
+	Refunded bool
+
+	Adult  int
+	Child  int
+	Amount int
+
+	// 自由席の場合は0. 号車をまたぐ予約では先頭の座席の号車
+	CarNum int
+	// 座席ごとの号車は CarNumber に持つ
+	Seats []*isutrain.ReservationSeat
+}
+
+// fakeWaitlistEntry は満席の列車のキャンセル待ちです
+type fakeWaitlistEntry struct {
+	ID     int
+	UserID int
+
+	Date          time.Time
+	TrainClass    string
+	TrainName     string
+	Departure     string
+	Arrival       string
+	SeatClass     string
+	IsSmokingSeat bool
+
+	Adult int
+	Child int
+
+	Status string
+	// 繰り上げで作成した予約
+	ReservationID int
+}
+
+// fakeTrainOperation は列車の運行情報です
+type fakeTrainOperation struct {
+	Status       string
+	DelayMinutes int
+}
+
+// fakeSeatKey は列車内の座席を識別します
+type fakeSeatKey struct {
+	carNum int
+	row    int
+	column string
+}
+
+// fakeState はモックが保持するwebappのデータです
+type fakeState struct {
+	mu sync.Mutex
+
+	stations   []*isutraindb.Station
+	stationMap map[string]*isutraindb.Station
+	trains     []*fakeTrain
+	trainMap   map[string]*fakeTrain
+
+	users             map[string]*fakeUser
+	usersByID         map[int]*fakeUser
+	reservations      map[int]*fakeReservation
+	operations        map[string]*fakeTrainOperation
+	waitlist          map[int]*fakeWaitlistEntry
+	lastUserID        int
+	lastReservationID int
+	lastWaitlistID    int
+}
+
+func newFakeState() *fakeState {
+	s := &fakeState{
+		stations:   isutraindb.ListStations(),
+		stationMap: map[string]*isutraindb.Station{},
+		trainMap:   map[string]*fakeTrain{},
+	}
+	for _, station := range s.stations {
+		s.stationMap[station.Name] = station
+	}
+	s.trains = newTimetable(s.stations)
+	for _, train := range s.trains {
+		s.trainMap[trainKey(train.Class, train.Name)] = train
+	}
+	s.reset()
+
+	return s
+}
+
+func trainKey(trainClass, trainName string) string {
+	return fmt.Sprintf("%s/%s", trainClass, trainName)
+}
+
+// reset はユーザと予約を全て削除します
+func (s *fakeState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = map[string]*fakeUser{}
+	s.usersByID = map[int]*fakeUser{}
+	s.reservations = map[int]*fakeReservation{}
+	s.operations = map[string]*fakeTrainOperation{}
+	s.waitlist = map[int]*fakeWaitlistEntry{}
+	s.lastUserID = 0
+	s.lastReservationID = 0
+	s.lastWaitlistID = 0
+}
+
+func operationKey(date time.Time, trainClass, trainName string) string {
+	return fmt.Sprintf("%s/%s/%s", date.Format("2006-01-02"), trainClass, trainName)
+}
+
+// trainStatus は、列車の運行状態と遅延時間を返します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) trainStatus(date time.Time, trainClass, trainName string) (string, int) {
+	operation, ok := s.operations[operationKey(date, trainClass, trainName)]
+	if !ok {
+		return isutrain.TrainStatusNormal, 0
+	}
+	return operation.Status, operation.DelayMinutes
+}
+
+func (s *fakeState) train(trainClass, trainName string) (*fakeTrain, bool) {
+	train, ok := s.trainMap[trainKey(trainClass, trainName)]
+	return train, ok
+}
+
+// isNobori は区間が上りか判定します
+func (s *fakeState) isNobori(from, to *isutraindb.Station) bool {
+	return from.Distance > to.Distance
+}
+
+// usableTrainClasses は、乗車駅と降車駅の両方に停車する列車種別を返します
+func (s *fakeState) usableTrainClasses(from, to *isutraindb.Station) map[string]bool {
+	usable := map[string]bool{}
+	for _, trainClass := range trainClasses {
+		if isStopStation(trainClass, from) && isStopStation(trainClass, to) {
+			usable[trainClass] = true
+		}
+	}
+	return usable
+}
+
+// occupiedSeats は、列車の指定区間で予約済みの座席を返します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) occupiedSeats(date time.Time, trainClass, trainName, departure, arrival string) (map[fakeSeatKey]bool, error) {
+	occupied := map[fakeSeatKey]bool{}
+	for _, reservation := range s.reservations {
+		if !reservation.Date.Equal(date) || reservation.TrainClass != trainClass || reservation.TrainName != trainName {
+			continue
+		}
+		if reservation.CarNum == 0 {
+			continue
+		}
+
+		overwrap, err := isutrain.IsSectionOverwrap(departure, arrival, reservation.Departure, reservation.Arrival)
+		if err != nil {
+			return nil, err
+		}
+		if !overwrap {
+			continue
+		}
+
+		for _, seat := range reservation.Seats {
+			occupied[fakeSeatKey{carNum: seat.CarNumber, row: seat.SeatRow, column: seat.SeatColumn}] = true
+		}
+	}
+
+	return occupied, nil
+}
+
+// userReservations はユーザの予約を予約ID順に返します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) userReservations(userID int) []*fakeReservation {
+	reservations := []*fakeReservation{}
+	for _, reservation := range s.reservations {
+		if reservation.UserID == userID {
+			reservations = append(reservations, reservation)
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].ID < reservations[j].ID
+	})
+
+	return reservations
+}
+
+// reservationResponse は予約一覧・予約詳細のレスポンスを作成します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) reservationResponse(reservation *fakeReservation) (*isutrain.Reservation, error) {
+	train, ok := s.train(reservation.TrainClass, reservation.TrainName)
+	if !ok {
+		return nil, fmt.Errorf("列車が存在しません: %s %s", reservation.TrainClass, reservation.TrainName)
+	}
+	departure, ok := train.stops[reservation.Departure]
+	if !ok {
+		return nil, fmt.Errorf("列車が乗車駅に停車しません: %s", reservation.Departure)
+	}
+	arrival, ok := train.stops[reservation.Arrival]
+	if !ok {
+		return nil, fmt.Errorf("列車が降車駅に停車しません: %s", reservation.Arrival)
+	}
+
+	seatClass := "non-reserved"
+	if reservation.CarNum != 0 {
+		seatClass = isutraindb.GetSeatClass(reservation.TrainClass, reservation.CarNum)
+	}
+
+	seats := []*isutrain.ReservationSeat{}
+	for _, seat := range reservation.Seats {
+		seats = append(seats, &isutrain.ReservationSeat{
+			CarNumber:  seat.CarNumber,
+			SeatRow:    seat.SeatRow,
+			SeatColumn: seat.SeatColumn,
+		})
+	}
+
+	trainStatus, delayMinutes := s.trainStatus(reservation.Date, reservation.TrainClass, reservation.TrainName)
+
+	return &isutrain.Reservation{
+		ReservationID: reservation.ID,
+		Date:          reservation.Date.Format("2006/01/02"),
+		TrainClass:    reservation.TrainClass,
+		TrainName:     reservation.TrainName,
+		CarNumber:     reservation.CarNum,
+		SeatClass:     seatClass,
+		Amount:        reservation.Amount,
+		Adult:         reservation.Adult,
+		Child:         reservation.Child,
+		Departure:     reservation.Departure,
+		Arrival:       reservation.Arrival,
+		DepartureTime: formatClock(departure.departure),
+		ArrivalTime:   formatClock(arrival.arrival),
+		Seats:         seats,
+		TrainStatus:   trainStatus,
+		DelayMinutes:  delayMinutes,
+		Refunded:      reservation.Refunded,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package mock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+)
+
+// モックの時刻表
+// NOTE: 本物のwebappはfixtureで日付ごとに列車を生成するが、モックでは毎日同じダイヤで運行する
+
+var trainClasses = []string{"最速", "中間", "遅いやつ"}
+
+// 列車種別ごとの表定速度 (km/h)
+var trainSpeeds = map[string]float64{
+	"最速":   410,
+	"中間":   290,
+	"遅いやつ": 200,
+}
+
+const (
+	// 始発駅を出発する時刻の範囲 (毎時0分発)
+	firstDepartureHour = 6
+	lastDepartureHour  = 18
+	// 途中駅での停車時間
+	stopDuration = time.Minute
+)
+
+// fakeStop は停車駅の到着・出発時刻 (0時からの経過時間) です
+type fakeStop struct {
+	arrival   time.Duration
+	departure time.Duration
+}
+
+type fakeTrain struct {
+	Class    string
+	Name     string
+	Start    string
+	Last     string
+	IsNobori bool
+
+	// 停車駅の順序
+	stations []string
+	stops    map[string]*fakeStop
+}
+
+func isStopStation(trainClass string, station *isutraindb.Station) bool {
+	switch trainClass {
+	case "最速":
+		return station.IsStopExpress
+	case "中間":
+		return station.IsStopSemiExpress
+	case "遅いやつ":
+		return station.IsStopLocal
+	default:
+		return false
+	}
+}
+
+// newTimetable は、全列車が東京〜大阪間を走るダイヤを作成します
+// 列車名は、下りが奇数、上りが偶数の号数になります
+func newTimetable(stations []*isutraindb.Station) []*fakeTrain {
+	trains := []*fakeTrain{}
+	for hour := firstDepartureHour; hour <= lastDepartureHour; hour++ {
+		for _, trainClass := range trainClasses {
+			for _, isNobori := range []bool{false, true} {
+				num := 2*(hour-firstDepartureHour) + 1
+				if isNobori {
+					num++
+				}
+				trains = append(trains, newFakeTrain(stations, trainClass, fmt.Sprintf("%d号", num), isNobori, time.Duration(hour)*time.Hour))
+			}
+		}
+	}
+
+	return trains
+}
+
+func newFakeTrain(stations []*isutraindb.Station, trainClass, trainName string, isNobori bool, departedAt time.Duration) *fakeTrain {
+	ordered := make([]*isutraindb.Station, len(stations))
+	copy(ordered, stations)
+	if isNobori {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+
+	train := &fakeTrain{
+		Class:    trainClass,
+		Name:     trainName,
+		Start:    ordered[0].Name,
+		Last:     ordered[len(ordered)-1].Name,
+		IsNobori: isNobori,
+		stations: []string{},
+		stops:    map[string]*fakeStop{},
+	}
+
+	origin := ordered[0].Distance
+	for i, station := range ordered {
+		if !isStopStation(trainClass, station) {
+			continue
+		}
+
+		distance := station.Distance - origin
+		if distance < 0 {
+			distance = -distance
+		}
+		arrival := departedAt + time.Duration(distance/trainSpeeds[trainClass]*float64(time.Hour)).Truncate(time.Second)
+		departure := arrival + stopDuration
+		if i == 0 {
+			departure = arrival
+		}
+
+		train.stations = append(train.stations, station.Name)
+		train.stops[station.Name] = &fakeStop{arrival: arrival, departure: departure}
+	}
+
+	return train
+}
+
+func formatClock(d time.Duration) string {
+	secs := int(d / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
@@ -0,0 +1,276 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+)
+
+func waitlistIDFromPath(req *http.Request) (int, error) {
+	sm := regexp.MustCompile(strings.TrimPrefix(endpoint.IsutrainMockCancelWaitlistPath, "=~")).FindStringSubmatch(req.URL.Path)
+	if len(sm) != 2 {
+		return 0, fmt.Errorf("キャンセル待ちIDが含まれていません: %s", req.URL.Path)
+	}
+	return strconv.Atoi(sm[1])
+}
+
+// trainWaitlist は、列車の待っているキャンセル待ちを登録順に返します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) trainWaitlist(date time.Time, trainClass, trainName string) []*fakeWaitlistEntry {
+	entries := []*fakeWaitlistEntry{}
+	for _, entry := range s.waitlist {
+		if entry.Status != isutrain.WaitlistStatusWaiting {
+			continue
+		}
+		if !entry.Date.Equal(date) || entry.TrainClass != trainClass || entry.TrainName != trainName {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// waitlistResponse はキャンセル待ちのレスポンスを作成します
+// NOTE: 呼び出し元でロックを取得すること
+func (s *fakeState) waitlistResponse(entry *fakeWaitlistEntry) *isutrain.WaitlistResponse {
+	resp := &isutrain.WaitlistResponse{
+		WaitlistID:    entry.ID,
+		Date:          entry.Date.Format("2006/01/02"),
+		TrainClass:    entry.TrainClass,
+		TrainName:     entry.TrainName,
+		Departure:     entry.Departure,
+		Arrival:       entry.Arrival,
+		SeatClass:     entry.SeatClass,
+		IsSmokingSeat: entry.IsSmokingSeat,
+		Adult:         entry.Adult,
+		Child:         entry.Child,
+		Status:        entry.Status,
+		ReservationID: entry.ReservationID,
+	}
+	if entry.Status == isutrain.WaitlistStatusWaiting {
+		for _, waiting := range s.trainWaitlist(entry.Date, entry.TrainClass, entry.TrainName) {
+			resp.Position++
+			if waiting.ID == entry.ID {
+				break
+			}
+		}
+	}
+	return resp
+}
+
+// promoteWaitlist は、列車のキャンセル待ちを登録順に調べ、座席を確保できたものを予約にします
+// 人数が多く座席を確保できないキャンセル待ちは飛ばします
+// NOTE: 呼び出し元でロックを取得すること
+func (m *Mock) promoteWaitlist(date time.Time, trainClass, trainName string) error {
+	if trainStatus, _ := m.state.trainStatus(date, trainClass, trainName); trainStatus == isutrain.TrainStatusCancelled {
+		return nil
+	}
+
+	entries := m.state.trainWaitlist(date, trainClass, trainName)
+	if m.hasBug(BugUnfairWaitlist) {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].ID > entries[j].ID
+		})
+	}
+
+	for _, entry := range entries {
+		carNum, seats, _, err := m.findVagueSeats(date, &isutrain.ReserveRequest{
+			TrainClass:    entry.TrainClass,
+			TrainName:     entry.TrainName,
+			SeatClass:     entry.SeatClass,
+			IsSmokingSeat: entry.IsSmokingSeat,
+			Departure:     entry.Departure,
+			Arrival:       entry.Arrival,
+			Adult:         entry.Adult,
+			Child:         entry.Child,
+		})
+		if err != nil {
+			return err
+		}
+		if len(seats) == 0 {
+			continue
+		}
+
+		amount, err := m.reservationAmount(date, entry.TrainClass, entry.Departure, entry.Arrival, entry.SeatClass, entry.Adult, entry.Child)
+		if err != nil {
+			return err
+		}
+
+		m.state.lastReservationID++
+		reservation := &fakeReservation{
+			ID:         m.state.lastReservationID,
+			UserID:     entry.UserID,
+			Date:       date,
+			TrainClass: entry.TrainClass,
+			TrainName:  entry.TrainName,
+			Departure:  entry.Departure,
+			Arrival:    entry.Arrival,
+			Status:     reservationStatusRequesting,
+			Adult:      entry.Adult,
+			Child:      entry.Child,
+			Amount:     amount,
+			CarNum:     carNum,
+			Seats:      seats,
+		}
+		m.state.reservations[reservation.ID] = reservation
+
+		entry.Status = isutrain.WaitlistStatusPromoted
+		entry.ReservationID = reservation.ID
+	}
+
+	return nil
+}
+
+// RegisterWaitlist は満席の列車のキャンセル待ちを登録します
+// 既に座席が空いていれば、すぐに繰り上げます
+func (m *Mock) RegisterWaitlist(req *http.Request) ([]byte, int) {
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
+	}
+
+	waitlistReq := &isutrain.WaitlistRequest{}
+	if err := json.NewDecoder(req.Body).Decode(waitlistReq); err != nil {
+		return errorResponse(http.StatusBadRequest, "JSON parseに失敗しました")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	useAt, err := parseDate(waitlistReq.Date)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "時刻のparseに失敗しました")
+	}
+	date := truncateDate(useAt)
+
+	switch waitlistReq.SeatClass {
+	case "premium", "reserved":
+	case "non-reserved":
+		return errorResponse(http.StatusBadRequest, "自由席はキャンセル待ちできません")
+	default:
+		return errorResponse(http.StatusBadRequest, "リクエストされた座席クラスが不明です")
+	}
+	if waitlistReq.Adult < 0 || waitlistReq.Child < 0 || waitlistReq.Adult+waitlistReq.Child <= 0 {
+		return errorResponse(http.StatusBadRequest, "人数が不正です")
+	}
+
+	train, ok := m.state.train(waitlistReq.TrainClass, waitlistReq.TrainName)
+	if !ok {
+		return errorResponse(http.StatusNotFound, "列車データがみつかりません")
+	}
+	from, ok := m.state.stationMap[waitlistReq.Departure]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("乗車駅データがみつかりません %s", waitlistReq.Departure))
+	}
+	to, ok := m.state.stationMap[waitlistReq.Arrival]
+	if !ok {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("降車駅データがみつかりません %s", waitlistReq.Arrival))
+	}
+	if !isStopStation(train.Class, from) || !isStopStation(train.Class, to) {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("%sの止まらない駅です", train.Class))
+	}
+	if from.Name == to.Name || train.IsNobori != m.state.isNobori(from, to) {
+		return errorResponse(http.StatusBadRequest, "リクエストされた区間に列車が運行していない区間が含まれています")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	if trainStatus, _ := m.state.trainStatus(date, train.Class, train.Name); trainStatus == isutrain.TrainStatusCancelled {
+		return errorResponse(http.StatusBadRequest, "運休のためキャンセル待ちできません")
+	}
+
+	m.state.lastWaitlistID++
+	entry := &fakeWaitlistEntry{
+		ID:            m.state.lastWaitlistID,
+		UserID:        user.ID,
+		Date:          date,
+		TrainClass:    train.Class,
+		TrainName:     train.Name,
+		Departure:     from.Name,
+		Arrival:       to.Name,
+		SeatClass:     waitlistReq.SeatClass,
+		IsSmokingSeat: waitlistReq.IsSmokingSeat,
+		Adult:         waitlistReq.Adult,
+		Child:         waitlistReq.Child,
+		Status:        isutrain.WaitlistStatusWaiting,
+	}
+	m.state.waitlist[entry.ID] = entry
+
+	if err := m.promoteWaitlist(date, train.Class, train.Name); err != nil {
+		return errorResponse(http.StatusInternalServerError, err.Error())
+	}
+
+	return jsonResponse(m.state.waitlistResponse(entry))
+}
+
+// ListWaitlist はログイン中のユーザのキャンセル待ちを登録順に返します
+func (m *Mock) ListWaitlist(req *http.Request) ([]byte, int) {
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	entries := []*fakeWaitlistEntry{}
+	for _, entry := range m.state.waitlist {
+		if entry.UserID == user.ID {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	resp := isutrain.ListWaitlistResponse{}
+	for _, entry := range entries {
+		resp = append(resp, m.state.waitlistResponse(entry))
+	}
+
+	return jsonResponse(resp)
+}
+
+// CancelWaitlist はキャンセル待ちを取り消します
+func (m *Mock) CancelWaitlist(req *http.Request) ([]byte, int) {
+	if !m.validCSRFToken(req) {
+		return errorResponse(http.StatusForbidden, "invalid csrf token")
+	}
+
+	waitlistID, err := waitlistIDFromPath(req)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "incorrect waitlist id")
+	}
+
+	user, ok := m.getUser(req)
+	if !ok {
+		return errorResponse(http.StatusUnauthorized, "no session")
+	}
+
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+
+	entry, ok := m.state.waitlist[waitlistID]
+	if !ok || entry.UserID != user.ID {
+		return errorResponse(http.StatusNotFound, "キャンセル待ちがみつかりません")
+	}
+	if entry.Status != isutrain.WaitlistStatusWaiting {
+		return errorResponse(http.StatusBadRequest, fmt.Sprintf("キャンセル待ちは既に%sです", entry.Status))
+	}
+	entry.Status = isutrain.WaitlistStatusCancelled
+
+	return messageResponse("waitlist cancelled")
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
 	"github.com/chibiegg/isucon9-final/bench/internal/config"
 	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
+	"github.com/chibiegg/isucon9-final/bench/internal/traffic"
 )
 
 var (
@@ -82,7 +83,8 @@ func (c *Client) RegistCard(ctx context.Context, cardNumber, cvv, expiryDate str
 		return "", bencherror.NewCriticalError(ErrRegistCard, "課金APIにクレジットカードを登録できませんでした. 運営に確認をお願いいたします")
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	// NOTE: リプレイ時にカードを登録し直し、記録されたトークンを差し替えるために記録する
+	resp, err := traffic.Do(traffic.PaymentSessionID, http.DefaultClient, req)
 	if err != nil {
 		return "", bencherror.NewCriticalError(ErrRegistCard, "課金APIにクレジットカードを登録できませんでした. 運営に確認をお願いいたします")
 	}
@@ -12,8 +12,12 @@ import (
 	"github.com/chibiegg/isucon9-final/bench/internal/util"
 	"github.com/chibiegg/isucon9-final/bench/internal/xrandom"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/chibiegg/isucon9-final/bench/payment"
 )
 
+// ロックアウトを確認するまでに、誤ったパスワードでログインを試みる最大回数
+const loginLockoutMaxAttempts = 20
+
 func AbnormalLoginScenario(ctx context.Context) error {
 	var (
 		email, err1    = util.SecureRandomStr(10)
@@ -161,6 +165,167 @@ func AbnormalReserveWrongSeat(ctx context.Context) error {
 	return nil
 }
 
+// CSRFトークンを偽装したリクエストが、予約・予約確定・キャンセルで弾かれるかチェック
+// NOTE: CSRF対策はGolangの参考実装のみなので、Golangの実装に限って実行する (isLanguage)
 func AbnormalReserveWithCSRFTokenScenario(ctx context.Context) error {
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	paymentClient, err := payment.NewClient()
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	user, err := xrandom.GetRandomUser()
+	if err != nil {
+		bencherror.SystemErrs.AddError(err)
+		return nil
+	}
+
+	forgedToken, err := util.SecureRandomStr(32)
+	if err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "ランダム文字列生成でエラーが発生しました"))
+		return nil
+	}
+
+	err = registerUserAndLogin(ctx, client, user)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	// CSRF対策を外した場合に、検証せずに成功させない
+	if client.CSRFToken() == "" {
+		return bencherror.BenchmarkErrs.AddError(bencherror.NewSimpleApplicationError("ログイン後にCSRFトークン (%s) が発行されませんでした", isutrain.CSRFCookieName))
+	}
+
+	// トークンなし、偽装したトークンの両方を試す
+	forgedOpts := []isutrain.ClientOption{
+		isutrain.CSRFTokenOpt(""),
+		isutrain.CSRFTokenOpt(forgedToken),
+	}
+
+	useAt := xrandom.GetRandomUseAt()
+	departure, arrival := xrandom.GetRandomSection()
+	trains, err := client.SearchTrains(ctx, useAt, departure, arrival, "遅いやつ", 1, 1)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	if len(trains) == 0 {
+		return bencherror.BenchmarkErrs.AddError(bencherror.NewSimpleCriticalError("列車検索結果が空でした"))
+	}
+	train := trains[0]
+
+	for _, forgedOpt := range forgedOpts {
+		_, err = client.Reserve(ctx,
+			train.Class, train.Name,
+			"premium", isutrain.TrainSeats{},
+			departure, arrival, useAt,
+			0, 1, 1,
+			forgedOpt, isutrain.StatusCodeOpt(http.StatusForbidden))
+		if err != nil {
+			return bencherror.BenchmarkErrs.AddError(err)
+		}
+	}
+
+	reserveResp, err := client.Reserve(ctx,
+		train.Class, train.Name,
+		"premium", isutrain.TrainSeats{},
+		departure, arrival, useAt,
+		0, 1, 1)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	cardToken, err := paymentClient.RegistCard(ctx, "11111111", "222", "10/50")
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	for _, forgedOpt := range forgedOpts {
+		err = client.CommitReservation(ctx, reserveResp.ReservationID, cardToken, forgedOpt, isutrain.StatusCodeOpt(http.StatusForbidden))
+		if err != nil {
+			return bencherror.BenchmarkErrs.AddError(err)
+		}
+	}
+
+	err = client.CommitReservation(ctx, reserveResp.ReservationID, cardToken)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	for _, forgedOpt := range forgedOpts {
+		err = client.CancelReservation(ctx, reserveResp.ReservationID, forgedOpt, isutrain.StatusCodeOpt(http.StatusForbidden))
+		if err != nil {
+			return bencherror.BenchmarkErrs.AddError(err)
+		}
+	}
+
+	err = client.CancelReservation(ctx, reserveResp.ReservationID)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	return nil
+}
+
+// ログインに繰り返し失敗したアカウントがロックアウトされ、正しいパスワードでもログインできないかチェック
+// NOTE: 試行制限はGolangの参考実装のみなので、Golangの実装に限って実行する (isLanguage)
+func AbnormalLoginLockoutScenario(ctx context.Context) error {
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	user, err := xrandom.GetRandomUser()
+	if err != nil {
+		bencherror.SystemErrs.AddError(err)
+		return nil
+	}
+
+	wrongPassword, err := util.SecureRandomStr(20)
+	if err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "ランダム文字列生成でエラーが発生しました"))
+		return nil
+	}
+
+	err = client.Signup(ctx, user.Email, user.Password)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	locked := false
+	for i := 0; i < loginLockoutMaxAttempts; i++ {
+		err = client.Login(ctx, user.Email, wrongPassword, isutrain.StatusCodeOpt(http.StatusForbidden))
+		if err == nil {
+			continue
+		}
+		// 403以外が返ってきた場合、ロックアウトされたかどうか確かめる
+		if lockErr := client.Login(ctx, user.Email, wrongPassword, isutrain.StatusCodeOpt(http.StatusTooManyRequests)); lockErr != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		locked = true
+		break
+	}
+	// 試行制限を外した場合に、検証せずに成功させない
+	if !locked {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleApplicationError("ログインに%d回失敗してもロックアウトされませんでした", loginLockoutMaxAttempts))
+	}
+
+	// ロックアウト中は、正しいパスワードでもログインできない
+	err = client.Login(ctx, user.Email, user.Password, isutrain.StatusCodeOpt(http.StatusTooManyRequests))
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
 	return nil
 }
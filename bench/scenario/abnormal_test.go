@@ -1,7 +1,77 @@
 package scenario
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/chibiegg/isucon9-final/bench/mock"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
 
 func TestAbnormalScenario(t *testing.T) {
 
 }
+
+func TestAbnormalReserveWithCSRFTokenScenario(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := mock.Register()
+	assert.NoError(t, err)
+
+	initClient, err := isutrain.NewClientForInitialize()
+	assert.NoError(t, err)
+	initClient.ReplaceMockTransport()
+	initClient.Initialize(context.Background())
+
+	config.Debug = true
+	assert.NoError(t, AbnormalReserveWithCSRFTokenScenario(context.Background()))
+
+	// CSRFトークンを検証しないwebappは検出する
+	m.InjectBug(mock.BugNoCSRFCheck)
+	assert.Error(t, AbnormalReserveWithCSRFTokenScenario(context.Background()))
+}
+
+func TestAbnormalLoginLockoutScenario(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := mock.Register()
+	assert.NoError(t, err)
+
+	initClient, err := isutrain.NewClientForInitialize()
+	assert.NoError(t, err)
+	initClient.ReplaceMockTransport()
+	initClient.Initialize(context.Background())
+
+	config.Debug = true
+	assert.NoError(t, AbnormalLoginLockoutScenario(context.Background()))
+
+	// ロックアウト中に正しいパスワードでログインできてしまうwebappは検出する
+	m.InjectBug(mock.BugLockoutBypass)
+	assert.Error(t, AbnormalLoginLockoutScenario(context.Background()))
+
+	// Golangの実装でロックアウトしないwebappは、検証せずに成功させない
+	m.LoginLockoutThreshold = 0
+	assert.Error(t, AbnormalLoginLockoutScenario(context.Background()))
+}
+
+func TestAbnormalScenarioPreconditions(t *testing.T) {
+	defer func(language string) {
+		config.Language = language
+	}(config.Language)
+
+	for _, name := range []string{"AbnormalReserveWithCSRFToken", "AbnormalLoginLockout"} {
+		s, ok := Lookup(name)
+		assert.True(t, ok, name)
+
+		config.Language = "golang"
+		assert.True(t, s.CanRun(), name)
+		// Golang以外の実装にはCSRF対策・試行制限がない
+		config.Language = "python"
+		assert.False(t, s.CanRun(), name)
+	}
+}
@@ -0,0 +1,39 @@
+package scenario
+
+import (
+	"context"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+)
+
+// ベンチ負荷の１単位で実行される組み込みシナリオ
+// NOTE: 登録順に実行されます
+func init() {
+	mustRegister(NewFuncScenario("NormalScenario", PhaseLoad, 1, NormalScenario))
+	mustRegister(NewFuncScenario("NormalCancelScenario", PhaseLoad, 1, NormalCancelScenario))
+	mustRegister(NewFuncScenario("AttackReserveForOtherReservation", PhaseLoad, 1, AttackReserveForOtherReservation))
+	mustRegister(NewFuncScenario("AttackReserveRaceCondition", PhaseLoad, 1, AttackReserveRaceCondition))
+	mustRegister(NewFuncScenario("AbnormalReserveWrongSection", PhaseLoad, 1, AbnormalReserveWrongSection))
+	mustRegister(NewFuncScenario("AbnormalReserveWrongSeat", PhaseLoad, 1, AbnormalReserveWrongSeat))
+	mustRegister(NewFuncScenario("AbnormalReserveWithCSRFToken", PhaseLoad, 1, AbnormalReserveWithCSRFTokenScenario, isLanguage("golang")))
+	mustRegister(NewFuncScenario("AbnormalLoginLockout", PhaseFinalCheck, 1, AbnormalLoginLockoutScenario, isLanguage("golang")))
+	mustRegister(NewFuncScenario("NormalTrainOperation", PhaseFinalCheck, 1, NormalTrainOperationScenario, hasAdminToken))
+	mustRegister(NewFuncScenario("NormalWaitlist", PhaseFinalCheck, 1, NormalWaitlistScenario, isLanguage("golang")))
+	mustRegister(NewFuncScenario("NormalManyAmbigiousSearchScenario", PhaseLoad, 1, func(ctx context.Context) error {
+		return NormalManyAmbigiousSearchScenario(ctx, int(config.ReservationEndDate.Month())*3)
+	}, afterMonth(3)))
+	mustRegister(NewFuncScenario("NormalManyCancelScenario", PhaseLoad, 1, func(ctx context.Context) error {
+		return NormalManyCancelScenario(ctx, int(config.ReservationEndDate.Month())*3)
+	}, afterMonth(3)))
+	mustRegister(NewFuncScenario("NormalVagueSearchScenario", PhaseLoad, 1, NormalVagueSearchScenario))
+	mustRegister(NewFuncScenario("NormalAccountScenario", PhaseLoad, 1, NormalAccountScenario))
+	mustRegister(NewFuncScenario("SeasonGoldenWeekStartScenario", PhaseLoad, 1, func(ctx context.Context) error {
+		return SeasonGoldenWeekScenario(ctx, config.GoldenWeekStartDate, 5)
+	}, config.IsGoldenweekStarted))
+	mustRegister(NewFuncScenario("SeasonGoldenWeekEndScenario", PhaseLoad, 1, func(ctx context.Context) error {
+		return SeasonGoldenWeekScenario(ctx, config.GoldenWeekEndDate, 5)
+	}, config.IsGoldenweekEnded))
+	mustRegister(NewFuncScenario("SeasonOlympicScenario", PhaseLoad, 1, func(ctx context.Context) error {
+		return SeasonOlympicScenario(ctx, 5)
+	}, config.IsOlympic))
+}
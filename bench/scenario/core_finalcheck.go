@@ -3,27 +3,46 @@ package scenario
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
-
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb/sqlmaster"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/chibiegg/isucon9-final/bench/payment"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// 予約の整合性チェックで、並行してユーザのログインを行うクライアント数
+const finalcheckParallelism = 10
+
 var (
 	ErrListReservation                              = errors.New("予約一覧の取得に失敗しました")
 	ErrInvalidReservationForPaymentAPI              = errors.New("課金APIと予約の整合性が取れていません")
 	ErrInvalidReservationForBenchCache              = errors.New("予約における計算結果が")
 	ErrNoReservationPayments                        = errors.New("予約に紐づく課金情報がありません")
 	ErrCanceledReservationExistsPaymentInformations = errors.New("キャンセルされた予約が課金情報に含まれています")
+	ErrDoubleBooking                                = errors.New("同じ座席が重複して予約されています")
 )
 
 // FinalCheck は、課金サービスとwebappとで決済情報を突き合わせ、売上を計上します
 func FinalCheck(ctx context.Context, isutrainClient *isutrain.Client, paymentClient *payment.Client) {
+	ctx = bencherror.WithScenario(ctx, "FinalCheck")
+
 	// 予約一覧と突き合わせて、不足チェック
 	finalcheckPayment(ctx, paymentClient)
+
+	// ユーザごとにwebappの予約とベンチの予約キャッシュを突き合わせ、座席の重複予約をチェック
+	finalcheckReservations(ctx, isutrainClient)
+
+	// 予約・確定・キャンセルの履歴が直列化可能かチェック
+	finalcheckHistory(ctx)
 }
 
 func finalcheckPayment(ctx context.Context, paymentClient *payment.Client) error {
@@ -104,3 +123,310 @@ func finalcheckPayment(ctx context.Context, paymentClient *payment.Client) error
 
 	return nil
 }
+
+// finalcheckSeat は座席の重複予約検出に用いる、座席の識別子です
+type finalcheckSeat struct {
+	date       string
+	trainClass string
+	trainName  string
+	carNum     int
+	seatRow    int
+	seatColumn string
+}
+
+// finalcheckOccupancy はwebappのレスポンスから再構築した座席の占有状況です
+type finalcheckOccupancy struct {
+	mu    sync.Mutex
+	seats map[finalcheckSeat][]*isutrain.Reservation
+	// 同じ列車、同じ駅の発着時刻は予約によらず一致しなければならない
+	times map[string]string
+}
+
+func newFinalcheckOccupancy() *finalcheckOccupancy {
+	return &finalcheckOccupancy{
+		seats: map[finalcheckSeat][]*isutrain.Reservation{},
+		times: map[string]string{},
+	}
+}
+
+func (o *finalcheckOccupancy) add(reservation *isutrain.Reservation) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, t := range []struct {
+		kind, station, time string
+	}{
+		{"departure", reservation.Departure, reservation.DepartureTime},
+		{"arrival", reservation.Arrival, reservation.ArrivalTime},
+	} {
+		key := fmt.Sprintf("%s/%s/%s/%s/%s", reservation.Date, reservation.TrainClass, reservation.TrainName, t.station, t.kind)
+		if want, ok := o.times[key]; ok && want != t.time {
+			return bencherror.NewSimpleCriticalError("予約 %d の時刻が、同じ列車の他の予約と一致しません: 列車=%s %s, 駅=%s, want=%s, got=%s",
+				reservation.ReservationID, reservation.TrainClass, reservation.TrainName, t.station, want, t.time)
+		}
+		o.times[key] = t.time
+	}
+
+	// 自由席は座席が割り当てられないので、重複チェックの対象外
+	if reservation.SeatClass == "non-reserved" {
+		return nil
+	}
+	for _, seat := range reservation.Seats {
+		key := finalcheckSeat{
+			date:       reservation.Date,
+			trainClass: reservation.TrainClass,
+			trainName:  reservation.TrainName,
+			carNum:     reservation.SeatCarNumber(seat),
+			seatRow:    seat.SeatRow,
+			seatColumn: seat.SeatColumn,
+		}
+		o.seats[key] = append(o.seats[key], reservation)
+	}
+
+	return nil
+}
+
+// doubleBookings は区間の重なる予約が同じ座席を占有していないかチェックします
+func (o *finalcheckOccupancy) doubleBookings() []error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	errs := []error{}
+	for seat, reservations := range o.seats {
+		for i := 0; i < len(reservations); i++ {
+			for j := i + 1; j < len(reservations); j++ {
+				a, b := reservations[i], reservations[j]
+				if a.ReservationID == b.ReservationID {
+					continue
+				}
+				overwrap, err := isutrain.IsSectionOverwrap(a.Departure, a.Arrival, b.Departure, b.Arrival)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if overwrap {
+					errs = append(errs, bencherror.NewCriticalError(ErrDoubleBooking, "同じ座席が重複して予約されています: 予約=%d,%d 列車=%s %s %s %d号車 %d%s",
+						a.ReservationID, b.ReservationID, seat.date, seat.trainClass, seat.trainName, seat.carNum, seat.seatRow, seat.seatColumn))
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// finalcheckHistory は、ベンチマーク中に記録した予約・確定・キャンセルの履歴を検証します
+// 並行して送ったリクエストの結果が、いずれかの順序で一つずつ処理した結果と一致しなければ、排他制御に問題があります
+func finalcheckHistory(ctx context.Context) error {
+	lgr := zap.S()
+
+	errs := isutrain.ReservationHistory.Check()
+	lgr.Infof("予約履歴の直列化チェック: エラー数=%d", len(errs))
+	for _, err := range errs {
+		bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	return nil
+}
+
+// finalcheckReservations は、予約キャッシュの全ユーザでログインし、予約一覧・予約詳細がキャッシュと一致するか検証します
+func finalcheckReservations(ctx context.Context, isutrainClient *isutrain.Client) error {
+	lgr := zap.S()
+
+	var (
+		userReservations = isutrain.ReservationCache.UserReservations()
+		occupancy        = newFinalcheckOccupancy()
+		userC            = make(chan *isutrain.UserReservations)
+		eg               errgroup.Group
+	)
+	lgr.Infof("予約の整合性チェック: ユーザ数=%d", len(userReservations))
+
+	for i := 0; i < finalcheckParallelism && i < len(userReservations); i++ {
+		client := isutrainClient
+		if i > 0 {
+			c, err := isutrain.NewClient()
+			if err != nil {
+				return bencherror.FinalCheckErrs.AddError(err)
+			}
+			if config.Debug {
+				c.ReplaceMockTransport()
+			}
+			client = c
+		}
+
+		eg.Go(func() error {
+			for reservations := range userC {
+				if err := finalcheckUserReservations(ctx, client, reservations, occupancy); err != nil {
+					bencherror.FinalCheckErrs.AddError(err)
+				}
+			}
+			return nil
+		})
+	}
+	for _, reservations := range userReservations {
+		userC <- reservations
+	}
+	close(userC)
+	eg.Wait()
+
+	for _, err := range occupancy.doubleBookings() {
+		bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	return nil
+}
+
+func finalcheckUserReservations(ctx context.Context, client *isutrain.Client, userReservations *isutrain.UserReservations, occupancy *finalcheckOccupancy) error {
+	user := userReservations.User
+	if err := client.Login(ctx, user.Email, user.Password); err != nil {
+		return bencherror.NewCriticalError(err, "予約の整合性チェックのためのログインに失敗しました: %s", user.Email)
+	}
+	defer client.Logout(ctx)
+
+	reservations, err := client.ListReservations(ctx)
+	if err != nil {
+		return bencherror.NewCriticalError(err, "予約の整合性チェックのための予約一覧取得に失敗しました")
+	}
+
+	listed := map[int]*isutrain.Reservation{}
+	for _, reservation := range reservations {
+		listed[reservation.ReservationID] = reservation
+	}
+
+	for _, canceled := range userReservations.Canceled {
+		if _, ok := listed[canceled.ID]; ok {
+			return bencherror.NewSimpleCriticalError("キャンセルされた予約 %d が予約一覧に含まれています", canceled.ID)
+		}
+		if _, err := client.ShowReservation(ctx, canceled.ID, isutrain.StatusCodeOpt(http.StatusNotFound)); err != nil {
+			return bencherror.NewCriticalError(err, "キャンセルされた予約 %d が予約詳細で取得できます", canceled.ID)
+		}
+	}
+
+	for _, cache := range userReservations.Reservations {
+		reservation, ok := listed[cache.ID]
+		if !ok {
+			return bencherror.NewSimpleCriticalError("予約 %d が予約一覧に含まれていません", cache.ID)
+		}
+		if err := assertFinalcheckReservation(cache, reservation); err != nil {
+			return err
+		}
+
+		shown, err := client.ShowReservation(ctx, cache.ID)
+		if err != nil {
+			return bencherror.NewCriticalError(err, "予約 %d を予約詳細で取得できませんでした", cache.ID)
+		}
+		if err := assertFinalcheckReservation(cache, shown); err != nil {
+			return err
+		}
+		if shown.DepartureTime != reservation.DepartureTime || shown.ArrivalTime != reservation.ArrivalTime {
+			return bencherror.NewSimpleCriticalError("予約 %d の発着時刻が予約一覧と予約詳細で一致しません", cache.ID)
+		}
+
+		if err := occupancy.add(reservation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assertFinalcheckReservation は、webappの予約が予約キャッシュと一致するか検証します
+func assertFinalcheckReservation(cache *isutrain.ReservationCacheEntry, reservation *isutrain.Reservation) error {
+	amount, err := cache.Amount()
+	if err != nil {
+		bencherror.SystemErrs.AddError(bencherror.NewCriticalError(err, "予約 %d の運賃取得に失敗しました", cache.ID))
+		return nil
+	}
+
+	if date := cache.Date.Format("2006/01/02"); reservation.Date != date {
+		return bencherror.NewSimpleCriticalError("予約 %d の日付が不正です: want=%s, got=%s", cache.ID, date, reservation.Date)
+	}
+	if reservation.TrainClass != cache.TrainClass || reservation.TrainName != cache.TrainName {
+		return bencherror.NewSimpleCriticalError("予約 %d の列車が不正です: want=%s %s, got=%s %s", cache.ID, cache.TrainClass, cache.TrainName, reservation.TrainClass, reservation.TrainName)
+	}
+	if reservation.Departure != cache.Departure || reservation.Arrival != cache.Arrival {
+		return bencherror.NewSimpleCriticalError("予約 %d の区間が不正です: want=%s-%s, got=%s-%s", cache.ID, cache.Departure, cache.Arrival, reservation.Departure, reservation.Arrival)
+	}
+	if reservation.SeatClass != cache.SeatClass {
+		return bencherror.NewSimpleCriticalError("予約 %d の座席種別が不正です: want=%s, got=%s", cache.ID, cache.SeatClass, reservation.SeatClass)
+	}
+	if reservation.Adult != cache.Adult || reservation.Child != cache.Child {
+		return bencherror.NewSimpleCriticalError("予約 %d の人数が不正です: want=大人%d 子供%d, got=大人%d 子供%d", cache.ID, cache.Adult, cache.Child, reservation.Adult, reservation.Child)
+	}
+	if reservation.Amount != amount {
+		return bencherror.NewSimpleCriticalError("予約 %d の amountが不正です: want=%d, got=%d", cache.ID, amount, reservation.Amount)
+	}
+	if len(reservation.Seats) != cache.SeatCount() {
+		return bencherror.NewSimpleCriticalError("予約 %d の座席数が不正です: want=%d, got=%d", cache.ID, cache.SeatCount(), len(reservation.Seats))
+	}
+
+	departureTime, err := time.Parse("15:04:05", reservation.DepartureTime)
+	if err != nil {
+		return bencherror.NewSimpleCriticalError("予約 %d の出発時刻の形式が不正です: %s", cache.ID, reservation.DepartureTime)
+	}
+	arrivalTime, err := time.Parse("15:04:05", reservation.ArrivalTime)
+	if err != nil {
+		return bencherror.NewSimpleCriticalError("予約 %d の到着時刻の形式が不正です: %s", cache.ID, reservation.ArrivalTime)
+	}
+	if !departureTime.Before(arrivalTime) {
+		return bencherror.NewSimpleCriticalError("予約 %d の到着時刻が出発時刻より前です: 出発=%s, 到着=%s", cache.ID, reservation.DepartureTime, reservation.ArrivalTime)
+	}
+	if err := assertReservationTimetable(cache, reservation); err != nil {
+		return err
+	}
+
+	// 座席指定の予約は、指定した号車・座席が確保されていること
+	if len(cache.Seats) > 0 {
+		if reservation.CarNumber != cache.CarNum {
+			return bencherror.NewSimpleCriticalError("予約 %d の号車が不正です: want=%d, got=%d", cache.ID, cache.CarNum, reservation.CarNumber)
+		}
+
+		var (
+			want = []string{}
+			got  = []string{}
+		)
+		for _, seat := range cache.Seats {
+			want = append(want, fmt.Sprintf("%d%s", seat.Row, seat.Column))
+		}
+		for _, seat := range reservation.Seats {
+			got = append(got, fmt.Sprintf("%d%s", seat.SeatRow, seat.SeatColumn))
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			return bencherror.NewSimpleCriticalError("予約 %d の座席が不正です: want=%v, got=%v", cache.ID, want, got)
+		}
+	}
+
+	return nil
+}
+
+// assertReservationTimetable は、予約の出発時刻・到着時刻が時刻表と一致するか検証します
+// 時刻表が読み込まれていない場合は検証しません
+func assertReservationTimetable(cache *isutrain.ReservationCacheEntry, reservation *isutrain.Reservation) error {
+	if !isutraindb.HasTimetable() {
+		return nil
+	}
+
+	train, ok := isutraindb.GetTrain(cache.Date, cache.TrainClass, cache.TrainName)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("予約 %d の列車が時刻表に存在しません: %s %s", cache.ID, cache.TrainClass, cache.TrainName)
+	}
+	departure, ok := train.Stop(cache.Departure)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("予約 %d の列車は %s に停車しません", cache.ID, cache.Departure)
+	}
+	arrival, ok := train.Stop(cache.Arrival)
+	if !ok {
+		return bencherror.NewSimpleCriticalError("予約 %d の列車は %s に停車しません", cache.ID, cache.Arrival)
+	}
+
+	if departureTime, err := sqlmaster.ParseClock(reservation.DepartureTime); err != nil || departureTime != departure.Departure {
+		return bencherror.NewSimpleCriticalError("予約 %d の出発時刻が時刻表と異なります: got=%s", cache.ID, reservation.DepartureTime)
+	}
+	if arrivalTime, err := sqlmaster.ParseClock(reservation.ArrivalTime); err != nil || arrivalTime != arrival.Arrival {
+		return bencherror.NewSimpleCriticalError("予約 %d の到着時刻が時刻表と異なります: got=%s", cache.ID, reservation.ArrivalTime)
+	}
+
+	return nil
+}
@@ -28,6 +28,8 @@ var (
 
 // Pretest は、ベンチマーク前のアプリケーションが正常に動作できているか検証し、できていなければFAILとします
 func Pretest(ctx context.Context, client *isutrain.Client, paymentClient *payment.Client, assets []*assets.Asset) {
+	ctx = bencherror.WithScenario(ctx, "Pretest")
+
 	// 正常 - 取得系
 	getGrp := &errgroup.Group{}
 	getGrp.Go(func() error {
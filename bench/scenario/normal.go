@@ -2,15 +2,20 @@ package scenario
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
 	"github.com/chibiegg/isucon9-final/bench/internal/config"
 	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/internal/util"
 	"github.com/chibiegg/isucon9-final/bench/internal/xrandom"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/chibiegg/isucon9-final/bench/payment"
+	"golang.org/x/sync/errgroup"
 )
 
 // NormalScenario は基本的な予約フローのシナリオです
@@ -358,3 +363,425 @@ func NormalManyAmbigiousSearchScenario(ctx context.Context, counter int) error {
 
 	return retErr
 }
+
+// パスワードとメールアドレスを変更し、確定済みの予約を残したまま退会する
+// 退会した予約の決済がキャンセルされているかは、FinalCheckで課金APIと突き合わせて検証する
+// NOTE: アカウント管理APIはGolangの参考実装のみなので、404が返された場合は検証しない
+// NOTE: ログインの失敗はIPアドレスごとの試行制限に数えられるので、誤ったパスワードでのログインは試さない
+// 再認証の失敗はアカウントごとの試行制限にのみ数えられるので、誤った現在のパスワードは試す
+func NormalAccountScenario(ctx context.Context) error {
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	user, err := xrandom.GetRandomUser()
+	if err != nil {
+		bencherror.SystemErrs.AddError(err)
+		return nil
+	}
+	// 変更後のメールアドレスとパスワード
+	changed, err := xrandom.GetRandomUser()
+	if err != nil {
+		bencherror.SystemErrs.AddError(err)
+		return nil
+	}
+
+	err = registerUserAndLogin(ctx, client, user)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	// 現在のパスワードが誤っていれば変更できない
+	err = client.ChangePassword(ctx, changed.Password, changed.Password, isutrain.StatusCodeOpt(http.StatusForbidden))
+	if err != nil {
+		if notFoundErr := client.ChangePassword(ctx, changed.Password, changed.Password, isutrain.StatusCodeOpt(http.StatusNotFound)); notFoundErr == nil {
+			return nil
+		}
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	var (
+		useAt              = xrandom.GetRandomUseAt()
+		departure, arrival = xrandom.GetRandomSection()
+		adult, child       = xrandom.GetRandomNumberOfPeople()
+	)
+	_, err = createSimpleReservation(ctx, client, user, useAt, departure, arrival, "", adult, child)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	err = client.ChangePassword(ctx, user.Password, changed.Password)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	if err := client.Logout(ctx); err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	err = client.Login(ctx, user.Email, changed.Password)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	err = client.ChangeEmail(ctx, changed.Email, changed.Password)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	if err := client.Logout(ctx); err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	err = client.Login(ctx, changed.Email, changed.Password)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	reservations, err := client.ListReservations(ctx)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	if len(reservations) != 1 {
+		return bencherror.BenchmarkErrs.AddError(bencherror.NewSimpleCriticalError("メールアドレス変更後の予約一覧の件数が不正です: got=%d, want=1", len(reservations)))
+	}
+
+	err = client.DeleteUser(ctx, user.Password, isutrain.StatusCodeOpt(http.StatusForbidden))
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+	err = client.DeleteUser(ctx, changed.Password)
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	// 退会するとセッションも無効になる
+	_, err = client.ListReservations(ctx, isutrain.StatusCodeOpt(http.StatusUnauthorized))
+	if err != nil {
+		return bencherror.BenchmarkErrs.AddError(err)
+	}
+
+	return nil
+}
+
+// NormalTrainOperationScenario は、管理APIで列車を遅延・運休にし、運休で予約が払い戻されるか検証するシナリオです
+// 他のユーザの予約も払い戻されるため、整合性チェックの後に実行します
+func NormalTrainOperationScenario(ctx context.Context) error {
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	paymentClient, err := payment.NewClient()
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	user, err := xrandom.GetRandomUser()
+	if err != nil {
+		bencherror.SystemErrs.AddError(err)
+		return nil
+	}
+
+	err = registerUserAndLogin(ctx, client, user)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	var (
+		useAt              = xrandom.GetRandomUseAt()
+		departure, arrival = xrandom.GetRandomSection()
+		adult, child       = xrandom.GetRandomNumberOfPeople()
+	)
+	reserveResp, err := createSimpleReservation(ctx, client, user, useAt, departure, arrival, "", adult, child)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	reservation, err := client.ShowReservation(ctx, reserveResp.ReservationID)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+	var (
+		trainClass = reservation.TrainClass
+		trainName  = reservation.TrainName
+		date       = strings.Replace(reservation.Date, "/", "-", -1)
+	)
+
+	_, err = client.UpdateTrainOperation(ctx, &isutrain.TrainOperationRequest{
+		Date:         date,
+		TrainClass:   trainClass,
+		TrainName:    trainName,
+		Status:       isutrain.TrainStatusDelayed,
+		DelayMinutes: 15,
+	})
+	if err != nil {
+		// 運行情報を実装していない場合は検証しない
+		if _, notFoundErr := client.UpdateTrainOperation(ctx, &isutrain.TrainOperationRequest{
+			Date:       date,
+			TrainClass: trainClass,
+			TrainName:  trainName,
+			Status:     isutrain.TrainStatusNormal,
+		}, isutrain.StatusCodeOpt(http.StatusNotFound)); notFoundErr == nil {
+			return nil
+		}
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	reservation, err = client.ShowReservation(ctx, reserveResp.ReservationID)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+	if reservation.TrainStatus != isutrain.TrainStatusDelayed || reservation.DelayMinutes != 15 {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("遅延した列車の運行情報が不正です: %s %s status=%s, delay_minutes=%d", trainClass, trainName, reservation.TrainStatus, reservation.DelayMinutes))
+	}
+
+	operationResp, err := client.UpdateTrainOperation(ctx, &isutrain.TrainOperationRequest{
+		Date:       date,
+		TrainClass: trainClass,
+		TrainName:  trainName,
+		Status:     isutrain.TrainStatusCancelled,
+	})
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+	if operationResp.Refunded < 1 {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("運休にした列車の払い戻し件数が不正です: %s %s refunded=%d", trainClass, trainName, operationResp.Refunded))
+	}
+
+	reservation, err = client.ShowReservation(ctx, reserveResp.ReservationID)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+	if reservation.TrainStatus != isutrain.TrainStatusCancelled || !reservation.Refunded {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("運休になった予約が払い戻されていません: reservation_id=%d status=%s, refunded=%t", reserveResp.ReservationID, reservation.TrainStatus, reservation.Refunded))
+	}
+
+	// 運休の列車は予約できない
+	_, err = client.Reserve(ctx,
+		trainClass, trainName,
+		"premium", isutrain.TrainSeats{},
+		departure, arrival, useAt,
+		0, child, adult,
+		isutrain.StatusCodeOpt(http.StatusBadRequest))
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	result, err := paymentClient.Result(ctx)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewCriticalError(err, "課金APIから決済結果を取得できませんでした"))
+	}
+	for _, rawData := range result.RawData {
+		if rawData.PaymentInfo == nil || rawData.PaymentInfo.ReservationID != reserveResp.ReservationID {
+			continue
+		}
+		if !rawData.PaymentInfo.IsCanceled {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("運休になった予約 %d の決済がキャンセルされていません", reserveResp.ReservationID))
+		}
+	}
+
+	return nil
+}
+
+const (
+	// キャンセル待ちのチェックで、同時にキャンセルする予約の数
+	waitlistCancelCount = 3
+	// 繰り上がらずに待ち続けるキャンセル待ちの数
+	waitlistRemainCount = 2
+)
+
+// newWaitlistUser は、キャンセル待ちのチェックに用いるユーザを作成し、ログインしたクライアントを返します
+func newWaitlistUser(ctx context.Context) (*isutrain.Client, error) {
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	user, err := xrandom.GetRandomUser()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := registerUserAndLogin(ctx, client, user); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// 満席の列車のキャンセル待ちが、同時にキャンセルされた座席の数だけ登録順に繰り上がり、同じ座席が割り当てられないかチェック
+// NOTE: キャンセル待ちはGolangの参考実装のみなので、Golangの実装に限って実行する (isLanguage)
+func NormalWaitlistScenario(ctx context.Context) error {
+	holder, err := newWaitlistUser(ctx)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	var (
+		useAt              = xrandom.GetRandomUseAt()
+		departure, arrival = "東京", "名古屋"
+		trainClass         = "最速"
+	)
+	trains, err := holder.SearchTrains(ctx, useAt, departure, arrival, trainClass, 1, 0)
+	if err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+	var train *isutrain.Train
+	for _, t := range trains {
+		if t.Class == trainClass {
+			train = t
+			break
+		}
+	}
+	if train == nil {
+		return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("列車検索結果に%sが含まれていません", trainClass))
+	}
+
+	// 区間の指定席の喫煙席を全て予約し、満席にする. 先頭の座席は1席ずつ予約し、後で同時にキャンセルする
+	var (
+		singles    = []int{}
+		freedSeats = map[string]bool{}
+	)
+	for carNum := 1; carNum <= 16; carNum++ {
+		hasSmokingSeat := false
+		for _, seat := range isutraindb.GetSeats(trainClass, carNum) {
+			if seat.SeatClass == "reserved" && seat.IsSmokingSeat {
+				hasSmokingSeat = true
+				break
+			}
+		}
+		if !hasSmokingSeat {
+			continue
+		}
+
+		seatsResp, err := holder.SearchTrainSeats(ctx, useAt, trainClass, train.Name, carNum, departure, arrival)
+		if err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		seats := isutrain.TrainSeats{}
+		for _, seat := range seatsResp.Seats {
+			if seat.Class != "reserved" || !seat.IsSmokingSeat || seat.IsOccupied {
+				continue
+			}
+			if len(singles) < waitlistCancelCount {
+				reserveResp, err := holder.Reserve(ctx, trainClass, train.Name, "reserved", isutrain.TrainSeats{{Row: seat.Row, Column: seat.Column}}, departure, arrival, useAt, carNum, 0, 1)
+				if err != nil {
+					return bencherror.FinalCheckErrs.AddError(err)
+				}
+				singles = append(singles, reserveResp.ReservationID)
+				freedSeats[fmt.Sprintf("%d-%d%s", carNum, seat.Row, seat.Column)] = true
+				continue
+			}
+			seats = append(seats, &isutrain.TrainSeat{Row: seat.Row, Column: seat.Column})
+		}
+		if len(seats) > 0 {
+			_, err := holder.Reserve(ctx, trainClass, train.Name, "reserved", seats, departure, arrival, useAt, carNum, 0, len(seats))
+			if err != nil {
+				return bencherror.FinalCheckErrs.AddError(err)
+			}
+		}
+	}
+	if len(singles) == 0 {
+		// 他のシナリオの予約で既に満席
+		return nil
+	}
+
+	waitlistReq := &isutrain.WaitlistRequest{
+		Date:          util.FormatISO8601(useAt),
+		TrainClass:    trainClass,
+		TrainName:     train.Name,
+		SeatClass:     "reserved",
+		IsSmokingSeat: true,
+		Departure:     departure,
+		Arrival:       arrival,
+		Adult:         1,
+	}
+	waiters := []*isutrain.Client{}
+	for i := 0; i < len(singles)+waitlistRemainCount; i++ {
+		waiter, err := newWaitlistUser(ctx)
+		if err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		waitlistResp, err := waiter.RegisterWaitlist(ctx, waitlistReq)
+		if err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		if waitlistResp.Status != isutrain.WaitlistStatusWaiting || waitlistResp.Position != i+1 {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("満席の列車のキャンセル待ちが不正です: waitlist_id=%d status=%s, position=%d (want=%d)", waitlistResp.WaitlistID, waitlistResp.Status, waitlistResp.Position, i+1))
+		}
+		waiters = append(waiters, waiter)
+	}
+
+	// 同時にキャンセルする
+	cancelGrp := &errgroup.Group{}
+	for _, reservationID := range singles {
+		reservationID := reservationID
+		cancelGrp.Go(func() error {
+			return holder.CancelReservation(ctx, reservationID)
+		})
+	}
+	if err := cancelGrp.Wait(); err != nil {
+		return bencherror.FinalCheckErrs.AddError(err)
+	}
+
+	// キャンセルした座席の数だけ登録順に繰り上がり、キャンセルした座席が1席ずつ割り当てられる
+	var (
+		assigned = map[string]bool{}
+		remains  = map[*isutrain.Client]int{}
+	)
+	for i, waiter := range waiters {
+		list, err := waiter.ListWaitlist(ctx)
+		if err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		if len(list) != 1 {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("キャンセル待ちの一覧の件数が不正です: want=1, got=%d", len(list)))
+		}
+		entry := list[0]
+
+		if i >= len(singles) {
+			if entry.Status != isutrain.WaitlistStatusWaiting || entry.Position != i-len(singles)+1 {
+				return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("空席がないキャンセル待ちが不正です: waitlist_id=%d status=%s, position=%d (want=%d)", entry.WaitlistID, entry.Status, entry.Position, i-len(singles)+1))
+			}
+			remains[waiter] = entry.WaitlistID
+			continue
+		}
+
+		if entry.Status != isutrain.WaitlistStatusPromoted {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("%d番目に登録したキャンセル待ちが繰り上がっていません: waitlist_id=%d status=%s", i+1, entry.WaitlistID, entry.Status))
+		}
+		shown, err := waiter.ShowReservation(ctx, entry.ReservationID)
+		if err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+		reservation := (*isutrain.Reservation)(shown)
+		if len(reservation.Seats) != 1 {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("繰り上げられた予約 %d の座席数が不正です: want=1, got=%d", entry.ReservationID, len(reservation.Seats)))
+		}
+		seat := reservation.Seats[0]
+		key := fmt.Sprintf("%d-%d%s", reservation.SeatCarNumber(seat), seat.SeatRow, seat.SeatColumn)
+		if !freedSeats[key] || assigned[key] {
+			return bencherror.FinalCheckErrs.AddError(bencherror.NewSimpleCriticalError("繰り上げられた予約 %d に空いていない座席が割り当てられました: %s %s %d号車 %d%s", entry.ReservationID, trainClass, train.Name, reservation.SeatCarNumber(seat), seat.SeatRow, seat.SeatColumn))
+		}
+		assigned[key] = true
+	}
+
+	// 繰り上がらなかったキャンセル待ちは取り消す
+	for waiter, waitlistID := range remains {
+		if err := waiter.CancelWaitlist(ctx, waitlistID); err != nil {
+			return bencherror.FinalCheckErrs.AddError(err)
+		}
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/chibiegg/isucon9-final/bench/internal/endpoint"
 	"github.com/chibiegg/isucon9-final/bench/isutrain"
 	"github.com/chibiegg/isucon9-final/bench/mock"
+	"github.com/chibiegg/isucon9-final/bench/payment"
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 )
@@ -57,3 +58,94 @@ func TestScenarioBenchError(t *testing.T) {
 func TestHTTPStatusCodeError(t *testing.T) {
 
 }
+
+func TestNormalAccountScenario(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := mock.Register()
+	assert.NoError(t, err)
+
+	initClient, err := isutrain.NewClientForInitialize()
+	assert.NoError(t, err)
+	initClient.ReplaceMockTransport()
+	initClient.Initialize(context.Background())
+
+	paymentClient, err := payment.NewClient()
+	assert.NoError(t, err)
+
+	canceledPayments := func() (canceled, total int) {
+		result, err := paymentClient.Result(context.Background())
+		assert.NoError(t, err)
+		for _, rawData := range result.RawData {
+			if rawData.PaymentInfo == nil {
+				continue
+			}
+			total++
+			if rawData.PaymentInfo.IsCanceled {
+				canceled++
+			}
+		}
+		return
+	}
+
+	config.Debug = true
+	assert.NoError(t, NormalAccountScenario(context.Background()))
+	canceled, total := canceledPayments()
+	assert.Equal(t, 1, total)
+	assert.Equal(t, 1, canceled, "退会したユーザの決済はキャンセルされる")
+
+	// 退会時に決済をキャンセルしないwebappは、課金APIに決済が残る
+	m.InjectBug(mock.BugKeepPaymentOnDelete)
+	assert.NoError(t, NormalAccountScenario(context.Background()))
+	canceled, total = canceledPayments()
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 1, canceled)
+}
+
+func TestNormalTrainOperationScenario(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := mock.Register()
+	assert.NoError(t, err)
+
+	initClient, err := isutrain.NewClientForInitialize()
+	assert.NoError(t, err)
+	initClient.ReplaceMockTransport()
+	initClient.Initialize(context.Background())
+
+	config.Debug = true
+	defer func() { config.AdminToken = "" }()
+
+	// 管理APIを実装していないwebappは検証をスキップする
+	config.AdminToken = "token"
+	assert.NoError(t, NormalTrainOperationScenario(context.Background()))
+
+	m.AdminToken = "token"
+	assert.NoError(t, NormalTrainOperationScenario(context.Background()))
+
+	// 運休にしても決済をキャンセルしないwebappは検出する
+	m.InjectBug(mock.BugNoRefund)
+	assert.Error(t, NormalTrainOperationScenario(context.Background()))
+}
+
+func TestNormalWaitlistScenario(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	m, err := mock.Register()
+	assert.NoError(t, err)
+
+	initClient, err := isutrain.NewClientForInitialize()
+	assert.NoError(t, err)
+	initClient.ReplaceMockTransport()
+	initClient.Initialize(context.Background())
+
+	config.Debug = true
+	assert.NoError(t, NormalWaitlistScenario(context.Background()))
+
+	// 登録順に繰り上げないwebappは検出する
+	m.InjectBug(mock.BugUnfairWaitlist)
+	assert.Error(t, NormalWaitlistScenario(context.Background()))
+}
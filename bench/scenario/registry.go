@@ -0,0 +1,247 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"golang.org/x/xerrors"
+)
+
+var (
+	ErrScenarioAlreadyRegistered = errors.New("同名のシナリオが既に登録されています")
+	ErrUnknownPhase              = errors.New("不明なフェーズです")
+	ErrUnknownScenario           = errors.New("登録されていないシナリオです")
+)
+
+// Phase はシナリオを実行するベンチマークのフェーズです
+type Phase int
+
+const (
+	PhasePretest Phase = iota
+	PhaseLoad
+	PhaseFinalCheck
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhasePretest:
+		return "pretest"
+	case PhaseLoad:
+		return "load"
+	case PhaseFinalCheck:
+		return "finalcheck"
+	default:
+		return "unknown"
+	}
+}
+
+// Errs はフェーズに応じて、シナリオのエラーを追加するbencherrorを返します
+func (p Phase) Errs() *bencherror.BenchErrors {
+	switch p {
+	case PhasePretest:
+		return bencherror.PreTestErrs
+	case PhaseFinalCheck:
+		return bencherror.FinalCheckErrs
+	default:
+		return bencherror.BenchmarkErrs
+	}
+}
+
+func ParsePhase(s string) (Phase, error) {
+	switch s {
+	case "pretest":
+		return PhasePretest, nil
+	case "", "load":
+		return PhaseLoad, nil
+	case "finalcheck":
+		return PhaseFinalCheck, nil
+	default:
+		return 0, xerrors.Errorf("%s: %w", s, ErrUnknownPhase)
+	}
+}
+
+// Precondition はシナリオを実行できるかの条件です
+type Precondition func() bool
+
+// 予約受付終了日の月が指定の月より後であれば実行する
+func afterMonth(month int) Precondition {
+	return func() bool {
+		return int(config.ReservationEndDate.Month()) > month
+	}
+}
+
+// 管理APIのトークンが指定されていれば実行する
+func hasAdminToken() bool {
+	return config.AdminToken != ""
+}
+
+// webappの /initialize が返した実装言語が一致すれば実行する
+// CSRF対策やログインの試行制限など、Golangの参考実装にしかない機能の検証に用いる
+func isLanguage(language string) Precondition {
+	return func() bool {
+		return config.Language == language
+	}
+}
+
+// Scenario はregistryに登録して実行するシナリオです
+type Scenario interface {
+	Name() string
+	// Weight はベンチ負荷の１単位あたりの実行回数です
+	Weight() int
+	Phase() Phase
+	// CanRun は全ての前提条件を満たしているか判定します
+	CanRun() bool
+	Run(ctx context.Context) error
+}
+
+type funcScenario struct {
+	name          string
+	weight        int
+	phase         Phase
+	preconditions []Precondition
+	run           func(ctx context.Context) error
+}
+
+// NewFuncScenario は関数からシナリオを作成します
+func NewFuncScenario(name string, phase Phase, weight int, run func(ctx context.Context) error, preconditions ...Precondition) Scenario {
+	return &funcScenario{
+		name:          name,
+		weight:        weight,
+		phase:         phase,
+		preconditions: preconditions,
+		run:           run,
+	}
+}
+
+func (s *funcScenario) Name() string {
+	return s.name
+}
+
+func (s *funcScenario) Weight() int {
+	return s.weight
+}
+
+func (s *funcScenario) Phase() Phase {
+	return s.phase
+}
+
+func (s *funcScenario) CanRun() bool {
+	for _, precondition := range s.preconditions {
+		if !precondition() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *funcScenario) Run(ctx context.Context) error {
+	return s.run(bencherror.WithScenario(ctx, s.name))
+}
+
+type registry struct {
+	mu        sync.RWMutex
+	scenarios []Scenario
+	names     map[string]Scenario
+}
+
+var defaultRegistry = &registry{
+	names: map[string]Scenario{},
+}
+
+// Register はシナリオを登録します
+func Register(s Scenario) error {
+	defaultRegistry.mu.Lock()
+	defer defaultRegistry.mu.Unlock()
+
+	if _, ok := defaultRegistry.names[s.Name()]; ok {
+		return xerrors.Errorf("%s: %w", s.Name(), ErrScenarioAlreadyRegistered)
+	}
+
+	defaultRegistry.scenarios = append(defaultRegistry.scenarios, s)
+	defaultRegistry.names[s.Name()] = s
+
+	return nil
+}
+
+func mustRegister(s Scenario) {
+	if err := Register(s); err != nil {
+		panic(err)
+	}
+}
+
+// Scenarios は指定したフェーズのシナリオを登録順に返します
+func Scenarios(phase Phase) []Scenario {
+	defaultRegistry.mu.RLock()
+	defer defaultRegistry.mu.RUnlock()
+
+	scenarios := []Scenario{}
+	for _, s := range defaultRegistry.scenarios {
+		if s.Phase() == phase {
+			scenarios = append(scenarios, s)
+		}
+	}
+	return scenarios
+}
+
+// Lookup は名前からシナリオを取得します
+func Lookup(name string) (Scenario, bool) {
+	defaultRegistry.mu.RLock()
+	defer defaultRegistry.mu.RUnlock()
+
+	s, ok := defaultRegistry.names[name]
+	return s, ok
+}
+
+// Filter はonlyに含まれる(onlyが空なら全ての)シナリオから、skipに含まれるものを除きます
+func Filter(scenarios []Scenario, only, skip []string) ([]Scenario, error) {
+	onlySet, err := scenarioNameSet(only)
+	if err != nil {
+		return nil, err
+	}
+	skipSet, err := scenarioNameSet(skip)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []Scenario{}
+	for _, s := range scenarios {
+		if _, ok := onlySet[s.Name()]; len(onlySet) > 0 && !ok {
+			continue
+		}
+		if _, ok := skipSet[s.Name()]; ok {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+
+	return filtered, nil
+}
+
+func scenarioNameSet(names []string) (map[string]struct{}, error) {
+	set := map[string]struct{}{}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, ok := Lookup(name); !ok {
+			return nil, xerrors.Errorf("%s: %w", name, ErrUnknownScenario)
+		}
+		set[name] = struct{}{}
+	}
+	return set, nil
+}
+
+// Run は前提条件を満たすシナリオを、並び順に重みの回数だけ実行します
+func Run(ctx context.Context, scenarios []Scenario) {
+	for _, s := range scenarios {
+		if !s.CanRun() {
+			continue
+		}
+		for i := 0; i < s.Weight(); i++ {
+			s.Run(ctx)
+		}
+	}
+}
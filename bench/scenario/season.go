@@ -26,7 +26,7 @@ func SeasonGoldenWeekScenario(ctx context.Context, goldenweekDate time.Time, par
 
 	for i := 0; i < parallel; i++ {
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			defer wg.Done()
 			defer lgr.Infof("[season:GoldenWeekScenario] Done %d", i)
 
@@ -64,7 +64,7 @@ func SeasonGoldenWeekScenario(ctx context.Context, goldenweekDate time.Time, par
 				bencherror.BenchmarkErrs.AddError(err)
 				totalErr = err
 			}
-		}()
+		}(i)
 	}
 	wg.Wait()
 
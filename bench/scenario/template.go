@@ -17,6 +17,7 @@ func DoSomething() (int, error) {
 	return -1, fmt.Errorf("always error")
 }
 
+// NOTE: 作成したシナリオは builtin.go で registry に登録してください
 func AwesomeScenario(ctx context.Context) error {
 	// zapロガー取得 (参考: https://qiita.com/emonuh/items/28dbee9bf2fe51d28153#sugaredlogger )
 	lgr := zap.S()
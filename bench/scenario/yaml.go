@@ -0,0 +1,437 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/chibiegg/isucon9-final/bench/internal/bencherror"
+	"github.com/chibiegg/isucon9-final/bench/internal/config"
+	"github.com/chibiegg/isucon9-final/bench/internal/isutraindb"
+	"github.com/chibiegg/isucon9-final/bench/internal/xrandom"
+	"github.com/chibiegg/isucon9-final/bench/isutrain"
+	"github.com/chibiegg/isucon9-final/bench/payment"
+	"golang.org/x/xerrors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	ErrYAMLScenarioNameEmpty    = errors.New("シナリオ名が指定されていません")
+	ErrYAMLScenarioNoSteps      = errors.New("ステップが指定されていません")
+	ErrYAMLUnknownAction        = errors.New("不明なアクションです")
+	ErrYAMLUnknownPrecondition  = errors.New("不明な前提条件です")
+	ErrYAMLMissingPreviousStep  = errors.New("前提となるステップが実行されていません")
+	ErrYAMLInvalidUseAt         = errors.New("use_atの形式が不正です")
+	ErrYAMLInvalidStepParameter = errors.New("ステップのパラメータが不正です")
+)
+
+// YAMLで指定できる前提条件
+var yamlPreconditions = map[string]Precondition{
+	"olympic":            config.IsOlympic,
+	"goldenweek_started": config.IsGoldenweekStarted,
+	"goldenweek_ended":   config.IsGoldenweekEnded,
+}
+
+// YAMLのアクションと、その実行に必要な前段のアクション
+var yamlActionRequirements = map[string][]string{
+	"signup":       {},
+	"login":        {"signup"},
+	"logout":       {"login"},
+	"stations":     {},
+	"search":       {},
+	"seats":        {"search"},
+	"reserve":      {"login", "seats"},
+	"commit":       {"reserve"},
+	"show":         {"reserve"},
+	"cancel":       {"reserve"},
+	"reservations": {"login"},
+}
+
+type yamlScenarioFile struct {
+	Scenarios []*yamlScenario `yaml:"scenarios"`
+}
+
+// yamlScenario はYAMLで定義された、isutrain.Clientのステップを連ねたシナリオです
+//
+//	scenarios:
+//	  - name: ReserveAndCancel
+//	    phase: load
+//	    weight: 2
+//	    preconditions: [olympic]
+//	    steps:
+//	      - action: signup
+//	      - action: login
+//	      - action: search
+//	        departure: 東京
+//	        arrival: 大阪
+//	        expect: {min_count: 1}
+//	      - action: seats
+//	        seat_class: reserved
+//	      - action: reserve
+//	      - action: commit
+//	      - action: cancel
+type yamlScenario struct {
+	ScenarioName   string      `yaml:"name"`
+	PhaseName      string      `yaml:"phase"`
+	ScenarioWeight int         `yaml:"weight"`
+	Preconditions  []string    `yaml:"preconditions"`
+	Steps          []*yamlStep `yaml:"steps"`
+
+	phase         Phase
+	preconditions []Precondition
+}
+
+type yamlStep struct {
+	Action string `yaml:"action"`
+
+	// 検索条件. 省略した場合はランダムに決定します
+	UseAt      string `yaml:"use_at"`
+	Departure  string `yaml:"departure"`
+	Arrival    string `yaml:"arrival"`
+	TrainClass string `yaml:"train_class"`
+	Adult      int    `yaml:"adult"`
+	Child      int    `yaml:"child"`
+
+	// 座席条件. 省略した場合はseat_classの号車からランダムに決定します
+	SeatClass string `yaml:"seat_class"`
+	CarNumber int    `yaml:"car_number"`
+
+	// CSRFToken は送るCSRFトークンを差し替えます. 空文字列の場合はトークンを送りません
+	CSRFToken *string `yaml:"csrf_token"`
+
+	Expect yamlExpect `yaml:"expect"`
+}
+
+type yamlExpect struct {
+	// Status は期待するステータスコードです. 省略した場合は各APIの成功時のステータスコードです
+	Status int `yaml:"status"`
+	// MinCount, MaxCount は search, seats(空席数), reservations の件数に対するアサーションです
+	MinCount *int `yaml:"min_count"`
+	MaxCount *int `yaml:"max_count"`
+}
+
+// yamlState はステップ間で引き継ぐ状態です
+type yamlState struct {
+	client        *isutrain.Client
+	paymentClient *payment.Client
+
+	user *isutrain.User
+
+	useAt              time.Time
+	departure, arrival string
+	adult, child       int
+
+	train  *isutrain.Train
+	carNum int
+	seats  isutrain.TrainSeats
+
+	reservationID int
+}
+
+// LoadYAML はYAMLからシナリオを読み込みます
+func LoadYAML(r io.Reader) ([]Scenario, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var file *yamlScenarioFile
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return []Scenario{}, nil
+	}
+
+	scenarios := []Scenario{}
+	for _, s := range file.Scenarios {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+
+	return scenarios, nil
+}
+
+// LoadYAMLFile はYAMLファイルからシナリオを読み込み、registryに登録します
+func LoadYAMLFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scenarios, err := LoadYAML(f)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range scenarios {
+		if err := Register(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *yamlScenario) validate() error {
+	if s.ScenarioName == "" {
+		return ErrYAMLScenarioNameEmpty
+	}
+	if len(s.Steps) == 0 {
+		return xerrors.Errorf("%s: %w", s.ScenarioName, ErrYAMLScenarioNoSteps)
+	}
+
+	phase, err := ParsePhase(s.PhaseName)
+	if err != nil {
+		return xerrors.Errorf("%s: %w", s.ScenarioName, err)
+	}
+	s.phase = phase
+
+	if s.ScenarioWeight <= 0 {
+		s.ScenarioWeight = 1
+	}
+
+	for _, name := range s.Preconditions {
+		precondition, ok := yamlPreconditions[name]
+		if !ok {
+			return xerrors.Errorf("%s: %s: %w", s.ScenarioName, name, ErrYAMLUnknownPrecondition)
+		}
+		s.preconditions = append(s.preconditions, precondition)
+	}
+
+	done := map[string]bool{}
+	for _, step := range s.Steps {
+		requirements, ok := yamlActionRequirements[step.Action]
+		if !ok {
+			return xerrors.Errorf("%s: %s: %w", s.ScenarioName, step.Action, ErrYAMLUnknownAction)
+		}
+		for _, requirement := range requirements {
+			if !done[requirement] {
+				return xerrors.Errorf("%s: %sの前に%sが必要です: %w", s.ScenarioName, step.Action, requirement, ErrYAMLMissingPreviousStep)
+			}
+		}
+		if step.UseAt != "" {
+			if _, err := parseYAMLUseAt(step.UseAt); err != nil {
+				return xerrors.Errorf("%s: %s: %w", s.ScenarioName, step.UseAt, ErrYAMLInvalidUseAt)
+			}
+		}
+		if (step.Departure == "") != (step.Arrival == "") || step.Adult < 0 || step.Child < 0 {
+			return xerrors.Errorf("%s: %s: %w", s.ScenarioName, step.Action, ErrYAMLInvalidStepParameter)
+		}
+		if step.SeatClass != "" && !isutrain.IsValidSeatClass(step.SeatClass) {
+			return xerrors.Errorf("%s: %s: %w", s.ScenarioName, step.SeatClass, ErrYAMLInvalidStepParameter)
+		}
+		if step.CarNumber != 0 && !isutrain.IsValidCarNumber(step.CarNumber) {
+			return xerrors.Errorf("%s: %d: %w", s.ScenarioName, step.CarNumber, ErrYAMLInvalidStepParameter)
+		}
+
+		// 異常系を期待するステップは、後続のステップの前提にならない
+		if step.Expect.Status == 0 || step.Expect.Status < http.StatusBadRequest {
+			done[step.Action] = true
+		}
+	}
+
+	return nil
+}
+
+func parseYAMLUseAt(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+func (s *yamlScenario) Name() string {
+	return s.ScenarioName
+}
+
+func (s *yamlScenario) Weight() int {
+	return s.ScenarioWeight
+}
+
+func (s *yamlScenario) Phase() Phase {
+	return s.phase
+}
+
+func (s *yamlScenario) CanRun() bool {
+	for _, precondition := range s.preconditions {
+		if !precondition() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *yamlScenario) Run(ctx context.Context) error {
+	ctx = bencherror.WithScenario(ctx, s.ScenarioName)
+
+	client, err := isutrain.NewClient()
+	if err != nil {
+		return err
+	}
+
+	paymentClient, err := payment.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if config.Debug {
+		client.ReplaceMockTransport()
+	}
+
+	state := &yamlState{
+		client:        client,
+		paymentClient: paymentClient,
+	}
+	for _, step := range s.Steps {
+		if err := s.runStep(ctx, state, step); err != nil {
+			return s.phase.Errs().AddError(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *yamlScenario) runStep(ctx context.Context, state *yamlState, step *yamlStep) error {
+	var opts []isutrain.ClientOption
+	if step.Expect.Status != 0 {
+		opts = append(opts, isutrain.StatusCodeOpt(step.Expect.Status))
+	}
+	if step.CSRFToken != nil {
+		opts = append(opts, isutrain.CSRFTokenOpt(*step.CSRFToken))
+	}
+	// 異常系を期待するステップでは、状態を更新しない
+	isAbnormal := step.Expect.Status >= http.StatusBadRequest
+
+	switch step.Action {
+	case "signup":
+		user, err := xrandom.GetRandomUser()
+		if err != nil {
+			bencherror.SystemErrs.AddError(err)
+			return err
+		}
+		if err := state.client.Signup(ctx, user.Email, user.Password, opts...); err != nil {
+			return err
+		}
+		if !isAbnormal {
+			state.user = user
+		}
+	case "login":
+		return state.client.Login(ctx, state.user.Email, state.user.Password, opts...)
+	case "logout":
+		return state.client.Logout(ctx, opts...)
+	case "stations":
+		_, err := state.client.ListStations(ctx, opts...)
+		return err
+	case "search":
+		useAt := xrandom.GetRandomUseAt()
+		if step.UseAt != "" {
+			useAt, _ = parseYAMLUseAt(step.UseAt)
+		}
+		departure, arrival := step.Departure, step.Arrival
+		if departure == "" {
+			departure, arrival = xrandom.GetRandomSection()
+		}
+		adult, child := step.Adult, step.Child
+		if adult == 0 && child == 0 {
+			adult, child = xrandom.GetRandomNumberOfPeople()
+		}
+
+		trains, err := state.client.SearchTrains(ctx, useAt, departure, arrival, step.TrainClass, adult, child, opts...)
+		if err != nil {
+			return err
+		}
+		if err := s.assertCount(step, "列車検索結果の件数", len(trains)); err != nil {
+			return err
+		}
+		if isAbnormal {
+			return nil
+		}
+		if len(trains) == 0 {
+			return bencherror.NewSimpleApplicationError("[%s] 列車検索結果が空でした", s.ScenarioName)
+		}
+
+		state.useAt, state.departure, state.arrival = useAt, departure, arrival
+		state.adult, state.child = adult, child
+		state.train = trains[rand.Intn(len(trains))]
+	case "seats":
+		carNum := step.CarNumber
+		if carNum == 0 {
+			seatClass := step.SeatClass
+			if seatClass == "" {
+				seatClass = "reserved"
+			}
+			carNum = xrandom.GetRandomCarNumber(state.train.Class, seatClass)
+		}
+
+		resp, err := state.client.SearchTrainSeats(ctx, state.useAt, state.train.Class, state.train.Name, carNum, state.departure, state.arrival, opts...)
+		if err != nil {
+			return err
+		}
+		if isAbnormal {
+			return nil
+		}
+
+		availSeats := 0
+		for _, seat := range resp.Seats {
+			if !seat.IsOccupied {
+				availSeats++
+			}
+		}
+		if err := s.assertCount(step, "空席数", availSeats); err != nil {
+			return err
+		}
+
+		state.carNum = carNum
+		state.seats = FilterTrainSeats(resp, state.adult+state.child)
+	case "reserve":
+		resp, err := state.client.Reserve(ctx,
+			state.train.Class, state.train.Name,
+			isutraindb.GetSeatClass(state.train.Class, state.carNum), state.seats,
+			state.departure, state.arrival, state.useAt,
+			state.carNum, state.child, state.adult, opts...)
+		if err != nil {
+			return err
+		}
+		if !isAbnormal {
+			state.reservationID = resp.ReservationID
+		}
+	case "commit":
+		cardToken, err := state.paymentClient.RegistCard(ctx, "11111111", "222", "10/50")
+		if err != nil {
+			return err
+		}
+		return state.client.CommitReservation(ctx, state.reservationID, cardToken, opts...)
+	case "show":
+		_, err := state.client.ShowReservation(ctx, state.reservationID, opts...)
+		return err
+	case "cancel":
+		return state.client.CancelReservation(ctx, state.reservationID, opts...)
+	case "reservations":
+		reservations, err := state.client.ListReservations(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		return s.assertCount(step, "予約一覧の件数", len(reservations))
+	}
+
+	return nil
+}
+
+func (s *yamlScenario) assertCount(step *yamlStep, target string, count int) error {
+	if step.Expect.MinCount != nil && count < *step.Expect.MinCount {
+		return bencherror.NewSimpleApplicationError("[%s] %sが不正です: got=%d, min=%d", s.ScenarioName, target, count, *step.Expect.MinCount)
+	}
+	if step.Expect.MaxCount != nil && count > *step.Expect.MaxCount {
+		return bencherror.NewSimpleApplicationError("[%s] %sが不正です: got=%d, max=%d", s.ScenarioName, target, count, *step.Expect.MaxCount)
+	}
+	return nil
+}
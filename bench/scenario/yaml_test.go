@@ -0,0 +1,94 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+)
+
+func TestLoadYAML(t *testing.T) {
+	scenarios, err := LoadYAML(strings.NewReader(`
+scenarios:
+  - name: YAMLReserveAndCancel
+    weight: 2
+    preconditions: [olympic]
+    steps:
+      - action: signup
+      - action: login
+      - action: search
+        departure: 東京
+        arrival: 大阪
+        expect: {min_count: 1}
+      - action: seats
+        seat_class: reserved
+      - action: reserve
+      - action: commit
+      - action: cancel
+  - name: YAMLAbnormalLogin
+    phase: pretest
+    steps:
+      - action: signup
+      - action: login
+        expect: {status: 403}
+`))
+	assert.NoError(t, err)
+	assert.Len(t, scenarios, 2)
+
+	assert.Equal(t, "YAMLReserveAndCancel", scenarios[0].Name())
+	assert.Equal(t, PhaseLoad, scenarios[0].Phase())
+	assert.Equal(t, 2, scenarios[0].Weight())
+
+	assert.Equal(t, PhasePretest, scenarios[1].Phase())
+	assert.Equal(t, 1, scenarios[1].Weight())
+	assert.True(t, scenarios[1].CanRun())
+}
+
+func TestLoadYAMLInvalid(t *testing.T) {
+	tests := []struct {
+		yaml string
+		err  error
+	}{
+		{"scenarios:\n  - steps: [{action: signup}]", ErrYAMLScenarioNameEmpty},
+		{"scenarios:\n  - name: a", ErrYAMLScenarioNoSteps},
+		{"scenarios:\n  - name: a\n    phase: warmup\n    steps: [{action: signup}]", ErrUnknownPhase},
+		{"scenarios:\n  - name: a\n    preconditions: [xmas]\n    steps: [{action: signup}]", ErrYAMLUnknownPrecondition},
+		{"scenarios:\n  - name: a\n    steps: [{action: fly}]", ErrYAMLUnknownAction},
+		{"scenarios:\n  - name: a\n    steps: [{action: search}, {action: reserve}]", ErrYAMLMissingPreviousStep},
+		{"scenarios:\n  - name: a\n    steps: [{action: search, departure: 東京}]", ErrYAMLInvalidStepParameter},
+		{"scenarios:\n  - name: a\n    steps: [{action: search, use_at: tomorrow}]", ErrYAMLInvalidUseAt},
+	}
+
+	for _, tt := range tests {
+		_, err := LoadYAML(strings.NewReader(tt.yaml))
+		assert.True(t, xerrors.Is(err, tt.err), "yaml=%s err=%+v", tt.yaml, err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	assert.NotEmpty(t, Scenarios(PhaseLoad))
+
+	s, ok := Lookup("NormalScenario")
+	assert.True(t, ok)
+	assert.Equal(t, PhaseLoad, s.Phase())
+
+	err := Register(NewFuncScenario("NormalScenario", PhaseLoad, 1, NormalScenario))
+	assert.True(t, xerrors.Is(err, ErrScenarioAlreadyRegistered))
+}
+
+func TestFilter(t *testing.T) {
+	scenarios := Scenarios(PhaseLoad)
+
+	filtered, err := Filter(scenarios, []string{"NormalScenario", "NormalCancelScenario"}, []string{"NormalCancelScenario"})
+	assert.NoError(t, err)
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, "NormalScenario", filtered[0].Name())
+
+	filtered, err = Filter(scenarios, nil, []string{"NormalScenario"})
+	assert.NoError(t, err)
+	assert.Len(t, filtered, len(scenarios)-1)
+
+	_, err = Filter(scenarios, []string{"UnknownScenario"}, nil)
+	assert.True(t, xerrors.Is(err, ErrUnknownScenario))
+}
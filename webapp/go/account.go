@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+	アカウント管理
+
+	POST   /api/user/password パスワード変更
+	POST   /api/user/email    メールアドレス変更
+	DELETE /api/user          退会
+
+	いずれも現在のパスワードでの再認証が必要
+*/
+
+// MySQLの重複キーエラー
+const mysqlErrDupEntry = 1062
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DeleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+type BulkCancelPaymentRequest struct {
+	PaymentIds []string `json:"payment_id"`
+}
+
+type BulkCancelPaymentResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// reauthenticate は、ログイン中のユーザのパスワードを検証します
+// アカウントのログインの試行制限を受け、失敗はそのアカウントのログインの失敗として数えます
+// 検証に失敗した場合はレスポンスを書き込み、falseを返します
+func reauthenticate(w http.ResponseWriter, r *http.Request, user *User, password string) bool {
+	now := time.Now()
+	limitKeys := reauthLimitKeys(user.Email)
+	retryAfter, err := checkLoginLimit(limitKeys, now)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "login limit error")
+		return false
+	}
+	if retryAfter > 0 {
+		tooManyRequestsResponse(w, retryAfter)
+		return false
+	}
+
+	ok, _, err := verifyPassword(user, password)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "password verification error")
+		return false
+	}
+	if !ok {
+		if err := failLogin(limitKeys, now); err != nil {
+			log.Print(err)
+		}
+		errorResponse(w, http.StatusForbidden, "authentication failed")
+		return false
+	}
+	return true
+}
+
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		パスワード変更
+		POST /api/user/password
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+
+	req := ChangePasswordRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "JSON parseに失敗しました")
+		return
+	}
+	if req.NewPassword == "" {
+		errorResponse(w, http.StatusBadRequest, "new password is empty")
+		return
+	}
+
+	if !reauthenticate(w, r, &user, req.CurrentPassword) {
+		return
+	}
+
+	if err := rehashPassword(user.ID, req.NewPassword); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "password update failed")
+		return
+	}
+
+	// 他の端末のセッションは無効にする
+	if err := revokeOtherSessions(r, user.ID); err != nil {
+		log.Print(err)
+	}
+
+	messageResponse(w, "password changed")
+}
+
+func changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		メールアドレス変更
+		POST /api/user/email
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+
+	req := ChangeEmailRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "JSON parseに失敗しました")
+		return
+	}
+	if req.Email == "" {
+		errorResponse(w, http.StatusBadRequest, "email is empty")
+		return
+	}
+
+	if !reauthenticate(w, r, &user, req.Password) {
+		return
+	}
+
+	_, err := dbx.Exec("UPDATE `users` SET `email` = ? WHERE `id` = ?", req.Email, user.ID)
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlErrDupEntry {
+		errorResponse(w, http.StatusConflict, "email already exists")
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "email update failed")
+		return
+	}
+
+	messageResponse(w, "email changed")
+}
+
+func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		退会
+		DELETE /api/user
+
+		全ての予約を削除し、決済済みの予約は決済をキャンセルする
+		決済のキャンセルに失敗した場合は、何も削除しない
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+
+	req := DeleteUserRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "JSON parseに失敗しました")
+		return
+	}
+
+	if !reauthenticate(w, r, &user, req.Password) {
+		return
+	}
+
+	tx := dbx.MustBegin()
+
+	reservations, err := deleteUserTx(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "退会処理に失敗しました")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		// 決済はキャンセル済みなので、残った予約は手動で削除する必要がある
+		log.Printf("failed to commit user deletion (user_id=%d): %s", user.ID, err)
+		errorResponse(w, http.StatusInternalServerError, "退会処理に失敗しました")
+		return
+	}
+
+	if err := revokeSession(w, r); err != nil {
+		log.Print(err)
+	}
+
+	// 空いた座席をキャンセル待ちに繰り上げる
+	promoteWaitlistFor(reservations)
+
+	messageResponse(w, "user deleted")
+}
+
+// deleteUserTx は、ユーザと全ての予約・キャンセル待ちを削除し、決済済みの予約の決済をキャンセルします
+// 削除した予約を返します
+// 決済のキャンセルはコミットの直前に行い、失敗した場合はエラーを返すので、呼び出し側でロールバックすること
+func deleteUserTx(tx *sqlx.Tx, userID int64) ([]Reservation, error) {
+	// キャンセル待ちの繰り上げ (promoteWaitlist) と同じく、キャンセル待ち、予約の順にロックを取る
+	if _, err := tx.Exec("DELETE FROM `waitlist` WHERE `user_id` = ?", userID); err != nil {
+		return nil, err
+	}
+
+	reservations := []Reservation{}
+	err := tx.Select(&reservations, "SELECT * FROM `reservations` WHERE `user_id` = ? FOR UPDATE", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentIDs := []string{}
+	for _, reservation := range reservations {
+		// requesting状態のものはpayment_id無いので対象外
+		// 運休などで返金済みのものは、決済がキャンセル済みなので対象外
+		if reservation.Status == "done" && reservation.PaymentId != "" && !reservation.Refunded {
+			paymentIDs = append(paymentIDs, reservation.PaymentId)
+		}
+	}
+
+	queries := []string{
+		"DELETE FROM `seat_reservations` WHERE `reservation_id` IN (SELECT `reservation_id` FROM `reservations` WHERE `user_id` = ?)",
+		"DELETE FROM `reservations` WHERE `user_id` = ?",
+		"DELETE FROM `sessions` WHERE `user_id` = ?",
+		"DELETE FROM `users` WHERE `id` = ?",
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(paymentIDs) == 0 {
+		return reservations, nil
+	}
+	if err := bulkCancelPayments(paymentIDs); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// bulkCancelPayments は、決済をまとめてキャンセルします
+func bulkCancelPayments(paymentIDs []string) error {
+	j, err := json.Marshal(BulkCancelPaymentRequest{PaymentIds: paymentIDs})
+	if err != nil {
+		return err
+	}
+
+	payment_api := os.Getenv("PAYMENT_API")
+	if payment_api == "" {
+		payment_api = "http://payment:5000"
+	}
+
+	client := &http.Client{Timeout: time.Duration(10) * time.Second}
+	resp, err := client.Post(payment_api+"/payment/_bulk", "application/json", bytes.NewBuffer(j))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("決済のキャンセルに失敗しました: status=%d body=%s", resp.StatusCode, body)
+	}
+
+	output := BulkCancelPaymentResponse{}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return err
+	}
+	if output.Deleted != len(paymentIDs) {
+		// 存在しない決済IDは無視されるので、キャンセル自体は成功している
+		log.Printf("bulk cancel: requested=%d deleted=%d", len(paymentIDs), output.Deleted)
+	}
+
+	return nil
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"goji.io/pat"
+)
+
+/*
+	マスタデータ管理API
+
+	GET    /api/admin/:table     一覧 (クエリパラメータでカラムの値を指定すると絞り込む)
+	POST   /api/admin/:table     追加 (JSONの配列)
+	PUT    /api/admin/:table     更新 (JSONの配列. キーのカラムで行を指定し、それ以外のカラムを更新する)
+	DELETE /api/admin/:table     削除 (JSONの配列. キーのカラムで行を指定する)
+	GET    /api/admin/:table/csv CSVでエクスポート (1行目はカラム名)
+	POST   /api/admin/:table/csv CSVで一括追加
+	PUT    /api/admin/:table/csv CSVで全件置き換え
+
+	:table は stations, trains, timetables, fares, distance_fares, seats のいずれか
+	ADMIN_TOKEN を設定した場合のみ有効で、Authorization: Bearer <ADMIN_TOKEN> が必要
+	更新はトランザクション内で行い、更新後のデータを検証して問題があればロールバックする
+*/
+
+const (
+	adminInt = iota
+	adminFloat
+	adminBool
+	adminString
+	adminDate
+	adminDatetime
+	adminTime
+)
+
+// CSVの一括追加で1クエリにまとめる行数
+const adminInsertBatchSize = 500
+
+// 検証エラーはこの件数までレスポンスに含める
+const adminMaxValidationErrors = 20
+
+type adminColumn struct {
+	name string
+	kind int
+}
+
+type adminTable struct {
+	table   string
+	columns []adminColumn
+	// 行を特定するカラム
+	keys []string
+	// 更新後の検証. scope は更新された行のキー. nilの場合は全件を検証する
+	validate func(tx *sqlx.Tx, scope []adminRow) ([]string, error)
+	// 削除時に合わせて削除する関連データ
+	cascade func(tx *sqlx.Tx, row adminRow) error
+}
+
+type adminRow map[string]interface{}
+
+var adminTables = map[string]*adminTable{
+	"stations": {
+		table: "station_master",
+		columns: []adminColumn{
+			{"id", adminInt},
+			{"name", adminString},
+			{"distance", adminFloat},
+			{"is_stop_express", adminBool},
+			{"is_stop_semi_express", adminBool},
+			{"is_stop_local", adminBool},
+		},
+		keys:     []string{"id"},
+		validate: validateStationMaster,
+	},
+	"trains": {
+		table: "train_master",
+		columns: []adminColumn{
+			{"date", adminDate},
+			{"departure_at", adminTime},
+			{"train_class", adminString},
+			{"train_name", adminString},
+			{"start_station", adminString},
+			{"last_station", adminString},
+			{"is_nobori", adminBool},
+		},
+		keys:     []string{"date", "train_class", "train_name"},
+		validate: validateTrainMaster,
+		cascade:  deleteTrainTimetable,
+	},
+	"timetables": {
+		table: "train_timetable_master",
+		columns: []adminColumn{
+			{"date", adminDate},
+			{"train_class", adminString},
+			{"train_name", adminString},
+			{"station", adminString},
+			{"departure", adminTime},
+			{"arrival", adminTime},
+		},
+		keys:     []string{"date", "train_class", "train_name", "station"},
+		validate: validateTrainTimetableMaster,
+	},
+	"fares": {
+		table: "fare_master",
+		columns: []adminColumn{
+			{"train_class", adminString},
+			{"seat_class", adminString},
+			{"start_date", adminDatetime},
+			{"fare_multiplier", adminFloat},
+		},
+		keys:     []string{"train_class", "seat_class", "start_date"},
+		validate: validateFareMaster,
+	},
+	"distance_fares": {
+		table: "distance_fare_master",
+		columns: []adminColumn{
+			{"distance", adminFloat},
+			{"fare", adminInt},
+		},
+		keys:     []string{"distance"},
+		validate: validateDistanceFareMaster,
+	},
+	"seats": {
+		table: "seat_master",
+		columns: []adminColumn{
+			{"train_class", adminString},
+			{"car_number", adminInt},
+			{"seat_column", adminString},
+			{"seat_row", adminInt},
+			{"seat_class", adminString},
+			{"is_smoking_seat", adminBool},
+		},
+		keys:     []string{"train_class", "car_number", "seat_column", "seat_row"},
+		validate: validateSeatMaster,
+	},
+}
+
+func (t *adminTable) column(name string) (adminColumn, bool) {
+	for _, c := range t.columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return adminColumn{}, false
+}
+
+func (t *adminTable) isKey(name string) bool {
+	for _, k := range t.keys {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *adminTable) selectColumns() string {
+	exprs := make([]string, 0, len(t.columns))
+	for _, c := range t.columns {
+		switch c.kind {
+		case adminDate:
+			exprs = append(exprs, fmt.Sprintf("DATE_FORMAT(`%s`, '%%Y-%%m-%%d')", c.name))
+		case adminDatetime:
+			exprs = append(exprs, fmt.Sprintf("DATE_FORMAT(`%s`, '%%Y-%%m-%%d %%H:%%i:%%s')", c.name))
+		default:
+			exprs = append(exprs, fmt.Sprintf("`%s`", c.name))
+		}
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (t *adminTable) orderBy() string {
+	keys := make([]string, 0, len(t.keys))
+	for _, k := range t.keys {
+		keys = append(keys, fmt.Sprintf("`%s`", k))
+	}
+	return strings.Join(keys, ", ")
+}
+
+// keyCondition は、キーのカラムで行を指定するWHERE句を返します
+func (t *adminTable) keyCondition(row adminRow) (string, []interface{}, error) {
+	conds := make([]string, 0, len(t.keys))
+	args := make([]interface{}, 0, len(t.keys))
+	for _, k := range t.keys {
+		v, ok := row[k]
+		if !ok {
+			return "", nil, fmt.Errorf("%s is required", k)
+		}
+		conds = append(conds, fmt.Sprintf("`%s` = ?", k))
+		args = append(args, v)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// parseAdminValue は、文字列をカラムの型に合わせて変換します
+func parseAdminValue(c adminColumn, s string) (interface{}, error) {
+	switch c.kind {
+	case adminInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid integer %q", c.name, s)
+		}
+		return i, nil
+	case adminFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid number %q", c.name, s)
+		}
+		return f, nil
+	case adminBool:
+		switch s {
+		case "1", "true":
+			return true, nil
+		case "0", "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%s: invalid boolean %q", c.name, s)
+	case adminDate:
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid date %q", c.name, s)
+		}
+		return d.Format("2006-01-02"), nil
+	case adminDatetime:
+		for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+			if d, err := time.Parse(layout, s); err == nil {
+				return d.Format("2006-01-02 15:04:05"), nil
+			}
+		}
+		return nil, fmt.Errorf("%s: invalid datetime %q", c.name, s)
+	case adminTime:
+		d, err := time.Parse("15:04:05", s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid time %q", c.name, s)
+		}
+		return d.Format("15:04:05"), nil
+	default:
+		return s, nil
+	}
+}
+
+// formatAdminValue は、DBから読み出した値をJSONの値に変換します
+func formatAdminValue(c adminColumn, b sql.RawBytes) interface{} {
+	s := string(b)
+	switch c.kind {
+	case adminInt:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case adminFloat:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case adminBool:
+		return s == "1"
+	}
+	return s
+}
+
+// decodeAdminRows は、JSONの配列をカラムの型に合わせて変換します
+func decodeAdminRows(t *adminTable, r io.Reader) ([]adminRow, error) {
+	raw := []map[string]interface{}{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("JSON parseに失敗しました")
+	}
+
+	rows := make([]adminRow, 0, len(raw))
+	for i, obj := range raw {
+		row := adminRow{}
+		for name, v := range obj {
+			c, ok := t.column(name)
+			if !ok {
+				return nil, fmt.Errorf("row %d: unknown column %s", i, name)
+			}
+			var s string
+			switch v := v.(type) {
+			case string:
+				s = v
+			case json.Number:
+				s = v.String()
+			case bool:
+				s = strconv.FormatBool(v)
+			default:
+				return nil, fmt.Errorf("row %d: %s: invalid value", i, name)
+			}
+			value, err := parseAdminValue(c, s)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %s", i, err)
+			}
+			row[name] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		errorResponse(w, http.StatusNotFound, "admin api is disabled")
+		return false
+	}
+	challenge := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(challenge)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		errorResponse(w, http.StatusUnauthorized, "invalid admin token")
+		return false
+	}
+	return true
+}
+
+// adminHandler は、認証とテーブルの解決を行ってからhandlerを呼び出します
+func adminHandler(handler func(w http.ResponseWriter, r *http.Request, t *adminTable)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !adminAuthorized(w, r) {
+			return
+		}
+		t, ok := adminTables[pat.Param(r, "table")]
+		if !ok {
+			errorResponse(w, http.StatusNotFound, "unknown table")
+			return
+		}
+		handler(w, r, t)
+	}
+}
+
+// queryAdminRows は、クエリパラメータで絞り込んだ行を読み出し、fnに渡します
+func queryAdminRows(t *adminTable, r *http.Request, fn func(values []sql.RawBytes) error) error {
+	conds := []string{}
+	args := []interface{}{}
+	for name, values := range r.URL.Query() {
+		c, ok := t.column(name)
+		if !ok {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		v, err := parseAdminValue(c, values[0])
+		if err != nil {
+			return err
+		}
+		conds = append(conds, fmt.Sprintf("`%s` = ?", name))
+		args = append(args, v)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM `%s`", t.selectColumns(), t.table)
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY " + t.orderBy()
+
+	rows, err := dbx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(t.columns))
+	dest := make([]interface{}, len(t.columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// commitAdminChange は、更新後のデータを検証し、問題がなければコミットします
+// レスポンスを書き込み、コミットした場合はtrueを返します
+func commitAdminChange(w http.ResponseWriter, tx *sqlx.Tx, t *adminTable, scope []adminRow) bool {
+	errs, err := t.validate(tx, scope)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "検証に失敗しました")
+		return false
+	}
+	if len(errs) > 0 {
+		tx.Rollback()
+		if len(errs) > adminMaxValidationErrors {
+			errs = append(errs[:adminMaxValidationErrors], fmt.Sprintf("and %d more errors", len(errs)-adminMaxValidationErrors))
+		}
+		errorResponse(w, http.StatusBadRequest, strings.Join(errs, "\n"))
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "commit error")
+		return false
+	}
+	return true
+}
+
+func adminListHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータ一覧
+		GET /api/admin/:table
+	*/
+
+	list := []adminRow{}
+	err := queryAdminRows(t, r, func(values []sql.RawBytes) error {
+		row := adminRow{}
+		for i, c := range t.columns {
+			row[c.name] = formatAdminValue(c, values[i])
+		}
+		list = append(list, row)
+		return nil
+	})
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := json.Marshal(list)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "JSON marshal error")
+		return
+	}
+	w.Write(resp)
+}
+
+func adminInsertHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータ追加
+		POST /api/admin/:table
+	*/
+
+	rows, err := decodeAdminRows(t, r.Body)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx := dbx.MustBegin()
+	for i, row := range rows {
+		columns := make([]string, 0, len(row))
+		args := make([]interface{}, 0, len(row))
+		for _, c := range t.columns {
+			if v, ok := row[c.name]; ok {
+				columns = append(columns, c.name)
+				args = append(args, v)
+			}
+		}
+		if err := insertAdminRows(tx, t, columns, args, 1); err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("row %d: %s", i, err))
+			return
+		}
+	}
+
+	if !commitAdminChange(w, tx, t, rows) {
+		return
+	}
+	messageResponse(w, fmt.Sprintf("%d rows inserted", len(rows)))
+}
+
+func adminUpdateHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータ更新
+		PUT /api/admin/:table
+	*/
+
+	rows, err := decodeAdminRows(t, r.Body)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx := dbx.MustBegin()
+	for i, row := range rows {
+		where, whereArgs, err := t.keyCondition(row)
+		if err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("row %d: %s", i, err))
+			return
+		}
+
+		var count int
+		if err := tx.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM `%s` WHERE %s", t.table, where), whereArgs...); err != nil {
+			tx.Rollback()
+			log.Print(err)
+			errorResponse(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if count == 0 {
+			tx.Rollback()
+			errorResponse(w, http.StatusNotFound, fmt.Sprintf("row %d: not found", i))
+			return
+		}
+
+		sets := []string{}
+		args := []interface{}{}
+		for _, c := range t.columns {
+			if v, ok := row[c.name]; ok && !t.isKey(c.name) {
+				sets = append(sets, fmt.Sprintf("`%s` = ?", c.name))
+				args = append(args, v)
+			}
+		}
+		if len(sets) == 0 {
+			continue
+		}
+		args = append(args, whereArgs...)
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE `%s` SET %s WHERE %s", t.table, strings.Join(sets, ", "), where), args...); err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("row %d: %s", i, err))
+			return
+		}
+	}
+
+	if !commitAdminChange(w, tx, t, rows) {
+		return
+	}
+	messageResponse(w, fmt.Sprintf("%d rows updated", len(rows)))
+}
+
+func adminDeleteHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータ削除
+		DELETE /api/admin/:table
+	*/
+
+	rows, err := decodeAdminRows(t, r.Body)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx := dbx.MustBegin()
+	for i, row := range rows {
+		where, args, err := t.keyCondition(row)
+		if err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("row %d: %s", i, err))
+			return
+		}
+		result, err := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE %s", t.table, where), args...)
+		if err != nil {
+			tx.Rollback()
+			log.Print(err)
+			errorResponse(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			tx.Rollback()
+			errorResponse(w, http.StatusNotFound, fmt.Sprintf("row %d: not found", i))
+			return
+		}
+		if t.cascade != nil {
+			if err := t.cascade(tx, row); err != nil {
+				tx.Rollback()
+				log.Print(err)
+				errorResponse(w, http.StatusInternalServerError, "db error")
+				return
+			}
+		}
+	}
+
+	if !commitAdminChange(w, tx, t, rows) {
+		return
+	}
+	messageResponse(w, fmt.Sprintf("%d rows deleted", len(rows)))
+}
+
+func adminExportCSVHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータのCSVエクスポート
+		GET /api/admin/:table/csv
+	*/
+
+	header := make([]string, 0, len(t.columns))
+	for _, c := range t.columns {
+		header = append(header, c.name)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, t.table))
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+
+	record := make([]string, len(t.columns))
+	err := queryAdminRows(t, r, func(values []sql.RawBytes) error {
+		for i := range values {
+			record[i] = string(values[i])
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		// ヘッダは送信済みなので、ログに残すのみ
+		log.Print(err)
+	}
+	writer.Flush()
+}
+
+func adminImportCSVHandler(w http.ResponseWriter, r *http.Request, t *adminTable) {
+	/*
+		マスタデータのCSVインポート
+		POST /api/admin/:table/csv 一括追加
+		PUT  /api/admin/:table/csv 全件置き換え
+	*/
+
+	replace := r.Method == http.MethodPut
+
+	reader := csv.NewReader(r.Body)
+	header, err := reader.Read()
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "CSV parseに失敗しました")
+		return
+	}
+	columns := make([]adminColumn, 0, len(header))
+	names := make([]string, 0, len(header))
+	for _, name := range header {
+		c, ok := t.column(strings.TrimSpace(name))
+		if !ok {
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("unknown column %s", name))
+			return
+		}
+		columns = append(columns, c)
+		names = append(names, c.name)
+	}
+
+	tx := dbx.MustBegin()
+	if replace {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM `%s`", t.table)); err != nil {
+			tx.Rollback()
+			log.Print(err)
+			errorResponse(w, http.StatusInternalServerError, "db error")
+			return
+		}
+	}
+
+	scope := []adminRow{}
+	args := make([]interface{}, 0, len(columns)*adminInsertBatchSize)
+	count := 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, fmt.Sprintf("line %d: %s", line, err))
+			return
+		}
+
+		row := adminRow{}
+		for i, c := range columns {
+			v, err := parseAdminValue(c, record[i])
+			if err != nil {
+				tx.Rollback()
+				errorResponse(w, http.StatusBadRequest, fmt.Sprintf("line %d: %s", line, err))
+				return
+			}
+			row[c.name] = v
+			args = append(args, v)
+		}
+		if !replace {
+			scope = append(scope, row)
+		}
+		count++
+
+		if count%adminInsertBatchSize == 0 {
+			if err := insertAdminRows(tx, t, names, args, adminInsertBatchSize); err != nil {
+				tx.Rollback()
+				errorResponse(w, http.StatusBadRequest, fmt.Sprintf("line %d: %s", line, err))
+				return
+			}
+			args = args[:0]
+		}
+	}
+	if n := count % adminInsertBatchSize; n > 0 {
+		if err := insertAdminRows(tx, t, names, args, n); err != nil {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// 全件置き換えの場合は全件を検証する
+	if replace {
+		scope = nil
+	}
+	if !commitAdminChange(w, tx, t, scope) {
+		return
+	}
+	messageResponse(w, fmt.Sprintf("%d rows imported", count))
+}
+
+// insertAdminRows は、n行分の値をまとめて追加します
+func insertAdminRows(tx *sqlx.Tx, t *adminTable, columns []string, args []interface{}, n int) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	quoted := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quoted = append(quoted, fmt.Sprintf("`%s`", c))
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := make([]string, n)
+	for i := range values {
+		values[i] = placeholder
+	}
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s", t.table, strings.Join(quoted, ", "), strings.Join(values, ", "))
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+func deleteTrainTimetable(tx *sqlx.Tx, row adminRow) error {
+	_, err := tx.Exec(
+		"DELETE FROM `train_timetable_master` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+		row["date"], row["train_class"], row["train_name"],
+	)
+	return err
+}
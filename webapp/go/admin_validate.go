@@ -0,0 +1,530 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+	マスタデータの検証
+
+	stations       名前が重複せず、idの順に距離が単調増加していること. 列車と時刻表の駅が存在すること
+	distance_fares 距離0の運賃が存在し、距離が重複せず、距離が長いほど運賃が下がらないこと
+	fares          全ての列車種別と座席種別の組み合わせについて、最初の運行日から運賃が設定されていること
+	seats          列車種別と座席種別が存在し、座席が重複しないこと
+	trains         始発駅と終着駅がその列車種別の停車駅で、上り下りが駅の距離と一致すること
+	timetables     始発駅から終着駅までの、その列車種別の停車駅だけを過不足なく含むこと. 通過駅や区間外の駅の時刻は持たないこと
+	               各駅で到着が出発より後にならず、進行方向の順に時刻が増加すること
+	               日付をまたぐ列車があるので時刻は24時間で一周するものとし、12時間以上戻る場合は日付をまたいだとみなす
+*/
+
+var (
+	seatClasses = map[string]bool{"premium": true, "reserved": true, "non-reserved": true}
+	seatColumns = map[string]bool{"A": true, "B": true, "C": true, "D": true, "E": true}
+)
+
+type trainKey struct {
+	date       string
+	trainClass string
+	trainName  string
+}
+
+func (k trainKey) String() string {
+	return fmt.Sprintf("%s %s %s", k.date, k.trainClass, k.trainName)
+}
+
+// isStopFor は、列車種別が駅に停車するかを返します
+func isStopFor(station Station, trainClass string) (bool, bool) {
+	switch trainClass {
+	case TrainClassMap["express"]:
+		return station.IsStopExpress, true
+	case TrainClassMap["semi_express"]:
+		return station.IsStopSemiExpress, true
+	case TrainClassMap["local"]:
+		return station.IsStopLocal, true
+	}
+	return false, false
+}
+
+func isTrainClass(trainClass string) bool {
+	_, ok := isStopFor(Station{}, trainClass)
+	return ok
+}
+
+func checkStations(stations []Station) []string {
+	errs := []string{}
+	sort.Slice(stations, func(i, j int) bool { return stations[i].ID < stations[j].ID })
+
+	names := map[string]bool{}
+	for i, station := range stations {
+		if station.Name == "" {
+			errs = append(errs, fmt.Sprintf("station %d: name is empty", station.ID))
+		}
+		if names[station.Name] {
+			errs = append(errs, fmt.Sprintf("station %s: duplicated name", station.Name))
+		}
+		names[station.Name] = true
+		if i > 0 && station.Distance <= stations[i-1].Distance {
+			errs = append(errs, fmt.Sprintf("station %s: distance %g must be greater than %s (%g)", station.Name, station.Distance, stations[i-1].Name, stations[i-1].Distance))
+		}
+	}
+	return errs
+}
+
+func checkDistanceFares(fares []DistanceFare) []string {
+	errs := []string{}
+	if len(fares) == 0 {
+		return append(errs, "distance fare is empty")
+	}
+	sort.Slice(fares, func(i, j int) bool { return fares[i].Distance < fares[j].Distance })
+
+	if fares[0].Distance != 0 {
+		errs = append(errs, "distance fare for distance 0 is required")
+	}
+	for i, fare := range fares {
+		if fare.Distance < 0 {
+			errs = append(errs, fmt.Sprintf("distance fare %g: distance is negative", fare.Distance))
+		}
+		if i == 0 {
+			continue
+		}
+		if fare.Distance == fares[i-1].Distance {
+			errs = append(errs, fmt.Sprintf("distance fare %g: duplicated distance", fare.Distance))
+		}
+		if fare.Fare < fares[i-1].Fare {
+			errs = append(errs, fmt.Sprintf("distance fare %g: fare %d is less than %d", fare.Distance, fare.Fare, fares[i-1].Fare))
+		}
+	}
+	return errs
+}
+
+// checkFares は、運賃倍率を検証します. firstDate は最初の運行日で、列車が無ければゼロ値
+func checkFares(fares []Fare, firstDate time.Time) []string {
+	errs := []string{}
+
+	earliest := map[string]time.Time{}
+	seen := map[string]bool{}
+	for _, fare := range fares {
+		name := fmt.Sprintf("fare %s %s %s", fare.TrainClass, fare.SeatClass, fare.StartDate.Format("2006-01-02 15:04:05"))
+		if !isTrainClass(fare.TrainClass) {
+			errs = append(errs, fmt.Sprintf("%s: unknown train class", name))
+		}
+		if !seatClasses[fare.SeatClass] {
+			errs = append(errs, fmt.Sprintf("%s: unknown seat class", name))
+		}
+		if fare.FareMultiplier <= 0 {
+			errs = append(errs, fmt.Sprintf("%s: fare multiplier must be positive", name))
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Sprintf("%s: duplicated", name))
+		}
+		seen[name] = true
+
+		class := fare.TrainClass + " " + fare.SeatClass
+		if t, ok := earliest[class]; !ok || fare.StartDate.Before(t) {
+			earliest[class] = fare.StartDate
+		}
+	}
+
+	// 期間の途中から運賃が無くならないよう、全ての組み合わせで最初の運行日から設定されている必要がある
+	for _, trainClass := range []string{TrainClassMap["express"], TrainClassMap["semi_express"], TrainClassMap["local"]} {
+		for _, seatClass := range []string{"premium", "reserved", "non-reserved"} {
+			class := trainClass + " " + seatClass
+			t, ok := earliest[class]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("fare %s: not found", class))
+				continue
+			}
+			if !firstDate.IsZero() && t.After(firstDate) {
+				errs = append(errs, fmt.Sprintf("fare %s: starts at %s after the first train date %s", class, t.Format("2006-01-02"), firstDate.Format("2006-01-02")))
+			}
+		}
+	}
+	return errs
+}
+
+func checkSeats(seats []Seat) []string {
+	errs := []string{}
+	seen := map[string]bool{}
+	for _, seat := range seats {
+		name := fmt.Sprintf("seat %s %d %d%s", seat.TrainClass, seat.CarNumber, seat.SeatRow, seat.SeatColumn)
+		if !isTrainClass(seat.TrainClass) {
+			errs = append(errs, fmt.Sprintf("%s: unknown train class", name))
+		}
+		if !seatClasses[seat.SeatClass] {
+			errs = append(errs, fmt.Sprintf("%s: unknown seat class", name))
+		}
+		if !seatColumns[seat.SeatColumn] {
+			errs = append(errs, fmt.Sprintf("%s: unknown seat column", name))
+		}
+		if seat.CarNumber <= 0 || seat.SeatRow <= 0 {
+			errs = append(errs, fmt.Sprintf("%s: car number and seat row must be positive", name))
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Sprintf("%s: duplicated", name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+func checkTrain(train Train, stations map[string]Station) []string {
+	errs := []string{}
+	name := fmt.Sprintf("train %s", trainKey{train.Date.Format("2006-01-02"), train.TrainClass, train.TrainName})
+
+	if !isTrainClass(train.TrainClass) {
+		return append(errs, fmt.Sprintf("%s: unknown train class", name))
+	}
+	start, ok := stations[train.StartStation]
+	if !ok {
+		errs = append(errs, fmt.Sprintf("%s: unknown start station %s", name, train.StartStation))
+	}
+	last, ok := stations[train.LastStation]
+	if !ok {
+		errs = append(errs, fmt.Sprintf("%s: unknown last station %s", name, train.LastStation))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if start.Name == last.Name {
+		errs = append(errs, fmt.Sprintf("%s: start station and last station are the same", name))
+	}
+	for _, station := range []Station{start, last} {
+		if stop, _ := isStopFor(station, train.TrainClass); !stop {
+			errs = append(errs, fmt.Sprintf("%s: %s does not stop at %s", name, train.TrainClass, station.Name))
+		}
+	}
+	if nobori := start.Distance > last.Distance; train.IsNobori != nobori {
+		errs = append(errs, fmt.Sprintf("%s: is_nobori must be %t", name, nobori))
+	}
+	return errs
+}
+
+// timetableStop は、時刻表の1駅分です. 時刻は "15:04:05" 形式
+type timetableStop struct {
+	station   string
+	arrival   string
+	departure string
+}
+
+// timetableElapsed は、時刻 from から to までの秒数を返します. to が from より前なら日付をまたいだとみなす
+func timetableElapsed(from, to string) (int, error) {
+	f, err := time.Parse("15:04:05", from)
+	if err != nil {
+		return 0, err
+	}
+	t, err := time.Parse("15:04:05", to)
+	if err != nil {
+		return 0, err
+	}
+	const day = 24 * 60 * 60
+	return (int(t.Sub(f).Seconds()) + day) % day, nil
+}
+
+// checkTimetable は、列車の時刻表の駅と時刻を検証します. train が nil の場合は列車が存在しない
+func checkTimetable(key trainKey, train *Train, stations []Station, timetable []timetableStop) []string {
+	errs := []string{}
+	name := fmt.Sprintf("timetable %s", key)
+
+	if train == nil {
+		return append(errs, fmt.Sprintf("%s: train not found", name))
+	}
+
+	// 始発駅から終着駅までの区間のみ運行する
+	var start, last *Station
+	for i := range stations {
+		switch stations[i].Name {
+		case train.StartStation:
+			start = &stations[i]
+		case train.LastStation:
+			last = &stations[i]
+		}
+	}
+	if start == nil || last == nil {
+		return append(errs, fmt.Sprintf("%s: unknown route %s~%s", name, train.StartStation, train.LastStation))
+	}
+	lower, upper := math.Min(start.Distance, last.Distance), math.Max(start.Distance, last.Distance)
+
+	onRoute := map[string]bool{}
+	stops := map[string]bool{}
+	for _, station := range stations {
+		if station.Distance < lower || station.Distance > upper {
+			continue
+		}
+		onRoute[station.Name] = true
+		if stop, _ := isStopFor(station, train.TrainClass); stop {
+			stops[station.Name] = true
+		}
+	}
+
+	const halfDay = 12 * 60 * 60
+	seen := map[string]timetableStop{}
+	for _, stop := range timetable {
+		if _, ok := seen[stop.station]; ok {
+			errs = append(errs, fmt.Sprintf("%s: duplicated station %s", name, stop.station))
+		}
+		seen[stop.station] = stop
+		if !onRoute[stop.station] {
+			errs = append(errs, fmt.Sprintf("%s: %s is out of route %s~%s and must not have a time", name, stop.station, train.StartStation, train.LastStation))
+			continue
+		}
+		if !stops[stop.station] {
+			errs = append(errs, fmt.Sprintf("%s: %s passes %s and must not have a time", name, train.TrainClass, stop.station))
+			continue
+		}
+		dwell, err := timetableElapsed(stop.arrival, stop.departure)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s: invalid time", name, stop.station))
+			continue
+		}
+		if dwell >= halfDay {
+			errs = append(errs, fmt.Sprintf("%s: %s: arrival %s is after departure %s", name, stop.station, stop.arrival, stop.departure))
+		}
+	}
+
+	// 進行方向の順に並べた停車駅
+	route := []Station{}
+	for _, station := range stations {
+		if !stops[station.Name] {
+			continue
+		}
+		if _, ok := seen[station.Name]; !ok {
+			// 停車駅の順に報告する
+			errs = append(errs, fmt.Sprintf("%s: station %s is missing", name, station.Name))
+			continue
+		}
+		route = append(route, station)
+	}
+	sort.SliceStable(route, func(i, j int) bool {
+		if train.IsNobori {
+			return route[i].Distance > route[j].Distance
+		}
+		return route[i].Distance < route[j].Distance
+	})
+	for i := 1; i < len(route); i++ {
+		prev, stop := seen[route[i-1].Name], seen[route[i].Name]
+		elapsed, err := timetableElapsed(prev.departure, stop.arrival)
+		if err != nil {
+			// 時刻の形式は駅ごとに報告済み
+			continue
+		}
+		if elapsed == 0 || elapsed >= halfDay {
+			errs = append(errs, fmt.Sprintf("%s: arrival %s at %s must be after departure %s at %s", name, stop.arrival, stop.station, prev.departure, prev.station))
+		}
+	}
+	return errs
+}
+
+// scopeTrainKeys は、更新された行から列車のキーを重複なく取り出します
+func scopeTrainKeys(scope []adminRow) []trainKey {
+	keys := []trainKey{}
+	seen := map[trainKey]bool{}
+	for _, row := range scope {
+		date, _ := row["date"].(string)
+		trainClass, _ := row["train_class"].(string)
+		trainName, _ := row["train_name"].(string)
+		key := trainKey{date, trainClass, trainName}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func selectStationsByName(tx *sqlx.Tx) ([]Station, map[string]Station, error) {
+	stations := []Station{}
+	if err := tx.Select(&stations, "SELECT * FROM `station_master` ORDER BY `id`"); err != nil {
+		return nil, nil, err
+	}
+	byName := map[string]Station{}
+	for _, station := range stations {
+		byName[station.Name] = station
+	}
+	return stations, byName, nil
+}
+
+func validateStationMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	stations := []Station{}
+	if err := tx.Select(&stations, "SELECT * FROM `station_master`"); err != nil {
+		return nil, err
+	}
+	errs := checkStations(stations)
+
+	// 駅名の変更や削除で、列車や時刻表の駅が無くならないこと
+	missing := []string{}
+	err := tx.Select(
+		&missing,
+		"SELECT `s`.`name` FROM ("+
+			"SELECT `start_station` AS `name` FROM `train_master` UNION "+
+			"SELECT `last_station` FROM `train_master` UNION "+
+			"SELECT DISTINCT `station` FROM `train_timetable_master`"+
+			") AS `s` LEFT JOIN `station_master` AS `m` ON `s`.`name` = `m`.`name` WHERE `m`.`id` IS NULL",
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range missing {
+		errs = append(errs, fmt.Sprintf("station %s: used by trains but not found", name))
+	}
+	return errs, nil
+}
+
+func validateDistanceFareMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	fares := []DistanceFare{}
+	if err := tx.Select(&fares, "SELECT * FROM `distance_fare_master`"); err != nil {
+		return nil, err
+	}
+	return checkDistanceFares(fares), nil
+}
+
+func validateFareMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	fares := []Fare{}
+	if err := tx.Select(&fares, "SELECT * FROM `fare_master`"); err != nil {
+		return nil, err
+	}
+
+	var firstDate time.Time
+	var first sql.NullString
+	if err := tx.Get(&first, "SELECT DATE_FORMAT(MIN(`date`), '%Y-%m-%d') FROM `train_master`"); err != nil {
+		return nil, err
+	}
+	if first.Valid {
+		d, err := time.Parse("2006-01-02", first.String)
+		if err != nil {
+			return nil, err
+		}
+		firstDate = d
+	}
+	return checkFares(fares, firstDate), nil
+}
+
+func validateSeatMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	seats := []Seat{}
+	if err := tx.Select(&seats, "SELECT * FROM `seat_master`"); err != nil {
+		return nil, err
+	}
+	return checkSeats(seats), nil
+}
+
+func validateTrainMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	_, stations, err := selectStationsByName(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	trains := []Train{}
+	if scope == nil {
+		if err := tx.Select(&trains, "SELECT * FROM `train_master`"); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, key := range scopeTrainKeys(scope) {
+			found := []Train{}
+			err := tx.Select(
+				&found,
+				"SELECT * FROM `train_master` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+				key.date, key.trainClass, key.trainName,
+			)
+			if err != nil {
+				return nil, err
+			}
+			trains = append(trains, found...)
+		}
+	}
+
+	errs := []string{}
+	seen := map[trainKey]bool{}
+	for _, train := range trains {
+		key := trainKey{train.Date.Format("2006-01-02"), train.TrainClass, train.TrainName}
+		if seen[key] {
+			errs = append(errs, fmt.Sprintf("train %s: duplicated", key))
+		}
+		seen[key] = true
+		errs = append(errs, checkTrain(train, stations)...)
+	}
+	return errs, nil
+}
+
+func validateTrainTimetableMaster(tx *sqlx.Tx, scope []adminRow) ([]string, error) {
+	stations, _, err := selectStationsByName(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	const query = "SELECT DATE_FORMAT(`date`, '%Y-%m-%d'), `train_class`, `train_name`, `station`, TIME_FORMAT(`arrival`, '%H:%i:%s'), TIME_FORMAT(`departure`, '%H:%i:%s') FROM `train_timetable_master`"
+	if scope == nil {
+		trains, err := selectTrainsByKey(tx, "SELECT * FROM `train_master`")
+		if err != nil {
+			return nil, err
+		}
+		return checkTimetables(tx, stations, trains, query+" ORDER BY `date`, `train_class`, `train_name`")
+	}
+
+	errs := []string{}
+	for _, key := range scopeTrainKeys(scope) {
+		const where = " WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?"
+		trains, err := selectTrainsByKey(tx, "SELECT * FROM `train_master`"+where, key.date, key.trainClass, key.trainName)
+		if err != nil {
+			return nil, err
+		}
+		e, err := checkTimetables(tx, stations, trains, query+where, key.date, key.trainClass, key.trainName)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, e...)
+	}
+	return errs, nil
+}
+
+func selectTrainsByKey(tx *sqlx.Tx, query string, args ...interface{}) (map[trainKey]*Train, error) {
+	trains := []Train{}
+	if err := tx.Select(&trains, query, args...); err != nil {
+		return nil, err
+	}
+	byKey := make(map[trainKey]*Train, len(trains))
+	for i, train := range trains {
+		byKey[trainKey{train.Date.Format("2006-01-02"), train.TrainClass, train.TrainName}] = &trains[i]
+	}
+	return byKey, nil
+}
+
+// checkTimetables は、列車ごとに並んだ時刻表の駅を読み出しながら検証します
+// 時刻表は全件だと数百万行になるので、列車ごとに検証してメモリに溜めない
+func checkTimetables(tx *sqlx.Tx, stations []Station, trains map[trainKey]*Train, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	errs := []string{}
+	var current trainKey
+	timetable := []timetableStop{}
+	for rows.Next() {
+		var key trainKey
+		var stop timetableStop
+		if err := rows.Scan(&key.date, &key.trainClass, &key.trainName, &stop.station, &stop.arrival, &stop.departure); err != nil {
+			return nil, err
+		}
+		if key != current && len(timetable) > 0 {
+			errs = append(errs, checkTimetable(current, trains[current], stations, timetable)...)
+			timetable = timetable[:0]
+		}
+		current = key
+		timetable = append(timetable, stop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(timetable) > 0 {
+		errs = append(errs, checkTimetable(current, trains[current], stations, timetable)...)
+	}
+	return errs, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testStations = []Station{
+	{ID: 1, Name: "東京", Distance: 0, IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true},
+	{ID: 2, Name: "品川", Distance: 6.8, IsStopExpress: false, IsStopSemiExpress: true, IsStopLocal: true},
+	{ID: 3, Name: "新横浜", Distance: 25.5, IsStopExpress: false, IsStopSemiExpress: false, IsStopLocal: true},
+	{ID: 4, Name: "名古屋", Distance: 366, IsStopExpress: true, IsStopSemiExpress: true, IsStopLocal: true},
+}
+
+func testStationsByName() map[string]Station {
+	byName := map[string]Station{}
+	for _, station := range testStations {
+		byName[station.Name] = station
+	}
+	return byName
+}
+
+func TestCheckStations(t *testing.T) {
+	stations := append([]Station{}, testStations...)
+	if errs := checkStations(stations); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// idの順に距離が増加しない
+	stations = append([]Station{}, testStations...)
+	stations[2].Distance = 6.8
+	if errs := checkStations(stations); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	stations = append([]Station{}, testStations...)
+	stations = append(stations, Station{ID: 5, Name: "東京", Distance: 500})
+	if errs := checkStations(stations); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+}
+
+func TestCheckDistanceFares(t *testing.T) {
+	fares := []DistanceFare{{Distance: 50, Fare: 3000}, {Distance: 0, Fare: 2500}, {Distance: 100, Fare: 3000}}
+	if errs := checkDistanceFares(fares); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	fares = []DistanceFare{{Distance: 10, Fare: 2500}, {Distance: 50, Fare: 2000}}
+	if errs := checkDistanceFares(fares); len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2 errors", errs)
+	}
+}
+
+func TestCheckFares(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fares := []Fare{}
+	for _, trainClass := range []string{"最速", "中間", "遅いやつ"} {
+		for _, seatClass := range []string{"premium", "reserved", "non-reserved"} {
+			fares = append(fares, Fare{TrainClass: trainClass, SeatClass: seatClass, StartDate: start, FareMultiplier: 1})
+		}
+	}
+	if errs := checkFares(fares, start); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// 最初の運行日より後から始まる運賃しかない
+	if errs := checkFares(fares, start.AddDate(0, 0, -1)); len(errs) != 9 {
+		t.Fatalf("errors = %v, want 9 errors", errs)
+	}
+
+	// 組み合わせが欠けている
+	if errs := checkFares(fares[1:], start); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+}
+
+func TestCheckSeats(t *testing.T) {
+	seats := []Seat{
+		{TrainClass: "最速", CarNumber: 1, SeatColumn: "A", SeatRow: 1, SeatClass: "premium"},
+		{TrainClass: "最速", CarNumber: 1, SeatColumn: "B", SeatRow: 1, SeatClass: "premium"},
+	}
+	if errs := checkSeats(seats); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	seats = append(seats, Seat{TrainClass: "最速", CarNumber: 1, SeatColumn: "A", SeatRow: 1, SeatClass: "premium"})
+	seats = append(seats, Seat{TrainClass: "鈍行", CarNumber: 0, SeatColumn: "F", SeatRow: 1, SeatClass: "green"})
+	if errs := checkSeats(seats); len(errs) != 5 {
+		t.Fatalf("errors = %v, want 5 errors", errs)
+	}
+}
+
+func TestCheckTrain(t *testing.T) {
+	stations := testStationsByName()
+	train := Train{
+		Date:         time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		TrainClass:   "最速",
+		TrainName:    "1",
+		StartStation: "東京",
+		LastStation:  "名古屋",
+		IsNobori:     false,
+	}
+	if errs := checkTrain(train, stations); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// 上りの列車が下りになっている
+	nobori := train
+	nobori.StartStation, nobori.LastStation = "名古屋", "東京"
+	if errs := checkTrain(nobori, stations); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	// 最速は品川に停車しない
+	shinagawa := train
+	shinagawa.LastStation = "品川"
+	if errs := checkTrain(shinagawa, stations); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	unknown := train
+	unknown.LastStation = "大阪"
+	if errs := checkTrain(unknown, stations); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+}
+
+func testTimetable(stations ...string) []timetableStop {
+	timetable := []timetableStop{}
+	for i, station := range stations {
+		hour := 6 + i
+		timetable = append(timetable, timetableStop{station, fmt.Sprintf("%02d:00:00", hour), fmt.Sprintf("%02d:02:00", hour)})
+	}
+	return timetable
+}
+
+func TestCheckTimetable(t *testing.T) {
+	key := trainKey{"2020-01-01", "中間", "1"}
+	train := &Train{TrainClass: "中間", TrainName: "1", StartStation: "東京", LastStation: "名古屋"}
+
+	if errs := checkTimetable(key, train, testStations, testTimetable("東京", "品川", "名古屋")); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// 通過駅の時刻が含まれ、停車駅が欠けている
+	errs := checkTimetable(key, train, testStations, testTimetable("東京", "新横浜", "名古屋"))
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2 errors", errs)
+	}
+
+	if errs := checkTimetable(key, train, testStations, testTimetable("東京", "品川", "品川", "名古屋")); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	if errs := checkTimetable(key, nil, testStations, testTimetable("東京")); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	// 到着が出発より後
+	timetable := testTimetable("東京", "品川", "名古屋")
+	timetable[1].arrival = "07:03:00"
+	if errs := checkTimetable(key, train, testStations, timetable); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	// 上り列車の時刻が、進行方向 (名古屋から東京) の順に増加しない
+	nobori := &Train{TrainClass: "中間", TrainName: "2", StartStation: "名古屋", LastStation: "東京", IsNobori: true}
+	if errs := checkTimetable(key, nobori, testStations, testTimetable("東京", "品川", "名古屋")); len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2 errors", errs)
+	}
+	if errs := checkTimetable(key, nobori, testStations, testTimetable("名古屋", "品川", "東京")); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	// 同じ時刻に次の駅に到着する
+	timetable = testTimetable("東京", "品川", "名古屋")
+	timetable[2].arrival = timetable[1].departure
+	if errs := checkTimetable(key, train, testStations, timetable); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	// 途中の駅までの列車は、終着駅より先の駅の時刻を持たない
+	partial := &Train{TrainClass: "遅いやつ", TrainName: "3", StartStation: "東京", LastStation: "新横浜"}
+	if errs := checkTimetable(key, partial, testStations, testTimetable("東京", "品川", "新横浜")); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if errs := checkTimetable(key, partial, testStations, testTimetable("東京", "品川", "新横浜", "名古屋")); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+	partialNobori := &Train{TrainClass: "遅いやつ", TrainName: "4", StartStation: "新横浜", LastStation: "品川", IsNobori: true}
+	if errs := checkTimetable(key, partialNobori, testStations, testTimetable("新横浜", "品川")); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if errs := checkTimetable(key, partialNobori, testStations, testTimetable("品川")); len(errs) != 1 {
+		t.Fatalf("errors = %v, want 1 error", errs)
+	}
+
+	// 日付をまたぐ
+	timetable = []timetableStop{
+		{"東京", "23:30:00", "23:32:00"},
+		{"品川", "23:58:00", "00:01:00"},
+		{"名古屋", "01:30:00", "01:32:00"},
+	}
+	if errs := checkTimetable(key, train, testStations, timetable); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+}
+
+func TestParseAdminValue(t *testing.T) {
+	tests := []struct {
+		column adminColumn
+		in     string
+		want   interface{}
+	}{
+		{adminColumn{"id", adminInt}, "12", int64(12)},
+		{adminColumn{"distance", adminFloat}, "12.5", 12.5},
+		{adminColumn{"is_nobori", adminBool}, "1", true},
+		{adminColumn{"is_nobori", adminBool}, "false", false},
+		{adminColumn{"date", adminDate}, "2020-01-01", "2020-01-01"},
+		{adminColumn{"start_date", adminDatetime}, "2020-01-01", "2020-01-01 00:00:00"},
+		{adminColumn{"departure", adminTime}, "06:00:00", "06:00:00"},
+		{adminColumn{"name", adminString}, "東京", "東京"},
+	}
+	for _, tt := range tests {
+		got, err := parseAdminValue(tt.column, tt.in)
+		if err != nil {
+			t.Fatalf("%s %q: %s", tt.column.name, tt.in, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s %q = %#v, want %#v", tt.column.name, tt.in, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		column adminColumn
+		in     string
+	}{
+		{adminColumn{"id", adminInt}, "1.5"},
+		{adminColumn{"is_nobori", adminBool}, "yes"},
+		{adminColumn{"date", adminDate}, "2020/01/01"},
+		{adminColumn{"departure", adminTime}, "25:00:00"},
+	} {
+		if _, err := parseAdminValue(tt.column, tt.in); err == nil {
+			t.Fatalf("%s %q: expected error", tt.column.name, tt.in)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+/*
+	CSRF対策 (double submit)
+
+	セッションに保存したトークンを XSRF-TOKEN cookie でも返し、
+	状態を変更するリクエストでは X-XSRF-TOKEN ヘッダでトークンを送ってもらう
+	cookie名とヘッダ名は、フロントエンドで使っているaxiosのデフォルトに合わせている
+*/
+
+const (
+	csrfCookieName = "XSRF-TOKEN"
+	csrfHeaderName = "X-XSRF-TOKEN"
+	csrfSessionKey = "csrf_token"
+)
+
+// セッションが無い状態で呼ばれるため、トークンを検証しないパス
+var csrfExemptPaths = map[string]bool{
+	"/initialize":      true,
+	"/api/auth/signup": true,
+	"/api/auth/login":  true,
+}
+
+func setCSRFCookie(w http.ResponseWriter, session *sessions.Session, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   csrfCookieName,
+		Value:  token,
+		Path:   "/",
+		MaxAge: session.Options.MaxAge,
+	})
+}
+
+// issueCSRFToken は、トークンを発行してセッションに保存します
+// NOTE: セッションの保存は呼び出し側で行う
+func issueCSRFToken(w http.ResponseWriter, session *sessions.Session) {
+	token := secureRandomStr(32)
+	session.Values[csrfSessionKey] = token
+	setCSRFCookie(w, session, token)
+}
+
+// ensureCSRFToken は、セッションにトークンがなければ発行します
+func ensureCSRFToken(w http.ResponseWriter, r *http.Request) error {
+	session := getSession(r)
+	if token, ok := session.Values[csrfSessionKey].(string); ok && token != "" {
+		setCSRFCookie(w, session, token)
+		return nil
+	}
+
+	issueCSRFToken(w, session)
+	return session.Save(r, w)
+}
+
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		// 管理APIはCookieではなくトークンで認証するので対象外
+		if csrfExemptPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/api/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session := getSession(r)
+		token, _ := session.Values[csrfSessionKey].(string)
+		challenge := r.Header.Get(csrfHeaderName)
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(challenge)) != 1 {
+			log.Printf("invalid csrf token: %s %s", r.Method, r.URL.Path)
+			errorResponse(w, http.StatusForbidden, "invalid csrf token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	crand "crypto/rand"
-	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -20,7 +19,6 @@ import (
 	"github.com/jmoiron/sqlx"
 	goji "goji.io"
 	"goji.io/pat"
-	"golang.org/x/crypto/pbkdf2"
 	// "sync"
 )
 
@@ -87,6 +85,7 @@ type Reservation struct {
 	Adult         int        `json:"adult" db:"adult"`
 	Child         int        `json:"child" db:"child"`
 	Amount        int        `json:"amount" db:"amount"`
+	Refunded      bool       `json:"refunded" db:"refunded"`
 }
 
 type SeatReservation struct {
@@ -105,6 +104,8 @@ type CarInformation struct {
 	CarNumber           int                    `json:"car_number"`
 	SeatInformationList []SeatInformation      `json:"seats"`
 	Cars                []SimpleCarInformation `json:"cars"`
+	TrainStatus         string                 `json:"train_status"`
+	DelayMinutes        int                    `json:"delay_minutes"`
 }
 
 type SimpleCarInformation struct {
@@ -136,14 +137,17 @@ type TrainSearchResponse struct {
 	ArrivalTime      string            `json:"arrival_time"`
 	SeatAvailability map[string]string `json:"seat_availability"`
 	Fare             map[string]int    `json:"seat_fare"`
+	TrainStatus      string            `json:"train_status"`
+	DelayMinutes     int               `json:"delay_minutes"`
 }
 
 type User struct {
-	ID             int64
-	Email          string `json:"email"`
-	Password       string `json:"password"`
-	Salt           []byte `db:"salt"`
-	HashedPassword []byte `db:"super_secure_password"`
+	ID              int64
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	Salt            []byte `db:"salt"`
+	HashedPassword  []byte `db:"super_secure_password"`
+	PasswordVersion int    `db:"password_version"`
 }
 
 type TrainReservationRequest struct {
@@ -159,17 +163,25 @@ type TrainReservationRequest struct {
 	Adult         int           `json:"adult"`
 	Column        string        `json:"Column"`
 	Seats         []RequestSeat `json:"seats"`
+	// あいまい予約の座席の希望
+	Preferences *SeatPreferences `json:"preferences"`
+	// あいまい予約で、1つの号車にまとめて予約できない場合に隣り合う号車に分けて予約するか
+	AllowSplit bool `json:"allow_split"`
 }
 
 type RequestSeat struct {
 	Row    int    `json:"row"`
 	Column string `json:"column"`
+	// 座席の号車. 座席を決めた後に設定する
+	CarNumber int `json:"-"`
 }
 
 type TrainReservationResponse struct {
 	ReservationId int64 `json:"reservation_id"`
 	Amount        int   `json:"amount"`
 	IsOk          bool  `json:"is_ok"`
+	// 座席の希望を指定したあいまい予約で、予約した全ての座席が満たした希望
+	Preferences *SatisfiedPreferences `json:"preferences,omitempty"`
 }
 
 type ReservationPaymentRequest struct {
@@ -211,6 +223,9 @@ type ReservationResponse struct {
 	DepartureTime string            `json:"departure_time"`
 	ArrivalTime   string            `json:"arrival_time"`
 	Seats         []SeatReservation `json:"seats"`
+	TrainStatus   string            `json:"train_status"`
+	DelayMinutes  int               `json:"delay_minutes"`
+	Refunded      bool              `json:"refunded"`
 }
 
 type CancelPaymentInformationRequest struct {
@@ -240,7 +255,7 @@ const (
 )
 
 var (
-	store sessions.Store = sessions.NewCookieStore([]byte(secureRandomStr(20)))
+	store sessions.Store
 )
 
 func handler(w http.ResponseWriter, r *http.Request) {
@@ -532,6 +547,12 @@ func trainSearchHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("From", fromStation)
 	fmt.Println("To", toStation)
 
+	operations, err := getTrainOperations(date)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	trainSearchResponseList := []TrainSearchResponse{}
 
 	for _, train := range trainList {
@@ -692,9 +713,22 @@ func trainSearchHandler(w http.ResponseWriter, r *http.Request) {
 				"non_reserved":   nonReservedFare,
 			}
 
+			// 運休の列車は予約できない
+			var operation *TrainOperation
+			if o, ok := operations[train.TrainClass+"/"+train.TrainName]; ok {
+				operation = &o
+			}
+			status, delayMinutes := trainStatus(operation)
+			if status == trainStatusCancelled {
+				for k := range seatAvailability {
+					seatAvailability[k] = "×"
+				}
+			}
+
 			trainSearchResponseList = append(trainSearchResponseList, TrainSearchResponse{
 				train.TrainClass, train.TrainName, train.StartStation, train.LastStation,
 				fromStation.Name, toStation.Name, departure, arrival, seatAvailability, fareInformation,
+				status, delayMinutes,
 			})
 
 			if len(trainSearchResponseList) >= 10 {
@@ -811,7 +845,7 @@ func trainSeatsHandler(w http.ResponseWriter, r *http.Request) {
 SELECT s.*
 FROM seat_reservations s, reservations r
 WHERE
-	r.date=? AND r.train_class=? AND r.train_name=? AND car_number=? AND seat_row=? AND seat_column=?
+	r.reservation_id=s.reservation_id AND r.date=? AND r.train_class=? AND r.train_name=? AND car_number=? AND seat_row=? AND seat_column=?
 `
 
 		err = dbx.Select(
@@ -893,7 +927,20 @@ WHERE
 		i = i + 1
 	}
 
-	c := CarInformation{date.Format("2006/01/02"), trainClass, trainName, carNumber, seatInformationList, simpleCarInformationList}
+	operation, err := getTrainOperation(dbx, date, trainClass, trainName)
+	if err != nil {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status, delayMinutes := trainStatus(operation)
+	if status == trainStatusCancelled {
+		// 運休の列車は全席予約できない
+		for i := range seatInformationList {
+			seatInformationList[i].IsOccupied = true
+		}
+	}
+
+	c := CarInformation{date.Format("2006/01/02"), trainClass, trainName, carNumber, seatInformationList, simpleCarInformationList, status, delayMinutes}
 	resp, err := json.Marshal(c)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, err.Error())
@@ -980,6 +1027,20 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 運休の列車は予約できない
+	operation, err := getTrainOperation(tx, date, req.TrainClass, req.TrainName)
+	if err != nil {
+		tx.Rollback()
+		errorResponse(w, http.StatusInternalServerError, "運行情報の取得に失敗しました")
+		log.Println(err.Error())
+		return
+	}
+	if status, _ := trainStatus(operation); status == trainStatusCancelled {
+		tx.Rollback()
+		errorResponse(w, http.StatusBadRequest, "運休のため予約できません")
+		return
+	}
+
 	// 列車自体の駅IDを求める
 	var departureStation, arrivalStation Station
 	query = "SELECT * FROM station_master WHERE name=?"
@@ -1102,11 +1163,29 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 		あいまい座席検索
 		seatsが空白の時に発動する
 	*/
+	var satisfiedPreferences *SatisfiedPreferences // 座席の希望を指定した場合に、予約した座席が満たした希望
 	switch len(req.Seats) {
 	case 0:
 		if req.SeatClass == "non-reserved" {
 			break // non-reservedはそもそもあいまい検索もせずダミーのRow/Columnで予約を確定させる。
 		}
+		if req.Preferences != nil {
+			if message := checkSeatPreferences(req.Preferences); message != "" {
+				tx.Rollback()
+				errorResponse(w, http.StatusBadRequest, message)
+				return
+			}
+			if req.Column != "" {
+				tx.Rollback()
+				errorResponse(w, http.StatusBadRequest, "Columnとpreferencesは同時に指定できません")
+				return
+			}
+		}
+		if req.AllowSplit && (req.Preferences != nil || req.Column != "") {
+			tx.Rollback()
+			errorResponse(w, http.StatusBadRequest, "allow_splitはColumn・preferencesと同時に指定できません")
+			return
+		}
 		//当該列車・号車中の空き座席検索
 		var train Train
 		query := "SELECT * FROM train_master WHERE date=? AND train_class=? AND train_name=?"
@@ -1135,8 +1214,19 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// 座席の希望を全て満たす号車がない場合に予約する、最初に席を確保できた号車
+		var fallbackCarNumber int
+		var fallbackSeats []RequestSeat
+		var fallbackPreferences *SatisfiedPreferences
+		// 号車をまたいで予約する場合に使う、座席クラスが一致する号車ごとの空席
+		freeSeatsByCar := map[int][]RequestSeat{}
+
 		req.Seats = []RequestSeat{} // 座席リクエスト情報は空に
 		for carnum := 1; carnum <= 16; carnum++ {
+			if req.Preferences != nil && !req.Preferences.inCarRange(carnum) {
+				continue
+			}
+
 			seatList := []Seat{}
 			query = "SELECT * FROM seat_master WHERE train_class=? AND car_number=? AND seat_class=? AND is_smoking_seat=? ORDER BY seat_row, seat_column"
 			err = dbx.Select(&seatList, query, req.TrainClass, carnum, req.SeatClass, req.IsSmokingSeat)
@@ -1150,7 +1240,7 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 			for _, seat := range seatList {
 				s := SeatInformation{seat.SeatRow, seat.SeatColumn, seat.SeatClass, seat.IsSmokingSeat, false}
 				seatReservationList := []SeatReservation{}
-				query = "SELECT s.* FROM seat_reservations s, reservations r WHERE r.date=? AND r.train_class=? AND r.train_name=? AND car_number=? AND seat_row=? AND seat_column=? FOR UPDATE"
+				query = "SELECT s.* FROM seat_reservations s, reservations r WHERE r.reservation_id=s.reservation_id AND r.date=? AND r.train_class=? AND r.train_name=? AND car_number=? AND seat_row=? AND seat_column=? FOR UPDATE"
 				err = dbx.Select(
 					&seatReservationList, query,
 					date.Format("2006/01/02"),
@@ -1212,6 +1302,46 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 				seatInformationList = append(seatInformationList, s)
 			}
 
+			if req.AllowSplit && len(seatInformationList) > 0 {
+				freeSeats := []RequestSeat{}
+				for _, seat := range seatInformationList {
+					if !seat.IsOccupied {
+						freeSeats = append(freeSeats, RequestSeat{Row: seat.Row, Column: seat.Column})
+					}
+				}
+				freeSeatsByCar[carnum] = freeSeats
+			}
+
+			// 座席の希望があれば、希望を多く満たす席を選び、全て満たせる号車を優先する
+			if req.Preferences != nil {
+				var firstRow, lastRow int
+				query = "SELECT MIN(seat_row), MAX(seat_row) FROM seat_master WHERE train_class=? AND car_number=?"
+				err = dbx.QueryRow(query, req.TrainClass, carnum).Scan(&firstRow, &lastRow)
+				if err != nil {
+					tx.Rollback()
+					errorResponse(w, http.StatusInternalServerError, "座席データの取得に失敗しました")
+					log.Println(err.Error())
+					return
+				}
+
+				seats, satisfied := req.Preferences.pickPreferredSeats(req.SeatClass, seatInformationList, req.Adult+req.Child, firstRow, lastRow)
+				if seats == nil {
+					continue
+				}
+				if satisfied.satisfiesAll(req.Preferences) {
+					req.Seats = seats
+					req.CarNumber = carnum
+					satisfiedPreferences = satisfied
+					break
+				}
+				if fallbackSeats == nil {
+					fallbackCarNumber = carnum
+					fallbackSeats = seats
+					fallbackPreferences = satisfied
+				}
+				continue
+			}
+
 			// 曖昧予約席とその他の候補席を選出
 			var seatnum int           // 予約する座席の合計数
 			var reserved bool         // あいまい指定席確保済フラグ
@@ -1271,6 +1401,18 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 				break
 			}
 		}
+		if len(req.Seats) == 0 && fallbackSeats != nil {
+			req.Seats = fallbackSeats
+			req.CarNumber = fallbackCarNumber
+			satisfiedPreferences = fallbackPreferences
+		}
+		if len(req.Seats) == 0 && req.AllowSplit {
+			// 1つの号車にまとめて予約できないので、隣り合う号車に分ける
+			if seats := splitSeats(freeSeatsByCar, req.Adult+req.Child); seats != nil {
+				req.Seats = seats
+				req.CarNumber = seats[0].CarNumber
+			}
+		}
 		if len(req.Seats) == 0 {
 			errorResponse(w, http.StatusNotFound, "あいまい座席予約ができませんでした。指定した席、もしくは1車両内に希望の席数をご用意できませんでした。")
 			tx.Rollback()
@@ -1300,6 +1442,13 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 		break
 	}
 
+	// 号車をまたぐ予約以外は、全席がリクエストの号車
+	for i := range req.Seats {
+		if req.Seats[i].CarNumber == 0 {
+			req.Seats[i].CarNumber = req.CarNumber
+		}
+	}
+
 	// 当該列車・列車名の予約一覧取得
 	reservations := []Reservation{}
 	query = "SELECT * FROM reservations WHERE date=? AND train_class=? AND train_name=? FOR UPDATE"
@@ -1416,7 +1565,7 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 
 			for _, v := range SeatReservations {
 				for _, seat := range req.Seats {
-					if v.CarNumber == req.CarNumber && v.SeatRow == seat.Row && v.SeatColumn == seat.Column {
+					if v.CarNumber == seat.CarNumber && v.SeatRow == seat.Row && v.SeatColumn == seat.Column {
 						tx.Rollback()
 						fmt.Println("Duplicated ", reservation)
 						errorResponse(w, http.StatusBadRequest, "リクエストに既に予約された席が含まれています")
@@ -1522,7 +1671,7 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 		_, err = tx.Exec(
 			query,
 			id,
-			req.CarNumber,
+			v.CarNumber,
 			v.Row,
 			v.Column,
 		)
@@ -1538,6 +1687,7 @@ func trainReservationHandler(w http.ResponseWriter, r *http.Request) {
 		ReservationId: id,
 		Amount:        sumFare,
 		IsOk:          true,
+		Preferences:   satisfiedPreferences,
 	}
 	response, err := json.Marshal(rr)
 	if err != nil {
@@ -1575,8 +1725,9 @@ func reservationPaymentHandler(w http.ResponseWriter, r *http.Request) {
 	tx := dbx.MustBegin()
 
 	// 予約IDで検索
+	// 列車の運休と同時に確定しないよう、行ロックを取る
 	reservation := Reservation{}
-	query := "SELECT * FROM reservations WHERE reservation_id=?"
+	query := "SELECT * FROM reservations WHERE reservation_id=? FOR UPDATE"
 	err = tx.Get(
 		&reservation, query,
 		req.ReservationId,
@@ -1615,6 +1766,11 @@ func reservationPaymentHandler(w http.ResponseWriter, r *http.Request) {
 		tx.Rollback()
 		errorResponse(w, http.StatusForbidden, "既に支払いが完了している予約IDです")
 		return
+	case "rejected":
+		// 列車が運休になった予約
+		tx.Rollback()
+		errorResponse(w, http.StatusBadRequest, "運休のため予約を確定できません")
+		return
 	default:
 		break
 	}
@@ -1698,6 +1854,13 @@ func reservationPaymentHandler(w http.ResponseWriter, r *http.Request) {
 
 func getAuthHandler(w http.ResponseWriter, r *http.Request) {
 
+	// 未ログインでもCSRFトークンは発行する
+	if err := ensureCSRFToken(w, r); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "session error")
+		return
+	}
+
 	// userID取得
 	user, errCode, errMsg := getUser(r)
 	if errCode != http.StatusOK {
@@ -1725,19 +1888,19 @@ func signUpHandler(w http.ResponseWriter, r *http.Request) {
 
 	// TODO: validation
 
-	salt := make([]byte, 1024)
-	_, err := crand.Read(salt)
+	passwordVersion, salt, superSecurePassword, err := hashPassword(user.Password)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, "salt generator error")
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "password hash error")
 		return
 	}
-	superSecurePassword := pbkdf2.Key([]byte(user.Password), salt, 100, 256, sha256.New)
 
 	_, err = dbx.Exec(
-		"INSERT INTO `users` (`email`, `salt`, `super_secure_password`) VALUES (?, ?, ?)",
+		"INSERT INTO `users` (`email`, `salt`, `super_secure_password`, `password_version`) VALUES (?, ?, ?, ?)",
 		user.Email,
 		salt,
 		superSecurePassword,
+		passwordVersion,
 	)
 	if err != nil {
 		errorResponse(w, http.StatusBadRequest, "user registration failed")
@@ -1759,28 +1922,67 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	postUser := User{}
 	json.Unmarshal(buf, &postUser)
 
+	// ロックアウト中はパスワードを検証しない
+	now := time.Now()
+	limitKeys, accountLimitKey := loginLimitKeys(r, postUser.Email)
+	retryAfter, err := checkLoginLimit(limitKeys, now)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "login limit error")
+		return
+	}
+	if retryAfter > 0 {
+		tooManyRequestsResponse(w, retryAfter)
+		return
+	}
+
 	user := User{}
 	query := "SELECT * FROM users WHERE email=?"
-	err := dbx.Get(&user, query, postUser.Email)
-	if err == sql.ErrNoRows {
-		errorResponse(w, http.StatusForbidden, "authentication failed")
+	err = dbx.Get(&user, query, postUser.Email)
+	if err != nil && err != sql.ErrNoRows {
+		errorResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+
+	userFound := err == nil
+	found := &user
+	if !userFound {
+		// 存在しないメールアドレスでも、ダミーのハッシュを検証して同じだけ時間をかける
+		found = nil
+	}
+	ok, needsRehash, err := verifyLoginPassword(found, postUser.Password)
 	if err != nil {
-		errorResponse(w, http.StatusInternalServerError, err.Error())
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "password verification error")
 		return
 	}
-
-	challengePassword := pbkdf2.Key([]byte(postUser.Password), user.Salt, 100, 256, sha256.New)
-
-	if !bytes.Equal(user.HashedPassword, challengePassword) {
+	if !ok || !userFound {
+		if err := failLogin(limitKeys, now); err != nil {
+			log.Print(err)
+		}
 		errorResponse(w, http.StatusForbidden, "authentication failed")
 		return
 	}
+	if needsRehash {
+		// 古い方式のハッシュを、平文のパスワードが分かるログイン時に置き換える
+		// 失敗してもログインはできるので、ログのみ残す
+		if err := rehashPassword(user.ID, postUser.Password); err != nil {
+			log.Print(err)
+		}
+	}
+	if err := limiter.reset(accountLimitKey); err != nil {
+		log.Print(err)
+	}
 
 	session := getSession(r)
+	if err := renewSessionID(session); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "session error")
+		return
+	}
 
 	session.Values["user_id"] = user.ID
+	issueCSRFToken(w, session)
 	if err = session.Save(r, w); err != nil {
 		log.Print(err)
 		errorResponse(w, http.StatusInternalServerError, "session error")
@@ -1795,10 +1997,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 		POST /auth/logout
 	*/
 
-	session := getSession(r)
-
-	session.Values["user_id"] = 0
-	if err := session.Save(r, w); err != nil {
+	if err := revokeSession(w, r); err != nil {
 		log.Print(err)
 		errorResponse(w, http.StatusInternalServerError, "session error")
 		return
@@ -1839,11 +2038,18 @@ func makeReservationResponse(reservation Reservation) (ReservationResponse, erro
 	reservationResponse.TrainName = reservation.TrainName
 	reservationResponse.DepartureTime = departure
 	reservationResponse.ArrivalTime = arrival
+	reservationResponse.Refunded = reservation.Refunded
+
+	operation, err := getTrainOperation(dbx, *reservation.Date, reservation.TrainClass, reservation.TrainName)
+	if err != nil {
+		return reservationResponse, err
+	}
+	reservationResponse.TrainStatus, reservationResponse.DelayMinutes = trainStatus(operation)
 
 	query := "SELECT * FROM seat_reservations WHERE reservation_id=?"
 	err = dbx.Select(&reservationResponse.Seats, query, reservation.ReservationId)
 
-	// 1つの予約内で車両番号は全席同じ
+	// 号車をまたぐ予約では、座席ごとの号車を seats で返す. car_number は先頭の座席の号車
 	reservationResponse.CarNumber = reservationResponse.Seats[0].CarNumber
 
 	if reservationResponse.Seats[0].CarNumber == 0 {
@@ -1869,7 +2075,6 @@ func makeReservationResponse(reservation Reservation) (ReservationResponse, erro
 	for i, v := range reservationResponse.Seats {
 		// omit
 		v.ReservationId = 0
-		v.CarNumber = 0
 		reservationResponse.Seats[i] = v
 	}
 	return reservationResponse, nil
@@ -1986,6 +2191,10 @@ func userReservationCancelHandler(w http.ResponseWriter, r *http.Request) {
 		errorResponse(w, http.StatusInternalServerError, "何らかの理由により予約はRejected状態です")
 		return
 	case "done":
+		if reservation.Refunded {
+			// 運休で払い戻し済み
+			break
+		}
 		// 支払いをキャンセルする
 		payInfo := CancelPaymentInformationRequest{reservation.PaymentId}
 		j, err := json.Marshal(payInfo)
@@ -2070,6 +2279,10 @@ func userReservationCancelHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	tx.Commit()
+
+	// 空いた座席をキャンセル待ちに繰り上げる
+	promoteWaitlistFor([]Reservation{reservation})
+
 	messageResponse(w, "cancell complete")
 }
 
@@ -2081,6 +2294,12 @@ func initializeHandler(w http.ResponseWriter, r *http.Request) {
 	dbx.Exec("TRUNCATE seat_reservations")
 	dbx.Exec("TRUNCATE reservations")
 	dbx.Exec("TRUNCATE users")
+	dbx.Exec("TRUNCATE sessions")
+	dbx.Exec("TRUNCATE train_operations")
+	dbx.Exec("TRUNCATE waitlist")
+	if err := limiter.clear(); err != nil {
+		log.Print(err)
+	}
 
 	resp := InitializeResponse{
 		availableDays,
@@ -2152,9 +2371,25 @@ func main() {
 	}
 	defer dbx.Close()
 
+	store, err = newSessionStore()
+	if err != nil {
+		log.Fatalf("failed to create session store: %s.", err.Error())
+	}
+	if err := initPasswordHash(); err != nil {
+		log.Fatalf("failed to configure password hash: %s.", err.Error())
+	}
+	limiter, err = newLoginLimiter()
+	if err != nil {
+		log.Fatalf("failed to create login limiter: %s.", err.Error())
+	}
+	if err := initWaitlist(); err != nil {
+		log.Fatalf("failed to configure waitlist: %s.", err.Error())
+	}
+
 	// HTTP
 
 	mux := goji.NewMux()
+	mux.Use(csrfMiddleware)
 
 	mux.HandleFunc(pat.Post("/initialize"), initializeHandler)
 	mux.HandleFunc(pat.Get("/api/settings"), settingsHandler)
@@ -2174,6 +2409,27 @@ func main() {
 	mux.HandleFunc(pat.Get("/api/user/reservations"), userReservationsHandler)
 	mux.HandleFunc(pat.Get("/api/user/reservations/:item_id"), userReservationResponseHandler)
 	mux.HandleFunc(pat.Post("/api/user/reservations/:item_id/cancel"), userReservationCancelHandler)
+	mux.HandleFunc(pat.Post("/api/user/password"), changePasswordHandler)
+	mux.HandleFunc(pat.Post("/api/user/email"), changeEmailHandler)
+	mux.HandleFunc(pat.Delete("/api/user"), deleteUserHandler)
+
+	// キャンセル待ち
+	mux.HandleFunc(pat.Post("/api/train/waitlist"), registerWaitlistHandler)
+	mux.HandleFunc(pat.Get("/api/user/waitlist"), userWaitlistHandler)
+	mux.HandleFunc(pat.Post("/api/user/waitlist/:waitlist_id/cancel"), cancelWaitlistHandler)
+
+	// 運行情報 (:table より先に登録する)
+	mux.HandleFunc(pat.Get("/api/admin/operations"), listTrainOperationsHandler)
+	mux.HandleFunc(pat.Put("/api/admin/operations"), updateTrainOperationHandler)
+
+	// マスタデータ管理
+	mux.HandleFunc(pat.Get("/api/admin/:table"), adminHandler(adminListHandler))
+	mux.HandleFunc(pat.Post("/api/admin/:table"), adminHandler(adminInsertHandler))
+	mux.HandleFunc(pat.Put("/api/admin/:table"), adminHandler(adminUpdateHandler))
+	mux.HandleFunc(pat.Delete("/api/admin/:table"), adminHandler(adminDeleteHandler))
+	mux.HandleFunc(pat.Get("/api/admin/:table/csv"), adminHandler(adminExportCSVHandler))
+	mux.HandleFunc(pat.Post("/api/admin/:table/csv"), adminHandler(adminImportCSVHandler))
+	mux.HandleFunc(pat.Put("/api/admin/:table/csv"), adminHandler(adminImportCSVHandler))
 
 	fmt.Println(banner)
 	err = http.ListenAndServe(":8000", mux)
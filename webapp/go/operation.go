@@ -0,0 +1,322 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+	運行情報
+
+	GET /api/admin/operations?date=2020-01-01 運行情報の一覧 (管理API)
+	PUT /api/admin/operations                 列車の運行情報を設定する (管理API)
+
+	status
+	  normal    平常運行 (運行情報を削除する)
+	  delayed   delay_minutes 分の遅延. 遅延は案内のみで、レスポンスの発着時刻は時刻表のまま返す
+	            予約の可否や運賃にも影響しない. 実際の発着時刻は利用者側で delay_minutes を加えて案内する
+	  cancelled 運休. 決済済みの予約は全て払い戻し、未決済の予約は rejected にする. キャンセル待ちは取り消す
+	運休にした列車は元に戻せない
+*/
+
+const (
+	trainStatusNormal    = "normal"
+	trainStatusDelayed   = "delayed"
+	trainStatusCancelled = "cancelled"
+)
+
+type TrainOperation struct {
+	Date         time.Time `db:"date"`
+	TrainClass   string    `db:"train_class"`
+	TrainName    string    `db:"train_name"`
+	Status       string    `db:"status"`
+	DelayMinutes int       `db:"delay_minutes"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+type TrainOperationRequest struct {
+	Date         string `json:"date"`
+	TrainClass   string `json:"train_class"`
+	TrainName    string `json:"train_name"`
+	Status       string `json:"status"`
+	DelayMinutes int    `json:"delay_minutes"`
+}
+
+type TrainOperationResponse struct {
+	Date         string `json:"date"`
+	TrainClass   string `json:"train_class"`
+	TrainName    string `json:"train_name"`
+	Status       string `json:"status"`
+	DelayMinutes int    `json:"delay_minutes"`
+	// 運休にした際に払い戻した予約と、rejectedにした予約の件数
+	Refunded int `json:"refunded,omitempty"`
+	Rejected int `json:"rejected,omitempty"`
+}
+
+type getter interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+}
+
+// getTrainOperation は、列車の運行情報を返します. 平常運行の場合は nil を返します
+func getTrainOperation(q getter, date time.Time, trainClass, trainName string) (*TrainOperation, error) {
+	operation := TrainOperation{}
+	err := q.Get(
+		&operation,
+		"SELECT * FROM `train_operations` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+		date.Format("2006/01/02"), trainClass, trainName,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// getTrainOperations は、指定した日の運行情報を列車種別と列車名ごとに返します
+func getTrainOperations(date time.Time) (map[string]TrainOperation, error) {
+	operations := []TrainOperation{}
+	err := dbx.Select(&operations, "SELECT * FROM `train_operations` WHERE `date` = ?", date.Format("2006/01/02"))
+	if err != nil {
+		return nil, err
+	}
+	byTrain := map[string]TrainOperation{}
+	for _, operation := range operations {
+		byTrain[operation.TrainClass+"/"+operation.TrainName] = operation
+	}
+	return byTrain, nil
+}
+
+// trainStatus は、運行情報から列車の状態と遅延時間を返します
+func trainStatus(operation *TrainOperation) (string, int) {
+	if operation == nil {
+		return trainStatusNormal, 0
+	}
+	return operation.Status, operation.DelayMinutes
+}
+
+func listTrainOperationsHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		運行情報の一覧
+		GET /api/admin/operations
+	*/
+
+	if !adminAuthorized(w, r) {
+		return
+	}
+
+	query := "SELECT * FROM `train_operations`"
+	args := []interface{}{}
+	if d := r.URL.Query().Get("date"); d != "" {
+		date, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, "invalid date")
+			return
+		}
+		query += " WHERE `date` = ?"
+		args = append(args, date.Format("2006/01/02"))
+	}
+	query += " ORDER BY `date`, `train_class`, `train_name`"
+
+	operations := []TrainOperation{}
+	if err := dbx.Select(&operations, query, args...); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	list := []TrainOperationResponse{}
+	for _, operation := range operations {
+		list = append(list, TrainOperationResponse{
+			Date:         operation.Date.Format("2006-01-02"),
+			TrainClass:   operation.TrainClass,
+			TrainName:    operation.TrainName,
+			Status:       operation.Status,
+			DelayMinutes: operation.DelayMinutes,
+		})
+	}
+
+	resp, err := json.Marshal(list)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "JSON marshal error")
+		return
+	}
+	w.Write(resp)
+}
+
+func updateTrainOperationHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		運行情報の設定
+		PUT /api/admin/operations
+	*/
+
+	if !adminAuthorized(w, r) {
+		return
+	}
+
+	req := TrainOperationRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "JSON parseに失敗しました")
+		return
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	switch req.Status {
+	case trainStatusNormal, trainStatusCancelled:
+		req.DelayMinutes = 0
+	case trainStatusDelayed:
+		if req.DelayMinutes <= 0 {
+			errorResponse(w, http.StatusBadRequest, "delay_minutes must be positive")
+			return
+		}
+	default:
+		errorResponse(w, http.StatusBadRequest, "unknown status")
+		return
+	}
+
+	tx := dbx.MustBegin()
+
+	train := Train{}
+	err = tx.Get(
+		&train,
+		"SELECT * FROM `train_master` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+		date.Format("2006/01/02"), req.TrainClass, req.TrainName,
+	)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		errorResponse(w, http.StatusNotFound, "列車が存在しません")
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	current, err := getTrainOperation(tx, date, req.TrainClass, req.TrainName)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if status, _ := trainStatus(current); status == trainStatusCancelled && req.Status != trainStatusCancelled {
+		tx.Rollback()
+		errorResponse(w, http.StatusConflict, "運休にした列車は元に戻せません")
+		return
+	}
+
+	resp := TrainOperationResponse{
+		Date:         req.Date,
+		TrainClass:   req.TrainClass,
+		TrainName:    req.TrainName,
+		Status:       req.Status,
+		DelayMinutes: req.DelayMinutes,
+	}
+
+	if req.Status == trainStatusNormal {
+		_, err = tx.Exec(
+			"DELETE FROM `train_operations` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+			date.Format("2006/01/02"), req.TrainClass, req.TrainName,
+		)
+	} else {
+		_, err = tx.Exec(
+			"INSERT INTO `train_operations` (`date`, `train_class`, `train_name`, `status`, `delay_minutes`, `updated_at`) VALUES (?, ?, ?, ?, ?, NOW()) "+
+				"ON DUPLICATE KEY UPDATE `status` = VALUES(`status`), `delay_minutes` = VALUES(`delay_minutes`), `updated_at` = VALUES(`updated_at`)",
+			date.Format("2006/01/02"), req.TrainClass, req.TrainName, req.Status, req.DelayMinutes,
+		)
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	if req.Status == trainStatusCancelled {
+		resp.Refunded, resp.Rejected, err = cancelTrainReservationsTx(tx, date, req.TrainClass, req.TrainName)
+		if err != nil {
+			tx.Rollback()
+			log.Print(err)
+			errorResponse(w, http.StatusInternalServerError, "払い戻しに失敗しました")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		// 決済はキャンセル済みなので、払い戻しのフラグは手動で立てる必要がある
+		log.Printf("failed to commit train operation (%s %s %s): %s", req.Date, req.TrainClass, req.TrainName, err)
+		errorResponse(w, http.StatusInternalServerError, "運行情報の更新に失敗しました")
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "JSON marshal error")
+		return
+	}
+	w.Write(j)
+}
+
+// cancelTrainReservationsTx は、運休になった列車の決済済みの予約を払い戻し、未決済の予約をrejectedにします
+// キャンセル待ちも取り消します
+// 決済のキャンセルはコミットの直前に行い、失敗した場合はエラーを返すので、呼び出し側でロールバックすること
+func cancelTrainReservationsTx(tx *sqlx.Tx, date time.Time, trainClass, trainName string) (refunded int, rejected int, err error) {
+	// キャンセル待ちは繰り上がらなくなるので取り消す
+	// キャンセル待ちの繰り上げ (promoteWaitlist) と同じく、キャンセル待ち、予約の順にロックを取る
+	_, err = tx.Exec(
+		"UPDATE `waitlist` SET `status` = ?, `updated_at` = NOW(6) WHERE `date` = ? AND `train_class` = ? AND `train_name` = ? AND `status` = ?",
+		waitlistStatusCancelled, date.Format("2006/01/02"), trainClass, trainName, waitlistStatusWaiting,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reservations := []Reservation{}
+	err = tx.Select(
+		&reservations,
+		"SELECT * FROM `reservations` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ? FOR UPDATE",
+		date.Format("2006/01/02"), trainClass, trainName,
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	paymentIDs := []string{}
+	for _, reservation := range reservations {
+		switch {
+		case reservation.Status == "done" && !reservation.Refunded:
+			_, err = tx.Exec("UPDATE `reservations` SET `refunded` = 1 WHERE `reservation_id` = ?", reservation.ReservationId)
+			if err != nil {
+				return 0, 0, err
+			}
+			paymentIDs = append(paymentIDs, reservation.PaymentId)
+		case reservation.Status == "requesting":
+			_, err = tx.Exec("UPDATE `reservations` SET `status` = 'rejected' WHERE `reservation_id` = ?", reservation.ReservationId)
+			if err != nil {
+				return 0, 0, err
+			}
+			rejected++
+		}
+	}
+
+	if len(paymentIDs) == 0 {
+		return 0, rejected, nil
+	}
+	if err := bulkCancelPayments(paymentIDs); err != nil {
+		return 0, 0, err
+	}
+	return len(paymentIDs), rejected, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+	パスワードハッシュ
+
+	users.password_version でハッシュの方式を区別する
+	  1: PBKDF2-SHA256 (100回). saltは users.salt に保存する. 他言語の実装はこの方式のみ
+	  2: argon2id. パラメータとsaltを含めて "$argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>" の形式で保存する
+	ログインに成功した際、設定と異なる方式やパラメータのハッシュは設定に合わせて再計算する
+
+	PASSWORD_HASH      argon2id (デフォルト) または pbkdf2
+	PASSWORD_HASH_COST fast (デフォルト) または strong. fastはベンチマーク向けに計算量を抑える. strongは64MiBを使う本番向けの値
+	ARGON2_TIME, ARGON2_MEMORY, ARGON2_THREADS
+	                   argon2idのパラメータ (ARGON2_MEMORYはKiB). 指定するとPASSWORD_HASH_COSTより優先する
+*/
+
+const (
+	passwordVersionPBKDF2   = 1
+	passwordVersionArgon2id = 2
+
+	pbkdf2Iterations = 100
+	pbkdf2KeyLen     = 256
+	pbkdf2SaltLen    = 1024
+
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+var argon2Costs = map[string]argon2Params{
+	"strong": {time: 1, memory: 64 * 1024, threads: 2},
+	"fast":   {time: 1, memory: 1024, threads: 1},
+}
+
+var (
+	passwordVersion = passwordVersionArgon2id
+	passwordArgon2  = argon2Costs["fast"]
+
+	// dummyUsers は、ログインで検証するハッシュの方式ごとのダミーのユーザです
+	// どのログインでも全ての方式を1回ずつ検証し、応答時間からメールアドレスが登録されているかや、ハッシュの方式が分からないようにする
+	dummyUsers = map[int]*User{}
+)
+
+func initPasswordHash() error {
+	switch os.Getenv("PASSWORD_HASH") {
+	case "", "argon2id":
+		passwordVersion = passwordVersionArgon2id
+	case "pbkdf2":
+		passwordVersion = passwordVersionPBKDF2
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASH: %s", os.Getenv("PASSWORD_HASH"))
+	}
+
+	cost := os.Getenv("PASSWORD_HASH_COST")
+	if cost == "" {
+		cost = "fast"
+	}
+	params, ok := argon2Costs[cost]
+	if !ok {
+		return fmt.Errorf("unknown PASSWORD_HASH_COST: %s", cost)
+	}
+
+	t, err := envInt("ARGON2_TIME", int(params.time))
+	if err != nil {
+		return err
+	}
+	m, err := envInt("ARGON2_MEMORY", int(params.memory))
+	if err != nil {
+		return err
+	}
+	p, err := envInt("ARGON2_THREADS", int(params.threads))
+	if err != nil {
+		return err
+	}
+	if t == 0 || m == 0 || p == 0 || p > 255 {
+		return fmt.Errorf("invalid argon2 params: t=%d m=%d p=%d", t, m, p)
+	}
+	passwordArgon2 = argon2Params{time: uint32(t), memory: uint32(m), threads: uint8(p)}
+
+	dummyPassword := make([]byte, 16)
+	if _, err := crand.Read(dummyPassword); err != nil {
+		return err
+	}
+	for _, version := range []int{passwordVersionPBKDF2, passwordVersionArgon2id} {
+		dummy := &User{}
+		dummy.PasswordVersion, dummy.Salt, dummy.HashedPassword, err = hashPasswordVersion(version, string(dummyPassword))
+		if err != nil {
+			return err
+		}
+		dummyUsers[version] = dummy
+	}
+
+	return nil
+}
+
+// hashPassword は、設定された方式でパスワードをハッシュ化し、users テーブルに保存する値を返します
+func hashPassword(password string) (version int, salt []byte, hashed []byte, err error) {
+	return hashPasswordVersion(passwordVersion, password)
+}
+
+func hashPasswordVersion(version int, password string) (int, []byte, []byte, error) {
+	switch version {
+	case passwordVersionPBKDF2:
+		salt := make([]byte, pbkdf2SaltLen)
+		if _, err := crand.Read(salt); err != nil {
+			return 0, nil, nil, err
+		}
+		return passwordVersionPBKDF2, salt, pbkdf2.Key([]byte(password), salt, pbkdf2Iterations, pbkdf2KeyLen, sha256.New), nil
+	case passwordVersionArgon2id:
+		argon2Salt := make([]byte, argon2SaltLen)
+		if _, err := crand.Read(argon2Salt); err != nil {
+			return 0, nil, nil, err
+		}
+		// saltはハッシュに含めるので、users.salt は空にする
+		return passwordVersionArgon2id, []byte{}, encodeArgon2id(password, argon2Salt, passwordArgon2), nil
+	default:
+		return 0, nil, nil, fmt.Errorf("unknown password version: %d", version)
+	}
+}
+
+// verifyLoginPassword は、ログインのパスワードを検証します. user が nil の場合はメールアドレスが登録されていない
+// ユーザのハッシュの方式以外はダミーのユーザを検証し、ユーザの有無や方式によらず全ての方式を1回ずつ計算する
+func verifyLoginPassword(user *User, password string) (ok bool, needsRehash bool, err error) {
+	for version, dummy := range dummyUsers {
+		if user != nil && version == user.PasswordVersion {
+			continue
+		}
+		if _, _, err := verifyPassword(dummy, password); err != nil {
+			return false, false, err
+		}
+	}
+	if user == nil {
+		return false, false, nil
+	}
+	return verifyPassword(user, password)
+}
+
+// verifyPassword は、パスワードを検証します
+// 検証に成功し、ハッシュが現在の設定と異なる方式やパラメータであれば、needsRehash を返します
+func verifyPassword(user *User, password string) (ok bool, needsRehash bool, err error) {
+	switch user.PasswordVersion {
+	case passwordVersionPBKDF2:
+		challenge := pbkdf2.Key([]byte(password), user.Salt, pbkdf2Iterations, pbkdf2KeyLen, sha256.New)
+		if !bytes.Equal(user.HashedPassword, challenge) {
+			return false, false, nil
+		}
+		return true, passwordVersion != passwordVersionPBKDF2, nil
+	case passwordVersionArgon2id:
+		params, salt, hash, err := decodeArgon2id(user.HashedPassword)
+		if err != nil {
+			return false, false, err
+		}
+		challenge := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(hash)))
+		if subtle.ConstantTimeCompare(hash, challenge) != 1 {
+			return false, false, nil
+		}
+		return true, passwordVersion != passwordVersionArgon2id || params != passwordArgon2, nil
+	default:
+		return false, false, fmt.Errorf("unknown password version: %d", user.PasswordVersion)
+	}
+}
+
+func encodeArgon2id(password string, salt []byte, params argon2Params) []byte {
+	hash := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, argon2KeyLen)
+	return []byte(fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.memory, params.time, params.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	))
+}
+
+func decodeArgon2id(encoded []byte) (params argon2Params, salt []byte, hash []byte, err error) {
+	parts := strings.Split(string(encoded), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+	hash, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(hash) == 0 {
+		return params, nil, nil, errInvalidPasswordHash
+	}
+
+	return params, salt, hash, nil
+}
+
+func rehashPassword(userID int64, password string) error {
+	version, salt, hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = dbx.Exec(
+		"UPDATE `users` SET `salt` = ?, `super_secure_password` = ?, `password_version` = ? WHERE `id` = ?",
+		salt,
+		hashed,
+		version,
+		userID,
+	)
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPasswordRehash(t *testing.T) {
+	defer func() {
+		passwordVersion = passwordVersionArgon2id
+		passwordArgon2 = argon2Costs["fast"]
+	}()
+
+	// 既存のPBKDF2のハッシュ
+	passwordVersion = passwordVersionPBKDF2
+	version, salt, hashed, err := hashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Salt: salt, HashedPassword: hashed, PasswordVersion: version}
+
+	passwordVersion = passwordVersionArgon2id
+	passwordArgon2 = argon2Costs["fast"]
+	if ok, _, _ := verifyPassword(user, "wrong"); ok {
+		t.Fatal("wrong password is accepted")
+	}
+	ok, needsRehash, err := verifyPassword(user, "password")
+	if err != nil || !ok || !needsRehash {
+		t.Fatalf("pbkdf2: ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	// argon2idで再計算する
+	version, salt, hashed, err = hashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user = &User{Salt: salt, HashedPassword: hashed, PasswordVersion: version}
+	if version != passwordVersionArgon2id || len(hashed) > 256 {
+		t.Fatalf("unexpected hash: version=%d hashed=%s", version, hashed)
+	}
+	if ok, _, _ := verifyPassword(user, "wrong"); ok {
+		t.Fatal("wrong password is accepted")
+	}
+	ok, needsRehash, err = verifyPassword(user, "password")
+	if err != nil || !ok || needsRehash {
+		t.Fatalf("argon2id: ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+
+	// パラメータを変更すると再計算する
+	passwordArgon2.time++
+	if _, needsRehash, _ := verifyPassword(user, "password"); !needsRehash {
+		t.Fatal("argon2id hash with old params should be rehashed")
+	}
+}
+
+func TestDecodeArgon2idInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$",
+	} {
+		if _, _, _, err := decodeArgon2id([]byte(encoded)); err != errInvalidPasswordHash {
+			t.Errorf("%q: err = %v", encoded, err)
+		}
+	}
+}
+
+func TestVerifyLoginPassword(t *testing.T) {
+	defer func() {
+		passwordVersion = passwordVersionArgon2id
+		passwordArgon2 = argon2Costs["fast"]
+	}()
+
+	os.Setenv("PASSWORD_HASH", "pbkdf2")
+	defer os.Unsetenv("PASSWORD_HASH")
+	if err := initPasswordHash(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 設定によらず、全ての方式のダミーのユーザを持つ
+	for _, version := range []int{passwordVersionPBKDF2, passwordVersionArgon2id} {
+		dummy, ok := dummyUsers[version]
+		if !ok || dummy.PasswordVersion != version {
+			t.Fatalf("dummy user for version %d: %+v", version, dummy)
+		}
+	}
+
+	// 存在しないメールアドレス
+	ok, _, err := verifyLoginPassword(nil, "")
+	if err != nil || ok {
+		t.Fatalf("unknown user: ok=%v err=%v", ok, err)
+	}
+
+	version, salt, hashed, err := hashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Salt: salt, HashedPassword: hashed, PasswordVersion: version}
+	if ok, _, _ := verifyLoginPassword(user, "wrong"); ok {
+		t.Fatal("wrong password is accepted")
+	}
+	if ok, needsRehash, err := verifyLoginPassword(user, "password"); err != nil || !ok || needsRehash {
+		t.Fatalf("pbkdf2: ok=%v needsRehash=%v err=%v", ok, needsRehash, err)
+	}
+}
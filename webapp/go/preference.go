@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+)
+
+/*
+	座席の希望 (あいまい予約のみ)
+
+	POST /api/train/reserve の preferences で指定する
+		"preferences": {
+			"window": true,      窓側 (指定席はA/E, プレミアム席はA/D)
+			"aisle": false,      通路側 (指定席はC/D, プレミアム席はB/C)
+			"near_exit": true,   出入口に近い席 (号車の最前列・最後列)
+			"car_from": 11,      号車の範囲 (0なら制限しない)
+			"car_to": 16,
+			"required": false    true なら window, aisle, near_exit を満たせない場合は予約しない
+		}
+	号車の範囲は常に守る. window, aisle, near_exit は required でなければ、満たす号車・座席を優先するだけ
+	レスポンスの preferences に、予約した全ての座席が満たした希望を返す
+*/
+
+type SeatPreferences struct {
+	Window   bool `json:"window"`
+	Aisle    bool `json:"aisle"`
+	NearExit bool `json:"near_exit"`
+	CarFrom  int  `json:"car_from"`
+	CarTo    int  `json:"car_to"`
+	Required bool `json:"required"`
+}
+
+type SatisfiedPreferences struct {
+	Window   bool `json:"window"`
+	Aisle    bool `json:"aisle"`
+	NearExit bool `json:"near_exit"`
+}
+
+// checkSeatPreferences は、座席の希望を検証し、エラーメッセージを返します. 正しければ空文字列を返します
+func checkSeatPreferences(p *SeatPreferences) string {
+	if p.Window && p.Aisle {
+		return "窓側と通路側は同時に指定できません"
+	}
+	if p.CarFrom < 0 || p.CarTo < 0 || p.CarFrom > 16 || p.CarTo > 16 {
+		return "号車の範囲が不正です"
+	}
+	if p.CarFrom > 0 && p.CarTo > 0 && p.CarFrom > p.CarTo {
+		return "号車の範囲が不正です"
+	}
+	return ""
+}
+
+func (p *SeatPreferences) inCarRange(carNumber int) bool {
+	if p.CarFrom > 0 && carNumber < p.CarFrom {
+		return false
+	}
+	if p.CarTo > 0 && carNumber > p.CarTo {
+		return false
+	}
+	return true
+}
+
+func isWindowSeat(seatClass, column string) bool {
+	if seatClass == "premium" {
+		return column == "A" || column == "D"
+	}
+	return column == "A" || column == "E"
+}
+
+func isAisleSeat(seatClass, column string) bool {
+	if seatClass == "premium" {
+		return column == "B" || column == "C"
+	}
+	return column == "C" || column == "D"
+}
+
+// satisfiedPreferences は、全ての座席が満たした希望を返します. 希望していない項目は false になります
+// firstRow, lastRow は号車の最前列・最後列です
+func (p *SeatPreferences) satisfiedPreferences(seatClass string, seats []RequestSeat, firstRow, lastRow int) *SatisfiedPreferences {
+	satisfied := &SatisfiedPreferences{
+		Window:   p.Window,
+		Aisle:    p.Aisle,
+		NearExit: p.NearExit,
+	}
+	for _, seat := range seats {
+		if !isWindowSeat(seatClass, seat.Column) {
+			satisfied.Window = false
+		}
+		if !isAisleSeat(seatClass, seat.Column) {
+			satisfied.Aisle = false
+		}
+		if seat.Row != firstRow && seat.Row != lastRow {
+			satisfied.NearExit = false
+		}
+	}
+	return satisfied
+}
+
+// satisfiesAll は、希望した項目を全て満たしたかを返します
+func (s *SatisfiedPreferences) satisfiesAll(p *SeatPreferences) bool {
+	return s.Window == p.Window && s.Aisle == p.Aisle && s.NearExit == p.NearExit
+}
+
+// pickPreferredSeats は、号車の座席から空いている n 席を、希望を多く満たす席から順に選びます
+// 同じ数の希望を満たす席は、行・列の順に選びます
+// 席が足りない場合や、required で全ての希望を満たす席が足りない場合は nil を返します
+func (p *SeatPreferences) pickPreferredSeats(seatClass string, seats []SeatInformation, n, firstRow, lastRow int) ([]RequestSeat, *SatisfiedPreferences) {
+	score := func(seat SeatInformation) int {
+		s := 0
+		if p.Window && isWindowSeat(seatClass, seat.Column) {
+			s++
+		}
+		if p.Aisle && isAisleSeat(seatClass, seat.Column) {
+			s++
+		}
+		if p.NearExit && (seat.Row == firstRow || seat.Row == lastRow) {
+			s++
+		}
+		return s
+	}
+	want := 0
+	for _, requested := range []bool{p.Window, p.Aisle, p.NearExit} {
+		if requested {
+			want++
+		}
+	}
+
+	free := []SeatInformation{}
+	for _, seat := range seats {
+		if seat.IsOccupied {
+			continue
+		}
+		if p.Required && score(seat) < want {
+			continue
+		}
+		free = append(free, seat)
+	}
+	if len(free) < n {
+		return nil, nil
+	}
+
+	sort.SliceStable(free, func(i, j int) bool {
+		return score(free[i]) > score(free[j])
+	})
+
+	picked := []RequestSeat{}
+	for _, seat := range free[:n] {
+		picked = append(picked, RequestSeat{Row: seat.Row, Column: seat.Column})
+	}
+	return picked, p.satisfiedPreferences(seatClass, picked, firstRow, lastRow)
+}
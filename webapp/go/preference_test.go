@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+)
+
+// 指定席 3列 (1〜3列目)
+func testCarSeats() []SeatInformation {
+	seats := []SeatInformation{}
+	for row := 1; row <= 3; row++ {
+		for _, column := range []string{"A", "B", "C", "D", "E"} {
+			seats = append(seats, SeatInformation{Row: row, Column: column, Class: "reserved"})
+		}
+	}
+	return seats
+}
+
+func occupy(seats []SeatInformation, occupied ...RequestSeat) []SeatInformation {
+	for i := range seats {
+		for _, o := range occupied {
+			if seats[i].Row == o.Row && seats[i].Column == o.Column {
+				seats[i].IsOccupied = true
+			}
+		}
+	}
+	return seats
+}
+
+func TestPickPreferredSeats(t *testing.T) {
+	// 窓側を優先する
+	p := &SeatPreferences{Window: true}
+	seats, satisfied := p.pickPreferredSeats("reserved", testCarSeats(), 2, 1, 3)
+	if len(seats) != 2 || seats[0] != (RequestSeat{Row: 1, Column: "A"}) || seats[1] != (RequestSeat{Row: 1, Column: "E"}) {
+		t.Fatalf("seats = %v, want [1A 1E]", seats)
+	}
+	if !satisfied.satisfiesAll(p) {
+		t.Fatalf("satisfied = %+v, want window", satisfied)
+	}
+
+	// 窓側が足りなければ、残りは窓側以外で埋める
+	seats, satisfied = p.pickPreferredSeats("reserved", occupy(testCarSeats(), RequestSeat{Row: 1, Column: "A"}, RequestSeat{Row: 2, Column: "A"}, RequestSeat{Row: 3, Column: "A"}, RequestSeat{Row: 2, Column: "E"}), 3, 1, 3)
+	if len(seats) != 3 || seats[0] != (RequestSeat{Row: 1, Column: "E"}) || seats[1] != (RequestSeat{Row: 3, Column: "E"}) {
+		t.Fatalf("seats = %v, want [1E 3E ...]", seats)
+	}
+	if satisfied.Window {
+		t.Fatalf("satisfied = %+v, want not window", satisfied)
+	}
+
+	// required なら、窓側が足りない場合は選ばない
+	p = &SeatPreferences{Window: true, Required: true}
+	if seats, _ := p.pickPreferredSeats("reserved", testCarSeats(), 7, 1, 3); seats != nil {
+		t.Fatalf("seats = %v, want nil", seats)
+	}
+
+	// プレミアム席の通路側はB/C
+	p = &SeatPreferences{Aisle: true, NearExit: true, Required: true}
+	premium := []SeatInformation{}
+	for _, seat := range testCarSeats() {
+		if seat.Column != "E" {
+			premium = append(premium, seat)
+		}
+	}
+	seats, satisfied = p.pickPreferredSeats("premium", occupy(premium, RequestSeat{Row: 1, Column: "B"}), 3, 1, 3)
+	if len(seats) != 3 || seats[0] != (RequestSeat{Row: 1, Column: "C"}) || seats[1] != (RequestSeat{Row: 3, Column: "B"}) || seats[2] != (RequestSeat{Row: 3, Column: "C"}) {
+		t.Fatalf("seats = %v, want [1C 3B 3C]", seats)
+	}
+	if !satisfied.satisfiesAll(p) {
+		t.Fatalf("satisfied = %+v, want aisle and near_exit", satisfied)
+	}
+}
+
+func TestCheckSeatPreferences(t *testing.T) {
+	tests := []struct {
+		p  SeatPreferences
+		ok bool
+	}{
+		{SeatPreferences{Window: true, CarFrom: 4, CarTo: 7}, true},
+		{SeatPreferences{CarFrom: 11}, true},
+		{SeatPreferences{Window: true, Aisle: true}, false},
+		{SeatPreferences{CarFrom: 7, CarTo: 4}, false},
+		{SeatPreferences{CarTo: 17}, false},
+	}
+	for _, tt := range tests {
+		if msg := checkSeatPreferences(&tt.p); (msg == "") != tt.ok {
+			t.Fatalf("%+v: %q, want ok=%t", tt.p, msg, tt.ok)
+		}
+	}
+
+	p := &SeatPreferences{CarFrom: 11}
+	if p.inCarRange(10) || !p.inCarRange(11) || !p.inCarRange(16) {
+		t.Fatalf("inCarRange is wrong for %+v", p)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+/*
+	ログインの試行制限
+
+	期間内のログイン失敗回数をIPアドレスごと、アカウントごとに数え、閾値に達したら一定期間ロックアウトする
+	ロックアウト中のログインには 429 と Retry-After を返す
+
+	LOGIN_LIMIT_STORE   memory (デフォルト) または mysql
+	LOGIN_LIMIT_ACCOUNT アカウントごとに許容する失敗回数 (デフォルト 5, 0で無効)
+	LOGIN_LIMIT_IP      IPアドレスごとに許容する失敗回数 (デフォルト 100, 0で無効)
+	LOGIN_LIMIT_WINDOW  失敗回数を数える期間 (秒, デフォルト 300)
+	LOGIN_LOCKOUT       ロックアウトする期間 (秒, デフォルト 300)
+	TRUSTED_PROXIES     X-Real-IP を信頼するプロキシのIPアドレス・CIDR (カンマ区切り)
+	                    デフォルトはループバックとプライベートアドレス (同じホスト・dockerネットワークのnginx)
+*/
+
+type loginLimiter interface {
+	// lockedUntil は、ロックアウトが解除される時刻を返します. ロックアウトされていなければゼロ値を返します
+	lockedUntil(key string, now time.Time) (time.Time, error)
+	// fail は、ログインの失敗を記録し、期間内の失敗回数がlimitに達したらロックアウトします
+	fail(key string, limit int, now time.Time) error
+	// reset は、ログインの失敗の記録を削除します
+	reset(key string) error
+	// clear は、全ての記録を削除します
+	clear() error
+}
+
+type loginLimitKey struct {
+	key   string
+	limit int
+}
+
+var (
+	limiter loginLimiter
+
+	loginLimitAccount = 5
+	loginLimitIP      = 100
+	loginLimitWindow  = 300 * time.Second
+	loginLockout      = 300 * time.Second
+
+	trustedProxies = mustParseCIDRs("127.0.0.0/8,::1/128,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16")
+)
+
+func parseCIDRs(v string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func mustParseCIDRs(v string) []*net.IPNet {
+	nets, err := parseCIDRs(v)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+func envInt(name string, defaultValue int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return i, nil
+}
+
+func newLoginLimiter() (loginLimiter, error) {
+	var err error
+	if loginLimitAccount, err = envInt("LOGIN_LIMIT_ACCOUNT", loginLimitAccount); err != nil {
+		return nil, err
+	}
+	if loginLimitIP, err = envInt("LOGIN_LIMIT_IP", loginLimitIP); err != nil {
+		return nil, err
+	}
+	window, err := envInt("LOGIN_LIMIT_WINDOW", int(loginLimitWindow/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	loginLimitWindow = time.Duration(window) * time.Second
+	lockout, err := envInt("LOGIN_LOCKOUT", int(loginLockout/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	loginLockout = time.Duration(lockout) * time.Second
+
+	if v, ok := os.LookupEnv("TRUSTED_PROXIES"); ok {
+		if trustedProxies, err = parseCIDRs(v); err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %s", v)
+		}
+	}
+
+	switch os.Getenv("LOGIN_LIMIT_STORE") {
+	case "", "memory":
+		return newMemoryLoginLimiter(loginLimitWindow, loginLockout), nil
+	case "mysql":
+		return &mysqlLoginLimiter{window: loginLimitWindow, lockout: loginLockout}, nil
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_LIMIT_STORE: %s", os.Getenv("LOGIN_LIMIT_STORE"))
+	}
+}
+
+// clientIP は、リクエスト元のIPアドレスを返します
+// 信頼するプロキシ (nginx) からのリクエストに限り、プロキシが設定する X-Real-IP を用います
+// それ以外では、クライアントが X-Real-IP を偽装してIPアドレスごとの制限を回避できてしまう
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	realIP := r.Header.Get("X-Real-IP")
+	if realIP == "" {
+		return host
+	}
+	remote := net.ParseIP(host)
+	if remote == nil {
+		return host
+	}
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(remote) {
+			return realIP
+		}
+	}
+	return host
+}
+
+// loginLimitKeys は、ログインの試行制限に使うキーと、そのうちログイン成功時にリセットするアカウントのキーを返します
+func loginLimitKeys(r *http.Request, email string) (keys []loginLimitKey, accountKey string) {
+	accountKey = "account:" + email
+	keys = []loginLimitKey{
+		{key: "ip:" + clientIP(r), limit: loginLimitIP},
+		{key: accountKey, limit: loginLimitAccount},
+	}
+	return keys, accountKey
+}
+
+// reauthLimitKeys は、ログイン中のユーザの再認証の試行制限に使うキーを返します
+// IPアドレスのキーに数えると、同じIPアドレスの他のユーザのログインまで制限してしまうので、アカウントのキーのみを使います
+func reauthLimitKeys(email string) []loginLimitKey {
+	return []loginLimitKey{{key: "account:" + email, limit: loginLimitAccount}}
+}
+
+// checkLoginLimit は、いずれかのキーがロックアウト中であれば、再試行できるまでの秒数を返します
+func checkLoginLimit(keys []loginLimitKey, now time.Time) (int, error) {
+	retryAfter := 0
+	for _, k := range keys {
+		if k.limit == 0 {
+			continue
+		}
+		until, err := limiter.lockedUntil(k.key, now)
+		if err != nil {
+			return 0, err
+		}
+		if until.IsZero() {
+			continue
+		}
+		if sec := int(math.Ceil(until.Sub(now).Seconds())); sec > retryAfter {
+			retryAfter = sec
+		}
+	}
+	return retryAfter, nil
+}
+
+func failLogin(keys []loginLimitKey, now time.Time) error {
+	for _, k := range keys {
+		if k.limit == 0 {
+			continue
+		}
+		if err := limiter.fail(k.key, k.limit, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tooManyRequestsResponse(w http.ResponseWriter, retryAfter int) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	errorResponse(w, http.StatusTooManyRequests, "too many login attempts")
+}
+
+// memoryLoginLimiter は、プロセス内で失敗を記録します
+type memoryLoginLimiter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	lockout  time.Duration
+	attempts map[string]*loginAttempts
+}
+
+type loginAttempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+func newMemoryLoginLimiter(window, lockout time.Duration) *memoryLoginLimiter {
+	return &memoryLoginLimiter{
+		window:   window,
+		lockout:  lockout,
+		attempts: map[string]*loginAttempts{},
+	}
+}
+
+// prune は、期間外の失敗と解除済みのロックアウトを削除します
+func (l *memoryLoginLimiter) prune(key string, now time.Time) *loginAttempts {
+	a, ok := l.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	failures := a.failures[:0]
+	for _, failedAt := range a.failures {
+		if now.Sub(failedAt) < l.window {
+			failures = append(failures, failedAt)
+		}
+	}
+	a.failures = failures
+	if !a.lockedUntil.After(now) {
+		a.lockedUntil = time.Time{}
+	}
+
+	if len(a.failures) == 0 && a.lockedUntil.IsZero() {
+		delete(l.attempts, key)
+		return nil
+	}
+	return a
+}
+
+func (l *memoryLoginLimiter) lockedUntil(key string, now time.Time) (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a := l.prune(key, now)
+	if a == nil {
+		return time.Time{}, nil
+	}
+	return a.lockedUntil, nil
+}
+
+func (l *memoryLoginLimiter) fail(key string, limit int, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a := l.prune(key, now)
+	if a == nil {
+		a = &loginAttempts{}
+		l.attempts[key] = a
+	}
+	a.failures = append(a.failures, now)
+	if len(a.failures) >= limit {
+		a.failures = nil
+		a.lockedUntil = now.Add(l.lockout)
+	}
+	return nil
+}
+
+func (l *memoryLoginLimiter) reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if a, ok := l.attempts[key]; ok {
+		a.failures = nil
+	}
+	return nil
+}
+
+func (l *memoryLoginLimiter) clear() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.attempts = map[string]*loginAttempts{}
+	return nil
+}
+
+// mysqlLoginLimiter は、login_failures, login_lockouts テーブルに失敗を記録します
+// 複数のwebappで制限を共有できます
+type mysqlLoginLimiter struct {
+	window  time.Duration
+	lockout time.Duration
+}
+
+func (l *mysqlLoginLimiter) lockedUntil(key string, now time.Time) (time.Time, error) {
+	var until time.Time
+	err := dbx.Get(&until, "SELECT `locked_until` FROM `login_lockouts` WHERE `limit_key` = ? AND `locked_until` > ?", key, now)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+func (l *mysqlLoginLimiter) fail(key string, limit int, now time.Time) error {
+	tx := dbx.MustBegin()
+
+	if err := l.failTx(tx, key, limit, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (l *mysqlLoginLimiter) failTx(tx *sqlx.Tx, key string, limit int, now time.Time) error {
+	// 期間外の失敗は数えないので、ついでに削除する
+	_, err := tx.Exec("DELETE FROM `login_failures` WHERE `limit_key` = ? AND `failed_at` <= ?", key, now.Add(-l.window))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO `login_failures` (`limit_key`, `failed_at`) VALUES (?, ?)", key, now)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.Get(&count, "SELECT COUNT(*) FROM `login_failures` WHERE `limit_key` = ? AND `failed_at` > ?", key, now.Add(-l.window))
+	if err != nil {
+		return err
+	}
+	if count < limit {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO `login_lockouts` (`limit_key`, `locked_until`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `locked_until` = VALUES(`locked_until`)",
+		key,
+		now.Add(l.lockout),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM `login_failures` WHERE `limit_key` = ?", key)
+	return err
+}
+
+func (l *mysqlLoginLimiter) reset(key string) error {
+	_, err := dbx.Exec("DELETE FROM `login_failures` WHERE `limit_key` = ?", key)
+	return err
+}
+
+func (l *mysqlLoginLimiter) clear() error {
+	if _, err := dbx.Exec("TRUNCATE login_failures"); err != nil {
+		return err
+	}
+	_, err := dbx.Exec("TRUNCATE login_lockouts")
+	return err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryLoginLimiter(t *testing.T) {
+	l := newMemoryLoginLimiter(time.Minute, 5*time.Minute)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		l.fail("account:a", 3, now.Add(time.Duration(i)*time.Second))
+	}
+	if until, _ := l.lockedUntil("account:a", now); !until.IsZero() {
+		t.Fatalf("locked before limit: %v", until)
+	}
+
+	// 期間外の失敗は数えない
+	l.fail("account:a", 3, now.Add(2*time.Minute))
+	if until, _ := l.lockedUntil("account:a", now.Add(2*time.Minute)); !until.IsZero() {
+		t.Fatalf("locked by expired failures: %v", until)
+	}
+
+	l.fail("account:a", 3, now.Add(2*time.Minute+time.Second))
+	l.fail("account:a", 3, now.Add(2*time.Minute+2*time.Second))
+	until, _ := l.lockedUntil("account:a", now.Add(3*time.Minute))
+	if want := now.Add(7*time.Minute + 2*time.Second); !until.Equal(want) {
+		t.Fatalf("lockedUntil = %v, want %v", until, want)
+	}
+	if until, _ := l.lockedUntil("account:b", now.Add(3*time.Minute)); !until.IsZero() {
+		t.Fatalf("other key is locked: %v", until)
+	}
+
+	// ロックアウトは期間が過ぎれば解除される
+	if until, _ := l.lockedUntil("account:a", now.Add(8*time.Minute)); !until.IsZero() {
+		t.Fatalf("lockout is not released: %v", until)
+	}
+	if len(l.attempts) != 0 {
+		t.Fatalf("attempts are not pruned: %d", len(l.attempts))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		// 信頼するプロキシ以外からの X-Real-IP は無視する
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"127.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"172.18.0.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"[::1]:1234", "198.51.100.1", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(r); got != tt.want {
+			t.Fatalf("clientIP(%s, %q) = %s, want %s", tt.remoteAddr, tt.realIP, got, tt.want)
+		}
+	}
+
+	nets, err := parseCIDRs("192.0.2.1, 2001:db8::/32")
+	if err != nil || len(nets) != 2 || !nets[0].Contains(net.ParseIP("192.0.2.1")) || nets[0].Contains(net.ParseIP("192.0.2.2")) {
+		t.Fatalf("parseCIDRs = %v, %v", nets, err)
+	}
+}
+
+func TestReauthenticateLimit(t *testing.T) {
+	defer func(l loginLimiter, ipLimit int) {
+		limiter, loginLimitIP = l, ipLimit
+		passwordVersion = passwordVersionArgon2id
+	}(limiter, loginLimitIP)
+	limiter = newMemoryLoginLimiter(time.Minute, 5*time.Minute)
+	loginLimitIP = 1
+
+	passwordVersion = passwordVersionPBKDF2
+	version, salt, hashed, err := hashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Email: "a@example.com", Salt: salt, HashedPassword: hashed, PasswordVersion: version}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/user/password", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	if reauthenticate(w, r, user, "wrong") || w.Code != http.StatusForbidden {
+		t.Fatalf("reauthenticate with wrong password: code=%d", w.Code)
+	}
+
+	// 再認証の失敗は、同じIPアドレスからの他のユーザのログインを制限しない
+	keys, _ := loginLimitKeys(r, "b@example.com")
+	if retryAfter, err := checkLoginLimit(keys, time.Now()); err != nil || retryAfter != 0 {
+		t.Fatalf("login from same ip is limited: retryAfter=%d err=%v", retryAfter, err)
+	}
+	if retryAfter, err := checkLoginLimit(reauthLimitKeys(user.Email), time.Now()); err != nil || retryAfter != 0 {
+		t.Fatalf("account is locked out after one failure: retryAfter=%d err=%v", retryAfter, err)
+	}
+}
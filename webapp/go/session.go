@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+/*
+	セッションストア
+
+	SESSION_STORE   cookie (デフォルト) または mysql
+	SESSION_KEYS    セッションの署名に使う鍵 (カンマ区切り)
+	                先頭の鍵で署名し、残りの鍵は検証にのみ使うので、鍵を先頭に追加していけばローテーションできる
+	                未指定の場合は起動時に生成するので、再起動すると全員ログアウトされる
+	SESSION_MAX_AGE セッションの有効期限 (秒)
+*/
+
+const (
+	defaultSessionMaxAge = 86400 * 30
+	sessionGCInterval    = 10 * time.Minute
+)
+
+func newSessionStore() (sessions.Store, error) {
+	keyPairs := [][]byte{}
+	for _, key := range strings.Split(os.Getenv("SESSION_KEYS"), ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		// 暗号化はせず、署名のみ行う
+		keyPairs = append(keyPairs, []byte(key), nil)
+	}
+	if len(keyPairs) == 0 {
+		log.Print("SESSION_KEYS is not set, sessions will be lost on restart")
+		keyPairs = append(keyPairs, []byte(secureRandomStr(20)), nil)
+	}
+
+	maxAge := defaultSessionMaxAge
+	if v := os.Getenv("SESSION_MAX_AGE"); v != "" {
+		var err error
+		maxAge, err = strconv.Atoi(v)
+		if err != nil || maxAge <= 0 {
+			return nil, fmt.Errorf("invalid SESSION_MAX_AGE: %s", v)
+		}
+	}
+
+	switch os.Getenv("SESSION_STORE") {
+	case "", "cookie":
+		store := sessions.NewCookieStore(keyPairs...)
+		store.MaxAge(maxAge)
+		return store, nil
+	case "mysql":
+		store := newMySQLSessionStore(maxAge, keyPairs...)
+		go store.gc(sessionGCInterval)
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown SESSION_STORE: %s", os.Getenv("SESSION_STORE"))
+	}
+}
+
+// revokeSession は、セッションを無効にします
+// mysqlストアではセッションを削除するので、cookieを保存していても再利用できません
+// cookieストアでは、ブラウザのcookieを削除するだけです
+func revokeSession(w http.ResponseWriter, r *http.Request) error {
+	session := getSession(r)
+	session.Values = map[interface{}]interface{}{}
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+// renewSessionID は、ログイン時にセッションIDを新しくします
+// ログイン前から使われているセッションIDが、そのまま認証済みになること (セッション固定攻撃) を防ぐ
+// mysqlストアでは古いセッションを削除します. cookieストアはcookieがセッションそのものなので何もしません
+// NOTE: セッションの保存は呼び出し側で行う
+func renewSessionID(session *sessions.Session) error {
+	if _, ok := store.(*mysqlSessionStore); !ok {
+		return nil
+	}
+	if session.ID != "" {
+		if _, err := dbx.Exec("DELETE FROM `sessions` WHERE `id` = ?", session.ID); err != nil {
+			return err
+		}
+	}
+	session.ID = secureRandomStr(32)
+	return nil
+}
+
+// mysqlSessionStore は、ログイン済みのセッションを sessions テーブルに保存します
+// cookieには署名したセッションIDのみを保存するので、複数のwebappで共有できます
+// 未ログインのセッションは、CSRFトークンを発行した場合のみ user_id を NULL にして保存する
+// トークンを発行するのは GET /api/auth のみなので、それ以外の未ログインのリクエストではテーブルに書き込まない
+type mysqlSessionStore struct {
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+func newMySQLSessionStore(maxAge int, keyPairs ...[]byte) *mysqlSessionStore {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(maxAge)
+		}
+	}
+	return &mysqlSessionStore{
+		Codecs: codecs,
+		Options: &sessions.Options{
+			Path:   "/",
+			MaxAge: maxAge,
+		},
+	}
+}
+
+func (s *mysqlSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *mysqlSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	if err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	var data []byte
+	err = dbx.Get(&data, "SELECT `data` FROM `sessions` WHERE `id` = ? AND `expires_at` > ?", session.ID, time.Now())
+	if err == sql.ErrNoRows {
+		// 期限切れか、ログアウト済み
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := (securecookie.GobEncoder{}).Deserialize(data, &session.Values); err != nil {
+		return session, err
+	}
+	session.IsNew = false
+
+	return session, nil
+}
+
+func (s *mysqlSessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := dbx.Exec("DELETE FROM `sessions` WHERE `id` = ?", session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	userID, ok := session.Values["user_id"]
+	if !ok {
+		userID = nil
+	}
+	if _, hasToken := session.Values[csrfSessionKey]; !ok && !hasToken {
+		// CSRFトークンも持たない未ログインのセッションは保存しない
+		if session.ID != "" {
+			if _, err := dbx.Exec("DELETE FROM `sessions` WHERE `id` = ?", session.ID); err != nil {
+				return err
+			}
+			session.ID = ""
+			http.SetCookie(w, sessions.NewCookie(session.Name(), "", &sessions.Options{Path: session.Options.Path, MaxAge: -1}))
+		}
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = secureRandomStr(32)
+	}
+	data, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+
+	_, err = dbx.Exec(
+		"INSERT INTO `sessions` (`id`, `user_id`, `data`, `expires_at`) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE `user_id` = VALUES(`user_id`), `data` = VALUES(`data`), `expires_at` = VALUES(`expires_at`)",
+		session.ID,
+		userID,
+		data,
+		expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// gc は、期限切れのセッションを定期的に削除します
+func (s *mysqlSessionStore) gc(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := dbx.Exec("DELETE FROM `sessions` WHERE `expires_at` <= ?", time.Now()); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// revokeOtherSessions は、現在のセッション以外のユーザのセッションを無効にします
+// mysqlストアのみ対応しており、cookieストアでは何もしません
+func revokeOtherSessions(r *http.Request, userID int64) error {
+	if _, ok := store.(*mysqlSessionStore); !ok {
+		return nil
+	}
+	session := getSession(r)
+	_, err := dbx.Exec("DELETE FROM `sessions` WHERE `user_id` = ? AND `id` <> ?", userID, session.ID)
+	return err
+}
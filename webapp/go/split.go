@@ -0,0 +1,51 @@
+package main
+
+/*
+	号車をまたぐあいまい予約
+
+	POST /api/train/reserve で "allow_split": true を指定すると、1つの号車にまとめて予約できない人数を
+	同じ座席クラスの隣り合う号車に分けて予約する
+	予約は1つのままで、座席ごとに号車が異なる (seat_reservations.car_number)
+	1つの号車にまとめて予約できる場合は、これまで通り1つの号車で予約する
+*/
+
+// splitSeats は、隣り合う号車に分けて n 席を選びます
+// cars は座席クラスが一致する号車ごとの空席で、空席がなくても座席クラスが一致する号車は含めること
+// 号車の数が最も少なく、同じなら号車番号が小さい連続した号車を選び、前の号車から順に席を埋めます
+// 席が足りない場合は nil を返します
+func splitSeats(cars map[int][]RequestSeat, n int) []RequestSeat {
+	bestFrom, bestTo := 0, 0
+	for from := 1; from <= 16; from++ {
+		free := 0
+		for to := from; to <= 16; to++ {
+			seats, ok := cars[to]
+			if !ok {
+				// 座席クラスの異なる号車をまたがない
+				break
+			}
+			free += len(seats)
+			if free < n {
+				continue
+			}
+			if bestFrom == 0 || to-from < bestTo-bestFrom {
+				bestFrom, bestTo = from, to
+			}
+			break
+		}
+	}
+	if bestFrom == 0 {
+		return nil
+	}
+
+	picked := []RequestSeat{}
+	for carNumber := bestFrom; carNumber <= bestTo; carNumber++ {
+		for _, seat := range cars[carNumber] {
+			if len(picked) == n {
+				break
+			}
+			seat.CarNumber = carNumber
+			picked = append(picked, seat)
+		}
+	}
+	return picked
+}
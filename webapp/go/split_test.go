@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testFreeSeats(n int) []RequestSeat {
+	seats := []RequestSeat{}
+	for row := 1; row <= n; row++ {
+		seats = append(seats, RequestSeat{Row: row, Column: "A"})
+	}
+	return seats
+}
+
+func seatCars(seats []RequestSeat) string {
+	s := ""
+	for _, seat := range seats {
+		s += fmt.Sprintf("%d-%d%s ", seat.CarNumber, seat.Row, seat.Column)
+	}
+	return s
+}
+
+func TestSplitSeats(t *testing.T) {
+	// 8〜10号車が同じ座席クラス
+	cars := map[int][]RequestSeat{
+		8:  testFreeSeats(2),
+		9:  testFreeSeats(1),
+		10: testFreeSeats(2),
+	}
+
+	// 前の号車から順に埋める
+	if got := seatCars(splitSeats(cars, 3)); got != "8-1A 8-2A 9-1A " {
+		t.Fatalf("seats = %q, want 8-1A 8-2A 9-1A", got)
+	}
+	if got := seatCars(splitSeats(cars, 5)); got != "8-1A 8-2A 9-1A 10-1A 10-2A " {
+		t.Fatalf("seats = %q, want 8-1A 8-2A 9-1A 10-1A 10-2A", got)
+	}
+	if seats := splitSeats(cars, 6); seats != nil {
+		t.Fatalf("seats = %v, want nil", seats)
+	}
+
+	// 号車の数が少ない組み合わせを優先する
+	cars = map[int][]RequestSeat{
+		8:  testFreeSeats(1),
+		9:  testFreeSeats(1),
+		10: testFreeSeats(2),
+		11: testFreeSeats(2),
+	}
+	if got := seatCars(splitSeats(cars, 4)); got != "10-1A 10-2A 11-1A 11-2A " {
+		t.Fatalf("seats = %q, want 10-1A 10-2A 11-1A 11-2A", got)
+	}
+
+	// 座席クラスの異なる号車をまたがない
+	cars = map[int][]RequestSeat{
+		6:  testFreeSeats(2),
+		7:  {},
+		11: testFreeSeats(2),
+	}
+	if got := seatCars(splitSeats(cars, 2)); got != "6-1A 6-2A " {
+		t.Fatalf("seats = %q, want 6-1A 6-2A", got)
+	}
+	if seats := splitSeats(cars, 3); seats != nil {
+		t.Fatalf("seats = %v, want nil", seats)
+	}
+}
@@ -78,17 +78,21 @@ func (train Train) getAvailableSeats(fromStation Station, toStation Station, sea
 		s.seat_column=sr.seat_column AND
 		s.seat_row=sr.seat_row AND
 		std.name=r.departure AND
-		sta.name=r.arrival
+		sta.name=r.arrival AND
+		r.date=? AND
+		r.train_class=? AND
+		r.train_name=?
 	`
 
+	// 乗車区間と重なる予約のみ
 	if train.IsNobori {
-		query += "AND ((sta.id < ? AND ? <= std.id) OR (sta.id < ? AND ? <= std.id) OR (? < sta.id AND std.id < ?))"
+		query += "AND ? < std.id AND sta.id < ?"
 	} else {
-		query += "AND ((std.id <= ? AND ? < sta.id) OR (std.id <= ? AND ? < sta.id) OR (sta.id < ? AND ? < std.id))"
+		query += "AND std.id < ? AND ? < sta.id"
 	}
 
 	seatReservationList := []SeatReservation{}
-	err = dbx.Select(&seatReservationList, query, fromStation.ID, fromStation.ID, toStation.ID, toStation.ID, fromStation.ID, toStation.ID)
+	err = dbx.Select(&seatReservationList, query, train.Date.Format("2006/01/02"), train.TrainClass, train.TrainName, toStation.ID, fromStation.ID)
 	if err != nil {
 		return nil, err
 	}
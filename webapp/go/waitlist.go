@@ -0,0 +1,701 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"goji.io/pat"
+)
+
+/*
+	キャンセル待ち
+
+	POST /api/train/waitlist                        満席の列車のキャンセル待ちを登録する
+	GET  /api/user/waitlist                         ログイン中のユーザのキャンセル待ちの一覧
+	POST /api/user/waitlist/:waitlist_id/cancel     キャンセル待ちを取り消す
+
+	予約のキャンセルや退会で座席が空くと、同じ列車のキャンセル待ちを登録順に調べ、
+	座席を確保できたものを requesting の予約にする (繰り上げ)
+	繰り上げた予約は予約一覧に表示され、キャンセル待ちの一覧にも予約IDが表示される
+	人数が多く座席を確保できないキャンセル待ちは飛ばし、後ろのキャンセル待ちを先に繰り上げる
+
+	繰り上げた予約を WAITLIST_HOLD 秒以内に確定しない場合は、予約を削除してキャンセル待ちを期限切れ (expired) にし、
+	空いた座席を次のキャンセル待ちに繰り上げる
+	NOTE: 繰り上げの通知はしない. メールなどの送信先を持たないので、利用者は予約一覧かキャンセル待ちの一覧で確認する
+*/
+
+const (
+	waitlistStatusWaiting   = "waiting"
+	waitlistStatusPromoted  = "promoted"
+	waitlistStatusCancelled = "cancelled"
+	waitlistStatusExpired   = "expired"
+)
+
+// 期限切れの繰り上げを解放する間隔
+const waitlistHoldGCInterval = time.Minute
+
+var (
+	// 繰り上げた予約を確定するまでの期限. 0なら期限切れにしない
+	waitlistHold = 10 * time.Minute
+)
+
+type WaitlistEntry struct {
+	ID            int64         `db:"id"`
+	UserID        int64         `db:"user_id"`
+	Date          time.Time     `db:"date"`
+	TrainClass    string        `db:"train_class"`
+	TrainName     string        `db:"train_name"`
+	Departure     string        `db:"departure"`
+	Arrival       string        `db:"arrival"`
+	SeatClass     string        `db:"seat_class"`
+	IsSmokingSeat bool          `db:"is_smoking_seat"`
+	Adult         int           `db:"adult"`
+	Child         int           `db:"child"`
+	Status        string        `db:"status"`
+	ReservationID sql.NullInt64 `db:"reservation_id"`
+	CreatedAt     time.Time     `db:"created_at"`
+	UpdatedAt     time.Time     `db:"updated_at"`
+}
+
+type WaitlistRequest struct {
+	Date          string `json:"date"`
+	TrainName     string `json:"train_name"`
+	TrainClass    string `json:"train_class"`
+	IsSmokingSeat bool   `json:"is_smoking_seat"`
+	SeatClass     string `json:"seat_class"`
+	Departure     string `json:"departure"`
+	Arrival       string `json:"arrival"`
+	Child         int    `json:"child"`
+	Adult         int    `json:"adult"`
+}
+
+type WaitlistResponse struct {
+	WaitlistID    int64  `json:"waitlist_id"`
+	Date          string `json:"date"`
+	TrainClass    string `json:"train_class"`
+	TrainName     string `json:"train_name"`
+	Departure     string `json:"departure"`
+	Arrival       string `json:"arrival"`
+	SeatClass     string `json:"seat_class"`
+	IsSmokingSeat bool   `json:"is_smoking_seat"`
+	Adult         int    `json:"adult"`
+	Child         int    `json:"child"`
+	Status        string `json:"status"`
+	// 待ち順 (waitingのみ. 同じ列車のキャンセル待ちのうち何番目か)
+	Position int `json:"position,omitempty"`
+	// 繰り上げられた予約 (promotedのみ)
+	ReservationID int64 `json:"reservation_id,omitempty"`
+}
+
+// waitlistOccupiedSeat は、予約済みの座席と、その予約の乗車区間です
+type waitlistOccupiedSeat struct {
+	Departure  string `db:"departure"`
+	Arrival    string `db:"arrival"`
+	CarNumber  int    `db:"car_number"`
+	SeatRow    int    `db:"seat_row"`
+	SeatColumn string `db:"seat_column"`
+}
+
+// waitlistAssignment は、繰り上げるキャンセル待ちと確保した座席です
+type waitlistAssignment struct {
+	Entry     WaitlistEntry
+	CarNumber int
+	Seats     []Seat
+}
+
+// initWaitlist は、繰り上げた予約の確定期限を環境変数から設定し、期限切れの繰り上げを解放するgoroutineを起動します
+func initWaitlist() error {
+	hold, err := envInt("WAITLIST_HOLD", int(waitlistHold/time.Second))
+	if err != nil {
+		return err
+	}
+	waitlistHold = time.Duration(hold) * time.Second
+	if waitlistHold > 0 {
+		go waitlistHoldGC(waitlistHoldGCInterval)
+	}
+	return nil
+}
+
+// waitlistHoldGC は、確定期限を過ぎた繰り上げのある列車を定期的に調べ、座席を次のキャンセル待ちに繰り上げます
+// 予約のキャンセルやキャンセル待ちの登録がない列車でも、期限切れの座席を解放するため
+func waitlistHoldGC(interval time.Duration) {
+	for range time.Tick(interval) {
+		trains := []Train{}
+		err := dbx.Select(
+			&trains,
+			"SELECT DISTINCT w.`date`, w.`train_class`, w.`train_name` FROM `waitlist` w JOIN `reservations` r ON r.`reservation_id` = w.`reservation_id` "+
+				"WHERE w.`status` = ? AND r.`status` = ? AND w.`updated_at` < NOW(6) - INTERVAL ? SECOND",
+			waitlistStatusPromoted, "requesting", int(waitlistHold/time.Second),
+		)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		for _, train := range trains {
+			if _, err := promoteWaitlist(train.Date, train.TrainClass, train.TrainName); err != nil {
+				log.Printf("failed to promote waitlist (%s/%s/%s): %s", train.Date.Format("2006/01/02"), train.TrainClass, train.TrainName, err)
+			}
+		}
+	}
+}
+
+func registerWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		キャンセル待ちの登録
+		POST /api/train/waitlist
+
+		予約と同じ形式で列車・区間・座席クラス・人数を指定する (座席・号車は指定できない)
+		登録した時点で座席が空いていれば、すぐに繰り上げる
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+
+	req := WaitlistRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, http.StatusBadRequest, "JSON parseに失敗しました")
+		return
+	}
+
+	jst := time.FixedZone("Asia/Tokyo", 9*60*60)
+	date, err := time.Parse(time.RFC3339, req.Date)
+	if err != nil {
+		errorResponse(w, http.StatusBadRequest, "時刻のparseに失敗しました")
+		return
+	}
+	date = date.In(jst)
+	if !checkAvailableDate(date) {
+		errorResponse(w, http.StatusNotFound, "予約可能期間外です")
+		return
+	}
+
+	switch req.SeatClass {
+	case "premium", "reserved":
+	case "non-reserved":
+		errorResponse(w, http.StatusBadRequest, "自由席はキャンセル待ちできません")
+		return
+	default:
+		errorResponse(w, http.StatusBadRequest, "リクエストされた座席クラスが不明です")
+		return
+	}
+	if req.Adult < 0 || req.Child < 0 || req.Adult+req.Child <= 0 {
+		errorResponse(w, http.StatusBadRequest, "人数が不正です")
+		return
+	}
+
+	train := Train{}
+	err = dbx.Get(
+		&train,
+		"SELECT * FROM `train_master` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ?",
+		date.Format("2006/01/02"), req.TrainClass, req.TrainName,
+	)
+	if err == sql.ErrNoRows {
+		errorResponse(w, http.StatusNotFound, "列車データがみつかりません")
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "列車データの取得に失敗しました")
+		return
+	}
+
+	operation, err := getTrainOperation(dbx, date, req.TrainClass, req.TrainName)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "運行情報の取得に失敗しました")
+		return
+	}
+	if status, _ := trainStatus(operation); status == trainStatusCancelled {
+		errorResponse(w, http.StatusBadRequest, "運休のためキャンセル待ちできません")
+		return
+	}
+
+	stations, err := getStationsByName(dbx)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "駅データの取得に失敗しました")
+		return
+	}
+	if msg := checkWaitlistSection(train, stations, req.Departure, req.Arrival); msg != "" {
+		errorResponse(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	result, err := dbx.Exec(
+		"INSERT INTO `waitlist` (`user_id`, `date`, `train_class`, `train_name`, `departure`, `arrival`, `seat_class`, `is_smoking_seat`, `adult`, `child`, `status`, `created_at`, `updated_at`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(6), NOW(6))",
+		user.ID, date.Format("2006/01/02"), req.TrainClass, req.TrainName, req.Departure, req.Arrival,
+		req.SeatClass, req.IsSmokingSeat, req.Adult, req.Child, waitlistStatusWaiting,
+	)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "キャンセル待ちの登録に失敗しました")
+		return
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "キャンセル待ちの登録に失敗しました")
+		return
+	}
+
+	// 既に座席が空いていれば繰り上げる. 失敗しても次のキャンセルで繰り上がるので、登録は成功とする
+	if _, err := promoteWaitlist(date, req.TrainClass, req.TrainName); err != nil {
+		log.Print(err)
+	}
+
+	entry := WaitlistEntry{}
+	if err := dbx.Get(&entry, "SELECT * FROM `waitlist` WHERE `id` = ?", id); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "キャンセル待ちの取得に失敗しました")
+		return
+	}
+	resp, err := makeWaitlistResponse(entry)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "キャンセル待ちの取得に失敗しました")
+		return
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "JSON marshal error")
+		return
+	}
+	w.Write(j)
+}
+
+func userWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		キャンセル待ちの一覧
+		GET /api/user/waitlist
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+
+	entries := []WaitlistEntry{}
+	if err := dbx.Select(&entries, "SELECT * FROM `waitlist` WHERE `user_id` = ? ORDER BY `id`", user.ID); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	list := []WaitlistResponse{}
+	for _, entry := range entries {
+		resp, err := makeWaitlistResponse(entry)
+		if err != nil {
+			log.Print(err)
+			errorResponse(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		list = append(list, resp)
+	}
+
+	j, err := json.Marshal(list)
+	if err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "JSON marshal error")
+		return
+	}
+	w.Write(j)
+}
+
+func cancelWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	/*
+		キャンセル待ちの取り消し
+		POST /api/user/waitlist/:waitlist_id/cancel
+
+		繰り上げ済みの場合は、予約をキャンセルすること
+	*/
+
+	user, errCode, errMsg := getUser(r)
+	if errCode != http.StatusOK {
+		errorResponse(w, errCode, errMsg)
+		return
+	}
+	id, err := strconv.ParseInt(pat.Param(r, "waitlist_id"), 10, 64)
+	if err != nil || id <= 0 {
+		errorResponse(w, http.StatusBadRequest, "incorrect waitlist id")
+		return
+	}
+
+	tx := dbx.MustBegin()
+
+	entry := WaitlistEntry{}
+	err = tx.Get(&entry, "SELECT * FROM `waitlist` WHERE `id` = ? AND `user_id` = ? FOR UPDATE", id, user.ID)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		errorResponse(w, http.StatusNotFound, "キャンセル待ちがみつかりません")
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if entry.Status != waitlistStatusWaiting {
+		tx.Rollback()
+		errorResponse(w, http.StatusBadRequest, fmt.Sprintf("キャンセル待ちは既に%sです", entry.Status))
+		return
+	}
+
+	_, err = tx.Exec("UPDATE `waitlist` SET `status` = ?, `updated_at` = NOW(6) WHERE `id` = ?", waitlistStatusCancelled, id)
+	if err != nil {
+		tx.Rollback()
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Print(err)
+		errorResponse(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	messageResponse(w, "waitlist cancelled")
+}
+
+// makeWaitlistResponse は、キャンセル待ちのレスポンスを作成します. waitingの場合は待ち順を求めます
+func makeWaitlistResponse(entry WaitlistEntry) (WaitlistResponse, error) {
+	resp := WaitlistResponse{
+		WaitlistID:    entry.ID,
+		Date:          entry.Date.Format("2006/01/02"),
+		TrainClass:    entry.TrainClass,
+		TrainName:     entry.TrainName,
+		Departure:     entry.Departure,
+		Arrival:       entry.Arrival,
+		SeatClass:     entry.SeatClass,
+		IsSmokingSeat: entry.IsSmokingSeat,
+		Adult:         entry.Adult,
+		Child:         entry.Child,
+		Status:        entry.Status,
+	}
+	if entry.ReservationID.Valid {
+		resp.ReservationID = entry.ReservationID.Int64
+	}
+	if entry.Status != waitlistStatusWaiting {
+		return resp, nil
+	}
+
+	ahead := 0
+	err := dbx.Get(
+		&ahead,
+		"SELECT COUNT(*) FROM `waitlist` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ? AND `status` = ? AND `id` < ?",
+		entry.Date.Format("2006/01/02"), entry.TrainClass, entry.TrainName, waitlistStatusWaiting, entry.ID,
+	)
+	if err != nil {
+		return resp, err
+	}
+	resp.Position = ahead + 1
+	return resp, nil
+}
+
+type selecter interface {
+	Select(dest interface{}, query string, args ...interface{}) error
+}
+
+func getStationsByName(q selecter) (map[string]Station, error) {
+	stations := []Station{}
+	if err := q.Select(&stations, "SELECT * FROM `station_master`"); err != nil {
+		return nil, err
+	}
+	byName := map[string]Station{}
+	for _, station := range stations {
+		byName[station.Name] = station
+	}
+	return byName, nil
+}
+
+// checkWaitlistSection は、列車が乗車駅・降車駅に停車し、区間を運行しているか検証します
+// 問題がなければ空文字列を返します
+func checkWaitlistSection(train Train, stations map[string]Station, departure, arrival string) string {
+	from, ok := stations[departure]
+	if !ok {
+		return fmt.Sprintf("乗車駅データがみつかりません %s", departure)
+	}
+	to, ok := stations[arrival]
+	if !ok {
+		return fmt.Sprintf("降車駅データがみつかりません %s", arrival)
+	}
+	start, startOK := stations[train.StartStation]
+	last, lastOK := stations[train.LastStation]
+	if !startOK || !lastOK {
+		return "列車の始発駅・終着駅データがみつかりません"
+	}
+
+	for _, station := range []Station{from, to} {
+		stop, ok := isStopFor(station, train.TrainClass)
+		if !ok {
+			return "リクエストされた列車クラスが不明です"
+		}
+		if !stop {
+			return fmt.Sprintf("%sの止まらない駅です", train.TrainClass)
+		}
+	}
+
+	// 上りは駅IDが減る方向に運行する
+	if train.IsNobori {
+		from.ID, to.ID, start.ID, last.ID = -from.ID, -to.ID, -start.ID, -last.ID
+	}
+	if !(start.ID <= from.ID && from.ID < to.ID && to.ID <= last.ID) {
+		return "リクエストされた区間に列車が運行していない区間が含まれています"
+	}
+	return ""
+}
+
+// promoteWaitlist は、列車のキャンセル待ちを登録順に調べ、座席を確保できたものを予約に繰り上げます
+// 確定期限を過ぎた繰り上げの予約は、先に削除して座席を空けます
+// 繰り上げた予約のIDを返します
+//
+// キャンセル待ちの行ロックを先に取ってから予約を読むので、同時に呼ばれても登録順に処理される
+// 予約API (trainReservationHandler) はキャンセル待ちのロックを取らないため、デッドロックしない
+func promoteWaitlist(date time.Time, trainClass, trainName string) ([]int64, error) {
+	tx := dbx.MustBegin()
+	defer tx.Rollback()
+
+	entries := []WaitlistEntry{}
+	err := tx.Select(
+		&entries,
+		"SELECT * FROM `waitlist` WHERE `date` = ? AND `train_class` = ? AND `train_name` = ? AND `status` = ? ORDER BY `id` FOR UPDATE",
+		date.Format("2006/01/02"), trainClass, trainName, waitlistStatusWaiting,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := expireWaitlistHolds(tx, date, trainClass, trainName); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, tx.Commit()
+	}
+
+	operation, err := getTrainOperation(tx, date, trainClass, trainName)
+	if err != nil {
+		return nil, err
+	}
+	if status, _ := trainStatus(operation); status == trainStatusCancelled {
+		return nil, tx.Commit()
+	}
+
+	stations, err := getStationsByName(tx)
+	if err != nil {
+		return nil, err
+	}
+	seats := []Seat{}
+	err = tx.Select(&seats, "SELECT * FROM `seat_master` WHERE `train_class` = ? ORDER BY `car_number`, `seat_row`, `seat_column`", trainClass)
+	if err != nil {
+		return nil, err
+	}
+	occupied := []waitlistOccupiedSeat{}
+	err = tx.Select(
+		&occupied,
+		"SELECT r.`departure`, r.`arrival`, s.`car_number`, s.`seat_row`, s.`seat_column` FROM `reservations` r JOIN `seat_reservations` s ON r.`reservation_id` = s.`reservation_id` "+
+			"WHERE r.`date` = ? AND r.`train_class` = ? AND r.`train_name` = ? AND s.`car_number` > 0 FOR UPDATE",
+		date.Format("2006/01/02"), trainClass, trainName,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	promoted := []int64{}
+	for _, assignment := range assignWaitlist(entries, seats, occupied, stations) {
+		reservationID, err := insertWaitlistReservation(tx, date, stations, assignment)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(
+			"UPDATE `waitlist` SET `status` = ?, `reservation_id` = ?, `updated_at` = NOW(6) WHERE `id` = ?",
+			waitlistStatusPromoted, reservationID, assignment.Entry.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, reservationID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// expireWaitlistHolds は、確定期限を過ぎた未決済の繰り上げの予約を削除し、キャンセル待ちを期限切れにします
+// 確定済みの予約や、利用者がキャンセルした予約は対象外
+func expireWaitlistHolds(tx *sqlx.Tx, date time.Time, trainClass, trainName string) error {
+	if waitlistHold <= 0 {
+		return nil
+	}
+
+	expired := []WaitlistEntry{}
+	err := tx.Select(
+		&expired,
+		"SELECT w.* FROM `waitlist` w JOIN `reservations` r ON r.`reservation_id` = w.`reservation_id` "+
+			"WHERE w.`date` = ? AND w.`train_class` = ? AND w.`train_name` = ? AND w.`status` = ? AND r.`status` = ? AND w.`updated_at` < NOW(6) - INTERVAL ? SECOND FOR UPDATE",
+		date.Format("2006/01/02"), trainClass, trainName, waitlistStatusPromoted, "requesting", int(waitlistHold/time.Second),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range expired {
+		if _, err := tx.Exec("DELETE FROM `seat_reservations` WHERE `reservation_id` = ?", entry.ReservationID.Int64); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM `reservations` WHERE `reservation_id` = ?", entry.ReservationID.Int64); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE `waitlist` SET `status` = ?, `updated_at` = NOW(6) WHERE `id` = ?", waitlistStatusExpired, entry.ID)
+		if err != nil {
+			return err
+		}
+		log.Printf("expired waitlist hold: waitlist_id=%d reservation_id=%d", entry.ID, entry.ReservationID.Int64)
+	}
+	return nil
+}
+
+// promoteWaitlistFor は、キャンセルした予約の列車のキャンセル待ちを繰り上げます
+// 繰り上げに失敗しても予約のキャンセルは完了しているので、ログに残すだけにする
+func promoteWaitlistFor(reservations []Reservation) {
+	done := map[string]bool{}
+	for _, reservation := range reservations {
+		if reservation.Date == nil {
+			continue
+		}
+		key := reservation.Date.Format("2006/01/02") + "/" + reservation.TrainClass + "/" + reservation.TrainName
+		if done[key] {
+			continue
+		}
+		done[key] = true
+
+		promoted, err := promoteWaitlist(*reservation.Date, reservation.TrainClass, reservation.TrainName)
+		if err != nil {
+			log.Printf("failed to promote waitlist (%s): %s", key, err)
+			continue
+		}
+		if len(promoted) > 0 {
+			log.Printf("promoted waitlist (%s): reservation_id=%v", key, promoted)
+		}
+	}
+}
+
+func insertWaitlistReservation(tx *sqlx.Tx, date time.Time, stations map[string]Station, assignment waitlistAssignment) (int64, error) {
+	entry := assignment.Entry
+	fare, err := fareCalc(date, stations[entry.Departure].ID, stations[entry.Arrival].ID, entry.TrainClass, entry.SeatClass)
+	if err != nil {
+		return 0, err
+	}
+	amount := entry.Adult*fare + (entry.Child*fare)/2
+
+	result, err := tx.Exec(
+		"INSERT INTO `reservations` (`user_id`, `date`, `train_class`, `train_name`, `departure`, `arrival`, `status`, `payment_id`, `adult`, `child`, `amount`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.UserID, date.Format("2006/01/02"), entry.TrainClass, entry.TrainName, entry.Departure, entry.Arrival,
+		"requesting", "a", entry.Adult, entry.Child, amount,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, seat := range assignment.Seats {
+		_, err = tx.Exec(
+			"INSERT INTO `seat_reservations` (`reservation_id`, `car_number`, `seat_row`, `seat_column`) VALUES (?, ?, ?, ?)",
+			id, assignment.CarNumber, seat.SeatRow, seat.SeatColumn,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// assignWaitlist は、キャンセル待ちを登録順に調べ、1つの号車でまとめて座席を確保できるものに座席を割り当てます
+// entries は登録順に並んでいること. 前のキャンセル待ちに割り当てた座席は、後ろのキャンセル待ちには割り当てない
+func assignWaitlist(entries []WaitlistEntry, seats []Seat, occupied []waitlistOccupiedSeat, stations map[string]Station) []waitlistAssignment {
+	type seatKey struct {
+		carNumber int
+		row       int
+		column    string
+	}
+
+	// 区間は駅IDの範囲で表す (上り・下りによらない)
+	section := func(departure, arrival string) (int, int, bool) {
+		from, ok1 := stations[departure]
+		to, ok2 := stations[arrival]
+		if !ok1 || !ok2 {
+			return 0, 0, false
+		}
+		if from.ID > to.ID {
+			return to.ID, from.ID, true
+		}
+		return from.ID, to.ID, true
+	}
+
+	// 割り当てた座席を追加していくので、呼び出し元のスライスを書き換えないようコピーする
+	occupied = append([]waitlistOccupiedSeat{}, occupied...)
+
+	assignments := []waitlistAssignment{}
+	for _, entry := range entries {
+		lo, hi, ok := section(entry.Departure, entry.Arrival)
+		if !ok {
+			continue
+		}
+
+		taken := map[seatKey]bool{}
+		for _, seat := range occupied {
+			seatLo, seatHi, ok := section(seat.Departure, seat.Arrival)
+			// 駅が不明な予約は、全区間を占有しているものとして扱う
+			if ok && (seatHi <= lo || hi <= seatLo) {
+				continue
+			}
+			taken[seatKey{seat.CarNumber, seat.SeatRow, seat.SeatColumn}] = true
+		}
+
+		want := entry.Adult + entry.Child
+		free := map[int][]Seat{}
+		for _, seat := range seats {
+			if seat.SeatClass != entry.SeatClass || seat.IsSmokingSeat != entry.IsSmokingSeat {
+				continue
+			}
+			if taken[seatKey{seat.CarNumber, seat.SeatRow, seat.SeatColumn}] {
+				continue
+			}
+			free[seat.CarNumber] = append(free[seat.CarNumber], seat)
+			if len(free[seat.CarNumber]) == want {
+				assignments = append(assignments, waitlistAssignment{
+					Entry:     entry,
+					CarNumber: seat.CarNumber,
+					Seats:     free[seat.CarNumber],
+				})
+				for _, s := range free[seat.CarNumber] {
+					occupied = append(occupied, waitlistOccupiedSeat{
+						Departure:  entry.Departure,
+						Arrival:    entry.Arrival,
+						CarNumber:  s.CarNumber,
+						SeatRow:    s.SeatRow,
+						SeatColumn: s.SeatColumn,
+					})
+				}
+				break
+			}
+		}
+	}
+
+	return assignments
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+)
+
+// 1号車に2席、2号車に1席の premium 席がある列車
+var testWaitlistSeats = []Seat{
+	{TrainClass: "最速", CarNumber: 1, SeatRow: 1, SeatColumn: "A", SeatClass: "premium"},
+	{TrainClass: "最速", CarNumber: 1, SeatRow: 1, SeatColumn: "B", SeatClass: "premium"},
+	{TrainClass: "最速", CarNumber: 2, SeatRow: 1, SeatColumn: "A", SeatClass: "premium"},
+	{TrainClass: "最速", CarNumber: 3, SeatRow: 1, SeatColumn: "A", SeatClass: "reserved"},
+}
+
+func testWaitlistEntry(id int64, departure, arrival string, people int) WaitlistEntry {
+	return WaitlistEntry{
+		ID:         id,
+		TrainClass: "最速",
+		TrainName:  "1",
+		Departure:  departure,
+		Arrival:    arrival,
+		SeatClass:  "premium",
+		Adult:      people,
+	}
+}
+
+func assignedIDs(assignments []waitlistAssignment) []int64 {
+	ids := []int64{}
+	for _, assignment := range assignments {
+		ids = append(ids, assignment.Entry.ID)
+	}
+	return ids
+}
+
+func TestAssignWaitlist(t *testing.T) {
+	stations := testStationsByName()
+	// 1号車1Aのみ空いている
+	occupied := []waitlistOccupiedSeat{
+		{Departure: "東京", Arrival: "名古屋", CarNumber: 1, SeatRow: 1, SeatColumn: "B"},
+		{Departure: "東京", Arrival: "名古屋", CarNumber: 2, SeatRow: 1, SeatColumn: "A"},
+	}
+
+	// 登録順に割り当て、後ろのキャンセル待ちには同じ座席を割り当てない
+	entries := []WaitlistEntry{
+		testWaitlistEntry(1, "東京", "名古屋", 1),
+		testWaitlistEntry(2, "東京", "名古屋", 1),
+	}
+	assignments := assignWaitlist(entries, testWaitlistSeats, occupied, stations)
+	if ids := assignedIDs(assignments); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("assigned = %v, want [1]", ids)
+	}
+	if seat := assignments[0].Seats[0]; assignments[0].CarNumber != 1 || seat.SeatRow != 1 || seat.SeatColumn != "A" {
+		t.Fatalf("seat = %d %d%s, want 1 1A", assignments[0].CarNumber, seat.SeatRow, seat.SeatColumn)
+	}
+	if len(occupied) != 2 {
+		t.Fatalf("occupied was modified: %v", occupied)
+	}
+
+	// 座席を確保できないキャンセル待ちは飛ばす
+	entries = []WaitlistEntry{
+		testWaitlistEntry(1, "東京", "名古屋", 2),
+		testWaitlistEntry(2, "東京", "名古屋", 1),
+	}
+	if ids := assignedIDs(assignWaitlist(entries, testWaitlistSeats, occupied, stations)); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("assigned = %v, want [2]", ids)
+	}
+
+	// 複数人は1つの号車でまとめて確保する
+	entries = []WaitlistEntry{testWaitlistEntry(1, "東京", "名古屋", 2)}
+	assignments = assignWaitlist(entries, testWaitlistSeats, nil, stations)
+	if len(assignments) != 1 || assignments[0].CarNumber != 1 || len(assignments[0].Seats) != 2 {
+		t.Fatalf("assignments = %+v, want 2 seats in car 1", assignments)
+	}
+}
+
+func TestAssignWaitlistSection(t *testing.T) {
+	stations := testStationsByName()
+	occupied := []waitlistOccupiedSeat{
+		{Departure: "東京", Arrival: "品川", CarNumber: 1, SeatRow: 1, SeatColumn: "A"},
+		{Departure: "東京", Arrival: "品川", CarNumber: 1, SeatRow: 1, SeatColumn: "B"},
+		{Departure: "東京", Arrival: "品川", CarNumber: 2, SeatRow: 1, SeatColumn: "A"},
+	}
+
+	// 区間が重ならない座席は割り当てられる (上りでも同じ)
+	entries := []WaitlistEntry{
+		testWaitlistEntry(1, "品川", "名古屋", 1),
+		testWaitlistEntry(2, "名古屋", "品川", 1),
+		testWaitlistEntry(3, "東京", "新横浜", 1),
+	}
+	if ids := assignedIDs(assignWaitlist(entries, testWaitlistSeats, occupied, stations)); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Fatalf("assigned = %v, want [1 2]", ids)
+	}
+}
+
+func TestCheckWaitlistSection(t *testing.T) {
+	stations := testStationsByName()
+	kudari := Train{TrainClass: "中間", StartStation: "東京", LastStation: "名古屋"}
+	nobori := Train{TrainClass: "中間", StartStation: "名古屋", LastStation: "東京", IsNobori: true}
+
+	tests := []struct {
+		train              Train
+		departure, arrival string
+		ok                 bool
+	}{
+		{kudari, "東京", "品川", true},
+		{kudari, "品川", "東京", false},
+		{nobori, "名古屋", "品川", true},
+		{nobori, "品川", "名古屋", false},
+		// 中間は新横浜に停車しない
+		{kudari, "東京", "新横浜", false},
+		{kudari, "東京", "大阪", false},
+		{Train{TrainClass: "中間", StartStation: "品川", LastStation: "名古屋"}, "東京", "名古屋", false},
+	}
+	for _, tt := range tests {
+		msg := checkWaitlistSection(tt.train, stations, tt.departure, tt.arrival)
+		if (msg == "") != tt.ok {
+			t.Fatalf("%s %s~%s: %q, want ok=%t", tt.train.StartStation, tt.departure, tt.arrival, msg, tt.ok)
+		}
+	}
+}
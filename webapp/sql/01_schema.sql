@@ -27,7 +27,8 @@ CREATE TABLE `reservations` (
   `payment_id` varchar(100) NOT NULL,
   `adult` int NOT NULL,
   `child` int NOT NULL,
-  `amount` bigint NOT NULL
+  `amount` bigint NOT NULL,
+  `refunded` tinyint(1) NOT NULL DEFAULT 0
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 DROP TABLE IF EXISTS `seat_master`;
@@ -69,6 +70,17 @@ CREATE TABLE `train_master` (
   `is_nobori` tinyint(1) NOT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+DROP TABLE IF EXISTS `train_operations`;
+CREATE TABLE `train_operations` (
+  `date` date NOT NULL,
+  `train_class` varchar(100) NOT NULL,
+  `train_name` varchar(100) NOT NULL,
+  `status` enum('delayed', 'cancelled') NOT NULL,
+  `delay_minutes` int NOT NULL DEFAULT 0,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`date`, `train_class`, `train_name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 DROP TABLE IF EXISTS `train_timetable_master`;
 CREATE TABLE `train_timetable_master` (
   `date` date NOT NULL,
@@ -79,10 +91,56 @@ CREATE TABLE `train_timetable_master` (
   `arrival` time NOT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+DROP TABLE IF EXISTS `waitlist`;
+CREATE TABLE `waitlist` (
+  `id` bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `user_id` bigint NOT NULL,
+  `date` date NOT NULL,
+  `train_class` varchar(100) NOT NULL,
+  `train_name` varchar(100) NOT NULL,
+  `departure` varchar(100) NOT NULL,
+  `arrival` varchar(100) NOT NULL,
+  `seat_class` enum('premium', 'reserved') NOT NULL,
+  `is_smoking_seat` tinyint(1) NOT NULL,
+  `adult` int NOT NULL,
+  `child` int NOT NULL,
+  `status` enum('waiting', 'promoted', 'cancelled', 'expired') NOT NULL,
+  `reservation_id` bigint DEFAULT NULL,
+  `created_at` datetime(6) NOT NULL,
+  `updated_at` datetime(6) NOT NULL,
+  KEY `idx_train_status` (`date`, `train_class`, `train_name`, `status`),
+  KEY `idx_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 DROP TABLE IF EXISTS `users`;
 CREATE TABLE `users` (
   `id` bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
   `email` varchar(300) NOT NULL UNIQUE,
   `salt` varbinary(1024) NOT NULL,
-  `super_secure_password` varbinary(256) NOT NULL
+  `super_secure_password` varbinary(256) NOT NULL,
+  `password_version` tinyint NOT NULL DEFAULT 1
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `sessions`;
+CREATE TABLE `sessions` (
+  `id` varchar(64) NOT NULL PRIMARY KEY,
+  `user_id` bigint DEFAULT NULL,
+  `data` blob NOT NULL,
+  `expires_at` datetime NOT NULL,
+  KEY `idx_user_id` (`user_id`),
+  KEY `idx_expires_at` (`expires_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `login_failures`;
+CREATE TABLE `login_failures` (
+  `id` bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  `limit_key` varchar(320) NOT NULL,
+  `failed_at` datetime(6) NOT NULL,
+  KEY `idx_limit_key_failed_at` (`limit_key`, `failed_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+DROP TABLE IF EXISTS `login_lockouts`;
+CREATE TABLE `login_lockouts` (
+  `limit_key` varchar(320) NOT NULL PRIMARY KEY,
+  `locked_until` datetime(6) NOT NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;